@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"uplink/backend/internal/config"
+	"uplink/backend/internal/db"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// runCreateAdmin назначает администратора, создавая пользователя при необходимости:
+//
+//	server create-admin -username admin [-password secret] [-role moderator]
+//
+// Если пароль для нового пользователя не задан, он генерируется и печатается один раз.
+func runCreateAdmin(cfg *config.Config, args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	fset.SetOutput(out)
+	username := fset.String("username", "", "имя пользователя")
+	password := fset.String("password", "", "пароль нового пользователя, не короче 8 символов")
+	role := fset.String("role", db.RoleAdmin, "назначаемая роль: player, moderator или admin")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return fmt.Errorf("не указано имя пользователя")
+	}
+	if !db.ValidRole(*role) {
+		return fmt.Errorf("неизвестная роль %q", *role)
+	}
+
+	store, err := db.New(cfg.DatabaseURL, 1)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	u, err := store.GetUser(ctx, *username)
+	switch {
+	case err == nil:
+		if *password != "" {
+			fmt.Fprintln(out, "пользователь уже существует, пароль не изменен")
+		}
+		if err := store.SetRole(ctx, u.ID, *role); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "пользователь %s получил роль %s\n", u.Username, *role)
+		return nil
+	case !errors.Is(err, pgx.ErrNoRows):
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		*password = base64.RawURLEncoding.EncodeToString(b)
+	}
+	if len(*password) < 8 {
+		return fmt.Errorf("пароль короче 8 символов")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), 10)
+	if err != nil {
+		return err
+	}
+	id, err := store.CreateUser(ctx, *username, string(hash))
+	if err != nil {
+		return err
+	}
+	if err := store.SetRole(ctx, id, *role); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "создан пользователь %s с ролью %s\n", *username, *role)
+	if generated {
+		fmt.Fprintf(out, "пароль: %s\n", *password)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"uplink/backend/internal/config"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/text"
+)
+
+var codeLanguages = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".java": "java",
+	".sql":  "sql",
+	".rs":   "rust",
+	".c":    "c",
+	".cpp":  "cpp",
+}
+
+type ingestReport struct {
+	files      int
+	passages   int
+	duplicates int
+	existing   int
+	skipped    []string
+	byBucket   map[string]int
+}
+
+// runIngest загружает тексты из UTF-8 файлов или каталогов:
+//
+//	server ingest [-lang ru] [-category literature] [-dry-run] corpus/
+//
+// Если категория не задана, для файлов из подкаталогов берется имя подкаталога.
+// Язык, если не задан, определяется по файлу целиком.
+func runIngest(cfg *config.Config, args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	fset.SetOutput(out)
+	lang := fset.String("lang", "", "язык текстов (по умолчанию определяется автоматически)")
+	category := fset.String("category", "", "категория текстов (по умолчанию имя каталога или general)")
+	subcategory := fset.String("subcategory", "", "подкатегория, для кода — язык программирования (по умолчанию по расширению файла)")
+	minLen := fset.Int("min", text.PassageMinLength, "минимальная длина отрывка в символах")
+	maxLen := fset.Int("max", text.PassageMaxLength, "максимальная длина отрывка в символах")
+	title := fset.String("title", "", "название произведения")
+	author := fset.String("author", "", "автор")
+	source := fset.String("source", "", "источник")
+	license := fset.String("license", "", "лицензия")
+	dryRun := fset.Bool("dry-run", false, "только показать отчет, ничего не записывая")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return fmt.Errorf("не указаны файлы или каталоги")
+	}
+	if *minLen <= 0 || *minLen > *maxLen {
+		return fmt.Errorf("некорректные границы длины отрывка: %d..%d", *minLen, *maxLen)
+	}
+
+	rules, err := text.LoadRules(cfg.TextRulesPath)
+	if err != nil {
+		return err
+	}
+
+	rep := &ingestReport{byBucket: make(map[string]int)}
+	seen := make(map[string]bool)
+	var batch []db.NewText
+
+	for _, root := range fset.Args() {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !utf8.Valid(raw) {
+				rep.skipped = append(rep.skipped, path+": не UTF-8")
+				return nil
+			}
+			rep.files++
+
+			cat := *category
+			if cat == "" {
+				cat = "general"
+				if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+					cat = filepath.Base(rel)
+				}
+			}
+
+			// Нормализация меняет длину текста, поэтому идет до разбиения:
+			// иначе отрывки выходили бы за границы -min и -max.
+			l := *lang
+			if l == "" {
+				l = text.DetectLanguage(string(raw))
+			}
+			content := rules.Normalize(string(raw), l)
+
+			sub := *subcategory
+			passages := text.Split(content, *minLen, *maxLen)
+			if cat == text.CodeCategory {
+				passages = text.SplitCode(content, *minLen, *maxLen)
+				if sub == "" {
+					sub = codeLanguages[strings.ToLower(filepath.Ext(path))]
+				}
+			}
+
+			for _, p := range passages {
+				rep.passages++
+
+				key := text.DedupKey(p, cat)
+				if seen[key] {
+					rep.duplicates++
+					continue
+				}
+				seen[key] = true
+
+				batch = append(batch, db.NewText{
+					Content:     p,
+					Language:    l,
+					Category:    cat,
+					Subcategory: sub,
+					Title:       *title,
+					Author:      *author,
+					Source:      *source,
+					License:     *license,
+					Length:      text.Length(p),
+					Difficulty:  text.Difficulty(p, l, text.Stats{}),
+				})
+				rep.byBucket[l+"/"+cat]++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	store, err := db.New(cfg.DatabaseURL, 2)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	langs := make(map[string]bool)
+	for _, t := range batch {
+		langs[t.Language] = true
+	}
+	existing, err := store.TextDedupKeys(ctx, slices.Collect(maps.Keys(langs)))
+	if err != nil {
+		return err
+	}
+	fresh := batch[:0]
+	for _, t := range batch {
+		if existing[text.DedupKey(t.Content, t.Category)] {
+			rep.existing++
+			rep.byBucket[t.Language+"/"+t.Category]--
+			continue
+		}
+		fresh = append(fresh, t)
+	}
+
+	rep.print(out, len(fresh))
+	if *dryRun {
+		fmt.Fprintln(out, "режим dry-run: изменения не записаны")
+		return nil
+	}
+
+	n, err := store.InsertTexts(ctx, fresh)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "добавлено текстов: %d\n", n)
+	return nil
+}
+
+func (r *ingestReport) print(out io.Writer, toInsert int) {
+	fmt.Fprintf(out, "файлов: %d\n", r.files)
+	fmt.Fprintf(out, "отрывков: %d\n", r.passages)
+	fmt.Fprintf(out, "дубликатов в корпусе: %d\n", r.duplicates)
+	fmt.Fprintf(out, "уже в базе: %d\n", r.existing)
+	fmt.Fprintf(out, "к добавлению: %d\n", toInsert)
+
+	buckets := make([]string, 0, len(r.byBucket))
+	for k, v := range r.byBucket {
+		if v > 0 {
+			buckets = append(buckets, k)
+		}
+	}
+	sort.Strings(buckets)
+	for _, k := range buckets {
+		fmt.Fprintf(out, "  %s: %d\n", k, r.byBucket[k])
+	}
+	if len(r.skipped) > 0 {
+		fmt.Fprintf(out, "пропущено файлов:\n  %s\n", strings.Join(r.skipped, "\n  "))
+	}
+}
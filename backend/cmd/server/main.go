@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,13 +11,28 @@ import (
 	"syscall"
 	"time"
 	"uplink/backend/internal/api"
+	"uplink/backend/internal/chat"
+	"uplink/backend/internal/cluster"
 	"uplink/backend/internal/config"
 	"uplink/backend/internal/db"
 	"uplink/backend/internal/game"
+	"uplink/backend/internal/mail"
+	"uplink/backend/internal/notify"
+	"uplink/backend/internal/oidc"
+	"uplink/backend/internal/text"
 )
 
 func main() {
 	cfg := config.Load()
+
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "ошибка:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 
 	store, err := db.New(cfg.DatabaseURL, cfg.DBMaxConns)
@@ -26,10 +42,60 @@ func main() {
 	}
 	defer store.Close()
 
+	rules, err := text.LoadRules(cfg.TextRulesPath)
+	if err != nil {
+		log.Error("ошибка загрузки типографских правил", "err", err)
+		os.Exit(1)
+	}
+	if n, err := store.NormalizeTexts(context.Background(), rules); err != nil {
+		log.Error("ошибка нормализации текстов", "err", err)
+	} else if n > 0 {
+		log.Info("тексты нормализованы", "texts", n)
+	}
+
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go runDifficultyJob(jobCtx, store, log)
+
+	policy, err := chat.LoadPolicy(cfg.ChatPolicyPath)
+	if err != nil {
+		log.Error("ошибка загрузки правил чата", "err", err)
+		os.Exit(1)
+	}
+
 	gm := game.New(store, log)
+	gm.SetTextRules(rules)
+	gm.SetChatPolicy(policy)
+	gm.SetChatPersistence(cfg.ChatPersist)
+	if cfg.ClusterMode == "postgres" {
+		pg, err := cluster.NewPostgres(cfg.DatabaseURL, cfg.NodeID)
+		if err != nil {
+			log.Error("ошибка подключения к кластеру", "err", err)
+			os.Exit(1)
+		}
+		defer pg.Close()
+		gm.UseCluster(cfg.NodeID, pg, pg)
+		log.Info("узел кластера запущен", "node", cfg.NodeID)
+	}
+	var idp []*oidc.Client
+	for _, p := range cfg.OIDCProviders {
+		idp = append(idp, oidc.New(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+		}))
+		log.Info("провайдер входа подключен", "provider", p.Name, "issuer", p.Issuer)
+	}
+	mailer, err := newMailer(cfg.Mail, log)
+	if err != nil {
+		log.Error("ошибка настройки почты", "err", err)
+		os.Exit(1)
+	}
 	srv := &http.Server{
 		Addr:         cfg.Port,
-		Handler:      api.New(store, gm, cfg.JWTSecret, cfg.AllowedOrigins, log),
+		Handler:      api.New(store, gm, notify.New(store, gm, log), idp, mailer, cfg.JWTSecret, cfg.PublicURL, cfg.MetricsToken, cfg.AllowedOrigins, log),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -47,11 +113,68 @@ func main() {
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 	<-stop
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
+	stopJobs()
+	log.Info("остановка: ожидание завершения заездов", "timeout", cfg.ShutdownTimeout)
+	gm.Drain(ctx)
 	gm.Shutdown()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Error("ошибка остановки", "err", err)
 	}
 }
+
+func runDifficultyJob(ctx context.Context, store *db.DB, log *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := store.RecomputeDifficulty(ctx)
+		if err != nil {
+			log.Error("ошибка пересчета сложности текстов", "err", err)
+		} else {
+			log.Info("сложность текстов пересчитана", "texts", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newMailer выбирает транспорт писем по MAIL_TRANSPORT. Без транспорта возвращает nil:
+// восстановление пароля и привязка почты отключены.
+func newMailer(c config.Mail, log *slog.Logger) (mail.Mailer, error) {
+	switch c.Transport {
+	case "":
+		log.Info("MAIL_TRANSPORT не задан: письма не отправляются, восстановление пароля отключено")
+		return nil, nil
+	case "log":
+		log.Warn("письма не отправляются, а пишутся в журнал вместе со ссылками сброса пароля (MAIL_TRANSPORT=log); только для разработки")
+		return &mail.Log{Log: log}, nil
+	case "file":
+		log.Info("письма складываются в папку", "dir", c.Dir)
+		return &mail.Dir{Path: c.Dir, From: c.From}, nil
+	case "smtp":
+		if c.SMTPAddr == "" {
+			return nil, errors.New("для MAIL_TRANSPORT=smtp нужен SMTP_ADDR")
+		}
+		return &mail.SMTP{Addr: c.SMTPAddr, From: c.From, Username: c.SMTPUsername, Password: c.SMTPPassword}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный MAIL_TRANSPORT %q", c.Transport)
+	}
+}
+
+func runCommand(cfg *config.Config, name string, args []string) error {
+	switch name {
+	case "ingest":
+		return runIngest(cfg, args, os.Stdout)
+	case "create-admin":
+		return runCreateAdmin(cfg, args, os.Stdout)
+	case "fake-oidc":
+		return runFakeOIDC(args, os.Stdout)
+	default:
+		return fmt.Errorf("неизвестная команда %q", name)
+	}
+}
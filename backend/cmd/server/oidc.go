@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"uplink/backend/internal/oidc"
+)
+
+// runFakeOIDC запускает встроенный провайдер OIDC для проверки входа без сети:
+//
+//	server fake-oidc -addr :9000 [-client-id uplink] [-client-secret secret]
+//
+// Страницы входа нет: провайдер сразу пускает пользователя из параметра login_hint.
+// Только для разработки.
+func runFakeOIDC(args []string, out io.Writer) error {
+	fset := flag.NewFlagSet("fake-oidc", flag.ContinueOnError)
+	fset.SetOutput(out)
+	addr := fset.String("addr", ":9000", "адрес провайдера")
+	clientID := fset.String("client-id", "", "ожидаемый client_id, пустой — любой")
+	secret := fset.String("client-secret", "", "ожидаемый секрет клиента, пустой — любой")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	f, err := oidc.NewFake()
+	if err != nil {
+		return err
+	}
+	f.ClientID, f.ClientSecret = *clientID, *secret
+	fmt.Fprintf(out, "тестовый провайдер OIDC слушает %s\n", *addr)
+	return http.ListenAndServe(*addr, f)
+}
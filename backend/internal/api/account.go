@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/mail"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// renameCooldown — как часто игрок может менять имя.
+	renameCooldown = 30 * 24 * time.Hour
+	// reauthWindow — сколько после входа игрок без пароля может менять аккаунт.
+	reauthWindow = 5 * time.Minute
+)
+
+var errStaleLogin = errors.New("войдите заново через провайдера: действие доступно в первые 5 минут после входа")
+
+var usernameRe = regexp.MustCompile(`^[\p{L}\p{N}_-]{3,32}$`)
+
+// routeAccount регистрирует управление своим аккаунтом: пароль, имя, почту, удаление и выгрузку данных.
+func (a *API) routeAccount(mux *http.ServeMux) {
+	auth := a.authMiddleware
+	mux.HandleFunc("POST /api/v1/account/password", auth(a.changePassword))
+	mux.HandleFunc("POST /api/v1/account/username", auth(a.changeUsername))
+	mux.HandleFunc("POST /api/v1/account/email", auth(a.changeEmail))
+	mux.HandleFunc("DELETE /api/v1/account", auth(a.deleteAccount))
+	mux.HandleFunc("GET /api/v1/account/export", auth(a.exportAccount))
+}
+
+// reauth проверяет текущий пароль игрока перед опасным действием.
+// У игрока, входящего только через провайдера, пароля нет: ему нужна сессия,
+// открытая входом не раньше reauthWindow назад, иначе украденный токен доступа
+// позволил бы забрать аккаунт. При отказе ответ уже записан.
+func (a *API) reauth(w http.ResponseWriter, r *http.Request, password string) (*db.User, bool) {
+	uid := r.Context().Value(uidKey).(string)
+	u, err := a.db.GetUserByID(r.Context(), uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return nil, false
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return nil, false
+	}
+	if u.PasswordHash == "" {
+		sid, _ := r.Context().Value(sidKey).(string)
+		fresh := false
+		if sid != "" {
+			if fresh, err = a.db.SessionStartedAfter(r.Context(), sid, time.Now().Add(-reauthWindow)); err != nil {
+				a.error(w, "ошибка бд", 500)
+				return nil, false
+			}
+		}
+		if !fresh {
+			a.error(w, errStaleLogin.Error(), 403)
+			return nil, false
+		}
+		return u, true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) != nil {
+		a.error(w, "неверный пароль", 403)
+		return nil, false
+	}
+	return u, true
+}
+
+// changePassword меняет пароль, завершает все сессии и открывает новую для текущего клиента.
+func (a *API) changePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.NewPassword) < 8 {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	u, ok := a.reauth(w, r, req.CurrentPassword)
+	if !ok {
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	if err := a.db.SetPassword(r.Context(), u.ID, string(hash)); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("пароль изменен", "user", u.ID)
+	a.sendToken(w, r, u.ID, u.Username, u.Role)
+}
+
+// changeUsername меняет имя. Новое имя попадает в токен доступа при следующем обмене
+// токена обновления.
+func (a *API) changeUsername(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !usernameRe.MatchString(req.Username) {
+		a.error(w, "имя: от 3 до 32 букв, цифр, _ или -", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	next, err := a.db.RenameUser(r.Context(), uid, req.Username, renameCooldown)
+	switch {
+	case errors.Is(err, db.ErrRenameCooldown):
+		a.json(w, map[string]any{"error": err.Error(), "next_change_at": next}, 429)
+		return
+	case errors.Is(err, db.ErrUsernameTaken):
+		a.error(w, err.Error(), 409)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		a.error(w, "пользователь не найден", 404)
+		return
+	case err != nil:
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("имя изменено", "user", uid, "username", req.Username)
+	a.json(w, map[string]any{"username": req.Username, "next_change_at": time.Now().Add(renameCooldown)}, 200)
+}
+
+// changeEmail высылает ссылку подтверждения на новую почту для восстановления пароля;
+// адрес сохранится после перехода по ней. Пустая строка удаляет почту сразу.
+// Почта нужна для сброса пароля, поэтому менять ее можно только с текущим паролем.
+func (a *API) changeEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			a.error(w, err.Error(), 400)
+			return
+		}
+		if a.mail == nil {
+			a.error(w, errNoMail.Error(), 503)
+			return
+		}
+	}
+	u, ok := a.reauth(w, r, req.Password)
+	if !ok {
+		return
+	}
+	if req.Email != "" {
+		go a.sendVerification(context.WithoutCancel(r.Context()), u.ID, u.Username, req.Email)
+		a.json(w, map[string]string{"status": "sent"}, 202)
+		return
+	}
+	err := a.db.SetEmail(r.Context(), u.ID, "")
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("почта удалена", "user", u.ID)
+	a.json(w, map[string]string{"email": ""}, 200)
+}
+
+// deleteAccount удаляет аккаунт после проверки пароля и отключает игрока от игры.
+func (a *API) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	u, ok := a.reauth(w, r, req.Password)
+	if !ok {
+		return
+	}
+	if err := a.db.DeleteUser(r.Context(), u.ID); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.gm.KickUser(u.ID)
+	a.log.Info("аккаунт удален", "user", u.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// exportAccount отдает все данные игрока одним JSON-файлом.
+func (a *API) exportAccount(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	e, err := a.db.ExportUser(r.Context(), uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="uplink-export-`+e.Profile.ID+`.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	a.json(w, e, 200)
+}
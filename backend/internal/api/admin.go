@@ -0,0 +1,284 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/game"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxAnnounceLen    = 500
+	maxRatingAdjust   = 1000
+	defaultCloseMsg   = "комната закрыта администратором"
+	adminActionsLimit = 100
+)
+
+// routeAdmin регистрирует консоль: модераторы следят за комнатами и игроками,
+// администраторы дополнительно управляют заездами, рейтингом и ролями.
+func (a *API) routeAdmin(mux *http.ServeMux) {
+	mod, admin := a.requireRole(db.RoleModerator), a.requireRole(db.RoleAdmin)
+	mux.HandleFunc("GET /api/v1/admin/rooms", mod(a.adminRooms))
+	mux.HandleFunc("GET /api/v1/admin/rooms/{id}", mod(a.adminRoom))
+	mux.HandleFunc("POST /api/v1/admin/rooms/{id}/finish", admin(a.adminFinishRoom))
+	mux.HandleFunc("POST /api/v1/admin/rooms/{id}/close", mod(a.adminCloseRoom))
+	mux.HandleFunc("POST /api/v1/admin/broadcast", admin(a.adminBroadcast))
+	mux.HandleFunc("GET /api/v1/admin/users", mod(a.adminFindUser))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/kick", mod(a.adminKick))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/ban", mod(a.adminBan))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/unban", mod(a.adminUnban))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/rating", admin(a.adminRating))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/role", admin(a.adminRole))
+	mux.HandleFunc("POST /api/v1/admin/users/{id}/2fa/reset", admin(a.adminResetTwoFactor))
+	mux.HandleFunc("GET /api/v1/admin/actions", admin(a.adminActions))
+}
+
+// audit записывает действие в журнал; ошибка журнала не отменяет само действие.
+func (a *API) audit(r *http.Request, action, target string, details any) {
+	uid, _ := r.Context().Value(uidKey).(string)
+	if err := a.db.LogAdminAction(r.Context(), uid, action, target, details); err != nil {
+		a.log.Error("не удалось записать действие администратора", "action", action, "target", target, "err", err)
+	}
+	a.log.Info("действие администратора", "admin", uid, "action", action, "target", target)
+}
+
+func (a *API) adminRooms(w http.ResponseWriter, r *http.Request) {
+	a.json(w, map[string]any{
+		"node":   a.gm.NodeID(),
+		"rooms":  a.gm.Rooms(),
+		"queues": a.gm.Queues(),
+	}, 200)
+}
+
+func (a *API) adminRoom(w http.ResponseWriter, r *http.Request) {
+	info, err := a.gm.Room(r.PathValue("id"))
+	if err != nil {
+		a.error(w, err.Error(), 404)
+		return
+	}
+	a.json(w, info, 200)
+}
+
+func (a *API) adminFinishRoom(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	switch err := a.gm.FinishRoom(id); {
+	case errors.Is(err, game.ErrRoomNotFound):
+		a.error(w, err.Error(), 404)
+		return
+	case errors.Is(err, game.ErrNotRacing):
+		a.error(w, err.Error(), 409)
+		return
+	}
+	a.audit(r, "finish_room", id, nil)
+	a.json(w, map[string]string{"status": "finished"}, 200)
+}
+
+func (a *API) adminCloseRoom(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message string `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			a.error(w, "некорректный запрос", 400)
+			return
+		}
+	}
+	if req.Message == "" {
+		req.Message = defaultCloseMsg
+	}
+	id := r.PathValue("id")
+	if err := a.gm.CloseRoom(id, req.Message); err != nil {
+		a.error(w, err.Error(), 404)
+		return
+	}
+	a.audit(r, "close_room", id, req)
+	a.json(w, map[string]string{"status": "closed"}, 200)
+}
+
+func (a *API) adminBroadcast(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" || utf8.RuneCountInString(req.Text) > maxAnnounceLen {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	a.gm.Announce(req.Text)
+	a.audit(r, "broadcast", "", req)
+	a.json(w, map[string]string{"status": "sent"}, 200)
+}
+
+func (a *API) adminFindUser(w http.ResponseWriter, r *http.Request) {
+	u, err := a.db.GetUser(r.Context(), r.URL.Query().Get("username"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, u, 200)
+}
+
+// outranked отвечает 403, если цель не младше по роли того, кто выполняет действие:
+// модератор не может выгнать, заблокировать или разблокировать модератора или администратора.
+func (a *API) outranked(w http.ResponseWriter, r *http.Request, id string) bool {
+	role, _ := r.Context().Value(roleKey).(string)
+	target, err := a.db.GetUserByID(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return true
+	}
+	if db.HasRole(target.Role, role) {
+		a.error(w, "недостаточно прав", 403)
+		return true
+	}
+	return false
+}
+
+func (a *API) adminKick(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if a.outranked(w, r, id) {
+		return
+	}
+	a.gm.KickUser(id)
+	a.audit(r, "kick", id, nil)
+	a.json(w, map[string]string{"status": "kicked"}, 200)
+}
+
+func (a *API) adminBan(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	id := r.PathValue("id")
+	if uid, _ := r.Context().Value(uidKey).(string); uid == id {
+		a.error(w, "нельзя заблокировать себя", 400)
+		return
+	}
+	if a.outranked(w, r, id) {
+		return
+	}
+	if !a.setBanned(w, r, id, true, req.Reason) {
+		return
+	}
+	if err := a.db.RevokeUserSessions(r.Context(), id); err != nil {
+		a.log.Warn("не удалось завершить сессии заблокированного игрока", "user", id, "err", err)
+	}
+	a.gm.KickUser(id)
+	a.audit(r, "ban", id, req)
+	a.json(w, map[string]string{"status": "banned"}, 200)
+}
+
+func (a *API) adminUnban(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if a.outranked(w, r, id) {
+		return
+	}
+	// Блокировку, которую установил администратор, модератор не снимает.
+	role, _ := r.Context().Value(roleKey).(string)
+	banRole, err := a.db.BanRole(r.Context(), id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if banRole != "" && !db.HasRole(role, banRole) {
+		a.error(w, "недостаточно прав", 403)
+		return
+	}
+	if !a.setBanned(w, r, id, false, "") {
+		return
+	}
+	a.audit(r, "unban", id, nil)
+	a.json(w, map[string]string{"status": "unbanned"}, 200)
+}
+
+func (a *API) setBanned(w http.ResponseWriter, r *http.Request, id string, banned bool, reason string) bool {
+	role, _ := r.Context().Value(roleKey).(string)
+	err := a.db.SetBanned(r.Context(), id, banned, reason, role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return false
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return false
+	}
+	return true
+}
+
+func (a *API) adminRating(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Delta  int    `json:"delta"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Delta == 0 || req.Delta > maxRatingAdjust || req.Delta < -maxRatingAdjust {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	id := r.PathValue("id")
+	rating, err := a.db.AdjustRating(r.Context(), id, req.Delta)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.audit(r, "rating", id, req)
+	a.json(w, map[string]int{"rating": rating}, 200)
+}
+
+func (a *API) adminRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !db.ValidRole(req.Role) {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	id := r.PathValue("id")
+	// Свою роль не меняют, чтобы не остаться без единого администратора.
+	if uid, _ := r.Context().Value(uidKey).(string); uid == id {
+		a.error(w, "нельзя изменить свою роль", 400)
+		return
+	}
+	err := a.db.SetRole(r.Context(), id, req.Role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.audit(r, "role", id, req)
+	a.json(w, map[string]string{"role": req.Role}, 200)
+}
+
+func (a *API) adminActions(w http.ResponseWriter, r *http.Request) {
+	list, err := a.db.GetAdminActions(r.Context(), adminActionsLimit)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list}, 200)
+}
+
+// banned сообщает, заблокирован ли аккаунт; при недоступной базе игрок пропускается.
+func (a *API) banned(r *http.Request, uid string) bool {
+	u, err := a.db.GetUserByID(r.Context(), uid)
+	return err == nil && u.Banned
+}
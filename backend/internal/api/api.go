@@ -3,19 +3,25 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"uplink/backend/internal/db"
 	"uplink/backend/internal/game"
+	"uplink/backend/internal/mail"
+	"uplink/backend/internal/metrics"
+	"uplink/backend/internal/notify"
+	"uplink/backend/internal/oidc"
+	"uplink/backend/internal/text"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/time/rate"
 )
@@ -25,6 +31,8 @@ type ctxKey int
 const (
 	uidKey ctxKey = iota
 	userKey
+	roleKey
+	sidKey
 )
 
 type visitor struct {
@@ -35,13 +43,19 @@ type visitor struct {
 type API struct {
 	db      *db.DB
 	gm      *game.Manager
+	notify  *notify.Service
+	idp     []*oidc.Client
 	secret  []byte
 	origins map[string]bool
 	log     *slog.Logger
 	limit   sync.Map
+	metrics *apiMetrics
+	mail    mail.Mailer
+	// publicURL — адрес сайта для ссылок в письмах.
+	publicURL string
 }
 
-func New(d *db.DB, g *game.Manager, s string, origins []string, l *slog.Logger) http.Handler {
+func New(d *db.DB, g *game.Manager, n *notify.Service, idp []*oidc.Client, m mail.Mailer, s, publicURL, metricsToken string, origins []string, l *slog.Logger) http.Handler {
 	fmt.Println(">>> [INIT] Запуск API и инициализация статики...")
 	
 	allowed := make(map[string]bool)
@@ -50,22 +64,37 @@ func New(d *db.DB, g *game.Manager, s string, origins []string, l *slog.Logger)
 	}
 
 	a := &API{
-		db:      d,
-		gm:      g,
-		secret:  []byte(s),
-		origins: allowed,
-		log:     l,
+		db:        d,
+		gm:        g,
+		notify:    n,
+		idp:       idp,
+		secret:    []byte(s),
+		origins:   allowed,
+		log:       l,
+		metrics:   newAPIMetrics(),
+		mail:      m,
+		publicURL: publicURL,
 	}
 
+	reg := metrics.NewRegistry()
+	reg.MustRegister(a.metrics.latency, a.metrics.rateLimited, a.metrics.loginFailed, a.metrics.loginLocked)
+	reg.MustRegister(g.Metrics()...)
+	reg.MustRegister(d.Metrics()...)
+
 	go a.cleanupVisitors()
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/v1/categories", a.getCategories)
+	mux.HandleFunc("GET /api/v1/texts", a.listTexts)
+	mux.HandleFunc("GET /api/v1/texts/{id}", a.getText)
 	mux.HandleFunc("POST /api/v1/auth/register", a.register)
 	mux.HandleFunc("POST /api/v1/auth/login", a.login)
+	mux.HandleFunc("POST /api/v1/auth/refresh", a.refresh)
+	mux.HandleFunc("POST /api/v1/auth/logout", a.logout)
 
 	auth := a.authMiddleware
+	mux.HandleFunc("POST /api/v1/auth/logout-all", auth(a.logoutAll))
 	mux.HandleFunc("/api/v1/users/me", auth(a.me))
 	mux.HandleFunc("GET /api/v1/users/history", auth(a.history))
 	mux.HandleFunc("GET /api/v1/leaderboard", auth(a.leaderboard))
@@ -75,6 +104,19 @@ func New(d *db.DB, g *game.Manager, s string, origins []string, l *slog.Logger)
 	mux.HandleFunc("POST /api/v1/practice", auth(a.createRoom("solo")))
 	mux.HandleFunc("/ws/lobby/", a.handleLobbyWS)
 	mux.HandleFunc("/ws", a.handleWS)
+	mux.HandleFunc("POST /api/v1/ws/ticket", auth(a.wsTicket))
+	a.routeAdmin(mux)
+	a.routeChat(mux)
+	a.routeFriends(mux)
+	a.routeNotifications(mux)
+	a.routeAccount(mux)
+	a.routeOIDC(mux)
+	a.routeTwoFactor(mux)
+	a.routePasswordReset(mux)
+	a.routeEmail(mux)
+	if metricsToken != "" {
+		mux.Handle("GET /metrics", metricsHandler(metricsToken, reg))
+	}
 
 	staticDir := "./frontend/static"
 	fs := http.FileServer(http.Dir(staticDir))
@@ -96,7 +138,7 @@ func New(d *db.DB, g *game.Manager, s string, origins []string, l *slog.Logger)
 		fs.ServeHTTP(w, r)
 	})
 
-	return a.corsMiddleware(a.rateLimitMiddleware(mux))
+	return a.corsMiddleware(a.rateLimitMiddleware(a.instrumentMiddleware(mux)))
 }
 
 func (a *API) cleanupVisitors() {
@@ -109,15 +151,34 @@ func (a *API) cleanupVisitors() {
 			}
 			return true
 		})
+		if err := a.db.PruneLoginFailures(context.Background(), time.Now().Add(-loginFailWindow)); err != nil {
+			a.log.Warn("не удалось удалить старые неудачные входы", "err", err)
+		}
+		if err := a.db.PruneWSTickets(context.Background()); err != nil {
+			a.log.Warn("не удалось удалить просроченные билеты сокетов", "err", err)
+		}
+		if err := a.db.PruneMFAChallenges(context.Background()); err != nil {
+			a.log.Warn("не удалось удалить просроченные токены второго шага", "err", err)
+		}
 	}
 }
 
 func (a *API) register(w http.ResponseWriter, r *http.Request) {
-	var req struct{ Username, Password string }
+	var req struct{ Username, Password, Email string }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Password) < 8 {
 		a.error(w, "некорректный запрос", 400)
 		return
 	}
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			a.error(w, err.Error(), 400)
+			return
+		}
+		if a.mail == nil {
+			a.error(w, errNoMail.Error(), 503)
+			return
+		}
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
 	if err != nil {
 		a.error(w, "ошибка сервера", 500)
@@ -128,10 +189,18 @@ func (a *API) register(w http.ResponseWriter, r *http.Request) {
 		a.error(w, "пользователь уже существует", 409)
 		return
 	}
-	a.sendToken(w, id, req.Username)
+	// Почта привяжется, когда игрок перейдет по ссылке из письма.
+	if req.Email != "" {
+		go a.sendVerification(context.WithoutCancel(r.Context()), id, req.Username, req.Email)
+	}
+	a.sendToken(w, r, id, req.Username, db.RolePlayer)
 }
 
 func (a *API) handleCreateManualLobby(w http.ResponseWriter, r *http.Request) {
+	if a.gm.Draining() {
+		a.error(w, game.ErrDraining.Error(), 503)
+		return
+	}
 	uid := r.Context().Value(uidKey).(string)
 	roomID := a.gm.CreateManualLobby(uid)
 	a.json(w, map[string]string{"room_id": roomID}, 200)
@@ -143,25 +212,33 @@ func (a *API) login(w http.ResponseWriter, r *http.Request) {
 		a.error(w, "некорректный запрос", 400)
 		return
 	}
+	if a.loginLocked(w, r, req.Username) {
+		return
+	}
 	u, err := a.db.GetUser(r.Context(), req.Username)
-	if err != nil || bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	hash := dummyHash()
+	if u != nil && u.PasswordHash != "" {
+		hash = []byte(u.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || u == nil || u.PasswordHash == "" {
+		a.loginFailed(r, req.Username)
 		a.error(w, "неверные данные", 401)
 		return
 	}
-	a.sendToken(w, u.ID, u.Username)
-}
-
-func (a *API) sendToken(w http.ResponseWriter, id, name string) {
-	t, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      id,
-		"username": name,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(),
-	}).SignedString(a.secret)
-	if err != nil {
-		a.error(w, "ошибка токена", 500)
+	if u.Banned {
+		a.error(w, "аккаунт заблокирован", 403)
 		return
 	}
-	a.json(w, map[string]string{"token": t}, 200)
+	if u.TwoFactor {
+		a.sendChallenge(w, r, u.ID)
+		return
+	}
+	a.loginSucceeded(r, u.Username)
+	a.sendToken(w, r, u.ID, u.Username, u.Role)
 }
 
 func (a *API) me(w http.ResponseWriter, r *http.Request) {
@@ -195,6 +272,10 @@ func (a *API) leaderboard(w http.ResponseWriter, r *http.Request) {
 
 func (a *API) createRoom(mode string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if a.gm.Draining() {
+			a.error(w, game.ErrDraining.Error(), 503)
+			return
+		}
 		var s game.Settings
 		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
 			a.error(w, "некорректный запрос", 400)
@@ -221,24 +302,56 @@ func (a *API) error(w http.ResponseWriter, msg string, code int) {
 
 func (a *API) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		h := r.Header.Get("Authorization")
-		if !strings.HasPrefix(h, "Bearer ") {
-			a.error(w, "нет токена", 401)
+		claims, err := a.requestClaims(r)
+		switch {
+		case errors.Is(err, errNoToken), errors.Is(err, errBadToken), errors.Is(err, errRevoked):
+			a.error(w, err.Error(), 401)
 			return
-		}
-		tokenStr := strings.TrimPrefix(h, "Bearer ")
-		t, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) { return a.secret, nil })
-		if err != nil || !t.Valid {
-			a.error(w, "неверный токен", 401)
+		case errors.Is(err, errCSRF):
+			a.error(w, err.Error(), 403)
+			return
+		case err != nil:
+			a.error(w, "ошибка бд", 500)
 			return
 		}
-		claims := t.Claims.(jwt.MapClaims)
+		// Токены, выданные до появления ролей, считаются токенами игрока.
+		role, _ := claims["role"].(string)
+		if role == "" {
+			role = db.RolePlayer
+		}
 		ctx := context.WithValue(r.Context(), uidKey, claims["sub"])
 		ctx = context.WithValue(ctx, userKey, claims["username"])
+		ctx = context.WithValue(ctx, roleKey, role)
+		ctx = context.WithValue(ctx, sidKey, claims["sid"])
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// requireRole — authMiddleware, пропускающий только роль need и старше.
+// Для ролей выше игрока права дополнительно сверяются с базой: понижение роли
+// и блокировка действуют сразу, а не после истечения токена.
+func (a *API) requireRole(need string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return a.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(roleKey).(string)
+			if !db.HasRole(role, need) {
+				a.error(w, "доступ запрещен", 403)
+				return
+			}
+			if need != db.RolePlayer {
+				uid, _ := r.Context().Value(uidKey).(string)
+				u, err := a.db.GetUserByID(r.Context(), uid)
+				if err != nil || u.Banned || !db.HasRole(u.Role, need) {
+					a.error(w, "доступ запрещен", 403)
+					return
+				}
+				r = r.WithContext(context.WithValue(r.Context(), roleKey, u.Role))
+			}
+			next(w, r)
+		})
+	}
+}
+
 func (a *API) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
@@ -268,21 +381,84 @@ func (a *API) getCategories(w http.ResponseWriter, r *http.Request) {
 		cats = []string{"general"}
 	}
 
+	codeLangs, err := a.db.GetSubcategories(r.Context(), text.CodeCategory)
+	if err != nil {
+		a.log.Error("Failed to get code languages", "err", err)
+		a.error(w, "внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
 	a.json(w, map[string]any{
-		"categories": cats,
+		"categories":     cats,
+		"code_languages": codeLangs,
 	}, http.StatusOK)
 }
 
+func (a *API) listTexts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	minD, maxD := text.DifficultyMin, text.DifficultyMax
+	if v := q.Get("min_difficulty"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			a.error(w, "некорректный запрос", 400)
+			return
+		}
+		minD = f
+	}
+	if v := q.Get("max_difficulty"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			a.error(w, "некорректный запрос", 400)
+			return
+		}
+		maxD = f
+	}
+	if minD > maxD {
+		a.error(w, "некорректный диапазон сложности", 400)
+		return
+	}
+
+	list, err := a.db.ListTexts(r.Context(), q.Get("language"), q.Get("category"), minD, maxD, 100)
+	if err != nil {
+		a.log.Error("Failed to list texts", "err", err)
+		a.error(w, "внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	a.json(w, map[string]any{"data": list}, http.StatusOK)
+}
+
+func (a *API) getText(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	t, err := a.db.GetTextDetails(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "текст не найден", 404)
+		return
+	}
+	if err != nil {
+		a.log.Error("Failed to get text", "err", err)
+		a.error(w, "внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	board, err := a.db.GetTextLeaderboard(r.Context(), id, 10)
+	if err != nil {
+		a.log.Error("Failed to get text leaderboard", "err", err)
+		a.error(w, "внутренняя ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	a.json(w, map[string]any{"text": t, "leaderboard": board}, http.StatusOK)
+}
+
 func (a *API) rateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-		if ip == "" {
-			ip = r.RemoteAddr
-		}
-		v, _ := a.limit.LoadOrStore(ip, &visitor{limiter: rate.NewLimiter(rate.Limit(10), 20)})
+		v, _ := a.limit.LoadOrStore(clientIP(r), &visitor{limiter: rate.NewLimiter(rate.Limit(10), 20)})
 		vis := v.(*visitor)
 		vis.lastSeen = time.Now()
 		if !vis.limiter.Allow() {
+			a.metrics.rateLimited.Inc()
 			a.error(w, "слишком много запросов", 429)
 			return
 		}
@@ -306,20 +482,18 @@ func (a *API) handleWS(w http.ResponseWriter, r *http.Request) {
 	user, _ := r.Context().Value(userKey).(string)
 	
 	if uid == "" {
-		tokenStr := r.URL.Query().Get("token")
-		if tokenStr != "" {
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-				return a.secret, nil
-			})
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					if s, ok := claims["sub"].(string); ok { uid = s }
-					if u, ok := claims["username"].(string); ok { user = u }
-				}
-			}
+		var err error
+		if uid, user, err = a.wsUser(r); err != nil {
+			a.wsDenied(w, err)
+			return
 		}
 	}
 
+	if uid != "" && a.banned(r, uid) {
+		a.error(w, "аккаунт заблокирован", 403)
+		return
+	}
+
 	if uid != "" && (user == "" || user == "Guest") {
 		dbUser, err := a.db.GetUserByID(r.Context(), uid)
 		if err == nil && dbUser != nil {
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/game"
+	"uplink/protocol"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxReportReason = 500
+	reportsLimit    = 100
+	chatPageSize    = 50
+)
+
+// routeChat регистрирует жалобы игроков на сообщения и их разбор модераторами.
+func (a *API) routeChat(mux *http.ServeMux) {
+	mod := a.requireRole(db.RoleModerator)
+	mux.HandleFunc("GET /api/v1/rooms/{id}/chat", a.authMiddleware(a.roomChat))
+	mux.HandleFunc("GET /api/v1/matches/{id}/chat", a.authMiddleware(a.matchChat))
+	mux.HandleFunc("POST /api/v1/rooms/{id}/report", a.authMiddleware(a.reportMessage))
+	mux.HandleFunc("GET /api/v1/admin/reports", mod(a.adminReports))
+	mux.HandleFunc("POST /api/v1/admin/reports/{id}/resolve", mod(a.adminResolveReport))
+	mux.HandleFunc("POST /api/v1/admin/rooms/{id}/mute", mod(a.adminMute))
+}
+
+// roomChat отдает сохраненный чат живой комнаты постранично, от новых сообщений к старым.
+func (a *API) roomChat(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	id := r.PathValue("id")
+	since, err := a.gm.ChatSince(id, uid)
+	switch {
+	case errors.Is(err, game.ErrNotInRoom):
+		a.error(w, err.Error(), 403)
+		return
+	case err != nil:
+		a.error(w, err.Error(), 404)
+		return
+	}
+	list, next, err := a.db.GetRoomChat(r.Context(), id, since, chatPageSize, r.URL.Query().Get("cursor"))
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list, "next_cursor": next}, 200)
+}
+
+// matchChat отдает чат завершенного матча его участникам и модераторам. Роль
+// модератора, как и в requireRole, берется из базы: в токене она могла устареть.
+func (a *API) matchChat(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	id := r.PathValue("id")
+	if !validUUID(id) {
+		a.error(w, "матч не найден", 404)
+		return
+	}
+	ok, err := a.db.InMatch(r.Context(), id, uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if !ok {
+		u, err := a.db.GetUserByID(r.Context(), uid)
+		if err != nil || u.Banned || !db.HasRole(u.Role, db.RoleModerator) {
+			a.error(w, "вы не участвовали в матче", 403)
+			return
+		}
+	}
+	list, next, err := a.db.GetMatchChat(r.Context(), id, chatPageSize, r.URL.Query().Get("cursor"))
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list, "next_cursor": next}, 200)
+}
+
+// validUUID проверяет запись UUID, чтобы не отправлять в базу заведомо неверный id.
+func validUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case !strings.ContainsRune("0123456789abcdefABCDEF", c):
+			return false
+		}
+	}
+	return true
+}
+
+// reportMessage сохраняет жалобу вместе с соседними сообщениями из истории комнаты,
+// чтобы модератор видел переписку такой, какой она была в момент жалобы.
+func (a *API) reportMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MessageID string `json:"message_id"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MessageID == "" || utf8.RuneCountInString(req.Reason) > maxReportReason {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	roomID := r.PathValue("id")
+
+	msg, around, err := a.gm.ChatContext(roomID, uid, req.MessageID)
+	switch {
+	case errors.Is(err, game.ErrNotInRoom):
+		a.error(w, err.Error(), 403)
+		return
+	case err != nil:
+		a.error(w, err.Error(), 404)
+		return
+	case msg.SenderID == uid:
+		a.error(w, "нельзя пожаловаться на свое сообщение", 400)
+		return
+	}
+	b, _ := json.Marshal(around)
+
+	id, err := a.db.CreateChatReport(r.Context(), &db.ChatReport{
+		ReporterID: uid,
+		RoomID:     roomID,
+		MessageID:  msg.ID,
+		SenderID:   msg.SenderID,
+		SenderName: msg.SenderName,
+		Text:       msg.Text,
+		Reason:     req.Reason,
+		Context:    b,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "жалоба уже отправлена", 409)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]int64{"id": id}, 201)
+}
+
+func (a *API) adminReports(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", db.ReportOpen, db.ReportDismissed, db.ReportActioned:
+	default:
+		a.error(w, "некорректный статус", 400)
+		return
+	}
+	list, err := a.db.ListChatReports(r.Context(), status, reportsLimit)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list}, 200)
+}
+
+func (a *API) adminResolveReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.error(w, "некорректный id", 400)
+		return
+	}
+	var req struct {
+		Status     string `json:"status"`
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
+		(req.Status != db.ReportDismissed && req.Status != db.ReportActioned) ||
+		utf8.RuneCountInString(req.Resolution) > maxReportReason {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	err = a.db.ResolveChatReport(r.Context(), id, uid, req.Status, req.Resolution)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "жалоба не найдена или уже разобрана", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.audit(r, "resolve_report", r.PathValue("id"), req)
+	a.json(w, map[string]string{"status": req.Status}, 200)
+}
+
+func (a *API) adminMute(w http.ResponseWriter, r *http.Request) {
+	var req protocol.Mute
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Validate() != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	id := r.PathValue("id")
+	if err := a.gm.MuteUser(id, req.UserID, time.Duration(req.Seconds)*time.Second); err != nil {
+		a.error(w, err.Error(), 404)
+		return
+	}
+	a.audit(r, "room_mute", req.UserID, map[string]any{"room_id": id, "seconds": req.Seconds})
+	a.json(w, map[string]string{"status": "muted"}, 200)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Сессия браузера в cookie. Клиент просит этот режим заголовком X-Session-Mode: cookie
+// при входе и обмене токенов: тогда токены не попадают в тело ответа и недоступны
+// скриптам страницы. Запросы, изменяющие данные, должны нести заголовок X-CSRF-Token
+// со значением, привязанным к сессии. Клиенты API по-прежнему передают токен в
+// заголовке Authorization, и для них CSRF-токен не нужен.
+const (
+	sessionModeHeader = "X-Session-Mode"
+	csrfHeader        = "X-CSRF-Token"
+
+	sessionCookie = "uplink_session"
+	// refreshCookie отправляется только на маршруты входа, где меняются токены.
+	refreshCookie = "uplink_refresh"
+	refreshPath   = "/api/v1/auth/"
+	// csrfCookie скрипты читают, чтобы повторить значение в заголовке.
+	csrfCookie = "uplink_csrf"
+)
+
+var errCSRF = errors.New("неверный CSRF-токен")
+
+func cookieMode(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(sessionModeHeader), "cookie")
+}
+
+// csrfToken привязан к сессии: его нельзя подобрать, не зная секрета сервера,
+// и он не меняется при обмене токенов.
+func (a *API) csrfToken(sid string) string {
+	m := hmac.New(sha256.New, a.subkey("csrf"))
+	m.Write([]byte(sid))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// setSession кладет пару токенов сессии sid в cookie.
+func (a *API) setSession(w http.ResponseWriter, r *http.Request, sid string, pair map[string]string) {
+	secure := r.TLS != nil
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    pair["token"],
+		Path:     "/",
+		MaxAge:   int(accessTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    pair["refresh_token"],
+		Path:     refreshPath,
+		MaxAge:   int(refreshTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    a.csrfToken(sid),
+		Path:     "/",
+		MaxAge:   int(refreshTTL.Seconds()),
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSession удаляет cookie сессии, если браузер их прислал.
+func (a *API) clearSession(w http.ResponseWriter, r *http.Request) {
+	for _, c := range []*http.Cookie{
+		{Name: sessionCookie, Path: "/", HttpOnly: true},
+		{Name: refreshCookie, Path: refreshPath, HttpOnly: true},
+		{Name: csrfCookie, Path: "/"},
+	} {
+		if _, err := r.Cookie(c.Name); err == nil {
+			c.MaxAge = -1
+			http.SetCookie(w, c)
+		}
+	}
+}
+
+// csrfSubmitted сверяет заголовок с cookie CSRF-токена. Так проверяется обмен токенов,
+// когда сессия еще не известна: чужой сайт не может ни прочитать cookie, ни задать заголовок.
+func csrfSubmitted(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookie)
+	h := r.Header.Get(csrfHeader)
+	return err == nil && h != "" && hmac.Equal([]byte(h), []byte(c.Value))
+}
+
+// requestClaims проверяет токен доступа из заголовка Authorization или из cookie.
+// Запрос с cookie, изменяющий данные, без верного CSRF-токена дает errCSRF.
+func (a *API) requestClaims(r *http.Request) (jwt.MapClaims, error) {
+	if tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.claims(r.Context(), tokenStr)
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errNoToken
+	}
+	claims, err := a.claims(r.Context(), c.Value)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return claims, nil
+	}
+	sid, _ := claims["sid"].(string)
+	if sid == "" || !hmac.Equal([]byte(r.Header.Get(csrfHeader)), []byte(a.csrfToken(sid))) {
+		return nil, errCSRF
+	}
+	return claims, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/mail"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Подтверждение почты. Адрес, указанный при регистрации или во вкладке ACCOUNT,
+// попадает в аккаунт только после перехода по ссылке из письма: иначе чужой адрес
+// можно было бы занять, а ответ «почта занята» выдавал бы, кто зарегистрирован.
+// Поэтому ответ на запрос не зависит от того, свободен ли адрес, а проверка и
+// отправка идут в фоне.
+const (
+	verifyTTL = 24 * time.Hour
+	// verifyLimit — сколько писем подтверждения в час можно выслать одному игроку.
+	verifyLimit = 3
+)
+
+var errNoMail = errors.New("сервер не отправляет писем")
+
+// routeEmail регистрирует подтверждение почты по ссылке из письма. Токен сам
+// подтверждает владельца ящика, поэтому ссылку можно открыть и без входа.
+func (a *API) routeEmail(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/auth/email/confirm", a.confirmEmail)
+}
+
+// sendVerification высылает на email ссылку подтверждения. Занятый адрес не подтверждается,
+// и письмо на него не уходит.
+func (a *API) sendVerification(ctx context.Context, uid, username, email string) {
+	ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+	defer cancel()
+	owner, err := a.db.GetUserByEmail(ctx, email)
+	if err == nil {
+		if owner.ID != uid {
+			a.log.Info("почта не подтверждается: адрес привязан к другому аккаунту", "user", uid)
+		}
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		a.log.Error("не удалось найти игрока по почте", "err", err)
+		return
+	}
+	token, err := randomToken()
+	if err != nil {
+		a.log.Error("не удалось создать токен подтверждения почты", "err", err)
+		return
+	}
+	err = a.db.CreateEmailVerification(ctx, uid, email, hashToken(token), time.Now().Add(verifyTTL), verifyLimit, time.Now().Add(-time.Hour))
+	if errors.Is(err, db.ErrVerifyThrottled) {
+		a.log.Warn("подтверждение почты не отправлено: лимит писем", "user", uid)
+		return
+	}
+	if err != nil {
+		a.log.Error("не удалось сохранить токен подтверждения почты", "user", uid, "err", err)
+		return
+	}
+	body := fmt.Sprintf(`Здравствуйте, %s!
+
+Этот адрес указали как почту для восстановления пароля аккаунта Uplink. Чтобы подтвердить его, откройте ссылку в течение суток:
+
+%s/auth/email#token=%s
+
+Если это были не вы, просто удалите письмо: адрес не будет привязан.
+`, username, a.publicURL, token)
+	if err := a.mail.Send(ctx, mail.Message{To: email, Subject: "Подтверждение почты Uplink", Body: body}); err != nil {
+		a.log.Error("не удалось отправить письмо подтверждения почты", "user", uid, "err", err)
+		return
+	}
+	a.log.Info("отправлена ссылка подтверждения почты", "user", uid)
+}
+
+// confirmEmail записывает адрес в аккаунт по токену из письма.
+func (a *API) confirmEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid, email, err := a.db.ConfirmEmail(r.Context(), hashToken(req.Token))
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		a.error(w, "ссылка недействительна или устарела", 400)
+		return
+	case errors.Is(err, db.ErrEmailTaken):
+		// Ответ видит только владелец ящика, ему адрес и так известен.
+		a.error(w, err.Error(), 409)
+		return
+	case err != nil:
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("почта подтверждена", "user", uid)
+	a.json(w, map[string]string{"email": email}, 200)
+}
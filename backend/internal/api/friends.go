@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/game"
+	"uplink/backend/internal/notify"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// routeFriends регистрирует друзей, заявки, приглашения в лобби и сокет присутствия.
+func (a *API) routeFriends(mux *http.ServeMux) {
+	auth := a.authMiddleware
+	mux.HandleFunc("GET /api/v1/friends", auth(a.listFriends))
+	mux.HandleFunc("POST /api/v1/friends/requests", auth(a.requestFriend))
+	mux.HandleFunc("POST /api/v1/friends/{id}/accept", auth(a.acceptFriend))
+	mux.HandleFunc("DELETE /api/v1/friends/{id}", auth(a.removeFriend))
+	mux.HandleFunc("POST /api/v1/friends/{id}/invite", auth(a.inviteFriend))
+	mux.HandleFunc("/ws/presence", a.handlePresenceWS)
+}
+
+type friendInfo struct {
+	db.Friend
+	Presence *game.Presence `json:"presence,omitempty"`
+}
+
+// listFriends возвращает друзей со статусом присутствия и входящие и исходящие заявки.
+func (a *API) listFriends(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	list, err := a.db.ListFriends(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	ids := make([]string, 0, len(list))
+	for _, f := range list {
+		if f.Status == db.FriendAccepted {
+			ids = append(ids, f.ID)
+		}
+	}
+	presence := a.gm.Presence(ids)
+	res := make([]friendInfo, len(list))
+	for i, f := range list {
+		res[i].Friend = f
+		if p, ok := presence[f.ID]; ok {
+			res[i].Presence = &p
+		}
+	}
+	a.json(w, map[string]any{"data": res}, 200)
+}
+
+func (a *API) requestFriend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	u, err := a.db.GetUser(r.Context(), req.Username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if u.ID == uid {
+		a.error(w, "нельзя добавить себя в друзья", 400)
+		return
+	}
+	status, err := a.db.RequestFriend(r.Context(), uid, u.ID)
+	if errors.Is(err, db.ErrAlreadyFriends) {
+		a.error(w, err.Error(), 409)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	kind := notify.KindFriendRequest
+	if status == db.FriendAccepted {
+		kind = notify.KindFriendAccepted
+	}
+	a.notifyFrom(r, u.ID, kind)
+	a.json(w, map[string]string{"id": u.ID, "status": status}, 201)
+}
+
+func (a *API) acceptFriend(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	from := r.PathValue("id")
+	err := a.db.AcceptFriend(r.Context(), uid, from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "заявка не найдена", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.notifyFrom(r, from, notify.KindFriendAccepted)
+	a.json(w, map[string]string{"status": db.FriendAccepted}, 200)
+}
+
+// removeFriend удаляет друга, отклоняет входящую или отменяет исходящую заявку.
+func (a *API) removeFriend(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	err := a.db.RemoveFriend(r.Context(), uid, r.PathValue("id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "игрок не найден среди друзей и заявок", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) inviteFriend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RoomID == "" {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	user, _ := r.Context().Value(userKey).(string)
+	to := r.PathValue("id")
+	ok, err := a.db.AreFriends(r.Context(), uid, to)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if !ok {
+		a.error(w, "приглашать можно только друзей", 403)
+		return
+	}
+	invite, err := a.gm.Invite(uid, user, to, req.RoomID)
+	switch {
+	case errors.Is(err, game.ErrNotInRoom):
+		a.error(w, err.Error(), 403)
+		return
+	case err != nil:
+		a.error(w, err.Error(), 404)
+		return
+	}
+	if err := a.notify.Publish(r.Context(), to, notify.KindLobbyInvite, invite); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.gm.DeliverInvite(to, invite)
+	a.json(w, map[string]string{"status": "sent"}, 200)
+}
+
+// notifyFrom сообщает игроку to о действии текущего игрока. Ошибку записывает сервис
+// уведомлений: заявка уже сохранена, и ответ на запрос от уведомления не зависит.
+func (a *API) notifyFrom(r *http.Request, to, kind string) {
+	uid := r.Context().Value(uidKey).(string)
+	user, _ := r.Context().Value(userKey).(string)
+	_ = a.notify.Publish(r.Context(), to, kind, notify.From{ID: uid, Name: user})
+}
+
+// handlePresenceWS открывает сокет игрока: он виден друзьям в сети и получает уведомления.
+func (a *API) handlePresenceWS(w http.ResponseWriter, r *http.Request) {
+	uid, user, err := a.wsUser(r)
+	if err != nil {
+		a.wsDenied(w, err)
+		return
+	}
+	if uid == "" {
+		a.error(w, errNoToken.Error(), 401)
+		return
+	}
+	if a.banned(r, uid) {
+		a.error(w, "аккаунт заблокирован", 403)
+		return
+	}
+	a.gm.HandlePresenceWS(w, r, uid, user)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Защита входа от перебора паролей. Неудачи считаются отдельно по введенному имени
+// и по адресу в таблице login_failures, поэтому действуют на всех узлах. После
+// свободных попыток вход по ключу закрывается на секунду, и с каждой следующей
+// неудачей срок удваивается до потолка. Пока ключ закрыт, пароль не проверяется.
+type loginPolicy struct {
+	free int           // неудач подряд без задержки
+	max  time.Duration // потолок блокировки
+}
+
+var (
+	accountPolicy = loginPolicy{free: 5, max: 15 * time.Minute}
+	// С одного адреса перебирают сразу много аккаунтов, поэтому порог выше, а блокировка дольше.
+	ipPolicy = loginPolicy{free: 20, max: time.Hour}
+	// factorPolicy — для кодов 2FA в настройках аккаунта: их перебирают с украденным токеном доступа.
+	factorPolicy = loginPolicy{free: 5, max: time.Hour}
+)
+
+const (
+	loginBackoffBase = time.Second
+	// loginFailWindow — через сколько после последней неудачи счет начинается заново.
+	// Должно быть дольше самой длинной блокировки, иначе задержка не растет.
+	loginFailWindow = 2 * time.Hour
+)
+
+// lockFor — на сколько закрыть вход после n неудач подряд.
+func (p loginPolicy) lockFor(n int) time.Duration {
+	if n <= p.free {
+		return 0
+	}
+	return min(loginBackoffBase<<min(n-p.free-1, 30), p.max)
+}
+
+func accountKey(username string) string { return "user:" + username }
+func ipKey(ip string) string            { return "ip:" + ip }
+func factorKey(uid string) string       { return "2fa:" + uid }
+
+// dummyHash сравнивается с паролем, когда аккаунта нет или у него нет пароля:
+// ответ для неизвестного имени занимает столько же, сколько для неверного пароля.
+var dummyHash = sync.OnceValue(func() []byte {
+	h, err := bcrypt.GenerateFromPassword([]byte("uplink-dummy-password"), 10)
+	if err != nil {
+		panic(err)
+	}
+	return h
+})
+
+// loginLocked отвечает 429, если вход для имени или адреса запроса закрыт.
+func (a *API) loginLocked(w http.ResponseWriter, r *http.Request, username string) bool {
+	until, err := a.db.LoginLockedUntil(r.Context(), accountKey(username), ipKey(clientIP(r)))
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return true
+	}
+	if until.IsZero() {
+		return false
+	}
+	a.retryLater(w, until, "слишком много неудачных попыток входа")
+	return true
+}
+
+// retryLater отвечает 429 со сроком, когда ключ снова откроется.
+func (a *API) retryLater(w http.ResponseWriter, until time.Time, msg string) {
+	secs := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	a.json(w, map[string]any{
+		"error":       fmt.Sprintf("%s, повторите через %d с", msg, secs),
+		"retry_after": secs,
+	}, 429)
+}
+
+// loginFailed учитывает неудачу по имени и адресу и закрывает вход, если неудач слишком много.
+// Учет не зависит от того, дождался ли клиент ответа.
+func (a *API) loginFailed(r *http.Request, username string) {
+	a.metrics.loginFailed.Inc()
+	ctx := context.WithoutCancel(r.Context())
+	ip := clientIP(r)
+	a.recordFailure(ctx, accountKey(username), accountPolicy, "account", username, ip)
+	a.recordFailure(ctx, ipKey(ip), ipPolicy, "ip", ip, ip)
+}
+
+func (a *API) recordFailure(ctx context.Context, key string, p loginPolicy, scope, target, ip string) {
+	n, err := a.db.RecordLoginFailure(ctx, key, time.Now().Add(-loginFailWindow))
+	if err != nil {
+		a.log.Error("не удалось учесть неудачный вход", "key", key, "err", err)
+		return
+	}
+	d := p.lockFor(n)
+	if d == 0 {
+		return
+	}
+	if err := a.db.LockLogin(ctx, key, time.Now().Add(d)); err != nil {
+		a.log.Error("не удалось закрыть вход", "key", key, "err", err)
+		return
+	}
+	a.metrics.loginLocked.Inc(scope)
+	// В журнал попадает начало перебора и каждая блокировка на полный срок,
+	// а не каждая короткая задержка между ними.
+	if n != p.free+1 && d != p.max {
+		return
+	}
+	a.log.Warn("вход временно закрыт после неудачных попыток", "scope", scope, "target", target, "failures", n, "lock", d)
+	details := map[string]any{"scope": scope, "failures": n, "locked_seconds": int(d.Seconds()), "ip": ip}
+	if err := a.db.LogSystemAction(ctx, "login_locked", target, details); err != nil {
+		a.log.Error("не удалось записать блокировку входа в журнал", "target", target, "err", err)
+	}
+}
+
+// loginSucceeded забывает неудачи по аккаунту. Счетчик адреса остается: иначе
+// один свой аккаунт позволял бы бесконечно перебирать чужие.
+func (a *API) loginSucceeded(r *http.Request, username string) {
+	if err := a.db.ClearLoginFailures(r.Context(), accountKey(username)); err != nil {
+		a.log.Error("не удалось сбросить неудачные входы", "user", username, "err", err)
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"uplink/backend/internal/metrics"
+)
+
+type apiMetrics struct {
+	latency     *metrics.Histogram
+	rateLimited *metrics.Counter
+	loginFailed *metrics.Counter
+	loginLocked *metrics.Counter
+}
+
+func newAPIMetrics() *apiMetrics {
+	return &apiMetrics{
+		latency: metrics.NewHistogram("uplink_http_request_duration_seconds",
+			"Время обработки HTTP запросов по шаблону маршрута и коду ответа.", metrics.DefBuckets, "route", "code"),
+		rateLimited: metrics.NewCounter("uplink_http_rate_limited_total",
+			"Запросы, отклоненные ограничением частоты."),
+		loginFailed: metrics.NewCounter("uplink_login_failures_total",
+			"Неудачные попытки входа: неверный пароль, неизвестное имя или сгоревший второй шаг."),
+		loginLocked: metrics.NewCounter("uplink_login_lockouts_total",
+			"Временные блокировки входа по аккаунту или адресу.", "scope"),
+	}
+}
+
+// statusRecorder запоминает код ответа. Соединения, перехваченные под WebSocket,
+// в гистограмму не попадают: их длительность — время жизни сокета.
+type statusRecorder struct {
+	http.ResponseWriter
+	code     int
+	hijacked bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.hijacked = true
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+// instrumentMiddleware замеряет обработчики; шаблон маршрута известен после ServeMux.
+func (a *API) instrumentMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.hijacked {
+			return
+		}
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		a.metrics.latency.Observe(time.Since(start).Seconds(), route, strconv.Itoa(rec.code))
+	})
+}
+
+// metricsHandler отдает метрики только с заголовком Authorization: Bearer <token>.
+// Маршрут висит на общем адресе приложения, поэтому без токена он не открывается.
+func metricsHandler(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
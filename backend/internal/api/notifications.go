@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	notificationsPageSize = 50
+	maxMarkRead           = 100
+)
+
+// routeNotifications регистрирует входящие игрока и отметку о прочтении.
+func (a *API) routeNotifications(mux *http.ServeMux) {
+	auth := a.authMiddleware
+	mux.HandleFunc("GET /api/v1/notifications", auth(a.listNotifications))
+	mux.HandleFunc("POST /api/v1/notifications/read", auth(a.markNotificationsRead))
+	mux.HandleFunc("POST /api/v1/notifications/{id}/read", auth(a.markNotificationRead))
+}
+
+// listNotifications отдает входящие постранично, от новых к старым, вместе с числом непрочитанных.
+// С ?unread=true в страницу попадают только непрочитанные.
+func (a *API) listNotifications(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	q := r.URL.Query()
+	list, next, err := a.db.ListNotifications(r.Context(), uid, q.Get("unread") == "true", notificationsPageSize, q.Get("cursor"))
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	unread, err := a.db.CountUnread(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list, "next_cursor": next, "unread": unread}, 200)
+}
+
+// markNotificationsRead отмечает прочитанными перечисленные уведомления. Все входящие
+// отмечаются только без тела или с ?all=true: пустой список ids ничего не меняет.
+func (a *API) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength == 0 || r.URL.Query().Get("all") == "true" {
+		uid := r.Context().Value(uidKey).(string)
+		a.markRead(w, r, func(ctx context.Context) error { return a.db.MarkAllNotificationsRead(ctx, uid) })
+		return
+	}
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) > maxMarkRead {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	a.markIDs(w, r, req.IDs)
+}
+
+func (a *API) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		a.error(w, "некорректный id", 400)
+		return
+	}
+	a.markIDs(w, r, []int64{id})
+}
+
+// markIDs отмечает уведомления ids. Чужие и уже прочитанные пропускаются молча.
+func (a *API) markIDs(w http.ResponseWriter, r *http.Request, ids []int64) {
+	uid := r.Context().Value(uidKey).(string)
+	a.markRead(w, r, func(ctx context.Context) error { return a.db.MarkNotificationsRead(ctx, uid, ids) })
+}
+
+// markRead выполняет отметку mark и отвечает числом оставшихся непрочитанных,
+// чтобы клиент обновил счетчик.
+func (a *API) markRead(w http.ResponseWriter, r *http.Request, mark func(context.Context) error) {
+	uid := r.Context().Value(uidKey).(string)
+	if err := mark(r.Context()); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	unread, err := a.db.CountUnread(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]int{"unread": unread}, 200)
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"crypto/hmac"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Вход через внешних провайдеров OIDC. Состояние входа (state, nonce, PKCE-верификатор)
+// хранится в подписанной cookie, поэтому обратный вызов может прийти на любой узел.
+// Сессия после входа кладется в cookie, а результат передается странице /auth/callback
+// во фрагменте адреса, который не уходит на сервер и не попадает в журналы.
+const (
+	oidcCookie   = "uplink_oidc"
+	oidcPath     = "/api/v1/auth/oidc/"
+	oidcStateTTL = 10 * time.Minute
+)
+
+// routeOIDC регистрирует вход через провайдеров и привязку учетных записей к аккаунту.
+func (a *API) routeOIDC(mux *http.ServeMux) {
+	auth := a.authMiddleware
+	mux.HandleFunc("GET /api/v1/auth/oidc", a.oidcProviders)
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/login", a.oidcLogin)
+	mux.HandleFunc("POST /api/v1/auth/oidc/{provider}/link", auth(a.oidcLink))
+	mux.HandleFunc("GET /api/v1/auth/oidc/{provider}/callback", a.oidcCallback)
+	mux.HandleFunc("GET /api/v1/account/identities", auth(a.listIdentities))
+	mux.HandleFunc("DELETE /api/v1/account/identities/{provider}", auth(a.unlinkIdentity))
+}
+
+func (a *API) provider(name string) *oidc.Client {
+	for _, c := range a.idp {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *API) oidcProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, len(a.idp))
+	for i, c := range a.idp {
+		names[i] = c.Name()
+	}
+	a.json(w, map[string]any{"data": names}, 200)
+}
+
+// startOIDC сохраняет состояние входа в cookie и возвращает адрес страницы провайдера.
+// link — ID игрока, к которому привязывается учетная запись; пустой для входа.
+func (a *API) startOIDC(w http.ResponseWriter, r *http.Request, link string) (string, bool) {
+	c := a.provider(r.PathValue("provider"))
+	if c == nil {
+		a.error(w, "неизвестный провайдер", 404)
+		return "", false
+	}
+	redirect := c.RedirectURL()
+	if redirect == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		redirect = scheme + "://" + r.Host + oidcPath + c.Name() + "/callback"
+	}
+	var vals [3]string
+	for i := range vals {
+		v, err := oidc.Random()
+		if err != nil {
+			a.error(w, "ошибка сервера", 500)
+			return "", false
+		}
+		vals[i] = v
+	}
+	state, nonce, verifier := vals[0], vals[1], vals[2]
+	authURL, err := c.AuthURL(r.Context(), redirect, state, nonce, verifier)
+	if err != nil {
+		a.log.Warn("провайдер входа недоступен", "provider", c.Name(), "err", err)
+		a.error(w, oidc.ErrDiscovery.Error(), 502)
+		return "", false
+	}
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"provider": c.Name(),
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"redirect": redirect,
+		"link":     link,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	}).SignedString(a.subkey("oidc-state"))
+	if err != nil {
+		a.error(w, errSign.Error(), 500)
+		return "", false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    cookie,
+		Path:     oidcPath,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return authURL, true
+}
+
+func (a *API) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if u, ok := a.startOIDC(w, r, ""); ok {
+		http.Redirect(w, r, u, http.StatusFound)
+	}
+}
+
+// oidcLink начинает привязку учетной записи провайдера к текущему игроку.
+// Браузер переходит по адресу из ответа, cookie состояния уже установлена.
+func (a *API) oidcLink(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	if u, ok := a.startOIDC(w, r, uid); ok {
+		a.json(w, map[string]string{"url": u}, 200)
+	}
+}
+
+// oidcDone отправляет браузер на страницу клиента с результатом во фрагменте.
+func (a *API) oidcDone(w http.ResponseWriter, r *http.Request, result url.Values) {
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: oidcPath, MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/auth/callback#"+result.Encode(), http.StatusFound)
+}
+
+func (a *API) oidcFail(w http.ResponseWriter, r *http.Request, msg string) {
+	a.oidcDone(w, r, url.Values{"error": {msg}})
+}
+
+func (a *API) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	c := a.provider(r.PathValue("provider"))
+	if c == nil {
+		a.error(w, "неизвестный провайдер", 404)
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		a.oidcFail(w, r, "провайдер отказал во входе: "+e)
+		return
+	}
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		a.oidcFail(w, r, "вход устарел, начните заново")
+		return
+	}
+	st := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, st, func(*jwt.Token) (any, error) { return a.subkey("oidc-state"), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	str := func(k string) string { v, _ := st[k].(string); return v }
+	if err != nil || str("provider") != c.Name() || q.Get("state") == "" || !hmac.Equal([]byte(q.Get("state")), []byte(str("state"))) {
+		a.oidcFail(w, r, "вход устарел, начните заново")
+		return
+	}
+
+	id, err := c.Exchange(r.Context(), q.Get("code"), str("redirect"), str("verifier"), str("nonce"))
+	if err != nil {
+		a.log.Warn("вход через провайдера не удался", "provider", c.Name(), "err", err)
+		a.oidcFail(w, r, "вход через провайдера не удался")
+		return
+	}
+
+	if link := str("link"); link != "" {
+		err := a.db.LinkIdentity(r.Context(), link, c.Name(), id.Subject, id.Email)
+		if errors.Is(err, db.ErrIdentityTaken) {
+			a.oidcFail(w, r, err.Error())
+			return
+		}
+		if err != nil {
+			a.oidcFail(w, r, "ошибка бд")
+			return
+		}
+		a.log.Info("учетная запись провайдера привязана", "user", link, "provider", c.Name())
+		a.oidcDone(w, r, url.Values{"linked": {c.Name()}})
+		return
+	}
+
+	uid, err := a.db.FindIdentity(r.Context(), c.Name(), id.Subject, id.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		uid, _, err = a.db.CreateExternalUser(r.Context(), externalUsername(id), c.Name(), id.Subject, id.Email)
+		if errors.Is(err, db.ErrIdentityTaken) {
+			// Первый вход пришел одновременно из двух вкладок, игрока уже создала другая.
+			uid, err = a.db.FindIdentity(r.Context(), c.Name(), id.Subject, id.Email)
+		}
+	}
+	if err != nil {
+		a.oidcFail(w, r, "ошибка бд")
+		return
+	}
+	u, err := a.db.GetUserByID(r.Context(), uid)
+	if err != nil {
+		a.oidcFail(w, r, "ошибка бд")
+		return
+	}
+	if u.Banned {
+		a.oidcFail(w, r, "аккаунт заблокирован")
+		return
+	}
+	// Провайдер заменяет только пароль: с 2FA вход завершается кодом на /auth/2fa.
+	if u.TwoFactor {
+		challenge, err := a.issueChallenge(r.Context(), u.ID)
+		if errors.Is(err, errSign) {
+			a.oidcFail(w, r, err.Error())
+			return
+		}
+		if err != nil {
+			a.oidcFail(w, r, "ошибка бд")
+			return
+		}
+		a.oidcDone(w, r, url.Values{"challenge": {challenge}})
+		return
+	}
+	sid, pair, err := a.openSession(r, u.ID, u.Username, u.Role)
+	if err != nil {
+		a.oidcFail(w, r, err.Error())
+		return
+	}
+	// Вход через провайдера бывает только в браузере, поэтому сессия всегда в cookie.
+	a.setSession(w, r, sid, pair)
+	a.oidcDone(w, r, url.Values{"session": {"cookie"}, "expires_in": {strconv.Itoa(int(accessTTL.Seconds()))}})
+}
+
+// externalUsername подбирает имя нового игрока из данных провайдера.
+func externalUsername(id *oidc.Identity) string {
+	local, _, _ := strings.Cut(id.Email, "@")
+	for _, s := range []string{id.PreferredUsername, local, id.Name} {
+		name := []rune(strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' {
+				return r
+			}
+			return '_'
+		}, strings.TrimSpace(s)))
+		if len(name) > 24 {
+			name = name[:24]
+		}
+		if len(name) >= 3 {
+			return string(name)
+		}
+	}
+	return "player"
+}
+
+func (a *API) listIdentities(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	list, err := a.db.ListIdentities(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"data": list}, 200)
+}
+
+func (a *API) unlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	err := a.db.UnlinkIdentity(r.Context(), uid, r.PathValue("provider"))
+	switch {
+	case errors.Is(err, db.ErrLastLogin):
+		a.error(w, err.Error(), 409)
+	case errors.Is(err, pgx.ErrNoRows):
+		a.error(w, "учетная запись не привязана", 404)
+	case err != nil:
+		a.error(w, "ошибка бд", 500)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
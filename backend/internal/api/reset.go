@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/mail"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Восстановление пароля по почте. Ссылка содержит одноразовый токен, в базе хранится
+// только его SHA-256. Токен передается во фрагменте адреса и не попадает в журналы.
+const (
+	resetTTL = time.Hour
+	// resetLimit — сколько ссылок в час можно выслать одному игроку: больше похоже
+	// на то, что чужой ящик засыпают письмами.
+	resetLimit   = 3
+	resetTimeout = 30 * time.Second
+)
+
+// routePasswordReset регистрирует запрос ссылки сброса и смену пароля по ней.
+func (a *API) routePasswordReset(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/auth/password/forgot", a.forgotPassword)
+	mux.HandleFunc("POST /api/v1/auth/password/reset", a.resetPassword)
+}
+
+// forgotPassword отвечает одинаково, есть ли аккаунт с такой почтой: иначе форма
+// выдавала бы, кто зарегистрирован. Поиск и отправка идут в фоне, чтобы и время
+// ответа ничего не выдавало.
+func (a *API) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	email, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		a.error(w, err.Error(), 400)
+		return
+	}
+	if a.mail == nil {
+		a.error(w, errNoMail.Error(), 503)
+		return
+	}
+	go a.sendReset(context.WithoutCancel(r.Context()), email)
+	a.json(w, map[string]string{"status": "sent"}, 202)
+}
+
+func (a *API) sendReset(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+	defer cancel()
+	u, err := a.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		a.log.Error("не удалось найти игрока по почте", "err", err)
+		return
+	}
+	if u.Banned {
+		return
+	}
+	token, err := randomToken()
+	if err != nil {
+		a.log.Error("не удалось создать токен сброса", "err", err)
+		return
+	}
+	err = a.db.CreatePasswordReset(ctx, u.ID, hashToken(token), time.Now().Add(resetTTL), resetLimit, time.Now().Add(-time.Hour))
+	if errors.Is(err, db.ErrResetThrottled) {
+		a.log.Warn("сброс пароля не отправлен: лимит писем", "user", u.ID)
+		return
+	}
+	if err != nil {
+		a.log.Error("не удалось сохранить токен сброса", "user", u.ID, "err", err)
+		return
+	}
+	body := fmt.Sprintf(`Здравствуйте, %s!
+
+Для аккаунта Uplink запросили сброс пароля. Чтобы задать новый пароль, откройте ссылку в течение часа:
+
+%s/auth/reset#token=%s
+
+Если сброс запрашивали не вы, просто удалите письмо: пароль останется прежним.
+`, u.Username, a.publicURL, token)
+	if err := a.mail.Send(ctx, mail.Message{To: u.Email, Subject: "Сброс пароля Uplink", Body: body}); err != nil {
+		a.log.Error("не удалось отправить письмо сброса пароля", "user", u.ID, "err", err)
+		return
+	}
+	a.log.Info("отправлена ссылка сброса пароля", "user", u.ID)
+}
+
+// resetPassword задает новый пароль по токену из письма и завершает все сессии.
+// Двухфакторная аутентификация остается включенной: войти все равно можно только с кодом.
+func (a *API) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || len(req.Password) < 8 {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	uid, username, err := a.db.ResetPassword(r.Context(), hashToken(req.Token), string(hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "ссылка недействительна или устарела", 400)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	// Владелец почты подтвердил, что аккаунт его: блокировка после перебора ему не мешает.
+	a.loginSucceeded(r, username)
+	a.log.Info("пароль сброшен по ссылке из письма", "user", uid)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"uplink/backend/internal/db"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Сессии входа. Токен доступа живет accessTTL и несет ID сессии (sid); токен обновления
+// хранится в базе хешем, меняется при каждом обмене и продлевает сессию на refreshTTL.
+// Отозванная сессия перестает пускать сразу, не дожидаясь истечения токена доступа.
+const (
+	accessTTL  = 15 * time.Minute
+	refreshTTL = 30 * 24 * time.Hour
+	// refreshGrace — сколько после обмена старый токен обновления не считается украденным:
+	// две вкладки браузера могут обменять один токен почти одновременно.
+	refreshGrace = 30 * time.Second
+)
+
+var (
+	errNoToken  = errors.New("нет токена")
+	errBadToken = errors.New("неверный токен")
+	errRevoked  = errors.New("сессия завершена")
+	errSign     = errors.New("ошибка токена")
+)
+
+// sendToken открывает сессию и выдает пару токенов.
+func (a *API) sendToken(w http.ResponseWriter, r *http.Request, id, name, role string) {
+	sid, pair, err := a.openSession(r, id, name, role)
+	if err != nil {
+		a.error(w, err.Error(), 500)
+		return
+	}
+	a.sendPair(w, r, sid, pair)
+}
+
+// sendPair отдает пару токенов в теле ответа, а браузеру в режиме cookie — в cookie.
+func (a *API) sendPair(w http.ResponseWriter, r *http.Request, sid string, pair map[string]string) {
+	if !cookieMode(r) {
+		a.json(w, pair, 200)
+		return
+	}
+	a.setSession(w, r, sid, pair)
+	a.json(w, map[string]any{"csrf_token": a.csrfToken(sid), "expires_in": int(accessTTL.Seconds())}, 200)
+}
+
+// openSession открывает сессию и возвращает ее ID и пару токенов; текст ошибки можно показать клиенту.
+func (a *API) openSession(r *http.Request, id, name, role string) (string, map[string]string, error) {
+	refresh, hash, err := newRefreshToken()
+	if err != nil {
+		return "", nil, errSign
+	}
+	ua := r.UserAgent()
+	if len(ua) > 256 {
+		ua = ua[:256]
+	}
+	sid, err := a.db.CreateSession(r.Context(), id, hash, ua, clientIP(r), time.Now().Add(refreshTTL))
+	if err != nil {
+		return "", nil, errors.New("ошибка бд")
+	}
+	pair, err := a.pair(sid, id, name, role, refresh)
+	return sid, pair, err
+}
+
+func (a *API) pair(sid, id, name, role, refresh string) (map[string]string, error) {
+	t, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      id,
+		"sid":      sid,
+		"username": name,
+		"role":     role,
+		"exp":      time.Now().Add(accessTTL).Unix(),
+	}).SignedString(a.secret)
+	if err != nil {
+		return nil, errSign
+	}
+	return map[string]string{"token": t, "refresh_token": refresh}, nil
+}
+
+// newRefreshToken возвращает случайный токен обновления и его хеш для базы.
+func newRefreshToken() (string, string, error) {
+	t, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return t, hashToken(t), nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(t string) string {
+	sum := sha256.Sum256([]byte(t))
+	return hex.EncodeToString(sum[:])
+}
+
+// subkey выводит из секрета сервера отдельный ключ для назначения purpose, чтобы
+// подписанное одним ключом нельзя было предъявить вместо другого, например cookie
+// состояния вместо токена доступа.
+func (a *API) subkey(purpose string) []byte {
+	m := hmac.New(sha256.New, a.secret)
+	m.Write([]byte(purpose))
+	return m.Sum(nil)
+}
+
+// refresh меняет токен обновления на новую пару. Роль и имя берутся из базы,
+// поэтому изменения роли попадают в токен при следующем обмене. В режиме cookie
+// токен обновления берется из cookie, если его нет в теле.
+func (a *API) refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c, err := r.Cookie(refreshCookie); err == nil && cookieMode(r) {
+		if !csrfSubmitted(r) {
+			a.error(w, errCSRF.Error(), 403)
+			return
+		}
+		req.RefreshToken = c.Value
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	next, hash, err := newRefreshToken()
+	if err != nil {
+		a.error(w, "ошибка токена", 500)
+		return
+	}
+	sid, uid, err := a.db.RotateSession(r.Context(), hashToken(req.RefreshToken), hash, time.Now().Add(refreshTTL), refreshGrace)
+	switch {
+	case errors.Is(err, db.ErrRefreshReused):
+		a.log.Warn("повторное использование токена обновления, сессия отозвана", "user", uid, "session", sid)
+		a.clearSession(w, r)
+		a.error(w, errRevoked.Error(), 401)
+		return
+	case errors.Is(err, db.ErrRefreshStale):
+		// Cookie не трогаем: в них уже лежит пара, которую получила другая вкладка.
+		a.error(w, err.Error(), 401)
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		a.clearSession(w, r)
+		a.error(w, errBadToken.Error(), 401)
+		return
+	case err != nil:
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	u, err := a.db.GetUserByID(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if u.Banned {
+		_ = a.db.RevokeUserSessions(r.Context(), uid)
+		a.clearSession(w, r)
+		a.error(w, "аккаунт заблокирован", 403)
+		return
+	}
+	pair, err := a.pair(sid, u.ID, u.Username, u.Role, next)
+	if err != nil {
+		a.error(w, err.Error(), 500)
+		return
+	}
+	a.sendPair(w, r, sid, pair)
+}
+
+// logout завершает сессию по токену обновления из тела или cookie и по sid токена доступа.
+// Ответ всегда 204: выход из уже завершенной сессии не ошибка. CSRF-токен не нужен:
+// подделанный запрос может разве что завершить чужую сессию.
+func (a *API) logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if c, err := r.Cookie(refreshCookie); err == nil && req.RefreshToken == "" {
+		req.RefreshToken = c.Value
+	}
+	if req.RefreshToken != "" {
+		if err := a.db.RevokeSessionByRefresh(r.Context(), hashToken(req.RefreshToken)); err != nil {
+			a.error(w, "ошибка бд", 500)
+			return
+		}
+	}
+	tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if c, err := r.Cookie(sessionCookie); err == nil && !ok {
+		tokenStr, ok = c.Value, true
+	}
+	a.clearSession(w, r)
+	if ok {
+		if claims, err := a.claims(r.Context(), tokenStr); err == nil {
+			uid, _ := claims["sub"].(string)
+			if sid, _ := claims["sid"].(string); sid != "" {
+				if err := a.db.RevokeSession(r.Context(), uid, sid); err != nil {
+					a.error(w, "ошибка бд", 500)
+					return
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAll завершает все сессии игрока, включая текущую.
+func (a *API) logoutAll(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	if err := a.db.RevokeUserSessions(r.Context(), uid); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.clearSession(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claims проверяет подпись и срок токена доступа и то, что его сессия не отозвана.
+// Токены без sid выданы до появления сессий и действуют до своего срока.
+func (a *API) claims(ctx context.Context, tokenStr string) (jwt.MapClaims, error) {
+	t, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) { return a.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !t.Valid {
+		return nil, errBadToken
+	}
+	claims := t.Claims.(jwt.MapClaims)
+	if sid, _ := claims["sid"].(string); sid != "" {
+		ok, err := a.db.SessionActive(ctx, sid)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errRevoked
+		}
+	}
+	return claims, nil
+}
+
+// clientIP — адрес клиента без порта.
+func clientIP(r *http.Request) string {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if ip == "" {
+		ip = r.RemoteAddr
+	}
+	return ip
+}
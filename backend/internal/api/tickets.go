@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Билеты для WebSocket. Браузер не передает заголовки при открытии сокета, поэтому
+// клиент сначала получает одноразовый билет по REST и предъявляет его в адресе
+// сокета. Билет живет wsTicketTTL и гаснет при первом предъявлении, так что адрес
+// в журналах ничего не дает. Cookie сессии на сокете не принимаются: открытие
+// сокета не защищено от CSRF, и чужая страница подключилась бы от имени игрока.
+// Клиенты API могут вместо билета передать заголовок Authorization.
+const wsTicketTTL = 30 * time.Second
+
+var errBadTicket = errors.New("неверный или использованный билет")
+
+func (a *API) wsTicket(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	sid, _ := r.Context().Value(sidKey).(string)
+	ticket, err := randomToken()
+	if err != nil {
+		a.error(w, errSign.Error(), 500)
+		return
+	}
+	if err := a.db.CreateWSTicket(r.Context(), hashToken(ticket), uid, sid, time.Now().Add(wsTicketTTL)); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"ticket": ticket, "expires_in": int(wsTicketTTL.Seconds())}, 200)
+}
+
+// wsUser определяет игрока сокета по билету из query или по заголовку Authorization.
+// Без того и другого возвращает пустой uid без ошибки.
+func (a *API) wsUser(r *http.Request) (uid, user string, err error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		uid, user, err = a.db.RedeemWSTicket(r.Context(), hashToken(ticket))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", errBadTicket
+		}
+		return uid, user, err
+	}
+	tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", "", nil
+	}
+	claims, err := a.claims(r.Context(), tokenStr)
+	if err != nil {
+		return "", "", err
+	}
+	uid, _ = claims["sub"].(string)
+	user, _ = claims["username"].(string)
+	return uid, user, nil
+}
+
+// wsDenied отвечает на рукопожатие, которое не прошло проверку wsUser.
+func (a *API) wsDenied(w http.ResponseWriter, err error) {
+	if errors.Is(err, errBadTicket) || errors.Is(err, errBadToken) || errors.Is(err, errRevoked) {
+		a.error(w, err.Error(), 401)
+		return
+	}
+	a.error(w, "ошибка бд", 500)
+}
@@ -0,0 +1,434 @@
+package api
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"uplink/backend/internal/db"
+	"uplink/backend/internal/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// Двухфакторная аутентификация по TOTP. Для аккаунта с 2FA верный пароль дает не пару
+// токенов, а токен второго шага (challenge) на mfaTTL; пара выдается после кода из
+// приложения или кода восстановления. Секрет хранится в базе зашифрованным ключом,
+// выведенным из JWT_SECRET, коды восстановления — хешами. Попытки по токену второго
+// шага считаются в таблице mfa_challenges, поэтому лимит и одноразовость действуют
+// на всех узлах.
+const (
+	mfaTTL      = 5 * time.Minute
+	mfaMaxTries = 5
+	// recoveryCount — сколько кодов восстановления выдается за раз.
+	recoveryCount = 10
+	totpIssuer    = "Uplink"
+)
+
+var errBadCode = errors.New("неверный код")
+
+// routeTwoFactor регистрирует второй шаг входа и управление 2FA своего аккаунта.
+func (a *API) routeTwoFactor(mux *http.ServeMux) {
+	auth := a.authMiddleware
+	mux.HandleFunc("POST /api/v1/auth/2fa", a.loginTwoFactor)
+	mux.HandleFunc("GET /api/v1/account/2fa", auth(a.twoFactorStatus))
+	mux.HandleFunc("POST /api/v1/account/2fa/enroll", auth(a.enrollTwoFactor))
+	mux.HandleFunc("POST /api/v1/account/2fa/confirm", auth(a.confirmTwoFactor))
+	mux.HandleFunc("POST /api/v1/account/2fa/disable", auth(a.disableTwoFactor))
+	mux.HandleFunc("POST /api/v1/account/2fa/recovery-codes", auth(a.regenerateRecoveryCodes))
+}
+
+// sendChallenge выдает токен второго шага вместо пары токенов.
+func (a *API) sendChallenge(w http.ResponseWriter, r *http.Request, uid string) {
+	t, err := a.issueChallenge(r.Context(), uid)
+	if errors.Is(err, errSign) {
+		a.error(w, err.Error(), 500)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]string{"challenge": t, "mfa": "totp"}, 200)
+}
+
+// issueChallenge подписывает токен второго шага и заводит для него счетчик попыток.
+func (a *API) issueChallenge(ctx context.Context, uid string) (string, error) {
+	jti, err := randomToken()
+	if err != nil {
+		return "", errSign
+	}
+	expires := time.Now().Add(mfaTTL)
+	t, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": uid,
+		"jti": jti,
+		"exp": expires.Unix(),
+	}).SignedString(a.subkey("mfa-challenge"))
+	if err != nil {
+		return "", errSign
+	}
+	if err := a.db.CreateMFAChallenge(ctx, hashToken(jti), uid, expires); err != nil {
+		return "", err
+	}
+	return t, nil
+}
+
+// loginTwoFactor — второй шаг входа: токен второго шага и код меняются на пару токенов.
+func (a *API) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" || req.Code == "" {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(req.Challenge, claims, func(*jwt.Token) (any, error) { return a.subkey("mfa-challenge"), nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	uid, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	if err != nil || uid == "" || jti == "" {
+		a.error(w, "вход устарел, введите пароль заново", 401)
+		return
+	}
+	n, err := a.db.MFAAttempt(r.Context(), hashToken(jti), uid, mfaMaxTries)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "слишком много попыток, введите пароль заново", 401)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+
+	u, err := a.db.GetUserByID(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if u.Banned {
+		a.error(w, "аккаунт заблокирован", 403)
+		return
+	}
+	if a.loginLocked(w, r, u.Username) {
+		return
+	}
+	st, err := a.db.GetTOTP(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	// Если 2FA сбросили, пока игрок вводил код, пароль он уже подтвердил.
+	if st.Enabled {
+		ok, err := a.checkFactor(r.Context(), uid, st, req.Code)
+		if err != nil {
+			a.error(w, "ошибка сервера", 500)
+			return
+		}
+		if !ok {
+			// Сгоревший токен второго шага считается одной неудачей входа: иначе,
+			// зная пароль, коды можно перебирать, каждый раз входя заново.
+			if n == mfaMaxTries {
+				a.loginFailed(r, u.Username)
+			}
+			a.error(w, errBadCode.Error(), 401)
+			return
+		}
+	}
+	// Токен второго шага одноразовый: из параллельных запросов пару получит один.
+	err = a.db.RedeemMFAChallenge(r.Context(), hashToken(jti), uid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "вход устарел, введите пароль заново", 401)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.loginSucceeded(r, u.Username)
+	a.sendToken(w, r, u.ID, u.Username, u.Role)
+}
+
+// checkFactor проверяет код из приложения или код восстановления и гасит его:
+// тот же код второй раз не примется.
+func (a *API) checkFactor(ctx context.Context, uid string, st db.TOTPState, code string) (bool, error) {
+	secret, err := a.openTOTP(st.Secret)
+	if err != nil {
+		return false, err
+	}
+	if step, ok := totp.Verify(secret, code, time.Now()); ok {
+		return a.db.UseTOTPStep(ctx, uid, step)
+	}
+	return a.db.UseRecoveryCode(ctx, uid, hashToken(normalizeRecovery(code)))
+}
+
+func (a *API) twoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(uidKey).(string)
+	st, err := a.db.GetTOTP(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{
+		"enabled":             st.Enabled,
+		"pending":             !st.Enabled && st.Secret != "",
+		"recovery_codes_left": st.RecoveryLeft,
+	}, 200)
+}
+
+// enrollTwoFactor начинает настройку: выдает секрет и адрес для QR-кода.
+// 2FA включится после подтверждения первым кодом.
+func (a *API) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	u, ok := a.reauth(w, r, req.Password)
+	if !ok {
+		return
+	}
+	secret, err := totp.NewSecret()
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	sealed, err := a.sealTOTP(secret)
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	err = a.db.SetTOTPPending(r.Context(), u.ID, sealed)
+	if errors.Is(err, db.ErrTOTPEnabled) {
+		a.error(w, err.Error(), 409)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]string{"secret": secret, "uri": totp.URI(totpIssuer, u.Username, secret)}, 200)
+}
+
+// confirmTwoFactor включает 2FA по первому коду из приложения и выдает коды восстановления.
+func (a *API) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	uid := r.Context().Value(uidKey).(string)
+	st, err := a.db.GetTOTP(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	if st.Enabled {
+		a.error(w, db.ErrTOTPEnabled.Error(), 409)
+		return
+	}
+	if st.Secret == "" {
+		a.error(w, "сначала начните настройку", 400)
+		return
+	}
+	secret, err := a.openTOTP(st.Secret)
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	step, ok := totp.Verify(secret, req.Code, time.Now())
+	if !ok {
+		a.error(w, errBadCode.Error(), 400)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	err = a.db.EnableTOTP(r.Context(), uid, step, hashes)
+	if errors.Is(err, db.ErrTOTPEnabled) {
+		a.error(w, err.Error(), 409)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("двухфакторная аутентификация включена", "user", uid)
+	a.json(w, map[string]any{"recovery_codes": codes}, 200)
+}
+
+// disableTwoFactor выключает 2FA; нужны пароль и код.
+func (a *API) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	u, ok := a.reauth(w, r, req.Password)
+	if !ok || !a.requireFactor(w, r, u.ID, req.Code) {
+		return
+	}
+	if err := a.db.DisableTOTP(r.Context(), u.ID); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.log.Info("двухфакторная аутентификация выключена", "user", u.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// regenerateRecoveryCodes заменяет коды восстановления новыми; старые перестают действовать.
+// Как и для выключения, нужны пароль и код: новые коды — это вход в обход приложения.
+func (a *API) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		a.error(w, "некорректный запрос", 400)
+		return
+	}
+	u, ok := a.reauth(w, r, req.Password)
+	if !ok || !a.requireFactor(w, r, u.ID, req.Code) {
+		return
+	}
+	uid := u.ID
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return
+	}
+	if err := a.db.ReplaceRecoveryCodes(r.Context(), uid, hashes); err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.json(w, map[string]any{"recovery_codes": codes}, 200)
+}
+
+// requireFactor проверяет код у игрока с включенной 2FA. При отказе ответ уже записан.
+// Неверные коды считаются по игроку в login_failures, как неудачные входы: иначе
+// с украденным токеном доступа код можно было бы перебирать без ограничений.
+func (a *API) requireFactor(w http.ResponseWriter, r *http.Request, uid, code string) bool {
+	until, err := a.db.LoginLockedUntil(r.Context(), factorKey(uid))
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return false
+	}
+	if !until.IsZero() {
+		a.retryLater(w, until, "слишком много неверных кодов")
+		return false
+	}
+	st, err := a.db.GetTOTP(r.Context(), uid)
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return false
+	}
+	if !st.Enabled {
+		a.error(w, db.ErrTOTPDisabled.Error(), 409)
+		return false
+	}
+	ok, err := a.checkFactor(r.Context(), uid, st, code)
+	if err != nil {
+		a.error(w, "ошибка сервера", 500)
+		return false
+	}
+	if !ok {
+		a.recordFailure(context.WithoutCancel(r.Context()), factorKey(uid), factorPolicy, "2fa", uid, clientIP(r))
+		a.error(w, errBadCode.Error(), 403)
+		return false
+	}
+	if err := a.db.ClearLoginFailures(r.Context(), factorKey(uid)); err != nil {
+		a.log.Error("не удалось сбросить неверные коды", "user", uid, "err", err)
+	}
+	return true
+}
+
+// adminResetTwoFactor выключает 2FA игроку, потерявшему телефон и коды восстановления.
+func (a *API) adminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	err := a.db.DisableTOTP(r.Context(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		a.error(w, "пользователь не найден", 404)
+		return
+	}
+	if err != nil {
+		a.error(w, "ошибка бд", 500)
+		return
+	}
+	a.audit(r, "reset_2fa", id, nil)
+	a.json(w, map[string]string{"status": "2fa_reset"}, 200)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes возвращает коды вида abcde-fghij и их хеши для базы.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for range recoveryCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+		codes = append(codes, c[:5]+"-"+c[5:])
+		hashes = append(hashes, hashToken(c))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecovery(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func (a *API) totpCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(a.subkey("totp-secret"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealTOTP шифрует секрет TOTP для хранения в базе.
+func (a *API) sealTOTP(secret string) (string, error) {
+	gcm, err := a.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (a *API) openTOTP(sealed string) (string, error) {
+	gcm, err := a.totpCipher()
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", errors.New("поврежденный секрет TOTP")
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,217 @@
+// Package chat — правила чата комнат и очередей подбора: ограничение частоты
+// и длины сообщений, фильтр слов по языкам и временное заглушение игроков.
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/time/rate"
+)
+
+// AnyLanguage — ключ списка слов, запрещенных во всех языках.
+const AnyLanguage = "*"
+
+// limiterTTL — через сколько простоя забывается ограничитель игрока.
+const limiterTTL = 10 * time.Minute
+
+var (
+	ErrEmpty       = errors.New("пустое сообщение")
+	ErrTooLong     = errors.New("слишком длинное сообщение")
+	ErrRateLimited = errors.New("слишком много сообщений, подождите")
+)
+
+// Policy задает ограничения чата. Rate — сообщений в секунду в среднем,
+// Burst — сколько сообщений можно отправить подряд.
+type Policy struct {
+	MaxLength int                 `json:"max_length"`
+	Rate      float64             `json:"rate"`
+	Burst     int                 `json:"burst"`
+	Words     map[string][]string `json:"words"`
+}
+
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MaxLength: 300,
+		Rate:      1,
+		Burst:     5,
+		Words:     make(map[string][]string),
+	}
+}
+
+// LoadPolicy читает JSON с ограничениями и словами поверх DefaultPolicy.
+// Пустой путь означает правила по умолчанию.
+func LoadPolicy(path string) (*Policy, error) {
+	p := DefaultPolicy()
+	if path == "" {
+		return p, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var custom Policy
+	if err := json.Unmarshal(b, &custom); err != nil {
+		return nil, err
+	}
+	if custom.MaxLength > 0 {
+		p.MaxLength = custom.MaxLength
+	}
+	if custom.Rate > 0 {
+		p.Rate = custom.Rate
+	}
+	if custom.Burst > 0 {
+		p.Burst = custom.Burst
+	}
+	for lang, words := range custom.Words {
+		p.Words[lang] = append(p.Words[lang], words...)
+	}
+	return p, nil
+}
+
+// Moderator проверяет сообщения по Policy. Безопасен для конкурентного использования.
+type Moderator struct {
+	policy    *Policy
+	words     map[string]map[string]bool
+	mu        sync.Mutex
+	limiters  map[string]*limiter
+	lastSweep time.Time
+}
+
+type limiter struct {
+	*rate.Limiter
+	seen time.Time
+}
+
+func New(p *Policy) *Moderator {
+	m := &Moderator{policy: p, words: make(map[string]map[string]bool), limiters: make(map[string]*limiter)}
+	for lang, list := range p.Words {
+		set := make(map[string]bool, len(list))
+		for _, w := range list {
+			set[fold(w)] = true
+		}
+		m.words[lang] = set
+	}
+	return m
+}
+
+// Check проверяет сообщение игрока uid и возвращает текст после фильтра слов
+// и признак того, что фильтр что-то заменил. Пустые и слишком длинные сообщения
+// отклоняются до проверки частоты и лимит не расходуют.
+func (m *Moderator) Check(uid, lang, text string, now time.Time) (string, bool, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", false, ErrEmpty
+	}
+	if utf8.RuneCountInString(text) > m.policy.MaxLength {
+		return "", false, ErrTooLong
+	}
+	if !m.allow(uid, now) {
+		return "", false, ErrRateLimited
+	}
+	clean, filtered := m.Censor(lang, text)
+	return clean, filtered, nil
+}
+
+func (m *Moderator) allow(uid string, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, l := range m.limiters {
+			if now.Sub(l.seen) > limiterTTL {
+				delete(m.limiters, id)
+			}
+		}
+		m.lastSweep = now
+	}
+	l, ok := m.limiters[uid]
+	if !ok {
+		l = &limiter{Limiter: rate.NewLimiter(rate.Limit(m.policy.Rate), m.policy.Burst)}
+		m.limiters[uid] = l
+	}
+	l.seen = now
+	return l.AllowN(now, 1)
+}
+
+// Censor заменяет звездочками запрещенные слова языка lang и общего списка.
+// Сравниваются целые слова без учета регистра, для русского «ё» не отличается от «е».
+func (m *Moderator) Censor(lang, text string) (string, bool) {
+	common, local := m.words[AnyLanguage], m.words[lang]
+	if len(common) == 0 && len(local) == 0 {
+		return text, false
+	}
+
+	var b strings.Builder
+	filtered := false
+	word := func(w string) {
+		if f := fold(w); common[f] || local[f] {
+			b.WriteString(strings.Repeat("*", utf8.RuneCountInString(w)))
+			filtered = true
+			return
+		}
+		b.WriteString(w)
+	}
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			word(text[start:i])
+			start = -1
+		}
+		if !inWord {
+			b.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		word(text[start:])
+	}
+	return b.String(), filtered
+}
+
+var yo = strings.NewReplacer("ё", "е")
+
+func fold(s string) string {
+	return yo.Replace(strings.ToLower(s))
+}
+
+// Mutes — заглушенные игроки комнаты и сроки, до которых они не могут писать.
+type Mutes struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func NewMutes() *Mutes {
+	return &Mutes{until: make(map[string]time.Time)}
+}
+
+// Set заглушает игрока на d; нулевая длительность снимает заглушение.
+func (m *Mutes) Set(uid string, d time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d <= 0 {
+		delete(m.until, uid)
+		return
+	}
+	m.until[uid] = now.Add(d)
+}
+
+// Until возвращает срок заглушения, если он еще не истек.
+func (m *Mutes) Until(uid string, now time.Time) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.until[uid]
+	if ok && !now.Before(t) {
+		delete(m.until, uid)
+		return time.Time{}, false
+	}
+	return t, ok
+}
@@ -0,0 +1,75 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Длина, частота и фильтр слов
+func TestModeratorCheck(t *testing.T) {
+	m := New(&Policy{MaxLength: 12, Rate: 1, Burst: 2, Words: map[string][]string{
+		AnyLanguage: {"spam"},
+		"ru":        {"ёлка"},
+	}})
+	now := time.Now()
+
+	_, _, err := m.Check("u1", "ru", "   ", now)
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, _, err = m.Check("u1", "ru", "слишком длинное", now)
+	assert.ErrorIs(t, err, ErrTooLong)
+
+	text, filtered, err := m.Check("u1", "ru", "Елка, SPAM!", now)
+	require.NoError(t, err)
+	assert.True(t, filtered)
+	assert.Equal(t, "****, ****!", text, "слова сравниваются без регистра и с ё = е")
+
+	text, filtered, err = m.Check("u1", "en", "ёлка spammy", now)
+	require.NoError(t, err)
+	assert.False(t, filtered, "русский список не действует в других языках, части слов не трогаются")
+	assert.Equal(t, "ёлка spammy", text)
+
+	_, _, err = m.Check("u1", "ru", "привет", now)
+	assert.ErrorIs(t, err, ErrRateLimited, "запас из двух сообщений исчерпан")
+	_, _, err = m.Check("u2", "ru", "привет", now)
+	assert.NoError(t, err, "лимит у каждого игрока свой")
+	_, _, err = m.Check("u1", "ru", "привет", now.Add(time.Second))
+	assert.NoError(t, err, "лимит восстанавливается со временем")
+}
+
+// Заглушение с истечением срока
+func TestMutes(t *testing.T) {
+	m := NewMutes()
+	now := time.Now()
+	m.Set("u1", time.Minute, now)
+
+	until, ok := m.Until("u1", now.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), until)
+	_, ok = m.Until("u1", now.Add(time.Minute))
+	assert.False(t, ok, "срок истек")
+
+	m.Set("u2", time.Hour, now)
+	m.Set("u2", 0, now)
+	_, ok = m.Until("u2", now)
+	assert.False(t, ok, "нулевая длительность снимает заглушение")
+}
+
+// Политика из файла дополняет значения по умолчанию
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"max_length": 120, "words": {"en": ["darn"]}}`), 0o644))
+
+	p, err := LoadPolicy(path)
+	require.NoError(t, err)
+	assert.Equal(t, 120, p.MaxLength)
+	assert.Equal(t, DefaultPolicy().Burst, p.Burst)
+	assert.Equal(t, []string{"darn"}, p.Words["en"])
+
+	_, err = LoadPolicy(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
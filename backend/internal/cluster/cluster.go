@@ -0,0 +1,100 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrNotFound = errors.New("комната не найдена")
+
+// Directory хранит, какой узел владеет комнатой.
+type Directory interface {
+	Register(ctx context.Context, roomID, nodeID string) error
+	Unregister(ctx context.Context, roomID, nodeID string) error
+	Lookup(ctx context.Context, roomID string) (string, error)
+	// Claim закрепляет ключ за узлом nodeID, если у ключа нет живого владельца,
+	// и возвращает владельца. Из нескольких узлов, претендующих одновременно, ключ получит один.
+	Claim(ctx context.Context, key, nodeID string) (string, error)
+	// Nodes возвращает узлы, которые сейчас живы.
+	Nodes(ctx context.Context) ([]string, error)
+}
+
+// SubscriptionBuffer — сколько сообщений может ждать обработчика подписки.
+const SubscriptionBuffer = 256
+
+// Bus доставляет сообщения между узлами по темам.
+// Обработчики одной подписки вызываются последовательно в порядке публикации.
+// Доставка не ждет медленного обработчика: если у подписки уже SubscriptionBuffer
+// необработанных сообщений, новые для нее отбрасываются.
+type Bus interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+	Subscribe(topic string, fn func([]byte)) (cancel func())
+}
+
+type subscription struct {
+	ch   chan []byte
+	done chan struct{}
+}
+
+// hub раздает входящие сообщения локальным подписчикам.
+type hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*subscription]struct{}
+}
+
+func (h *hub) Subscribe(topic string, fn func([]byte)) func() {
+	s := &subscription{ch: make(chan []byte, SubscriptionBuffer), done: make(chan struct{})}
+
+	h.mu.Lock()
+	if h.subs == nil {
+		h.subs = make(map[string]map[*subscription]struct{})
+	}
+	if h.subs[topic] == nil {
+		h.subs[topic] = make(map[*subscription]struct{})
+	}
+	h.subs[topic][s] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case b := <-s.ch:
+				fn(b)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[topic], s)
+			if len(h.subs[topic]) == 0 {
+				delete(h.subs, topic)
+			}
+			h.mu.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+// deliver раздает сообщение подписчикам темы, не дожидаясь их: один медленный
+// обработчик не должен задерживать остальные темы и чтение LISTEN.
+func (h *hub) deliver(topic string, data []byte) {
+	h.mu.RLock()
+	list := make([]*subscription, 0, len(h.subs[topic]))
+	for s := range h.subs[topic] {
+		list = append(list, s)
+	}
+	h.mu.RUnlock()
+
+	for _, s := range list {
+		select {
+		case s.ch <- data:
+		default:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Каталог в памяти
+func TestMemoryDirectory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	assert.NoError(t, m.Register(ctx, "room1", "node_a"))
+	node, err := m.Lookup(ctx, "room1")
+	assert.NoError(t, err)
+	assert.Equal(t, "node_a", node)
+
+	assert.NoError(t, m.Unregister(ctx, "room1", "node_b"))
+	_, err = m.Lookup(ctx, "room1")
+	assert.NoError(t, err, "чужой узел не может снять регистрацию")
+
+	assert.NoError(t, m.Unregister(ctx, "room1", "node_a"))
+	_, err = m.Lookup(ctx, "room1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+// Ключ получает первый претендент
+func TestMemoryClaim(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	node, err := m.Claim(ctx, "queue:ru", "node_a")
+	assert.NoError(t, err)
+	assert.Equal(t, "node_a", node)
+	node, err = m.Claim(ctx, "queue:ru", "node_b")
+	assert.NoError(t, err)
+	assert.Equal(t, "node_a", node, "ключ остается за первым узлом")
+
+	assert.NoError(t, m.Unregister(ctx, "queue:ru", "node_a"))
+	node, _ = m.Claim(ctx, "queue:ru", "node_b")
+	assert.Equal(t, "node_b", node, "освобожденный ключ переходит к следующему")
+}
+
+// Медленный подписчик не задерживает публикацию и другие темы
+func TestMemoryBusSlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	m.Subscribe("slow", func([]byte) { <-stuck })
+	got := make(chan string, 1)
+	m.Subscribe("fast", func(b []byte) { got <- string(b) })
+
+	published := make(chan struct{})
+	go func() {
+		for range SubscriptionBuffer + 10 {
+			m.Publish(ctx, "slow", []byte("x"))
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("публикация ждет медленного подписчика")
+	}
+	assert.NoError(t, m.Publish(ctx, "fast", []byte("ok")))
+	select {
+	case s := <-got:
+		assert.Equal(t, "ok", s)
+	case <-time.After(time.Second):
+		t.Fatal("сообщение другой темы не доставлено")
+	}
+}
+
+// Порядок доставки и отписка
+func TestMemoryBus(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	got := make(chan string, 10)
+	cancel := m.Subscribe("topic", func(b []byte) { got <- string(b) })
+
+	for _, s := range []string{"1", "2", "3"} {
+		assert.NoError(t, m.Publish(ctx, "topic", []byte(s)))
+	}
+	assert.NoError(t, m.Publish(ctx, "other", []byte("x")))
+
+	for _, want := range []string{"1", "2", "3"} {
+		select {
+		case s := <-got:
+			assert.Equal(t, want, s)
+		case <-time.After(time.Second):
+			t.Fatalf("сообщение %s не доставлено", want)
+		}
+	}
+
+	cancel()
+	assert.NoError(t, m.Publish(ctx, "topic", []byte("4")))
+	select {
+	case s := <-got:
+		t.Fatalf("сообщение %s доставлено после отписки", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
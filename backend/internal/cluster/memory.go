@@ -0,0 +1,74 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory — реализация каталога и шины в памяти процесса.
+// Один экземпляр можно разделить между несколькими менеджерами, чтобы запускать кластер в тестах.
+type Memory struct {
+	hub
+	mu    sync.RWMutex
+	rooms map[string]string
+}
+
+func NewMemory() *Memory {
+	return &Memory{rooms: make(map[string]string)}
+}
+
+func (m *Memory) Register(_ context.Context, roomID, nodeID string) error {
+	m.mu.Lock()
+	m.rooms[roomID] = nodeID
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Unregister(_ context.Context, roomID, nodeID string) error {
+	m.mu.Lock()
+	if m.rooms[roomID] == nodeID {
+		delete(m.rooms, roomID)
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) Lookup(_ context.Context, roomID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, ok := m.rooms[roomID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return node, nil
+}
+
+func (m *Memory) Claim(_ context.Context, key, nodeID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if node, ok := m.rooms[key]; ok {
+		return node, nil
+	}
+	m.rooms[key] = nodeID
+	return nodeID, nil
+}
+
+// Nodes возвращает узлы, за которыми закреплен хотя бы один ключ.
+func (m *Memory) Nodes(_ context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := make(map[string]struct{})
+	var nodes []string
+	for _, node := range m.rooms {
+		if _, ok := seen[node]; !ok {
+			seen[node] = struct{}{}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (m *Memory) Publish(_ context.Context, topic string, data []byte) error {
+	m.deliver(topic, data)
+	return nil
+}
@@ -0,0 +1,212 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	busChannel        = "uplink_bus"
+	maxNotifyPayload  = 7900
+	HeartbeatInterval = 10 * time.Second
+	NodeTTL           = 30 * time.Second
+	MessageTTL        = time.Minute
+)
+
+// Postgres — каталог комнат в таблице room_directory и шина поверх LISTEN/NOTIFY.
+// Все узлы слушают один канал и сами раздают сообщения локальным подписчикам.
+type Postgres struct {
+	hub
+	pool   *pgxpool.Pool
+	nodeID string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type notification struct {
+	Topic string `json:"t"`
+	Data  []byte `json:"d,omitempty"`
+	Ref   int64  `json:"r,omitempty"`
+}
+
+func NewPostgres(url, nodeID string) (*Postgres, error) {
+	cfg, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxConns = 4
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Postgres{pool: pool, nodeID: nodeID, cancel: cancel, done: make(chan struct{})}
+	if err := p.heartbeat(ctx); err != nil {
+		cancel()
+		pool.Close()
+		return nil, err
+	}
+
+	ready := make(chan error, 1)
+	go p.listen(ctx, ready)
+	if err := <-ready; err != nil {
+		cancel()
+		<-p.done
+		pool.Close()
+		return nil, fmt.Errorf("подписка на %s: %w", busChannel, err)
+	}
+	go p.keepAlive(ctx)
+	return p, nil
+}
+
+// Close снимает регистрацию узла и его комнат.
+func (p *Postgres) Close() {
+	p.cancel()
+	<-p.done
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = p.pool.Exec(ctx, `DELETE FROM room_directory WHERE node_id = $1`, p.nodeID)
+	_, _ = p.pool.Exec(ctx, `DELETE FROM cluster_nodes WHERE node_id = $1`, p.nodeID)
+	p.pool.Close()
+}
+
+func (p *Postgres) Register(ctx context.Context, roomID, nodeID string) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO room_directory (room_id, node_id) VALUES ($1, $2)
+		ON CONFLICT (room_id) DO UPDATE SET node_id = EXCLUDED.node_id, updated_at = NOW()`,
+		roomID, nodeID)
+	return err
+}
+
+func (p *Postgres) Unregister(ctx context.Context, roomID, nodeID string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM room_directory WHERE room_id = $1 AND node_id = $2`, roomID, nodeID)
+	return err
+}
+
+// Claim перехватывает ключ и у узла, переставшего отмечаться.
+func (p *Postgres) Claim(ctx context.Context, key, nodeID string) (string, error) {
+	var node string
+	err := p.pool.QueryRow(ctx, `
+		INSERT INTO room_directory (room_id, node_id) VALUES ($1, $2)
+		ON CONFLICT (room_id) DO UPDATE SET node_id = EXCLUDED.node_id, updated_at = NOW()
+		WHERE NOT EXISTS (SELECT 1 FROM cluster_nodes n
+			WHERE n.node_id = room_directory.node_id AND n.seen_at > NOW() - make_interval(secs => $3))
+		RETURNING node_id`, key, nodeID, NodeTTL.Seconds()).Scan(&node)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Ключ за живым узлом: строку вставки условие не пропустило.
+		return p.Lookup(ctx, key)
+	}
+	return node, err
+}
+
+// Lookup находит узел-владельца; комнаты узлов, переставших отмечаться, не возвращаются.
+func (p *Postgres) Lookup(ctx context.Context, roomID string) (string, error) {
+	var node string
+	err := p.pool.QueryRow(ctx, `
+		SELECT d.node_id FROM room_directory d
+		JOIN cluster_nodes n ON n.node_id = d.node_id
+		WHERE d.room_id = $1 AND n.seen_at > NOW() - make_interval(secs => $2)`,
+		roomID, NodeTTL.Seconds()).Scan(&node)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return node, err
+}
+
+// Nodes возвращает узлы, отмечавшиеся за последние NodeTTL.
+func (p *Postgres) Nodes(ctx context.Context) ([]string, error) {
+	rows, err := p.pool.Query(ctx, `SELECT node_id FROM cluster_nodes WHERE seen_at > NOW() - make_interval(secs => $1)`, NodeTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (p *Postgres) Publish(ctx context.Context, topic string, data []byte) error {
+	payload, err := json.Marshal(notification{Topic: topic, Data: data})
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		var id int64
+		err := p.pool.QueryRow(ctx, `INSERT INTO cluster_messages (topic, data) VALUES ($1, $2) RETURNING id`, topic, data).Scan(&id)
+		if err != nil {
+			return err
+		}
+		payload, _ = json.Marshal(notification{Topic: topic, Ref: id})
+	}
+	_, err = p.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, busChannel, string(payload))
+	return err
+}
+
+// listen слушает канал шины и переподключается при обрыве. Результат первой
+// подписки уходит в ready: узел, не получающий сообщений шины, запускать нельзя.
+func (p *Postgres) listen(ctx context.Context, ready chan<- error) {
+	defer close(p.done)
+	for ctx.Err() == nil {
+		conn, err := p.pool.Acquire(ctx)
+		if err == nil {
+			_, err = conn.Exec(ctx, "LISTEN "+busChannel)
+		}
+		if ready != nil {
+			ready <- err
+			ready = nil
+		}
+		for err == nil {
+			n, werr := conn.Conn().WaitForNotification(ctx)
+			if err = werr; err == nil {
+				p.dispatch(ctx, n.Payload)
+			}
+		}
+		if conn != nil {
+			// Соединение с оборванным LISTEN не возвращаем в пул.
+			_ = conn.Conn().Close(context.Background())
+			conn.Release()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (p *Postgres) dispatch(ctx context.Context, payload string) {
+	var n notification
+	if json.Unmarshal([]byte(payload), &n) != nil {
+		return
+	}
+	if n.Ref != 0 {
+		if err := p.pool.QueryRow(ctx, `SELECT data FROM cluster_messages WHERE id = $1`, n.Ref).Scan(&n.Data); err != nil {
+			return
+		}
+	}
+	p.deliver(n.Topic, n.Data)
+}
+
+func (p *Postgres) heartbeat(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO cluster_nodes (node_id) VALUES ($1)
+		ON CONFLICT (node_id) DO UPDATE SET seen_at = NOW()`, p.nodeID)
+	return err
+}
+
+func (p *Postgres) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = p.heartbeat(ctx)
+			_, _ = p.pool.Exec(ctx, `DELETE FROM cluster_messages WHERE created_at < NOW() - make_interval(secs => $1)`, MessageTTL.Seconds())
+		}
+	}
+}
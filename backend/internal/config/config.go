@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,16 +13,91 @@ type Config struct {
 	JWTSecret      string
 	DBMaxConns     int32
 	AllowedOrigins []string
+	TextRulesPath  string
+	// ChatPolicyPath — JSON с ограничениями чата и запрещенными словами по языкам.
+	ChatPolicyPath string
+	ClusterMode    string
+	NodeID         string
+	// ShutdownTimeout — сколько сервер ждет завершения идущих заездов при остановке.
+	ShutdownTimeout time.Duration
+	// ChatPersist включает сохранение чата комнат в базе.
+	ChatPersist bool
+	// OIDCProviders — внешние провайдеры входа, перечисленные в OIDC_PROVIDERS.
+	OIDCProviders []OIDCProvider
+	// PublicURL — адрес сайта для ссылок в письмах. Из заголовка Host его брать нельзя:
+	// подменив Host, чужую ссылку сброса пароля можно увести на свой сайт.
+	PublicURL string
+	// MetricsToken — bearer-токен для GET /metrics. Пустой токен отключает эндпоинт.
+	MetricsToken string
+	Mail         Mail
+}
+
+// Mail — отправка писем. Transport: file (файлы .eml в Dir), smtp или log (в журнал,
+// только для разработки). Пустой Transport отключает письма и все, что на них держится.
+type Mail struct {
+	Transport    string
+	From         string
+	Dir          string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// OIDCProvider — провайдер OpenID Connect. Для провайдера name настройки читаются
+// из OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET
+// и OIDC_<NAME>_REDIRECT_URL.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
 }
 
 func Load() *Config {
 	return &Config{
-		Port:           getEnv("PORT", ":8080"),
-		DatabaseURL:    getEnv("DATABASE_URL", "postgres://user:pass@db:5432/uplink?sslmode=disable"),
-		JWTSecret:      getEnv("JWT_SECRET", "secret"),
-		DBMaxConns:     getEnvInt("DB_MAX_CONNS", 25),
-		AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "*"), ","),
+		Port:            getEnv("PORT", ":8080"),
+		DatabaseURL:     getEnv("DATABASE_URL", "postgres://user:pass@db:5432/uplink?sslmode=disable"),
+		JWTSecret:       getEnv("JWT_SECRET", "secret"),
+		DBMaxConns:      getEnvInt("DB_MAX_CONNS", 25),
+		AllowedOrigins:  strings.Split(getEnv("ALLOWED_ORIGINS", "*"), ","),
+		TextRulesPath:   getEnv("TEXT_RULES_PATH", ""),
+		ChatPolicyPath:  getEnv("CHAT_POLICY_PATH", ""),
+		ClusterMode:     getEnv("CLUSTER_MODE", "memory"),
+		NodeID:          getEnv("NODE_ID", hostname()),
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ChatPersist:     getEnvBool("CHAT_PERSIST", false),
+		OIDCProviders:   oidcProviders(getEnv("OIDC_PROVIDERS", "")),
+		PublicURL:       strings.TrimSuffix(getEnv("PUBLIC_URL", "http://localhost:8080"), "/"),
+		MetricsToken:    getEnv("METRICS_TOKEN", ""),
+		Mail: Mail{
+			Transport:    getEnv("MAIL_TRANSPORT", ""),
+			From:         getEnv("MAIL_FROM", "Uplink <noreply@localhost>"),
+			Dir:          getEnv("MAIL_DIR", "./mail"),
+			SMTPAddr:     getEnv("SMTP_ADDR", ""),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		},
+	}
+}
+
+func oidcProviders(names string) []OIDCProvider {
+	var list []OIDCProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		list = append(list, OIDCProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+		})
 	}
+	return list
 }
 
 func getEnv(key, def string) string {
@@ -31,6 +107,32 @@ func getEnv(key, def string) string {
 	return def
 }
 
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "node"
+	}
+	return h
+}
+
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return def
+}
+
+func getEnvBool(key string, def bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
 func getEnvInt(key string, def int) int32 {
 	if v := os.Getenv(key); v != "" {
 		if i, err := strconv.Atoi(v); err == nil {
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// DeletedUsername подставляется вместо имени удаленного игрока в чате и журнале.
+const DeletedUsername = "[удален]"
+
+var (
+	ErrUsernameTaken  = errors.New("имя уже занято")
+	ErrRenameCooldown = errors.New("имя можно менять не чаще раза в 30 дней")
+)
+
+// RenameUser меняет имя игрока, если с прошлой смены прошло не меньше cooldown.
+// При отказе по сроку возвращает время, с которого смена снова доступна.
+func (d *DB) RenameUser(ctx context.Context, uid, name string, cooldown time.Duration) (time.Time, error) {
+	var next time.Time
+	err := pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		var changed *time.Time
+		if err := tx.QueryRow(ctx, `SELECT username_changed_at FROM users WHERE id = $1 FOR UPDATE`, uid).Scan(&changed); err != nil {
+			return err
+		}
+		if changed != nil && time.Since(*changed) < cooldown {
+			next = changed.Add(cooldown)
+			return ErrRenameCooldown
+		}
+		_, err := tx.Exec(ctx, `UPDATE users SET username = $2, username_changed_at = NOW() WHERE id = $1`, uid, name)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrUsernameTaken
+		}
+		return err
+	})
+	return next, err
+}
+
+// DeleteUser удаляет игрока. Его результаты остаются в матчах без ссылки на аккаунт,
+// сообщения в чате — без имени; друзья, уведомления и сессии удаляются вместе с ним.
+func (d *DB) DeleteUser(ctx context.Context, uid string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `UPDATE chat_messages SET sender_id = '', sender_name = $2 WHERE sender_id = $1`, uid, DeletedUsername); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE chat_reports SET sender_id = '', sender_name = $2 WHERE sender_id = $1`, uid, DeletedUsername); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, uid)
+		if err == nil && tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return err
+	})
+}
+
+// Export — все данные игрока для выгрузки по его запросу.
+type Export struct {
+	ExportedAt    time.Time       `json:"exported_at"`
+	Profile       ExportProfile   `json:"profile"`
+	Matches       []ExportMatch   `json:"matches"`
+	Moderation    []ExportAction  `json:"moderation"`
+	Chat          []ChatMessage   `json:"chat"`
+	Reports       []ExportReport  `json:"reports"`
+	Friends       []Friend        `json:"friends"`
+	Notifications []Notification  `json:"notifications"`
+	Sessions      []ExportSession `json:"sessions"`
+	Identities    []Identity      `json:"identities"`
+}
+
+type ExportProfile struct {
+	ID                string     `json:"id"`
+	Username          string     `json:"username"`
+	Rating            int        `json:"rating"`
+	AvgWpm            float64    `json:"avg_wpm"`
+	Role              string     `json:"role"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UsernameChangedAt *time.Time `json:"username_changed_at,omitempty"`
+	BannedAt          *time.Time `json:"banned_at,omitempty"`
+	BanReason         string     `json:"ban_reason,omitempty"`
+	TwoFactorSince    *time.Time `json:"two_factor_since,omitempty"`
+	Email             string     `json:"email,omitempty"`
+}
+
+type ExportMatch struct {
+	MatchID   string     `json:"match_id"`
+	EndedAt   *time.Time `json:"ended_at"`
+	TextID    *int       `json:"text_id"`
+	WPM       int        `json:"wpm"`
+	Accuracy  float64    `json:"accuracy"`
+	Rank      int        `json:"rank"`
+	LatencyMs int        `json:"latency_ms"`
+}
+
+// ExportAction — действие модератора над игроком, в том числе изменения рейтинга;
+// кто из модераторов его выполнил, в выгрузку не попадает.
+type ExportAction struct {
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type ExportReport struct {
+	RoomID    string    `json:"room_id"`
+	MessageID string    `json:"message_id"`
+	Text      string    `json:"text"`
+	Reason    string    `json:"reason"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportSession struct {
+	UserAgent string     `json:"user_agent"`
+	IP        string     `json:"ip"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ExportUser собирает данные игрока. Выгрузка читается в одной транзакции, чтобы разделы
+// не расходились между собой.
+func (d *DB) ExportUser(ctx context.Context, uid string) (*Export, error) {
+	e := &Export{ExportedAt: time.Now()}
+	err := pgx.BeginTxFunc(ctx, d.pool, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		p := &e.Profile
+		if err := tx.QueryRow(ctx, `SELECT id, username, rating, avg_wpm, role, created_at, username_changed_at, banned_at, ban_reason, totp_enabled_at, COALESCE(email, '')
+			FROM users WHERE id = $1`, uid).Scan(&p.ID, &p.Username, &p.Rating, &p.AvgWpm, &p.Role, &p.CreatedAt,
+			&p.UsernameChangedAt, &p.BannedAt, &p.BanReason, &p.TwoFactorSince, &p.Email); err != nil {
+			return err
+		}
+
+		var err error
+		e.Matches, err = collect(ctx, tx, `SELECT m.id, m.ended_at, m.text_id, mr.wpm, mr.accuracy::float8, mr.rank, mr.latency_ms
+			FROM match_results mr JOIN matches m ON m.id = mr.match_id
+			WHERE mr.user_id = $1 ORDER BY m.ended_at`, uid, func(r pgx.Rows, m *ExportMatch) error {
+			return r.Scan(&m.MatchID, &m.EndedAt, &m.TextID, &m.WPM, &m.Accuracy, &m.Rank, &m.LatencyMs)
+		})
+		if err != nil {
+			return err
+		}
+		e.Moderation, err = collect(ctx, tx, `SELECT action, details, created_at FROM admin_actions
+			WHERE target = $1 ORDER BY id`, uid, func(r pgx.Rows, a *ExportAction) error {
+			return r.Scan(&a.Action, &a.Details, &a.CreatedAt)
+		})
+		if err != nil {
+			return err
+		}
+		e.Chat, err = collect(ctx, tx, `SELECT id, room_id, match_id::text, message_id, sender_id, sender_name, text, action, created_at
+			FROM chat_messages WHERE sender_id = $1 ORDER BY id`, uid, func(r pgx.Rows, m *ChatMessage) error {
+			return r.Scan(&m.ID, &m.RoomID, &m.MatchID, &m.MessageID, &m.SenderID, &m.SenderName, &m.Text, &m.Action, &m.CreatedAt)
+		})
+		if err != nil {
+			return err
+		}
+		e.Reports, err = collect(ctx, tx, `SELECT room_id, message_id, text, reason, status, created_at
+			FROM chat_reports WHERE reporter_id = $1 ORDER BY id`, uid, func(r pgx.Rows, c *ExportReport) error {
+			return r.Scan(&c.RoomID, &c.MessageID, &c.Text, &c.Reason, &c.Status, &c.CreatedAt)
+		})
+		if err != nil {
+			return err
+		}
+		e.Friends, err = collect(ctx, tx, friendsQuery, uid, func(r pgx.Rows, f *Friend) error {
+			return r.Scan(&f.ID, &f.Username, &f.Rating, &f.Status)
+		})
+		if err != nil {
+			return err
+		}
+		e.Notifications, err = collect(ctx, tx, `SELECT id, kind, data, created_at, read_at
+			FROM notifications WHERE user_id = $1 ORDER BY id`, uid, func(r pgx.Rows, n *Notification) error {
+			return r.Scan(&n.ID, &n.Kind, &n.Data, &n.CreatedAt, &n.ReadAt)
+		})
+		if err != nil {
+			return err
+		}
+		e.Sessions, err = collect(ctx, tx, `SELECT user_agent, ip, created_at, expires_at, revoked_at
+			FROM sessions WHERE user_id = $1 ORDER BY created_at`, uid, func(r pgx.Rows, s *ExportSession) error {
+			return r.Scan(&s.UserAgent, &s.IP, &s.CreatedAt, &s.ExpiresAt, &s.RevokedAt)
+		})
+		if err != nil {
+			return err
+		}
+		e.Identities, err = collect(ctx, tx, identitiesQuery, uid, func(r pgx.Rows, i *Identity) error {
+			return r.Scan(&i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// collect читает строки запроса с одним параметром в срез; пустой результат — пустой срез, а не nil.
+func collect[T any](ctx context.Context, tx pgx.Tx, query, arg string, scan func(pgx.Rows, *T) error) ([]T, error) {
+	rows, err := tx.Query(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]T, 0)
+	for rows.Next() {
+		var v T
+		if err := scan(rows, &v); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
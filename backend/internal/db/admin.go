@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type AdminAction struct {
+	ID        int64           `json:"id"`
+	AdminID   string          `json:"admin_id"`
+	Admin     string          `json:"admin"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// SetBanned блокирует или разблокирует аккаунт; для неизвестного id возвращает pgx.ErrNoRows.
+// role — роль того, кто блокирует; при разблокировке не используется.
+func (d *DB) SetBanned(ctx context.Context, uid string, banned bool, reason, role string) error {
+	q := "UPDATE users SET banned_at = NULL, ban_reason = '', ban_role = NULL WHERE id = $1"
+	args := []any{uid}
+	if banned {
+		q, args = "UPDATE users SET banned_at = NOW(), ban_reason = $2, ban_role = $3 WHERE id = $1", []any{uid, reason, role}
+	}
+	tag, err := d.pool.Exec(ctx, q, args...)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+// BanRole возвращает роль того, кто заблокировал аккаунт; пустая строка — аккаунт не
+// заблокирован или заблокирован до появления этой записи.
+func (d *DB) BanRole(ctx context.Context, uid string) (string, error) {
+	var role string
+	err := d.pool.QueryRow(ctx, "SELECT COALESCE(ban_role, '') FROM users WHERE id = $1", uid).Scan(&role)
+	return role, err
+}
+
+// AdjustRating меняет рейтинг на delta и возвращает новое значение.
+func (d *DB) AdjustRating(ctx context.Context, uid string, delta int) (int, error) {
+	var rating int
+	err := d.pool.QueryRow(ctx, "UPDATE users SET rating = rating + $1 WHERE id = $2 RETURNING rating", delta, uid).Scan(&rating)
+	return rating, err
+}
+
+// LogAdminAction записывает действие администратора в журнал.
+func (d *DB) LogAdminAction(ctx context.Context, adminID, action, target string, details any) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = d.pool.Exec(ctx, "INSERT INTO admin_actions (admin_id, action, target, details) VALUES ($1, $2, $3, $4)", adminID, action, target, b)
+	return err
+}
+
+// GetAdminActions возвращает последние записи журнала.
+func (d *DB) GetAdminActions(ctx context.Context, limit int) ([]AdminAction, error) {
+	rows, err := d.pool.Query(ctx, `SELECT a.id, COALESCE(a.admin_id::text, ''),
+			CASE WHEN a.by_system THEN $3 ELSE COALESCE(u.username, $2) END, a.action, a.target, a.details, a.created_at
+		FROM admin_actions a LEFT JOIN users u ON u.id = a.admin_id
+		ORDER BY a.created_at DESC LIMIT $1`, limit, DeletedUsername, SystemActor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []AdminAction
+	for rows.Next() {
+		var a AdminAction
+		if err := rows.Scan(&a.ID, &a.AdminID, &a.Admin, &a.Action, &a.Target, &a.Details, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// ChatReport — жалоба на сообщение чата вместе со снимком соседних сообщений.
+type ChatReport struct {
+	ID         int64           `json:"id"`
+	ReporterID string          `json:"reporter_id"`
+	Reporter   string          `json:"reporter"`
+	RoomID     string          `json:"room_id"`
+	MessageID  string          `json:"message_id"`
+	SenderID   string          `json:"sender_id"`
+	SenderName string          `json:"sender_name"`
+	Text       string          `json:"text"`
+	Reason     string          `json:"reason"`
+	Context    json.RawMessage `json:"context"`
+	Status     string          `json:"status"`
+	Resolution string          `json:"resolution"`
+	ResolvedBy *string         `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// CreateChatReport сохраняет жалобу и возвращает ее id. Повторная жалоба того же
+// игрока на то же сообщение не сохраняется, тогда возвращается pgx.ErrNoRows.
+func (d *DB) CreateChatReport(ctx context.Context, r *ChatReport) (int64, error) {
+	var id int64
+	err := d.pool.QueryRow(ctx, `INSERT INTO chat_reports (reporter_id, room_id, message_id, sender_id, sender_name, text, reason, context)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING RETURNING id`,
+		r.ReporterID, r.RoomID, r.MessageID, r.SenderID, r.SenderName, r.Text, r.Reason, r.Context).Scan(&id)
+	return id, err
+}
+
+// ListChatReports возвращает последние жалобы с указанным статусом; пустой статус — все.
+func (d *DB) ListChatReports(ctx context.Context, status string, limit int) ([]ChatReport, error) {
+	rows, err := d.pool.Query(ctx, `SELECT r.id, r.reporter_id, u.username, r.room_id, r.message_id, r.sender_id, r.sender_name,
+			r.text, r.reason, r.context, r.status, r.resolution, r.resolved_by::text, r.resolved_at, r.created_at
+		FROM chat_reports r JOIN users u ON u.id = r.reporter_id
+		WHERE $1 = '' OR r.status = $1
+		ORDER BY r.created_at DESC LIMIT $2`, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]ChatReport, 0)
+	for rows.Next() {
+		var r ChatReport
+		if err := rows.Scan(&r.ID, &r.ReporterID, &r.Reporter, &r.RoomID, &r.MessageID, &r.SenderID, &r.SenderName,
+			&r.Text, &r.Reason, &r.Context, &r.Status, &r.Resolution, &r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// ResolveChatReport закрывает открытую жалобу; для неизвестной или уже закрытой возвращает pgx.ErrNoRows.
+func (d *DB) ResolveChatReport(ctx context.Context, id int64, moderatorID, status, resolution string) error {
+	tag, err := d.pool.Exec(ctx, `UPDATE chat_reports SET status = $3, resolution = $4, resolved_by = $2, resolved_at = NOW()
+		WHERE id = $1 AND status = 'open'`, id, moderatorID, status, resolution)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+// ChatMessage — сохраненное сообщение чата комнаты.
+type ChatMessage struct {
+	ID         int64     `json:"id"`
+	RoomID     string    `json:"room_id"`
+	MatchID    *string   `json:"match_id,omitempty"`
+	MessageID  string    `json:"message_id"`
+	SenderID   string    `json:"sender_id"`
+	SenderName string    `json:"sender_name"`
+	Text       string    `json:"text"`
+	Action     bool      `json:"action"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (d *DB) SaveChatMessage(ctx context.Context, m *ChatMessage) error {
+	_, err := d.pool.Exec(ctx, `INSERT INTO chat_messages (room_id, message_id, sender_id, sender_name, text, action, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, m.RoomID, m.MessageID, m.SenderID, m.SenderName, m.Text, m.Action, m.CreatedAt)
+	return err
+}
+
+// AttachChat относит к матчу сообщения комнаты, написанные с since и еще не привязанные
+// к предыдущему заезду той же комнаты.
+func (d *DB) AttachChat(ctx context.Context, roomID, matchID string, since time.Time) error {
+	_, err := d.pool.Exec(ctx, "UPDATE chat_messages SET match_id = $2 WHERE room_id = $1 AND match_id IS NULL AND created_at >= $3",
+		roomID, matchID, since)
+	return err
+}
+
+// GetRoomChat возвращает страницу чата комнаты с since, от новых к старым.
+// Курсор — id последнего сообщения предыдущей страницы.
+func (d *DB) GetRoomChat(ctx context.Context, roomID string, since time.Time, limit int, cursor string) ([]ChatMessage, string, error) {
+	return d.chatPage(ctx, "room_id = $1 AND created_at >= $2", []any{roomID, since}, limit, cursor)
+}
+
+// GetMatchChat возвращает страницу чата, привязанного к матчу, от новых к старым.
+func (d *DB) GetMatchChat(ctx context.Context, matchID string, limit int, cursor string) ([]ChatMessage, string, error) {
+	return d.chatPage(ctx, "match_id = $1", []any{matchID}, limit, cursor)
+}
+
+func (d *DB) chatPage(ctx context.Context, where string, args []any, limit int, cursor string) ([]ChatMessage, string, error) {
+	query := `SELECT id, room_id, match_id::text, message_id, sender_id, sender_name, text, action, created_at
+		FROM chat_messages WHERE ` + where
+	if id, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+		args = append(args, id)
+		query += " AND id < $" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	list := make([]ChatMessage, 0, limit)
+	for rows.Next() {
+		var m ChatMessage
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.MatchID, &m.MessageID, &m.SenderID, &m.SenderName, &m.Text, &m.Action, &m.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		list = append(list, m)
+	}
+	var next string
+	if len(list) == limit {
+		next = strconv.FormatInt(list[len(list)-1].ID, 10)
+	}
+	return list, next, rows.Err()
+}
+
+// InMatch сообщает, участвовал ли игрок в матче.
+func (d *DB) InMatch(ctx context.Context, matchID, uid string) (bool, error) {
+	var ok bool
+	err := d.pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM match_results WHERE match_id = $1 AND user_id = $2)", matchID, uid).Scan(&ok)
+	return ok, err
+}
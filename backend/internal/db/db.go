@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 	"time"
+	"uplink/backend/internal/text"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -19,18 +20,60 @@ type User struct {
 	PasswordHash string  `json:"-"`
 	Rating       int     `json:"rating"`
 	AvgWpm       float64 `json:"avg_wpm"`
+	Role         string  `json:"role"`
+	Banned       bool    `json:"banned"`
+	TwoFactor    bool    `json:"two_factor"`
+	Email        string  `json:"email"`
 }
 
+const userColumns = "id, username, password_hash, rating, avg_wpm, role, banned_at IS NOT NULL AS banned, totp_enabled_at IS NOT NULL AS two_factor, COALESCE(email, '') AS email"
+
 type Text struct {
-	ID      int    `db:"id"`
-	Length  int    `db:"length"`
-	Content string `db:"content"`
+	ID          int     `db:"id"`
+	Length      int     `db:"length"`
+	Content     string  `db:"content"`
+	Difficulty  float64 `db:"difficulty"`
+	Title       string  `db:"title"`
+	Author      string  `db:"author"`
+	Subcategory string  `db:"subcategory"`
+}
+
+type TextDetails struct {
+	ID           int     `json:"id" db:"id"`
+	Content      string  `json:"content" db:"content"`
+	Language     string  `json:"language" db:"language"`
+	Category     string  `json:"category" db:"category"`
+	Subcategory  string  `json:"subcategory" db:"subcategory"`
+	Length       int     `json:"length" db:"length"`
+	Difficulty   float64 `json:"difficulty" db:"difficulty"`
+	Title        string  `json:"title" db:"title"`
+	Author       string  `json:"author" db:"author"`
+	Source       string  `json:"source" db:"source"`
+	License      string  `json:"license" db:"license"`
+	TimesRaced   int     `json:"times_raced" db:"times_raced"`
+	AvgWPM       float64 `json:"avg_wpm" db:"avg_wpm"`
+	BestWPM      int     `json:"best_wpm" db:"best_wpm"`
+	RecordHolder string  `json:"record_holder" db:"record_holder"`
+}
+
+type NewText struct {
+	Content     string
+	Language    string
+	Category    string
+	Subcategory string
+	Title       string
+	Author      string
+	Source      string
+	License     string
+	Length      int
+	Difficulty  float64
 }
 
 type MatchResult struct {
 	UserID   string
 	WPM, Rank int
 	Accuracy  float64
+	Latency   int
 }
 
 func New(url string, maxConns int32) (*DB, error) {
@@ -65,7 +108,7 @@ func (d *DB) GetLeaderboard(ctx context.Context, limit int) ([]map[string]any, e
 }
 
 func (d *DB) GetUser(ctx context.Context, name string) (*User, error) {
-	rows, err := d.pool.Query(ctx, "SELECT id, username, password_hash, rating, avg_wpm FROM users WHERE username=$1", name)
+	rows, err := d.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE username=$1", name)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +140,7 @@ func (db *DB) RefreshUserStats(ctx context.Context, userID string) error {
 }
 
 func (d *DB) GetUserByID(ctx context.Context, id string) (*User, error) {
-	rows, err := d.pool.Query(ctx, "SELECT id, username, password_hash, rating, avg_wpm FROM users WHERE id=$1", id)
+	rows, err := d.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE id=$1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -108,10 +151,33 @@ func (d *DB) GetUserByID(ctx context.Context, id string) (*User, error) {
 	return &u, nil
 }
 func (d *DB) GetText(ctx context.Context, lang, cat string, id int) (*Text, error) {
-	q, args := "SELECT id, content, length FROM texts WHERE id=$1", []any{id}
+	q, args := "SELECT id, content, length, difficulty, title, author, subcategory FROM texts WHERE id=$1", []any{id}
 	if id == 0 {
-		q, args = "SELECT id, content, length FROM texts WHERE language=$1 AND category=$2 ORDER BY RANDOM() LIMIT 1", []any{lang, cat}
+		q, args = "SELECT id, content, length, difficulty, title, author, subcategory FROM texts WHERE language=$1 AND category=$2 ORDER BY RANDOM() LIMIT 1", []any{lang, cat}
 	}
+	return d.queryText(ctx, q, args...)
+}
+
+// GetTextInRange выбирает случайный текст с учетом диапазона сложности.
+// Если в диапазоне ничего нет, берется ближайший к нему по сложности текст.
+// Пустые язык и подкатегория означают любое значение.
+func (d *DB) GetTextInRange(ctx context.Context, lang, cat, sub string, minD, maxD float64) (*Text, error) {
+	q := `SELECT id, content, length, difficulty, title, author, subcategory FROM texts
+		WHERE ($1 = '' OR language = $1) AND category = $2 AND ($3 = '' OR subcategory = $3)
+		ORDER BY GREATEST($4 - difficulty, difficulty - $5, 0), RANDOM()
+		LIMIT 1`
+	return d.queryText(ctx, q, lang, cat, sub, minD, maxD)
+}
+
+func (d *DB) GetSubcategories(ctx context.Context, cat string) ([]string, error) {
+	rows, err := d.pool.Query(ctx, "SELECT DISTINCT subcategory FROM texts WHERE category = $1 AND subcategory <> '' ORDER BY subcategory", cat)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func (d *DB) queryText(ctx context.Context, q string, args ...any) (*Text, error) {
 	rows, err := d.pool.Query(ctx, q, args...)
 	if err != nil {
 		return nil, err
@@ -133,26 +199,29 @@ func (d *DB) GenerateText(ctx context.Context, lang string) (*Text, error) {
 		return d.GetText(ctx, lang, "general", 0)
 	}
 	content := strings.Join(words, " ")
-	return &Text{Content: content, Length: len([]rune(content))}, nil
+	return &Text{Content: content, Length: text.Length(content), Difficulty: text.Difficulty(content, lang, text.Stats{})}, nil
 }
 
-func (d *DB) SaveMatch(ctx context.Context, textID int, res []MatchResult) error {
-	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
-		var mid string
+// SaveMatch сохраняет матч с результатами и возвращает его id.
+func (d *DB) SaveMatch(ctx context.Context, textID int, res []MatchResult) (string, error) {
+	var mid string
+	err := pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
 		if err := tx.QueryRow(ctx, "INSERT INTO matches (text_id, ended_at) VALUES ($1, NOW()) RETURNING id", textID).Scan(&mid); err != nil {
 			return err
 		}
 		b := &pgx.Batch{}
 		for _, r := range res {
-			b.Queue("INSERT INTO match_results (match_id, user_id, wpm, accuracy, rank) VALUES ($1, $2, $3, $4, $5)", mid, r.UserID, r.WPM, r.Accuracy, r.Rank)
+			b.Queue("INSERT INTO match_results (match_id, user_id, wpm, accuracy, rank, latency_ms) VALUES ($1, $2, $3, $4, $5, $6)", mid, r.UserID, r.WPM, r.Accuracy, r.Rank, r.Latency)
 		}
 		return tx.SendBatch(ctx, b).Close()
 	})
+	return mid, err
 }
 
 func (d *DB) GetHistory(ctx context.Context, uid string, limit int, cursor string) ([]map[string]any, string, error) {
 	args := []any{uid, limit}
-	query := `SELECT m.id, mr.wpm, mr.accuracy, mr.rank, m.ended_at, COALESCE(left(t.content, 50), '[удалено]') as preview 
+	query := `SELECT m.id, mr.wpm, mr.accuracy, mr.rank, mr.latency_ms, m.ended_at, COALESCE(left(t.content, 50), '[удалено]') as preview,
+        COALESCE(t.id, 0) as text_id, COALESCE(t.title, '') as title, COALESCE(t.author, '') as author
         FROM match_results mr 
         JOIN matches m ON mr.match_id = m.id 
         LEFT JOIN texts t ON m.text_id = t.id 
@@ -171,9 +240,13 @@ func (d *DB) GetHistory(ctx context.Context, uid string, limit int, cursor strin
 	type Row struct {
 		ID      string    `db:"id"`
 		Preview string    `db:"preview"`
+		TextID  int       `db:"text_id"`
+		Title   string    `db:"title"`
+		Author  string    `db:"author"`
 		WPM     int       `db:"wpm"`
 		Rank    int       `db:"rank"`
 		Accuracy float64  `db:"accuracy"`
+		Latency  int       `db:"latency_ms"`
 		EndedAt  time.Time `db:"ended_at"`
 	}
 	data, err := pgx.CollectRows(rows, pgx.RowToStructByName[Row])
@@ -184,7 +257,8 @@ func (d *DB) GetHistory(ctx context.Context, uid string, limit int, cursor strin
 	res := make([]map[string]any, len(data))
 	var next string
 	for i, r := range data {
-		res[i] = map[string]any{"match_id": r.ID, "wpm": r.WPM, "accuracy": r.Accuracy, "rank": r.Rank, "date": r.EndedAt, "text_preview": r.Preview}
+		res[i] = map[string]any{"match_id": r.ID, "wpm": r.WPM, "accuracy": r.Accuracy, "rank": r.Rank, "date": r.EndedAt, "text_preview": r.Preview,
+			"text_id": r.TextID, "text_title": r.Title, "text_author": r.Author, "latency_ms": r.Latency}
 		if i == len(data)-1 {
 			next = r.EndedAt.Format(time.RFC3339) + "," + r.ID
 		}
@@ -209,4 +283,184 @@ func (d *DB) GetCategories(ctx context.Context) ([]string, error) {
 		categories = append(categories, cat)
 	}
 	return categories, nil
-}
\ No newline at end of file
+}
+
+func (d *DB) ListTexts(ctx context.Context, lang, cat string, minD, maxD float64, limit int) ([]map[string]any, error) {
+	q := `SELECT id, language, category, subcategory, length, difficulty, title, author, left(content, 50) AS preview
+		FROM texts
+		WHERE ($1 = '' OR language = $1) AND ($2 = '' OR category = $2)
+			AND difficulty BETWEEN $3 AND $4
+		ORDER BY difficulty, id
+		LIMIT $5`
+	rows, err := d.pool.Query(ctx, q, lang, cat, minD, maxD, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToMap)
+}
+
+// RecomputeDifficulty пересчитывает сложность всех текстов с учетом истории заездов.
+func (d *DB) RecomputeDifficulty(ctx context.Context) (int, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT t.id, t.content, t.language,
+			COALESCE(AVG(mr.wpm), 0)::float8 AS avg_wpm,
+			COUNT(mr.wpm)::int AS races
+		FROM texts t
+		LEFT JOIN matches m ON m.text_id = t.id
+		LEFT JOIN match_results mr ON mr.match_id = m.id AND mr.wpm > 0
+		GROUP BY t.id`)
+	if err != nil {
+		return 0, err
+	}
+	type Row struct {
+		ID       int     `db:"id"`
+		Content  string  `db:"content"`
+		Language string  `db:"language"`
+		AvgWPM   float64 `db:"avg_wpm"`
+		Races    int     `db:"races"`
+	}
+	data, err := pgx.CollectRows(rows, pgx.RowToStructByName[Row])
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	var total int
+	for _, r := range data {
+		sum += r.AvgWPM * float64(r.Races)
+		total += r.Races
+	}
+	ref := 0.0
+	if total > 0 {
+		ref = sum / float64(total)
+	}
+
+	b := &pgx.Batch{}
+	for _, r := range data {
+		score := text.Difficulty(r.Content, r.Language, text.Stats{AvgWPM: r.AvgWPM, Races: r.Races, ReferenceWPM: ref})
+		b.Queue("UPDATE texts SET difficulty = $1, difficulty_updated_at = NOW() WHERE id = $2", score, r.ID)
+	}
+	if err := d.pool.SendBatch(ctx, b).Close(); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+// NormalizeTexts приводит сохраненные тексты к типографским правилам и пересчитывает их длину.
+func (d *DB) NormalizeTexts(ctx context.Context, rules *text.Rules) (int, error) {
+	rows, err := d.pool.Query(ctx, "SELECT id, content, language, length FROM texts")
+	if err != nil {
+		return 0, err
+	}
+	type Row struct {
+		ID       int    `db:"id"`
+		Content  string `db:"content"`
+		Language string `db:"language"`
+		Length   int    `db:"length"`
+	}
+	data, err := pgx.CollectRows(rows, pgx.RowToStructByName[Row])
+	if err != nil {
+		return 0, err
+	}
+
+	b := &pgx.Batch{}
+	for _, r := range data {
+		content := rules.Normalize(r.Content, r.Language)
+		length := text.Length(content)
+		if content != r.Content || length != r.Length {
+			b.Queue("UPDATE texts SET content = $1, length = $2 WHERE id = $3", content, length, r.ID)
+		}
+	}
+	if b.Len() == 0 {
+		return 0, nil
+	}
+	return b.Len(), d.pool.SendBatch(ctx, b).Close()
+}
+
+func (d *DB) GetTextDetails(ctx context.Context, id int) (*TextDetails, error) {
+	q := `SELECT t.id, t.content, t.language, t.category, t.subcategory, t.length, t.difficulty,
+			t.title, t.author, t.source, t.license,
+			COUNT(DISTINCT m.id)::int AS times_raced,
+			COALESCE(AVG(mr.wpm) FILTER (WHERE mr.wpm > 0), 0)::float8 AS avg_wpm,
+			COALESCE(MAX(mr.wpm), 0) AS best_wpm,
+			COALESCE((
+				SELECT u.username FROM match_results br
+				JOIN matches bm ON br.match_id = bm.id
+				JOIN users u ON br.user_id = u.id
+				WHERE bm.text_id = t.id AND br.wpm > 0
+				ORDER BY br.wpm DESC, bm.ended_at
+				LIMIT 1
+			), '') AS record_holder
+		FROM texts t
+		LEFT JOIN matches m ON m.text_id = t.id
+		LEFT JOIN match_results mr ON mr.match_id = m.id
+		WHERE t.id = $1
+		GROUP BY t.id`
+	rows, err := d.pool.Query(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	t, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[TextDetails])
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetTextLeaderboard возвращает лучший результат каждого игрока на тексте.
+func (d *DB) GetTextLeaderboard(ctx context.Context, textID, limit int) ([]map[string]any, error) {
+	q := `SELECT username, wpm, accuracy, ended_at FROM (
+			SELECT DISTINCT ON (mr.user_id) u.username, mr.wpm, mr.accuracy, m.ended_at
+			FROM match_results mr
+			JOIN matches m ON mr.match_id = m.id
+			JOIN users u ON mr.user_id = u.id
+			WHERE m.text_id = $1 AND mr.wpm > 0
+			ORDER BY mr.user_id, mr.wpm DESC, m.ended_at
+		) best
+		ORDER BY wpm DESC, ended_at
+		LIMIT $2`
+	rows, err := d.pool.Query(ctx, q, textID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToMap)
+}
+
+// TextDedupKeys возвращает ключи text.DedupKey всех текстов на языках langs:
+// по ним загрузка находит дубликаты текстов в базе.
+func (d *DB) TextDedupKeys(ctx context.Context, langs []string) (map[string]bool, error) {
+	rows, err := d.pool.Query(ctx, "SELECT content, COALESCE(category, '') FROM texts WHERE language = ANY($1)", langs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make(map[string]bool)
+	var content, category string
+	_, err = pgx.ForEachRow(rows, []any{&content, &category}, func() error {
+		res[text.DedupKey(content, category)] = true
+		return nil
+	})
+	return res, err
+}
+
+// InsertTexts добавляет тексты одной транзакцией, пропуская уже существующие.
+func (d *DB) InsertTexts(ctx context.Context, texts []NewText) (int, error) {
+	inserted := 0
+	err := pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		for _, t := range texts {
+			tag, err := tx.Exec(ctx, `
+				INSERT INTO texts (content, language, category, subcategory, length, difficulty, title, author, source, license)
+				SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+				WHERE NOT EXISTS (SELECT 1 FROM texts WHERE content = $1)`,
+				t.Content, t.Language, t.Category, t.Subcategory, t.Length, t.Difficulty, t.Title, t.Author, t.Source, t.License)
+			if err != nil {
+				return err
+			}
+			inserted += int(tag.RowsAffected())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
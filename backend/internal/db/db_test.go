@@ -109,7 +109,7 @@ func TestSaveMatchAndGetHistory(t *testing.T) {
 	results := []MatchResult{
 		{UserID: userID, WPM: 100, Accuracy: 95.5, Rank: 1},
 	}
-	err = db.SaveMatch(ctx, textID, results)
+	_, err = db.SaveMatch(ctx, textID, results)
 	if err != nil {
 		t.Fatalf("не удалось сохранить матч: %v", err)
 	}
@@ -140,3 +140,52 @@ func TestGetLeaderboard(t *testing.T) {
 		t.Log("таблица лидеров пустая")
 	}
 }
+
+// Выбор текста по сложности
+func TestGetTextInRange(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if _, err := db.RecomputeDifficulty(ctx); err != nil {
+		t.Fatalf("не удалось пересчитать сложность: %v", err)
+	}
+
+	text, err := db.GetTextInRange(ctx, "en", "general", "", 0, 30)
+	if err != nil {
+		t.Fatalf("не удалось получить текст по сложности: %v", err)
+	}
+	if len(text.Content) == 0 {
+		t.Error("текст пустой")
+	}
+
+	list, err := db.ListTexts(ctx, "en", "", 0, 100, 10)
+	if err != nil {
+		t.Fatalf("не удалось получить список текстов: %v", err)
+	}
+	if len(list) == 0 {
+		t.Log("список текстов пуст")
+	}
+}
+
+// Иерархия ролей
+func TestHasRole(t *testing.T) {
+	cases := []struct {
+		have, need string
+		want       bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleModerator, RoleModerator, true},
+		{RolePlayer, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RolePlayer, RolePlayer, true},
+		{"", RolePlayer, false},
+		{"root", RolePlayer, false},
+	}
+	for _, c := range cases {
+		if got := HasRole(c.have, c.need); got != c.want {
+			t.Errorf("HasRole(%q, %q) = %v, ожидалось %v", c.have, c.need, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	FriendAccepted = "accepted"
+	FriendIncoming = "incoming"
+	FriendOutgoing = "outgoing"
+)
+
+var ErrAlreadyFriends = errors.New("заявка уже отправлена или вы уже друзья")
+
+// Friend — друг или заявка в друзья с точки зрения текущего игрока.
+type Friend struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	Status   string `json:"status"`
+}
+
+// RequestFriend отправляет заявку. Если встречная заявка уже ждет ответа, она принимается
+// и возвращается FriendAccepted; иначе — FriendOutgoing.
+func (d *DB) RequestFriend(ctx context.Context, from, to string) (string, error) {
+	var status string
+	err := pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE friendships SET status = 'accepted', accepted_at = NOW()
+			WHERE requester_id = $2 AND addressee_id = $1 AND status = 'pending'`, from, to)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() > 0 {
+			status = FriendAccepted
+			return nil
+		}
+		tag, err = tx.Exec(ctx, `INSERT INTO friendships (requester_id, addressee_id)
+			SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM friendships WHERE requester_id = $2 AND addressee_id = $1)
+			ON CONFLICT DO NOTHING`, from, to)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrAlreadyFriends
+		}
+		status = FriendOutgoing
+		return nil
+	})
+	return status, err
+}
+
+// AcceptFriend принимает заявку от from; если заявки нет, возвращает pgx.ErrNoRows.
+func (d *DB) AcceptFriend(ctx context.Context, uid, from string) error {
+	tag, err := d.pool.Exec(ctx, `UPDATE friendships SET status = 'accepted', accepted_at = NOW()
+		WHERE requester_id = $2 AND addressee_id = $1 AND status = 'pending'`, uid, from)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+// RemoveFriend удаляет дружбу или заявку в любую сторону: отказ, отмена и удаление из друзей.
+func (d *DB) RemoveFriend(ctx context.Context, uid, other string) error {
+	tag, err := d.pool.Exec(ctx, `DELETE FROM friendships
+		WHERE (requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1)`, uid, other)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
+
+const friendsQuery = `SELECT u.id, u.username, u.rating,
+		CASE WHEN f.status = 'accepted' THEN 'accepted' WHEN f.requester_id = $1 THEN 'outgoing' ELSE 'incoming' END
+	FROM friendships f
+	JOIN users u ON u.id = CASE WHEN f.requester_id = $1 THEN f.addressee_id ELSE f.requester_id END
+	WHERE f.requester_id = $1 OR f.addressee_id = $1
+	ORDER BY f.status = 'accepted' DESC, u.username`
+
+// ListFriends возвращает друзей и заявки игрока, друзей — первыми.
+func (d *DB) ListFriends(ctx context.Context, uid string) ([]Friend, error) {
+	rows, err := d.pool.Query(ctx, friendsQuery, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := make([]Friend, 0)
+	for rows.Next() {
+		var f Friend
+		if err := rows.Scan(&f.ID, &f.Username, &f.Rating, &f.Status); err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+// AreFriends сообщает, приняли ли игроки заявку друг друга.
+func (d *DB) AreFriends(ctx context.Context, a, b string) (bool, error) {
+	var ok bool
+	err := d.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM friendships WHERE status = 'accepted'
+		AND ((requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1)))`, a, b).Scan(&ok)
+	return ok, err
+}
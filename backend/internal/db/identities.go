@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrIdentityTaken — внешняя учетная запись уже привязана к другому игроку
+	// или у игрока уже есть учетная запись этого провайдера.
+	ErrIdentityTaken = errors.New("учетная запись провайдера уже привязана")
+	// ErrLastLogin — отвязка оставила бы аккаунт без способа входа.
+	ErrLastLogin = errors.New("нельзя отвязать единственный способ входа: сначала задайте пароль")
+)
+
+// Identity — внешняя учетная запись игрока.
+type Identity struct {
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// FindIdentity возвращает игрока, к которому привязана учетная запись провайдера,
+// и отмечает вход. Непривязанная учетная запись дает pgx.ErrNoRows.
+func (d *DB) FindIdentity(ctx context.Context, provider, subject, email string) (string, error) {
+	var uid string
+	err := d.pool.QueryRow(ctx, `UPDATE user_identities SET last_login_at = NOW(), email = $3
+		WHERE provider = $1 AND subject = $2 RETURNING user_id`, provider, subject, email).Scan(&uid)
+	return uid, err
+}
+
+// LinkIdentity привязывает учетную запись провайдера к игроку.
+func (d *DB) LinkIdentity(ctx context.Context, uid, provider, subject, email string) error {
+	_, err := d.pool.Exec(ctx, `INSERT INTO user_identities (provider, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())`, provider, subject, uid, email)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrIdentityTaken
+	}
+	return err
+}
+
+// CreateExternalUser создает игрока без пароля и привязывает к нему учетную запись
+// провайдера. Если имя занято, к нему добавляется номер. Возвращает ID и итоговое имя.
+func (d *DB) CreateExternalUser(ctx context.Context, name, provider, subject, email string) (id, username string, err error) {
+	err = pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		for i := 1; i <= 100; i++ {
+			username = name
+			if i > 1 {
+				suffix := fmt.Sprintf("_%d", i)
+				username = truncate(name, 32-len(suffix)) + suffix
+			}
+			err := tx.QueryRow(ctx, `INSERT INTO users (username, password_hash, rating, avg_wpm) VALUES ($1, '', 0, 0)
+				ON CONFLICT (username) DO NOTHING RETURNING id`, username).Scan(&id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `INSERT INTO user_identities (provider, subject, user_id, email, last_login_at)
+				VALUES ($1, $2, $3, $4, NOW())`, provider, subject, id, email)
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				return ErrIdentityTaken
+			}
+			return err
+		}
+		return ErrUsernameTaken
+	})
+	return id, username, err
+}
+
+// truncate обрезает строку до n байт, не разрезая символы.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
+
+// ListIdentities возвращает внешние учетные записи игрока.
+func (d *DB) ListIdentities(ctx context.Context, uid string) ([]Identity, error) {
+	rows, err := d.pool.Query(ctx, identitiesQuery, uid)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (Identity, error) {
+		var i Identity
+		err := r.Scan(&i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+		return i, err
+	})
+}
+
+const identitiesQuery = `SELECT provider, subject, email, created_at, last_login_at
+	FROM user_identities WHERE user_id = $1 ORDER BY provider`
+
+// UnlinkIdentity отвязывает учетную запись провайдера. У игрока без пароля
+// последнюю учетную запись отвязать нельзя.
+func (d *DB) UnlinkIdentity(ctx context.Context, uid, provider string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		var hasPassword bool
+		var others int
+		err := tx.QueryRow(ctx, `SELECT password_hash <> '',
+			(SELECT COUNT(*) FROM user_identities WHERE user_id = $1 AND provider <> $2)
+			FROM users WHERE id = $1 FOR UPDATE`, uid, provider).Scan(&hasPassword, &others)
+		if err != nil {
+			return err
+		}
+		if !hasPassword && others == 0 {
+			return ErrLastLogin
+		}
+		tag, err := tx.Exec(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, uid, provider)
+		if err == nil && tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return err
+	})
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// SystemActor — имя в журнале для записей, которые сделал сервер.
+const SystemActor = "[система]"
+
+// LoginLockedUntil возвращает самый поздний срок блокировки входа среди ключей.
+// Нулевое время — вход открыт.
+func (d *DB) LoginLockedUntil(ctx context.Context, keys ...string) (time.Time, error) {
+	var until *time.Time
+	err := d.pool.QueryRow(ctx, `SELECT MAX(locked_until) FROM login_failures
+		WHERE key = ANY($1) AND locked_until > NOW()`, keys).Scan(&until)
+	if err != nil || until == nil {
+		return time.Time{}, err
+	}
+	return *until, nil
+}
+
+// RecordLoginFailure увеличивает счетчик неудач по ключу и возвращает его.
+// Если прошлая неудача была раньше since, счет начинается с единицы.
+func (d *DB) RecordLoginFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	var n int
+	err := d.pool.QueryRow(ctx, `INSERT INTO login_failures AS f (key) VALUES ($1)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN f.last_failure_at < $2 THEN 1 ELSE f.failures + 1 END,
+			locked_until = CASE WHEN f.last_failure_at < $2 THEN NULL ELSE f.locked_until END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, since).Scan(&n)
+	return n, err
+}
+
+// LockLogin закрывает вход по ключу до until.
+func (d *DB) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := d.pool.Exec(ctx, `UPDATE login_failures SET locked_until = $2 WHERE key = $1`, key, until)
+	return err
+}
+
+// ClearLoginFailures забывает неудачи по ключу после успешного входа.
+func (d *DB) ClearLoginFailures(ctx context.Context, key string) error {
+	_, err := d.pool.Exec(ctx, `DELETE FROM login_failures WHERE key = $1`, key)
+	return err
+}
+
+// PruneLoginFailures удаляет счетчики без неудач после before и без действующей блокировки.
+func (d *DB) PruneLoginFailures(ctx context.Context, before time.Time) error {
+	_, err := d.pool.Exec(ctx, `DELETE FROM login_failures
+		WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < NOW())`, before)
+	return err
+}
+
+// LogSystemAction записывает в журнал событие, замеченное сервером.
+func (d *DB) LogSystemAction(ctx context.Context, action, target string, details any) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = d.pool.Exec(ctx, "INSERT INTO admin_actions (action, target, details, by_system) VALUES ($1, $2, $3, true)", action, target, b)
+	return err
+}
@@ -0,0 +1,27 @@
+package db
+
+import "uplink/backend/internal/metrics"
+
+// Metrics возвращает статистику пула соединений; значения снимаются при каждом запросе /metrics.
+func (d *DB) Metrics() []metrics.Metric {
+	conns := metrics.NewGaugeFunc("uplink_db_pool_connections", "Соединения пула PostgreSQL по состоянию.", func(emit func(float64, ...string)) {
+		s := d.pool.Stat()
+		emit(float64(s.AcquiredConns()), "acquired")
+		emit(float64(s.IdleConns()), "idle")
+		emit(float64(s.ConstructingConns()), "constructing")
+		emit(float64(s.TotalConns()), "total")
+	}, "state")
+	maxConns := metrics.NewGaugeFunc("uplink_db_pool_max_connections", "Предел размера пула.", func(emit func(float64, ...string)) {
+		emit(float64(d.pool.Stat().MaxConns()))
+	})
+	acquires := metrics.NewCounterFunc("uplink_db_pool_acquires_total", "Получения соединения из пула: успешные, с ожиданием свободного и отмененные.", func(emit func(float64, ...string)) {
+		s := d.pool.Stat()
+		emit(float64(s.AcquireCount()), "ok")
+		emit(float64(s.EmptyAcquireCount()), "waited")
+		emit(float64(s.CanceledAcquireCount()), "canceled")
+	}, "result")
+	acquireTime := metrics.NewCounterFunc("uplink_db_pool_acquire_seconds_total", "Суммарное время ожидания соединения.", func(emit func(float64, ...string)) {
+		emit(d.pool.Stat().AcquireDuration().Seconds())
+	})
+	return []metrics.Metric{conns, maxConns, acquires, acquireTime}
+}
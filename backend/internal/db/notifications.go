@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Notification — запись во входящих игрока.
+type Notification struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+}
+
+// SaveNotification добавляет уведомление во входящие и возвращает его номер и время.
+func (d *DB) SaveNotification(ctx context.Context, uid, kind string, data []byte) (int64, time.Time, error) {
+	var id int64
+	var at time.Time
+	err := d.pool.QueryRow(ctx, `INSERT INTO notifications (user_id, kind, data) VALUES ($1, $2, $3)
+		RETURNING id, created_at`, uid, kind, data).Scan(&id, &at)
+	return id, at, err
+}
+
+// ListNotifications возвращает страницу входящих от новых к старым; unread оставляет только непрочитанные.
+func (d *DB) ListNotifications(ctx context.Context, uid string, unread bool, limit int, cursor string) ([]Notification, string, error) {
+	query := `SELECT id, kind, data, created_at, read_at FROM notifications WHERE user_id = $1`
+	args := []any{uid}
+	if unread {
+		query += " AND read_at IS NULL"
+	}
+	if id, err := strconv.ParseInt(cursor, 10, 64); err == nil {
+		args = append(args, id)
+		query += " AND id < $" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	query += " ORDER BY id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := d.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	list := make([]Notification, 0, limit)
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Kind, &n.Data, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, "", err
+		}
+		list = append(list, n)
+	}
+	var next string
+	if len(list) == limit {
+		next = strconv.FormatInt(list[len(list)-1].ID, 10)
+	}
+	return list, next, rows.Err()
+}
+
+func (d *DB) CountUnread(ctx context.Context, uid string) (int, error) {
+	var n int
+	err := d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, uid).Scan(&n)
+	return n, err
+}
+
+// MarkNotificationsRead отмечает прочитанными перечисленные уведомления игрока;
+// пустой ids ничего не меняет.
+func (d *DB) MarkNotificationsRead(ctx context.Context, uid string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := d.pool.Exec(ctx, `UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND id = ANY($2) AND read_at IS NULL`, uid, ids)
+	return err
+}
+
+// MarkAllNotificationsRead отмечает прочитанными все входящие игрока.
+func (d *DB) MarkAllNotificationsRead(ctx context.Context, uid string) error {
+	_, err := d.pool.Exec(ctx, `UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`, uid)
+	return err
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrEmailTaken = errors.New("почта уже привязана к другому аккаунту")
+	// ErrResetThrottled — игроку недавно уже выдали несколько ссылок сброса.
+	ErrResetThrottled = errors.New("слишком много запросов на сброс пароля")
+	// ErrVerifyThrottled — игроку недавно уже выслали несколько писем подтверждения почты.
+	ErrVerifyThrottled = errors.New("слишком много писем для подтверждения почты")
+)
+
+// uniqueTaken переводит нарушение уникальности имени или почты в понятную ошибку.
+func uniqueTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return err
+	}
+	if pgErr.ConstraintName == "idx_users_email" {
+		return ErrEmailTaken
+	}
+	return ErrUsernameTaken
+}
+
+// SetEmail меняет почту игрока; пустая строка ее удаляет. Ссылки сброса пароля,
+// отправленные на прежнюю почту, и неподтвержденные адреса перестают действовать.
+func (d *DB) SetEmail(ctx context.Context, uid, email string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		if err := setEmail(ctx, tx, uid, email); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `UPDATE email_verifications SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, uid)
+		return err
+	})
+}
+
+func setEmail(ctx context.Context, tx pgx.Tx, uid, email string) error {
+	tag, err := tx.Exec(ctx, `UPDATE users SET email = NULLIF($2, '') WHERE id = $1`, uid, email)
+	if err != nil {
+		return uniqueTaken(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	_, err = tx.Exec(ctx, `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, uid)
+	return err
+}
+
+// CreateEmailVerification сохраняет хеш токена подтверждения адреса email до expires.
+// Прежние неподтвержденные адреса игрока перестают действовать. Если после since
+// игроку уже выслали limit писем, возвращает ErrVerifyThrottled.
+func (d *DB) CreateEmailVerification(ctx context.Context, uid, email, tokenHash string, expires time.Time, limit int, since time.Time) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, uid); err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM email_verifications WHERE user_id = $1 AND created_at > $2`, uid, since).Scan(&n); err != nil {
+			return err
+		}
+		if n >= limit {
+			return ErrVerifyThrottled
+		}
+		if _, err := tx.Exec(ctx, `UPDATE email_verifications SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, uid); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO email_verifications (token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, $4)`, tokenHash, uid, email, expires)
+		return err
+	})
+}
+
+// ConfirmEmail гасит токен подтверждения и записывает адрес игроку. Неизвестный,
+// использованный или просроченный токен дает pgx.ErrNoRows, занятый адрес — ErrEmailTaken.
+func (d *DB) ConfirmEmail(ctx context.Context, tokenHash string) (uid, email string, err error) {
+	err = pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `UPDATE email_verifications SET used_at = NOW()
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+			RETURNING user_id, email`, tokenHash).Scan(&uid, &email)
+		if err != nil {
+			return err
+		}
+		return setEmail(ctx, tx, uid, email)
+	})
+	return uid, email, err
+}
+
+// GetUserByEmail ищет игрока по почте без учета регистра.
+func (d *DB) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	rows, err := d.pool.Query(ctx, "SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER($1)", email)
+	if err != nil {
+		return nil, err
+	}
+	u, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[User])
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// CreatePasswordReset сохраняет хеш нового токена сброса до expires. Прежние токены
+// игрока перестают действовать. Если после since игроку уже выдали limit токенов,
+// возвращает ErrResetThrottled.
+func (d *DB) CreatePasswordReset(ctx context.Context, uid, tokenHash string, expires time.Time, limit int, since time.Time) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		// Блокировка строки игрока не дает двум запросам одновременно обойти лимит.
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, uid); err != nil {
+			return err
+		}
+		var n int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM password_resets WHERE user_id = $1 AND created_at > $2`, uid, since).Scan(&n); err != nil {
+			return err
+		}
+		if n >= limit {
+			return ErrResetThrottled
+		}
+		if _, err := tx.Exec(ctx, `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, uid); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`, tokenHash, uid, expires)
+		return err
+	})
+}
+
+// ResetPassword гасит токен сброса, меняет пароль и завершает все сессии игрока.
+// Неизвестный, использованный или просроченный токен дает pgx.ErrNoRows.
+func (d *DB) ResetPassword(ctx context.Context, tokenHash, hash string) (uid, username string, err error) {
+	err = pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `UPDATE password_resets r SET used_at = NOW() FROM users u
+			WHERE r.token_hash = $1 AND r.used_at IS NULL AND r.expires_at > NOW() AND u.id = r.user_id
+			RETURNING u.id, u.username`, tokenHash).Scan(&uid, &username)
+		if err != nil {
+			return err
+		}
+		return setPassword(ctx, tx, uid, hash)
+	})
+	return uid, username, err
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Роли пользователей по возрастанию прав: каждая следующая включает предыдущие.
+const (
+	RolePlayer    = "player"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RolePlayer: 1, RoleModerator: 2, RoleAdmin: 3}
+
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// HasRole сообщает, достаточно ли роли have для действия, требующего need.
+// Неизвестная роль не дает никаких прав.
+func HasRole(have, need string) bool {
+	return roleRank[have] > 0 && roleRank[have] >= roleRank[need]
+}
+
+// SetRole меняет роль пользователя; для неизвестного id возвращает pgx.ErrNoRows.
+func (d *DB) SetRole(ctx context.Context, uid, role string) error {
+	tag, err := d.pool.Exec(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, uid)
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
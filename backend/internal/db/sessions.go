@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrRefreshReused — предъявлен уже обмененный токен обновления: сессия отозвана.
+	ErrRefreshReused = errors.New("токен обновления использован повторно")
+	// ErrRefreshStale — токен только что обменяли в другой вкладке; сессия остается живой.
+	ErrRefreshStale = errors.New("токен обновления уже обменян")
+)
+
+// CreateSession открывает сессию входа и возвращает ее ID. В базе хранится только хеш токена обновления.
+func (d *DB) CreateSession(ctx context.Context, uid, refreshHash, userAgent, ip string, expires time.Time) (string, error) {
+	var id string
+	err := d.pool.QueryRow(ctx, `INSERT INTO sessions (user_id, refresh_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`, uid, refreshHash, userAgent, ip, expires).Scan(&id)
+	return id, err
+}
+
+// RotateSession меняет токен обновления сессии на новый и продлевает ее до expires.
+// Возвращает ID сессии и игрока. Старый токен, предъявленный позже grace после обмена,
+// считается украденным: сессия отзывается. Неизвестный, просроченный или отозванный
+// токен дает pgx.ErrNoRows.
+func (d *DB) RotateSession(ctx context.Context, oldHash, newHash string, expires time.Time, grace time.Duration) (sid, uid string, err error) {
+	err = pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		var current bool
+		var rotated time.Time
+		err := tx.QueryRow(ctx, `SELECT id, user_id, refresh_hash = $1, rotated_at FROM sessions
+			WHERE (refresh_hash = $1 OR prev_hash = $1) AND revoked_at IS NULL AND expires_at > NOW()
+			FOR UPDATE`, oldHash).Scan(&sid, &uid, &current, &rotated)
+		if err != nil {
+			return err
+		}
+		if !current {
+			if time.Since(rotated) < grace {
+				return ErrRefreshStale
+			}
+			return ErrRefreshReused
+		}
+		_, err = tx.Exec(ctx, `UPDATE sessions SET prev_hash = refresh_hash, refresh_hash = $2,
+			rotated_at = NOW(), expires_at = $3 WHERE id = $1`, sid, newHash, expires)
+		return err
+	})
+	// Транзакция с ошибкой откатывается, поэтому отзыв при повторном использовании идет отдельно.
+	if errors.Is(err, ErrRefreshReused) {
+		if _, rerr := d.pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1`, sid); rerr != nil {
+			return sid, uid, rerr
+		}
+	}
+	return sid, uid, err
+}
+
+// SessionActive сообщает, что сессия не отозвана и не истекла.
+func (d *DB) SessionActive(ctx context.Context, sid string) (bool, error) {
+	var ok bool
+	err := d.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW())`, sid).Scan(&ok)
+	return ok, err
+}
+
+// SessionStartedAfter сообщает, что сессия действует и открыта входом позже since.
+// Обмен токенов время входа не меняет.
+func (d *DB) SessionStartedAfter(ctx context.Context, sid string, since time.Time) (bool, error) {
+	var ok bool
+	err := d.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM sessions
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW() AND created_at > $2)`, sid, since).Scan(&ok)
+	return ok, err
+}
+
+// RevokeSession завершает сессию игрока uid; чужую сессию отозвать нельзя.
+func (d *DB) RevokeSession(ctx context.Context, uid, sid string) error {
+	_, err := d.pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, sid, uid)
+	return err
+}
+
+// RevokeSessionByRefresh завершает сессию по ее текущему токену обновления.
+func (d *DB) RevokeSessionByRefresh(ctx context.Context, refreshHash string) error {
+	_, err := d.pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW()
+		WHERE refresh_hash = $1 AND revoked_at IS NULL`, refreshHash)
+	return err
+}
+
+// RevokeUserSessions завершает все сессии игрока.
+func (d *DB) RevokeUserSessions(ctx context.Context, uid string) error {
+	_, err := d.pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, uid)
+	return err
+}
+
+// SetPassword меняет хеш пароля и в той же транзакции завершает все сессии игрока.
+func (d *DB) SetPassword(ctx context.Context, uid, hash string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		return setPassword(ctx, tx, uid, hash)
+	})
+}
+
+func setPassword(ctx context.Context, tx pgx.Tx, uid, hash string) error {
+	tag, err := tx.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, hash, uid)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, uid)
+	return err
+}
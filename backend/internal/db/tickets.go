@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// CreateWSTicket сохраняет хеш билета на подключение к WebSocket до expires.
+// Билет выдается в рамках сессии sid; пустой sid — токен, выданный до появления сессий.
+func (d *DB) CreateWSTicket(ctx context.Context, ticketHash, uid, sid string, expires time.Time) error {
+	_, err := d.pool.Exec(ctx, `INSERT INTO ws_tickets (ticket_hash, user_id, session_id, expires_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4)`, ticketHash, uid, sid, expires)
+	return err
+}
+
+// RedeemWSTicket гасит билет и возвращает игрока. Неизвестный, использованный или
+// просроченный билет, как и билет завершенной сессии, дает pgx.ErrNoRows.
+func (d *DB) RedeemWSTicket(ctx context.Context, ticketHash string) (uid, username string, err error) {
+	err = d.pool.QueryRow(ctx, `DELETE FROM ws_tickets t USING users u
+		WHERE t.ticket_hash = $1 AND t.expires_at > NOW() AND u.id = t.user_id
+			AND (t.session_id IS NULL OR EXISTS (SELECT 1 FROM sessions s
+				WHERE s.id = t.session_id AND s.revoked_at IS NULL AND s.expires_at > NOW()))
+		RETURNING u.id, u.username`, ticketHash).Scan(&uid, &username)
+	return uid, username, err
+}
+
+// PruneWSTickets удаляет просроченные билеты.
+func (d *DB) PruneWSTickets(ctx context.Context) error {
+	_, err := d.pool.Exec(ctx, `DELETE FROM ws_tickets WHERE expires_at <= NOW()`)
+	return err
+}
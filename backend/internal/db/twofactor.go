@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTOTPEnabled  = errors.New("двухфакторная аутентификация уже включена")
+	ErrTOTPDisabled = errors.New("двухфакторная аутентификация не включена")
+)
+
+// TOTPState — состояние двухфакторной аутентификации игрока.
+type TOTPState struct {
+	// Secret — зашифрованный секрет; пустой, если настройка не начиналась.
+	Secret       string
+	Enabled      bool
+	LastStep     int64
+	RecoveryLeft int
+}
+
+func (d *DB) GetTOTP(ctx context.Context, uid string) (TOTPState, error) {
+	var s TOTPState
+	err := d.pool.QueryRow(ctx, `SELECT COALESCE(totp_secret, ''), totp_enabled_at IS NOT NULL, totp_last_step,
+			(SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+		FROM users WHERE id = $1`, uid).Scan(&s.Secret, &s.Enabled, &s.LastStep, &s.RecoveryLeft)
+	return s, err
+}
+
+// SetTOTPPending сохраняет новый секрет, который включится после подтверждения кодом.
+func (d *DB) SetTOTPPending(ctx context.Context, uid, secret string) error {
+	tag, err := d.pool.Exec(ctx, `UPDATE users SET totp_secret = $2 WHERE id = $1 AND totp_enabled_at IS NULL`, uid, secret)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrTOTPEnabled
+	}
+	return err
+}
+
+// EnableTOTP включает подтвержденный секрет и заменяет коды восстановления.
+// step — шаг кода, которым подтвердили настройку.
+func (d *DB) EnableTOTP(ctx context.Context, uid string, step int64, codeHashes []string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $2
+			WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`, uid, step)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrTOTPEnabled
+		}
+		return replaceRecoveryCodes(ctx, tx, uid, codeHashes)
+	})
+}
+
+// ReplaceRecoveryCodes выдает новый набор кодов восстановления взамен старого.
+func (d *DB) ReplaceRecoveryCodes(ctx context.Context, uid string, codeHashes []string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		return replaceRecoveryCodes(ctx, tx, uid, codeHashes)
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, uid string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, uid); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`, uid, codeHashes)
+	return err
+}
+
+// UseTOTPStep отмечает шаг принятого кода. false — код этого или более позднего
+// шага уже принимали, и повтор нужно отклонить.
+func (d *DB) UseTOTPStep(ctx context.Context, uid string, step int64) (bool, error) {
+	tag, err := d.pool.Exec(ctx, `UPDATE users SET totp_last_step = $2
+		WHERE id = $1 AND totp_enabled_at IS NOT NULL AND totp_last_step < $2`, uid, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode гасит код восстановления. false — такого неиспользованного кода нет.
+func (d *DB) UseRecoveryCode(ctx context.Context, uid, codeHash string) (bool, error) {
+	tag, err := d.pool.Exec(ctx, `UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, uid, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DisableTOTP выключает двухфакторную аутентификацию и удаляет коды восстановления.
+func (d *DB) DisableTOTP(ctx context.Context, uid string) error {
+	return pgx.BeginFunc(ctx, d.pool, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0
+			WHERE id = $1`, uid)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, uid)
+		return err
+	})
+}
+
+// CreateMFAChallenge сохраняет хеш jti токена второго шага до expires.
+func (d *DB) CreateMFAChallenge(ctx context.Context, jtiHash, uid string, expires time.Time) error {
+	_, err := d.pool.Exec(ctx, `INSERT INTO mfa_challenges (jti_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		jtiHash, uid, expires)
+	return err
+}
+
+// MFAAttempt засчитывает попытку ввести код по токену второго шага и возвращает их число.
+// Токен, по которому уже было max попыток, как и неизвестный, погашенный или
+// просроченный, дает pgx.ErrNoRows.
+func (d *DB) MFAAttempt(ctx context.Context, jtiHash, uid string, max int) (int, error) {
+	var n int
+	err := d.pool.QueryRow(ctx, `UPDATE mfa_challenges SET tries = tries + 1
+		WHERE jti_hash = $1 AND user_id = $2 AND expires_at > NOW() AND tries < $3
+		RETURNING tries`, jtiHash, uid, max).Scan(&n)
+	return n, err
+}
+
+// RedeemMFAChallenge гасит токен второго шага. Если его уже погасили, в том числе
+// на другом узле, или он истек, возвращает pgx.ErrNoRows.
+func (d *DB) RedeemMFAChallenge(ctx context.Context, jtiHash, uid string) error {
+	return d.pool.QueryRow(ctx, `DELETE FROM mfa_challenges
+		WHERE jti_hash = $1 AND user_id = $2 AND expires_at > NOW()
+		RETURNING user_id`, jtiHash, uid).Scan(&uid)
+}
+
+// PruneMFAChallenges удаляет просроченные токены второго шага.
+func (d *DB) PruneMFAChallenges(ctx context.Context) error {
+	_, err := d.pool.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at <= NOW()`)
+	return err
+}
@@ -0,0 +1,258 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Инструменты оператора: просмотр комнат, принудительное завершение и закрытие,
+// системные объявления и отключение игроков. Комнаты видны только узлу-владельцу,
+// объявления и отключения расходятся по шине на все узлы.
+const (
+	ReasonRoomClosed = "ROOM_CLOSED"
+	ReasonKicked     = "KICKED"
+
+	// SystemSender — имя отправителя системных сообщений в чате.
+	SystemSender = "SYSTEM"
+
+	adminTopic  = "admin"
+	envKick     = "kick"
+	envAnnounce = "announce"
+)
+
+var (
+	ErrRoomNotFound = errors.New("комната не найдена")
+	ErrNotRacing    = errors.New("в комнате не идет заезд")
+)
+
+// ClientInfo — игрок комнаты или очереди подбора глазами администратора.
+type ClientInfo struct {
+	UserID       string     `json:"user_id"`
+	Username     string     `json:"username"`
+	Remote       bool       `json:"remote"`
+	Ready        bool       `json:"ready"`
+	Finished     bool       `json:"finished"`
+	Disqualified bool       `json:"disqualified"`
+	Progress     float64    `json:"progress"`
+	WPM          int        `json:"wpm"`
+	Latency      int        `json:"latency_ms"`
+	JoinedAt     time.Time  `json:"joined_at"`
+	Queue        QueueStats `json:"queue"`
+}
+
+// RoomInfo — состояние комнаты; история чата заполняется только для одной комнаты.
+type RoomInfo struct {
+	ID          string                 `json:"id"`
+	Owner       string                 `json:"owner"`
+	Mode        string                 `json:"mode"`
+	State       string                 `json:"state"`
+	Settings    Settings               `json:"settings"`
+	TextID      int                    `json:"text_id,omitempty"`
+	StartTime   *time.Time             `json:"start_time,omitempty"`
+	Closing     bool                   `json:"closing"`
+	Clients     []ClientInfo           `json:"clients"`
+	ChatHistory []protocol.ChatMessage `json:"chat_history,omitempty"`
+}
+
+func (c *Client) info() ClientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientInfo{
+		UserID:       c.ID,
+		Username:     c.Username,
+		Remote:       c.conn == nil,
+		Ready:        c.Ready,
+		Finished:     c.Finished,
+		Disqualified: c.Disqualified,
+		Progress:     c.Progress,
+		WPM:          int(c.WPM),
+		Latency:      c.latency(),
+		JoinedAt:     c.joinTime,
+		Queue:        c.send.snapshot(),
+	}
+}
+
+func (r *Room) info(chat bool) RoomInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ri := RoomInfo{
+		ID:       r.ID,
+		Owner:    r.Owner,
+		Mode:     r.Mode,
+		State:    stateNames[r.State],
+		Settings: r.Settings,
+		Closing:  r.closing,
+		Clients:  make([]ClientInfo, 0, len(r.clients)),
+	}
+	if r.Text != nil {
+		ri.TextID = r.Text.ID
+	}
+	if !r.StartTime.IsZero() {
+		t := r.StartTime
+		ri.StartTime = &t
+	}
+	for _, c := range r.clients {
+		ri.Clients = append(ri.Clients, c.info())
+	}
+	sort.Slice(ri.Clients, func(i, j int) bool { return ri.Clients[i].JoinedAt.Before(ri.Clients[j].JoinedAt) })
+	if chat {
+		ri.ChatHistory = append([]protocol.ChatMessage(nil), r.ChatHistory...)
+	}
+	return ri
+}
+
+// Rooms возвращает комнаты узла без истории чата.
+func (m *Manager) Rooms() []RoomInfo {
+	list := make([]RoomInfo, 0)
+	m.rooms.Range(func(_, v any) bool {
+		list = append(list, v.(*Room).info(false))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Room возвращает одну комнату вместе с историей чата.
+func (m *Manager) Room(id string) (RoomInfo, error) {
+	val, ok := m.rooms.Load(id)
+	if !ok {
+		return RoomInfo{}, ErrRoomNotFound
+	}
+	return val.(*Room).info(true), nil
+}
+
+// Queues возвращает игроков, ожидающих подбора, по ключам очередей.
+func (m *Manager) Queues() map[string][]ClientInfo {
+	m.qMu.Lock()
+	defer m.qMu.Unlock()
+	res := make(map[string][]ClientInfo, len(m.queues))
+	for k, q := range m.queues {
+		for _, c := range q {
+			res[k] = append(res[k], c.info())
+		}
+	}
+	return res
+}
+
+// FinishRoom завершает идущий заезд досрочно; результаты сохраняются как обычно.
+func (m *Manager) FinishRoom(id string) error {
+	val, ok := m.rooms.Load(id)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	r := val.(*Room)
+	r.mu.RLock()
+	racing := r.State == StateGame && !time.Now().Before(r.StartTime)
+	r.mu.RUnlock()
+	if !racing {
+		return ErrNotRacing
+	}
+	r.finish()
+	return nil
+}
+
+// CloseRoom отключает всех игроков комнаты без сохранения результатов.
+// Комната сразу исчезает из каталога, ее горутина завершится после ухода клиентов.
+func (m *Manager) CloseRoom(id, message string) error {
+	val, ok := m.rooms.Load(id)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	r := val.(*Room)
+	m.removeRoom(id)
+
+	r.mu.Lock()
+	r.closing = true
+	r.mu.Unlock()
+	if message != "" {
+		r.deliverAll(systemMessage(message))
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range r.flushClients() {
+		wg.Go(func() { c.closeAfterFlush(websocket.StatusNormalClosure, ReasonRoomClosed) })
+	}
+	wg.Wait()
+	return nil
+}
+
+// Announce рассылает системное сообщение во все комнаты и очереди всех узлов.
+func (m *Manager) Announce(text string) {
+	data, _ := json.Marshal(text)
+	m.publish(adminTopic, envelope{Kind: envAnnounce, Data: data})
+}
+
+// KickUser отключает игрока от всех комнат и очередей на всех узлах.
+func (m *Manager) KickUser(uid string) {
+	m.publish(adminTopic, envelope{Kind: envKick, User: uid, Reason: ReasonKicked})
+}
+
+func (m *Manager) handleAdminMessage(b []byte) {
+	var env envelope
+	if json.Unmarshal(b, &env) != nil {
+		return
+	}
+	switch env.Kind {
+	case envAnnounce:
+		var text string
+		if json.Unmarshal(env.Data, &text) == nil {
+			m.announce(systemMessage(text))
+		}
+	case envKick:
+		m.kick(env.User, env.Reason)
+	}
+}
+
+func systemMessage(text string) protocol.Message {
+	return protocol.Message{Type: protocol.TypeChatMessage, Payload: protocol.ChatMessage{
+		SenderName: SystemSender,
+		Text:       text,
+		Time:       time.Now(),
+	}}
+}
+
+func (m *Manager) announce(msg protocol.Message) {
+	m.rooms.Range(func(_, v any) bool {
+		v.(*Room).deliverAll(msg)
+		return true
+	})
+	m.qMu.Lock()
+	for _, q := range m.queues {
+		for _, c := range q {
+			c.deliver(msg)
+		}
+	}
+	m.qMu.Unlock()
+}
+
+func (m *Manager) kick(uid, reason string) {
+	var victims []*Client
+	m.rooms.Range(func(_, v any) bool {
+		r := v.(*Room)
+		r.mu.RLock()
+		if c, ok := r.clients[uid]; ok {
+			victims = append(victims, c)
+		}
+		r.mu.RUnlock()
+		return true
+	})
+	m.qMu.Lock()
+	for _, q := range m.queues {
+		for _, c := range q {
+			if c.ID == uid {
+				victims = append(victims, c)
+			}
+		}
+	}
+	m.qMu.Unlock()
+
+	for _, c := range victims {
+		go c.close(websocket.StatusPolicyViolation, reason)
+	}
+}
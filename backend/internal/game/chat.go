@@ -0,0 +1,305 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"uplink/backend/internal/chat"
+	"uplink/backend/internal/db"
+	"uplink/protocol"
+)
+
+// Модерация чата: каждое сообщение проходит chat.Moderator (длина, частота,
+// фильтр слов языка комнаты или очереди), заглушенные игроки не пишут в комнату.
+// История комнаты хранит ID сообщений, по ним игроки отправляют жалобы.
+// При включенном сохранении чат комнаты пишется в базу и привязывается к матчу.
+const (
+	chatHistoryLimit = 50
+	chatLogBuffer    = 1024
+	// reportContext — сколько сообщений до и после обжалуемого попадает в жалобу.
+	reportContext = 5
+)
+
+var (
+	ErrMessageNotFound = errors.New("сообщение не найдено")
+	ErrNotInRoom       = errors.New("вы не участник комнаты")
+)
+
+// SetChatPolicy заменяет правила чата для новых комнат и очередей подбора.
+func (m *Manager) SetChatPolicy(p *chat.Policy) {
+	m.chat = chat.New(p)
+}
+
+// moderate проверяет сообщение игрока и при отказе сообщает ему причину.
+func (c *Client) moderate(mod *chat.Moderator, gm *gameMetrics, lang, text string) (string, bool) {
+	clean, filtered, err := mod.Check(c.ID, lang, text, time.Now())
+	switch {
+	case errors.Is(err, chat.ErrRateLimited):
+		gm.chat.Inc("rate_limited")
+		c.reject(protocol.NewError(protocol.ErrRateLimited, protocol.TypeChatMessage, err.Error()))
+		return "", false
+	case err != nil:
+		gm.chat.Inc("rejected")
+		c.reject(protocol.NewError(protocol.ErrInvalidPayload, protocol.TypeChatMessage, err.Error()))
+		return "", false
+	case filtered:
+		gm.chat.Inc("filtered")
+	default:
+		gm.chat.Inc("sent")
+	}
+	return clean, true
+}
+
+func (c *Client) chat(text string) {
+	if name, arg, ok := parseCommand(text); ok {
+		c.command(name, arg)
+		return
+	}
+	text, ok := c.checkChat(text)
+	if !ok {
+		return
+	}
+	c.room.post(protocol.ChatMessage{
+		ID:         genID(),
+		SenderID:   c.ID,
+		SenderName: c.Username,
+		Text:       text,
+		Time:       time.Now(),
+	})
+}
+
+// checkChat проверяет заглушение и правила чата комнаты перед публикацией от имени игрока.
+func (c *Client) checkChat(text string) (string, bool) {
+	r := c.room
+	if until, ok := r.mutes.Until(c.ID, time.Now()); ok {
+		r.metrics.chat.Inc("muted")
+		c.reject(protocol.NewError(protocol.ErrMuted, protocol.TypeChatMessage,
+			"чат недоступен еще "+remaining(time.Until(until))))
+		return "", false
+	}
+	r.mu.RLock()
+	lang := r.Settings.Language
+	r.mu.RUnlock()
+	return c.moderate(r.chat, r.metrics, lang, text)
+}
+
+// post добавляет сообщение в историю комнаты, сохраняет его и рассылает игрокам.
+func (r *Room) post(msg protocol.ChatMessage) {
+	r.mu.Lock()
+	r.ChatHistory = append(r.ChatHistory, msg)
+	if len(r.ChatHistory) > chatHistoryLimit {
+		r.ChatHistory = r.ChatHistory[1:]
+	}
+	r.mu.Unlock()
+	r.persist(chatRecord{msg: &msg})
+
+	r.broadcast <- protocol.Message{Type: protocol.TypeChatMessage, Payload: msg}
+}
+
+// chatRecord — задание для записи чата: сообщение или привязка чата комнаты к сохраненному матчу.
+type chatRecord struct {
+	roomID  string
+	since   time.Time
+	msg     *protocol.ChatMessage
+	matchID string
+}
+
+// SetChatPersistence включает сохранение чата комнат в базе. Вызывается до создания комнат.
+func (m *Manager) SetChatPersistence(on bool) {
+	if on && m.chatLog == nil {
+		m.chatLog = make(chan chatRecord, chatLogBuffer)
+		go m.persistChat()
+	}
+}
+
+// persist ставит запись в очередь; при переполненной очереди сообщение остается только в памяти.
+func (r *Room) persist(rec chatRecord) {
+	if r.chatLog == nil {
+		return
+	}
+	rec.roomID, rec.since = r.ID, r.created
+	select {
+	case r.chatLog <- rec:
+	default:
+		if r.log != nil {
+			r.log.Warn("очередь записи чата переполнена", "room", r.ID)
+		}
+	}
+}
+
+// persistChat пишет чат всех комнат одной горутиной: привязка к матчу идет в общей
+// очереди после сообщений, поэтому сообщения, отправленные до конца заезда, попадают в матч.
+func (m *Manager) persistChat() {
+	for {
+		select {
+		case rec := <-m.chatLog:
+			m.writeChat(rec)
+		case <-m.done:
+			for {
+				select {
+				case rec := <-m.chatLog:
+					m.writeChat(rec)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Manager) writeChat(rec chatRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var err error
+	if rec.msg != nil {
+		err = m.db.SaveChatMessage(ctx, &db.ChatMessage{
+			RoomID:     rec.roomID,
+			MessageID:  rec.msg.ID,
+			SenderID:   rec.msg.SenderID,
+			SenderName: rec.msg.SenderName,
+			Text:       rec.msg.Text,
+			Action:     rec.msg.Action,
+			CreatedAt:  rec.msg.Time,
+		})
+	} else {
+		err = m.db.AttachChat(ctx, rec.roomID, rec.matchID, rec.since)
+	}
+	if err != nil && m.log != nil {
+		m.log.Warn("ошибка записи чата", "room", rec.roomID, "err", err)
+	}
+}
+
+// ChatSince возвращает время создания комнаты: чат комнаты в базе читается начиная с него.
+// Читать его может тот, кто находится в комнате или участвовал в заезде.
+func (m *Manager) ChatSince(roomID, uid string) (time.Time, error) {
+	val, ok := m.rooms.Load(roomID)
+	if !ok {
+		return time.Time{}, ErrRoomNotFound
+	}
+	r := val.(*Room)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.member(uid) {
+		return time.Time{}, ErrNotInRoom
+	}
+	return r.created, nil
+}
+
+// member сообщает, находится ли игрок в комнате или участвовал в заезде; r.mu должен быть захвачен.
+func (r *Room) member(uid string) bool {
+	if _, ok := r.clients[uid]; ok {
+		return true
+	}
+	for _, p := range r.participants {
+		if p.ID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// queueChat рассылает сообщение игрокам очереди подбора; язык берется из ключа очереди.
+func (m *Manager) queueChat(c *Client, queueKey, text string) {
+	lang, _, _ := strings.Cut(queueKey, "|")
+	text, ok := c.moderate(m.chat, m.metrics, lang, text)
+	if !ok {
+		return
+	}
+	out := protocol.Message{Type: protocol.TypeChatMessage, Payload: protocol.ChatMessage{
+		SenderID:   c.ID,
+		SenderName: c.Username,
+		Text:       text,
+		Time:       time.Now(),
+	}}
+	m.qMu.Lock()
+	for _, recipient := range m.queues[queueKey] {
+		recipient.deliver(out)
+	}
+	m.qMu.Unlock()
+}
+
+// remaining округляет оставшийся срок заглушения для сообщения игроку.
+func remaining(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%d с", int(math.Ceil(d.Seconds())))
+	}
+	return fmt.Sprintf("%d мин", int(math.Ceil(d.Minutes())))
+}
+
+// muteByOwner обрабатывает заглушение от владельца комнаты.
+func (c *Client) muteByOwner(p *protocol.Mute) {
+	r := c.room
+	switch {
+	case c.ID != r.Owner:
+		c.reject(protocol.NewError(protocol.ErrForbidden, protocol.TypeMute, "заглушать игроков может только владелец комнаты"))
+		return
+	case p.UserID == c.ID:
+		c.reject(protocol.NewError(protocol.ErrInvalidPayload, protocol.TypeMute, "нельзя заглушить себя"))
+		return
+	}
+	d := time.Duration(p.Seconds) * time.Second
+	if !r.mute(p.UserID, d) {
+		c.reject(protocol.NewError(protocol.ErrInvalidPayload, protocol.TypeMute, "игрок не найден в комнате"))
+		return
+	}
+	// Действия владельцев попадают в тот же журнал, что и действия модераторов.
+	r.audit(c.ID, "room_mute", p.UserID, map[string]any{"seconds": p.Seconds})
+}
+
+// mute заглушает игрока комнаты и сообщает об этом в чат.
+// Возвращает false, если игрока нет в комнате.
+func (r *Room) mute(uid string, d time.Duration) bool {
+	r.mu.RLock()
+	target, ok := r.clients[uid]
+	r.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	r.mutes.Set(uid, d, time.Now())
+	text := target.Username + " снова может писать в чат"
+	if d > 0 {
+		text = target.Username + " заглушен на " + remaining(d)
+	}
+	r.deliverAll(systemMessage(text))
+	return true
+}
+
+// MuteUser заглушает игрока в комнате по решению модератора; нулевой срок снимает заглушение.
+func (m *Manager) MuteUser(roomID, uid string, d time.Duration) error {
+	val, ok := m.rooms.Load(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	if !val.(*Room).mute(uid, d) {
+		return ErrNotInRoom
+	}
+	return nil
+}
+
+// ChatContext возвращает обжалуемое сообщение и соседние с ним из истории комнаты.
+// Жаловаться может только тот, кто находится в комнате или участвовал в заезде.
+func (m *Manager) ChatContext(roomID, reporterID, msgID string) (protocol.ChatMessage, []protocol.ChatMessage, error) {
+	val, ok := m.rooms.Load(roomID)
+	if !ok {
+		return protocol.ChatMessage{}, nil, ErrRoomNotFound
+	}
+	r := val.(*Room)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if !r.member(reporterID) {
+		return protocol.ChatMessage{}, nil, ErrNotInRoom
+	}
+
+	for i, msg := range r.ChatHistory {
+		if msg.ID != msgID {
+			continue
+		}
+		lo, hi := max(i-reportContext, 0), min(i+reportContext+1, len(r.ChatHistory))
+		return msg, append([]protocol.ChatMessage(nil), r.ChatHistory[lo:hi]...), nil
+	}
+	return protocol.ChatMessage{}, nil, ErrMessageNotFound
+}
@@ -0,0 +1,361 @@
+package game
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+	"uplink/backend/internal/cluster"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Сообщения между узлами. Узел, принявший соединение для чужой комнаты или очереди
+// подбора, пересылает владельцу join (queue)/msg/leave, а владелец отвечает send/close.
+const (
+	envJoin  = "join"
+	envQueue = "queue"
+	envMsg   = "msg"
+	envLeave = "leave"
+	envSend  = "send"
+	envClose = "close"
+)
+
+// RemoteInbox — сколько сообщений игрока с другого узла может ждать обработки.
+// Если комната не успевает за игроком, его отключают: подписка узла на шину
+// общая для всех его игроков и ждать одну комнату не может.
+const RemoteInbox = 64
+
+type envelope struct {
+	Kind    string          `json:"kind"`
+	Room    string          `json:"room,omitempty"`
+	Queue   string          `json:"queue,omitempty"`
+	User    string          `json:"user,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Rating  int             `json:"rating,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Conn    string          `json:"conn,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Code    int             `json:"code,omitempty"`
+	Reason  string          `json:"reason,omitempty"`
+}
+
+func nodeTopic(id string) string { return "node." + id }
+func connTopic(id string) string { return "conn." + id }
+
+// UseCluster подключает менеджер к общему каталогу комнат и шине сообщений.
+// По умолчанию менеджер работает в одиночку с каталогом в памяти.
+func (m *Manager) UseCluster(nodeID string, dir cluster.Directory, bus cluster.Bus) {
+	if m.unsubNode != nil {
+		m.unsubNode()
+	}
+	m.nodeID, m.dir, m.bus = nodeID, dir, bus
+	if err := dir.Register(context.Background(), nodeDirKey(nodeID), nodeID); err != nil {
+		m.log.Error("ошибка регистрации узла", "node", nodeID, "err", err)
+	}
+	unsubNode := bus.Subscribe(nodeTopic(nodeID), m.handleNodeMessage)
+	unsubAdmin := bus.Subscribe(adminTopic, m.handleAdminMessage)
+	unsubUsers := bus.Subscribe(userTopic, m.handleUserMessage)
+	m.unsubNode = func() {
+		unsubNode()
+		unsubAdmin()
+		unsubUsers()
+	}
+}
+
+func (m *Manager) NodeID() string {
+	return m.nodeID
+}
+
+func (m *Manager) registerRoom(id string) {
+	if err := m.dir.Register(context.Background(), id, m.nodeID); err != nil {
+		m.log.Error("ошибка регистрации комнаты", "room", id, "err", err)
+	}
+}
+
+func (m *Manager) removeRoom(id string) {
+	if _, ok := m.rooms.LoadAndDelete(id); !ok {
+		return
+	}
+	if err := m.dir.Unregister(context.Background(), id, m.nodeID); err != nil {
+		m.log.Error("ошибка удаления комнаты из каталога", "room", id, "err", err)
+	}
+}
+
+func (m *Manager) publish(topic string, env envelope) {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), WriteWait)
+	defer cancel()
+	if err := m.bus.Publish(ctx, topic, b); err != nil {
+		m.log.Warn("ошибка публикации в шину", "topic", topic, "err", err)
+	}
+}
+
+// queueOwner возвращает узел, который ведет очередь подбора k. Очередь закрепляется
+// за узлом, к которому первым пришел игрок, и остается за ним, пока узел жив: так
+// игроки со всех узлов попадают в одну очередь. Без каталога очередь ведется здесь.
+func (m *Manager) queueOwner(ctx context.Context, k string) string {
+	node, err := m.dir.Claim(ctx, queueDirKey(k), m.nodeID)
+	if err != nil {
+		m.log.Error("ошибка поиска владельца очереди", "queue", k, "err", err)
+		return m.nodeID
+	}
+	if node == m.nodeID {
+		m.qMu.Lock()
+		m.ownQueues[k] = struct{}{}
+		m.qMu.Unlock()
+	}
+	return node
+}
+
+// releaseQueues отдает очереди этого узла, чтобы их подхватили другие узлы.
+func (m *Manager) releaseQueues(ctx context.Context) {
+	m.qMu.Lock()
+	own := m.ownQueues
+	m.ownQueues = make(map[string]struct{})
+	m.qMu.Unlock()
+	for k := range own {
+		if err := m.dir.Unregister(ctx, queueDirKey(k), m.nodeID); err != nil {
+			m.log.Error("ошибка освобождения очереди", "queue", k, "err", err)
+		}
+	}
+}
+
+// nodeDirKey — ключ узла в каталоге: по нему каталог в памяти знает узлы, у которых
+// еще нет комнат.
+func nodeDirKey(id string) string { return "node:" + id }
+
+// queueDirKey — ключ очереди в каталоге комнат. Ключ очереди задает клиент,
+// поэтому в каталог идет его хеш фиксированной длины.
+func queueDirKey(k string) string {
+	sum := sha256.Sum256([]byte(k))
+	return "queue:" + hex.EncodeToString(sum[:12])
+}
+
+// proxy обслуживает соединение игрока с комнатой или очередью, которая живет на узле node.
+// join — первое сообщение владельцу, без ID соединения.
+// Между узлами сообщения идут в JSON, в сокет — в кодеке, согласованном с клиентом.
+func (m *Manager) proxy(conn *websocket.Conn, codec protocol.Codec, node string, join envelope) {
+	connID := genID() + genID()
+	m.proxies.Store(connID, conn)
+	defer m.proxies.Delete(connID)
+
+	writeFrame := func(data []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), WriteWait)
+		_ = conn.Write(ctx, frameType(codec), data)
+		cancel()
+	}
+
+	unsub := m.bus.Subscribe(connTopic(connID), func(b []byte) {
+		var env envelope
+		if json.Unmarshal(b, &env) != nil {
+			return
+		}
+		switch env.Kind {
+		case envSend:
+			data, perr := protocol.Transcode(protocol.Server, protocol.JSON, codec, env.Data)
+			if perr != nil {
+				m.log.Warn("ошибка перекодирования сообщения", "err", perr)
+				return
+			}
+			writeFrame(data)
+		case envClose:
+			_ = conn.Close(websocket.StatusCode(env.Code), env.Reason)
+		}
+	})
+	defer unsub()
+
+	join.Conn = connID
+	m.publish(nodeTopic(node), join)
+
+	for {
+		_, data, err := conn.Read(context.Background())
+		if err != nil {
+			break
+		}
+		data, perr := protocol.Transcode(protocol.Client, codec, protocol.JSON, data)
+		if perr != nil {
+			if out, err := codec.Encode(protocol.Message{Type: protocol.TypeError, Payload: perr}); err == nil {
+				writeFrame(out)
+			}
+			continue
+		}
+		m.publish(nodeTopic(node), envelope{Kind: envMsg, Conn: connID, Data: data})
+	}
+
+	m.publish(nodeTopic(node), envelope{Kind: envLeave, Conn: connID})
+}
+
+// handleNodeMessage принимает события от узлов, проксирующих игроков в локальные
+// комнаты и очереди. Обработчик общий для всех таких игроков, поэтому ничего не ждет:
+// сообщения игрока обрабатывает его собственная горутина.
+func (m *Manager) handleNodeMessage(b []byte) {
+	var env envelope
+	if json.Unmarshal(b, &env) != nil {
+		return
+	}
+
+	switch env.Kind {
+	case envJoin:
+		m.joinRemote(env)
+	case envQueue:
+		m.joinRemoteQueue(env)
+	case envMsg:
+		v, ok := m.remotes.Load(env.Conn)
+		if !ok {
+			return
+		}
+		c := v.(*Client)
+		select {
+		case c.inbox <- env.Data:
+		default:
+			m.log.Warn("игрок с другого узла отключен: его сообщения не успевают обрабатываться", "user", c.ID)
+			m.dropRemote(env.Conn)
+			go c.close(websocket.StatusTryAgainLater, "перегрузка")
+		}
+	case envLeave:
+		m.dropRemote(env.Conn)
+	case envPresence:
+		go m.answerPresence(env)
+	case envMember:
+		go m.answerMember(env)
+	case envPresenceReply, envMemberReply:
+		if v, ok := m.asks.Load(env.Conn); ok {
+			select {
+			case v.(chan json.RawMessage) <- env.Data:
+			default:
+			}
+		}
+	}
+}
+
+// dropRemote завершает обработку сообщений игрока с другого узла.
+// Вызывается только из handleNodeMessage, поэтому left закрывается один раз.
+func (m *Manager) dropRemote(connID string) {
+	if v, ok := m.remotes.LoadAndDelete(connID); ok {
+		close(v.(*Client).left)
+	}
+}
+
+// remoteClient создает игрока, чей сокет открыт на другом узле.
+func (m *Manager) remoteClient(env envelope) *Client {
+	c := &Client{
+		ID:        env.User,
+		Username:  env.Name,
+		Rating:    env.Rating,
+		codec:     protocol.JSON,
+		remote:    env.Conn,
+		bus:       m.bus,
+		joinTime:  time.Now(),
+		lastInput: time.Now(),
+		send:      m.newOutbox(),
+		inbox:     make(chan []byte, RemoteInbox),
+		left:      make(chan struct{}),
+	}
+	c.version = env.Version
+	return c
+}
+
+// serveRemote обрабатывает сообщения игрока с другого узла, как readLoop — из сокета,
+// пока тот не уйдет. Пришедшее до ухода обрабатывается.
+func (c *Client) serveRemote(handle func([]byte)) {
+	for {
+		select {
+		case data := <-c.inbox:
+			handle(data)
+		case <-c.left:
+			for {
+				select {
+				case data := <-c.inbox:
+					handle(data)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *Manager) joinRemote(env envelope) {
+	cl := m.remoteClient(env)
+	m.remotes.Store(env.Conn, cl)
+	go func() {
+		val, ok := m.rooms.Load(env.Room)
+		if !ok {
+			m.remotes.CompareAndDelete(env.Conn, cl)
+			cl.close(websocket.StatusNormalClosure, "комната не найдена")
+			return
+		}
+		room := val.(*Room)
+		cl.room = room
+		cl.Username = m.displayName(context.Background(), env.User, env.Name)
+		if !m.attach(room, cl) {
+			m.remotes.CompareAndDelete(env.Conn, cl)
+			return
+		}
+		cl.serveRemote(cl.handleMessage)
+
+		room.mu.RLock()
+		current := room.clients[cl.ID] == cl
+		room.mu.RUnlock()
+		// После переподключения в комнате уже другой клиент с тем же ID.
+		if current {
+			room.unregister <- cl.ID
+		}
+	}()
+}
+
+// joinRemoteQueue ставит в очередь подбора этого узла игрока с другого узла.
+func (m *Manager) joinRemoteQueue(env envelope) {
+	cl := m.remoteClient(env)
+	m.remotes.Store(env.Conn, cl)
+	go func() {
+		if !m.enqueue(cl, env.Queue) {
+			m.remotes.CompareAndDelete(env.Conn, cl)
+			cl.close(websocket.StatusTryAgainLater, ReasonShutdown)
+			return
+		}
+		go cl.writeLoop()
+		m.broadcastLobbyPlayers(env.Queue)
+		cl.serveRemote(func(data []byte) { m.handleQueueMessage(cl, env.Queue, data) })
+		m.leaveQueue(cl, env.Queue)
+	}()
+}
+
+// write отправляет сообщение в сокет или, для игрока с другого узла, в шину.
+func (c *Client) write(ctx context.Context, m protocol.Message) error {
+	if c.conn != nil {
+		data, err := c.codec.Encode(m)
+		if err != nil {
+			return err
+		}
+		return c.conn.Write(ctx, frameType(c.codec), data)
+	}
+	b, err := protocol.JSON.Encode(m)
+	if err != nil {
+		return err
+	}
+	env, _ := json.Marshal(envelope{Kind: envSend, Data: b})
+	return c.bus.Publish(ctx, connTopic(c.remote), env)
+}
+
+func frameType(codec protocol.Codec) websocket.MessageType {
+	if codec.Binary() {
+		return websocket.MessageBinary
+	}
+	return websocket.MessageText
+}
+
+func (c *Client) close(code websocket.StatusCode, reason string) {
+	if c.conn != nil {
+		_ = c.conn.Close(code, reason)
+		return
+	}
+	env, _ := json.Marshal(envelope{Kind: envClose, Code: int(code), Reason: reason})
+	_ = c.bus.Publish(context.Background(), connTopic(c.remote), env)
+}
@@ -0,0 +1,203 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Команды чата комнаты. Сообщение вида «/имя аргументы» не публикуется, а выполняется
+// как действие в комнате; ответ видит только автор команды. /me и /roll публикуются
+// от имени игрока и подчиняются тем же правилам, что и обычные сообщения.
+const (
+	ReasonKickedByOwner = "KICKED_BY_OWNER"
+
+	defaultRoll = 100
+	maxRoll     = 1_000_000
+)
+
+type command struct {
+	name, args, help string
+	run              func(c *Client, arg string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "список команд", (*Client).cmdHelp},
+		{"ready", "", "переключить готовность", (*Client).cmdReady},
+		{"start", "", "начать заезд (владелец)", (*Client).cmdStart},
+		{"kick", "имя", "исключить игрока из лобби (владелец)", (*Client).cmdKick},
+		{"roll", "[N]", "случайное число от 1 до N, по умолчанию 100", (*Client).cmdRoll},
+		{"me", "действие", "сообщение от третьего лица", (*Client).cmdMe},
+	}
+}
+
+// parseCommand выделяет имя команды и аргумент. Текст, где за «/» не следует буква,
+// командой не считается и отправляется как обычное сообщение.
+func parseCommand(text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	rest, ok := strings.CutPrefix(text, "/")
+	if !ok {
+		return "", "", false
+	}
+	name, arg, _ := strings.Cut(rest, " ")
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(arg), true
+}
+
+func (c *Client) command(name, arg string) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			cmd.run(c, arg)
+			return
+		}
+	}
+	c.reply("неизвестная команда /" + name + ", список команд — /help")
+}
+
+// reply отправляет системное сообщение только этому игроку.
+func (c *Client) reply(text string) {
+	c.deliver(systemMessage(text))
+}
+
+func (c *Client) cmdHelp(string) {
+	list := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		usage := "/" + cmd.name
+		if cmd.args != "" {
+			usage += " " + cmd.args
+		}
+		list = append(list, usage+" — "+cmd.help)
+	}
+	c.reply("Команды: " + strings.Join(list, "; "))
+}
+
+func (c *Client) inLobby() bool {
+	c.room.mu.RLock()
+	defer c.room.mu.RUnlock()
+	return c.room.State == StateLobby
+}
+
+func (c *Client) cmdReady(string) {
+	if !c.inLobby() {
+		c.reply("готовность меняется только в лобби")
+		return
+	}
+	if c.toggleReady() {
+		c.reply("вы готовы")
+	} else {
+		c.reply("вы не готовы")
+	}
+}
+
+func (c *Client) cmdStart(string) {
+	switch {
+	case c.ID != c.room.Owner:
+		c.reply("начать заезд может только владелец комнаты")
+	case !c.inLobby():
+		c.reply("заезд уже идет")
+	default:
+		go c.room.startGame()
+	}
+}
+
+func (c *Client) cmdKick(name string) {
+	r := c.room
+	switch {
+	case c.ID != r.Owner:
+		c.reply("исключать игроков может только владелец комнаты")
+		return
+	case name == "":
+		c.reply("укажите имя: /kick имя")
+		return
+	case !c.inLobby():
+		c.reply("исключать игроков можно только в лобби")
+		return
+	}
+
+	r.mu.Lock()
+	var target *Client
+	for _, cl := range r.clients {
+		if strings.EqualFold(cl.Username, name) {
+			target = cl
+		}
+	}
+	if target != nil && target != c {
+		r.kicked[target.ID] = true
+	}
+	r.mu.Unlock()
+
+	switch {
+	case target == nil:
+		c.reply("игрок " + name + " не найден в комнате")
+	case target == c:
+		c.reply("нельзя исключить себя")
+	default:
+		r.deliverAll(systemMessage(target.Username + " исключен из комнаты"))
+		go target.close(websocket.StatusPolicyViolation, ReasonKickedByOwner)
+		r.audit(c.ID, "room_kick", target.ID, nil)
+	}
+}
+
+func (c *Client) cmdRoll(arg string) {
+	n := defaultRoll
+	if arg != "" {
+		v, err := strconv.Atoi(arg)
+		if err != nil || v < 2 || v > maxRoll {
+			c.reply(fmt.Sprintf("укажите число от 2 до %d: /roll 20", maxRoll))
+			return
+		}
+		n = v
+	}
+	c.action(fmt.Sprintf("выбрасывает %d (1–%d)", rand.IntN(n)+1, n))
+}
+
+func (c *Client) cmdMe(arg string) {
+	if arg == "" {
+		c.reply("укажите действие: /me машет рукой")
+		return
+	}
+	c.action(arg)
+}
+
+// action публикует сообщение от третьего лица после проверок чата.
+func (c *Client) action(text string) {
+	text, ok := c.checkChat(text)
+	if !ok {
+		return
+	}
+	c.room.post(protocol.ChatMessage{
+		ID:         genID(),
+		SenderID:   c.ID,
+		SenderName: c.Username,
+		Text:       text,
+		Action:     true,
+		Time:       time.Now(),
+	})
+}
+
+// audit записывает действие владельца комнаты в общий журнал модерации.
+func (r *Room) audit(actorID, action, target string, details map[string]any) {
+	if details == nil {
+		details = make(map[string]any)
+	}
+	details["room_id"] = r.ID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.db.LogAdminAction(ctx, actorID, action, target, details); err != nil && r.log != nil {
+			r.log.Warn("не удалось записать действие в комнате", "room", r.ID, "action", action, "err", err)
+		}
+	}()
+}
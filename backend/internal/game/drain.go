@@ -0,0 +1,169 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Остановка узла. Drain перестает принимать новые комнаты и игроков в подбор,
+// рассылает server_shutdown, дает идущим заездам доиграть, а к сроку завершает их
+// принудительно с сохранением результатов. Сокеты закрываются кодом 1001
+// с причиной SERVER_SHUTDOWN после отправки последних событий.
+const (
+	ReasonShutdown = "SERVER_SHUTDOWN"
+
+	// DrainCloseMargin — запас до истечения контекста на сохранение результатов и закрытие сокетов.
+	DrainCloseMargin = 3 * time.Second
+	FlushTimeout     = time.Second
+)
+
+var ErrDraining = errors.New("сервер завершает работу")
+
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// rejoining разрешает во время остановки переподключение участника идущего заезда.
+func (m *Manager) rejoining(roomID, uid string) bool {
+	val, ok := m.rooms.Load(roomID)
+	if !ok {
+		return false
+	}
+	r := val.(*Room)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.State != StateGame {
+		return false
+	}
+	for _, p := range r.participants {
+		if p.ID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// Drain останавливает прием игроков и ждет завершения заездов, но не дольше контекста.
+func (m *Manager) Drain(ctx context.Context) {
+	if !m.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	raceEnd := time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		raceEnd = deadline.Add(-DrainCloseMargin)
+	}
+	notice := protocol.Message{Type: protocol.TypeShutdown, Payload: protocol.ServerShutdown{
+		Deadline: raceEnd,
+		Message:  "сервер перезапускается, текущий заезд будет завершен",
+	}}
+
+	m.qMu.Lock()
+	var queued []*Client
+	for _, q := range m.queues {
+		queued = append(queued, q...)
+	}
+	m.queues = make(map[string][]*Client)
+	m.qMu.Unlock()
+	// Новые игроки встанут в очередь другого узла.
+	m.releaseQueues(ctx)
+
+	var wg sync.WaitGroup
+	for _, c := range queued {
+		wg.Go(func() {
+			c.deliver(notice)
+			c.shutdown()
+		})
+	}
+	// Игроки чужих комнат переподключатся через другой узел, заезд там продолжается.
+	m.proxies.Range(func(_, v any) bool {
+		conn := v.(*websocket.Conn)
+		wg.Go(func() { _ = conn.Close(websocket.StatusGoingAway, ReasonShutdown) })
+		return true
+	})
+	m.rooms.Range(func(_, v any) bool {
+		r := v.(*Room)
+		wg.Go(func() { r.drain(notice, raceEnd) })
+		return true
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if m.log != nil {
+			m.log.Warn("не все комнаты закрыты до остановки", "err", ctx.Err())
+		}
+	}
+}
+
+// drain ждет конца заезда до raceEnd, затем завершает его и отключает игроков.
+func (r *Room) drain(notice protocol.Message, raceEnd time.Time) {
+	r.mu.Lock()
+	r.closing = true
+	for _, c := range r.clients {
+		c.deliver(notice)
+	}
+	r.mu.Unlock()
+
+	for {
+		r.mu.RLock()
+		state, started := r.State, !time.Now().Before(r.StartTime)
+		r.mu.RUnlock()
+		if state != StateGame && state != StateLoading {
+			break
+		}
+		if !time.Now().Before(raceEnd) {
+			// Заезд, не дошедший до старта, сохранять нечего.
+			if state == StateGame && started {
+				r.finish()
+			}
+			break
+		}
+		time.Sleep(RoomUpdateTick)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range r.flushClients() {
+		wg.Go(c.shutdown)
+	}
+	wg.Wait()
+}
+
+// flushClients дожидается, пока run разошлет накопленные события, в том числе game_end,
+// и возвращает клиентов комнаты.
+func (r *Room) flushClients() []*Client {
+	ack := make(chan struct{})
+	select {
+	case r.stop <- ack:
+		<-ack
+	case <-time.After(FlushTimeout):
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clients := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (c *Client) shutdown() {
+	c.closeAfterFlush(websocket.StatusGoingAway, ReasonShutdown)
+}
+
+// closeAfterFlush дожидается отправки остатка очереди и закрывает соединение.
+func (c *Client) closeAfterFlush(code websocket.StatusCode, reason string) {
+	c.send.flush(FlushTimeout)
+	c.close(code, reason)
+}
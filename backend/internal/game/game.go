@@ -4,18 +4,21 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"log/slog"
 	"math"
 	"net/http"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"uplink/backend/internal/chat"
+	"uplink/backend/internal/cluster"
 	"uplink/backend/internal/db"
+	"uplink/backend/internal/text"
+	"uplink/protocol"
 
 	"github.com/coder/websocket"
-	"github.com/coder/websocket/wsjson"
 )
 
 const (
@@ -40,21 +43,25 @@ const (
 	StateLoading  = 3
 )
 
-type Settings struct {
-	Language   string `json:"language"`
-	TextMode   string `json:"text_mode"`
-	Category   string `json:"category"`
-	TextID     int    `json:"text_id"`
-	MaxPlayers int    `json:"max_players"`
-}
+type (
+	Settings        = protocol.Settings
+	DifficultyRange = protocol.DifficultyRange
+)
 
 type Client struct {
 	ID, Username string
 	Rating       int
 	conn         *websocket.Conn
+	codec        protocol.Codec
+	remote       string
+	bus          cluster.Bus
+	inbox        chan []byte
+	left         chan struct{}
 	room         *Room
+	version      int
+	rtt          time.Duration
 	joinTime     time.Time
-	send         chan any
+	send         *outbox
 	Accuracy     int
 	mu           sync.Mutex
 	Progress     float64
@@ -68,12 +75,27 @@ type Client struct {
 }
 
 type Manager struct {
-	rooms  sync.Map
-	queues map[string][]*Client
-	qMu    sync.Mutex
-	db     *db.DB
-	log    *slog.Logger
-	done   chan struct{}
+	rooms     sync.Map
+	remotes   sync.Map
+	proxies   sync.Map
+	queues    map[string][]*Client
+	ownQueues map[string]struct{}
+	qMu       sync.Mutex
+	db        *db.DB
+	log       *slog.Logger
+	rules     *text.Rules
+	nodeID    string
+	dir       cluster.Directory
+	bus       cluster.Bus
+	unsubNode func()
+	draining  atomic.Bool
+	metrics   *gameMetrics
+	chat      *chat.Moderator
+	chatLog   chan chatRecord
+	homes     map[string]map[*Client]struct{}
+	hMu       sync.Mutex
+	asks      sync.Map
+	done      chan struct{}
 }
 
 type LobbyInfo struct {
@@ -84,30 +106,46 @@ type LobbyInfo struct {
 
 func New(d *db.DB, l *slog.Logger) *Manager {
 	m := &Manager{
-		queues: make(map[string][]*Client),
-		db:     d,
-		log:    l,
-		done:   make(chan struct{}),
+		queues:    make(map[string][]*Client),
+		ownQueues: make(map[string]struct{}),
+		homes:     make(map[string]map[*Client]struct{}),
+		db:        d,
+		log:       l,
+		rules:     text.DefaultRules(),
+		metrics:   newGameMetrics(),
+		chat:      chat.New(chat.DefaultPolicy()),
+		done:      make(chan struct{}),
 	}
+	mem := cluster.NewMemory()
+	m.UseCluster(genID(), mem, mem)
 	go m.matchmaker()
 	return m
 }
 
+func (m *Manager) SetTextRules(r *text.Rules) {
+	m.rules = r
+}
+
 func (m *Manager) Shutdown() {
 	close(m.done)
+	if m.unsubNode != nil {
+		m.unsubNode()
+	}
 }
 
 func (m *Manager) CreateRoom(owner, mode string, s Settings) string {
 	id := genID()
 	r := &Room{
 		ID: id, Owner: owner, Mode: mode, Settings: s,
-		clients: make(map[string]*Client), db: m.db, log: m.log,
-		broadcast: make(chan any, 256), unregister: make(chan string),
-		input: make(chan *inputMsg, 64),
-		ChatHistory: make([]map[string]any, 0),
+		clients: make(map[string]*Client), db: m.db, log: m.log, rules: m.rules, metrics: m.metrics,
+		chat: m.chat, mutes: chat.NewMutes(), chatLog: m.chatLog, created: time.Now(), kicked: make(map[string]bool),
+		broadcast: make(chan protocol.Message, 256), unregister: make(chan string),
+		input: make(chan *inputMsg, 64), stop: make(chan chan struct{}), closing: m.Draining(),
+		ChatHistory: make([]protocol.ChatMessage, 0),
 	}
 	m.rooms.Store(id, r)
-	go r.run(func() { m.rooms.Delete(id) })
+	m.registerRoom(id)
+	go r.run(func() { m.removeRoom(id) })
 	return id
 }
 
@@ -119,40 +157,43 @@ func (m *Manager) broadcastLobbyPlayers(queueKey string) {
 		return
 	}
 
-	playersList := make([]any, 0, len(clients))
+	playersList := make(protocol.Players, 0, len(clients))
 	for _, c := range clients {
-		playersList = append(playersList, map[string]any{
-			"user_id":  c.ID,
-			"username": c.Username,
-			"rating":   c.Rating,
+		playersList = append(playersList, protocol.Player{
+			UserID:   c.ID,
+			Username: c.Username,
+			Rating:   c.Rating,
 		})
 	}
 	m.qMu.Unlock()
 
-	msg := map[string]any{
-		"type":    "player_joined",
-		"payload": playersList,
-	}
+	msg := protocol.Message{Type: protocol.TypePlayerJoined, Payload: playersList}
 
 	m.qMu.Lock()
 	for _, c := range m.queues[queueKey] {
-		select {
-		case c.send <- msg:
-		default:
-		}
+		c.deliver(msg)
 	}
 	m.qMu.Unlock()
 }
 
 func (m *Manager) HandleWS(w http.ResponseWriter, r *http.Request, uid, user string) {
-	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: []string{"*"}})
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		OriginPatterns: []string{"*"},
+		Subprotocols:   protocol.Subprotocols,
+	})
 	if err != nil {
 		m.log.Warn("ошибка рукопожатия", "err", err)
 		return
 	}
+	codec := protocol.CodecFor(c.Subprotocol())
 
 	rid := r.URL.Query().Get("room_id")
 
+	if m.Draining() && !m.rejoining(rid, uid) {
+		_ = c.Close(websocket.StatusTryAgainLater, ReasonShutdown)
+		return
+	}
+
 	if rid == "" {
 		u, _ := m.db.GetUserByID(r.Context(), uid)
 		rating := 1000
@@ -167,27 +208,29 @@ func (m *Manager) HandleWS(w http.ResponseWriter, r *http.Request, uid, user str
 			Username: user,
 			Rating:   rating,
 			conn:     c,
+			codec:    codec,
 			joinTime: time.Now(),
-			send:     make(chan any, 64),
-		}
-
-		var msg struct {
-			Type    string `json:"type"`
-			Payload struct{ Mode, Language, TextMode string } `json:"payload"`
+			send:     m.newOutbox(),
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), time.Second*5)
-		if err := wsjson.Read(ctx, c, &msg); err != nil {
-			cancel()
+		join, err := client.readJoin(ctx)
+		cancel()
+		if err != nil {
 			_ = c.Close(websocket.StatusProtocolError, "ошибка инициализации")
 			return
 		}
-		cancel()
 
-		m.qMu.Lock()
-		k := msg.Payload.Language + "|" + msg.Payload.TextMode
-		m.queues[k] = append(m.queues[k], client)
-		m.qMu.Unlock()
+		k := join.Language + "|" + join.TextMode
+		// Очередь одна на кластер: если ее ведет другой узел, игрок ждет подбора там.
+		if node := m.queueOwner(r.Context(), k); node != m.nodeID {
+			go m.proxy(c, codec, node, envelope{Kind: envQueue, Queue: k, User: uid, Name: user, Rating: rating, Version: client.protoVersion()})
+			return
+		}
+		if !m.enqueue(client, k) {
+			_ = c.Close(websocket.StatusTryAgainLater, ReasonShutdown)
+			return
+		}
 
 		go client.writeLoop()
 		m.broadcastLobbyPlayers(k)
@@ -197,29 +240,34 @@ func (m *Manager) HandleWS(w http.ResponseWriter, r *http.Request, uid, user str
 
 	val, ok := m.rooms.Load(rid)
 	if !ok {
-		_ = c.Close(websocket.StatusNormalClosure, "комната не найдена")
+		// Комната может жить на другом узле: тогда соединение проксируется через шину.
+		node, err := m.dir.Lookup(r.Context(), rid)
+		if err != nil || node == m.nodeID {
+			_ = c.Close(websocket.StatusNormalClosure, "комната не найдена")
+			return
+		}
+		go m.proxy(c, codec, node, envelope{Kind: envJoin, Room: rid, User: uid, Name: user})
 		return
 	}
 	room := val.(*Room)
 
-	room.mu.Lock()
-	_, isReconnecting := room.clients[uid]
-	if !isReconnecting && len(room.clients) >= room.Settings.MaxPlayers {
-		room.mu.Unlock()
-		_ = c.Close(websocket.StatusPolicyViolation, "LOBBY_FULL")
-		return
+	cl := &Client{
+		ID:        uid,
+		Username:  m.displayName(r.Context(), uid, user),
+		conn:      c,
+		codec:     codec,
+		room:      room,
+		joinTime:  time.Now(),
+		lastInput: time.Now(),
+		send:      m.newOutbox(),
 	}
-
-	if isReconnecting {
-		oldClient, exists := room.clients[uid]
-		if exists {
-			_ = oldClient.conn.Close(websocket.StatusGoingAway, "reconnected")
-			delete(room.clients, uid)
-		}
+	if m.attach(room, cl) {
+		go cl.readLoop()
 	}
-	room.mu.Unlock()
+}
 
-	u, _ := m.db.GetUserByID(r.Context(), uid)
+func (m *Manager) displayName(ctx context.Context, uid, user string) string {
+	u, _ := m.db.GetUserByID(ctx, uid)
 	if u != nil {
 		user = u.Username
 	}
@@ -227,67 +275,102 @@ func (m *Manager) HandleWS(w http.ResponseWriter, r *http.Request, uid, user str
 	if user == "" || user == "Guest" {
 		user = "Agent_" + uid[:4]
 	}
+	return user
+}
 
-	cl := &Client{
-		ID:        uid,
-		Username:  user,
-		conn:      c,
-		room:      room,
-		joinTime:  time.Now(),
-		lastInput: time.Now(),
-		send:      make(chan any, 64),
+// attach добавляет клиента в комнату, заменяя прежнее подключение того же игрока.
+func (m *Manager) attach(room *Room, cl *Client) bool {
+	room.mu.Lock()
+	oldClient, isReconnecting := room.clients[cl.ID]
+	if room.kicked[cl.ID] {
+		room.mu.Unlock()
+		cl.close(websocket.StatusPolicyViolation, ReasonKickedByOwner)
+		return false
+	}
+	if !isReconnecting && len(room.clients) >= room.Settings.MaxPlayers {
+		room.mu.Unlock()
+		cl.close(websocket.StatusPolicyViolation, "LOBBY_FULL")
+		return false
+	}
+
+	if isReconnecting {
+		oldClient.close(websocket.StatusGoingAway, "reconnected")
+		delete(room.clients, cl.ID)
 	}
+	room.mu.Unlock()
+
 	room.join(cl)
 	go cl.writeLoop()
-	go cl.readLoop()
+	return true
+}
+
+// enqueue ставит игрока в очередь подбора; во время остановки узла очереди закрыты.
+func (m *Manager) enqueue(c *Client, queueKey string) bool {
+	m.qMu.Lock()
+	defer m.qMu.Unlock()
+	if m.Draining() {
+		return false
+	}
+	m.queues[queueKey] = append(m.queues[queueKey], c)
+	return true
+}
+
+// setQueue заменяет очередь k; опустевшая очередь удаляется, чтобы не копить ключи.
+// Вызывается под qMu.
+func (m *Manager) setQueue(k string, q []*Client) {
+	if len(q) == 0 {
+		delete(m.queues, k)
+		return
+	}
+	m.queues[k] = q
+}
+
+// leaveQueue убирает игрока из очереди и рассылает оставшимся новый список.
+func (m *Manager) leaveQueue(c *Client, queueKey string) {
+	m.qMu.Lock()
+	q := m.queues[queueKey]
+	for i, cl := range q {
+		if cl == c {
+			q = append(q[:i], q[i+1:]...)
+			break
+		}
+	}
+	m.setQueue(queueKey, q)
+	m.qMu.Unlock()
+	m.broadcastLobbyPlayers(queueKey)
+	c.send.close()
 }
 
 func (m *Manager) lobbyReadLoop(c *Client, queueKey string) {
 	defer func() {
-		m.qMu.Lock()
-		q := m.queues[queueKey]
-		for i, cl := range q {
-			if cl == c {
-				m.queues[queueKey] = append(q[:i], q[i+1:]...)
-				break
-			}
-		}
-		m.qMu.Unlock()
-		m.broadcastLobbyPlayers(queueKey)
+		m.leaveQueue(c, queueKey)
 		_ = c.conn.Close(websocket.StatusNormalClosure, "")
 	}()
 
 	for {
-		var msg struct {
-			Type    string          `json:"type"`
-			Payload json.RawMessage `json:"payload"`
-		}
-		if err := wsjson.Read(context.Background(), c.conn, &msg); err != nil {
+		_, data, err := c.conn.Read(context.Background())
+		if err != nil {
 			break
 		}
-		if msg.Type == "chat_message" {
-			var p struct {
-				Text string `json:"text"`
-			}
-			if json.Unmarshal(msg.Payload, &p) == nil {
-				out := map[string]any{
-					"type": "chat_message",
-					"payload": map[string]any{
-						"sender_name": c.Username,
-						"text":        p.Text,
-						"time":        time.Now(),
-					},
-				}
-				m.qMu.Lock()
-				for _, recipient := range m.queues[queueKey] {
-					select {
-					case recipient.send <- out:
-					default:
-					}
-				}
-				m.qMu.Unlock()
-			}
-		}
+		m.handleQueueMessage(c, queueKey, data)
+	}
+}
+
+// handleQueueMessage разбирает сообщение игрока в очереди подбора.
+func (m *Manager) handleQueueMessage(c *Client, queueKey string, data []byte) {
+	typ, payload, perr := c.codec.Decode(protocol.Client, data)
+	if perr != nil {
+		c.reject(perr)
+		return
+	}
+
+	switch p := payload.(type) {
+	case *protocol.Hello:
+		c.hello(p)
+	case *protocol.ChatSend:
+		m.queueChat(c, queueKey, p.Text)
+	default:
+		c.reject(protocol.NewError(protocol.ErrUnexpected, typ, "сообщение недоступно в очереди подбора"))
 	}
 }
 
@@ -299,6 +382,9 @@ func (m *Manager) matchmaker() {
 		case <-m.done:
 			return
 		case <-ticker.C:
+			if m.Draining() {
+				continue
+			}
 			m.qMu.Lock()
 			for k, q := range m.queues {
 				if len(q) < 2 {
@@ -323,6 +409,8 @@ func (m *Manager) matchmaker() {
 
 					if diff <= MatchmakingBaseRange+wait*MatchmakingTimeMult {
 						matched[i], matched[i+1] = true, true
+						m.metrics.wait.Observe(wait, k)
+						m.metrics.wait.Observe(time.Since(p2.joinTime).Seconds(), k)
 						go m.startMatch(p1, p2, lang, textMode)
 					}
 				}
@@ -332,7 +420,7 @@ func (m *Manager) matchmaker() {
 						next = append(next, c)
 					}
 				}
-				m.queues[k] = next
+				m.setQueue(k, next)
 			}
 			m.qMu.Unlock()
 		}
@@ -344,10 +432,10 @@ func (m *Manager) startMatch(p1, p2 *Client, lang, textMode string) {
 		MaxPlayers: 2, Language: lang, TextMode: textMode, Category: "general",
 	})
 
-	msg := map[string]any{"type": "match_found", "payload": map[string]string{"room_id": rid}}
+	msg := protocol.Message{Type: protocol.TypeMatchFound, Payload: protocol.MatchFound{RoomID: rid}}
 
-	p1.send <- msg
-	p2.send <- msg
+	p1.deliver(msg)
+	p2.deliver(msg)
 }
 
 func (m *Manager) CreateManualLobby(ownerID string) string {
@@ -366,14 +454,24 @@ func (m *Manager) CreateManualLobby(ownerID string) string {
 		clients:     make(map[string]*Client),
 		db:          m.db,
 		log:         m.log,
-		broadcast:   make(chan any, 256),
+		rules:       m.rules,
+		metrics:     m.metrics,
+		chat:        m.chat,
+		mutes:       chat.NewMutes(),
+		chatLog:     m.chatLog,
+		created:     time.Now(),
+		kicked:      make(map[string]bool),
+		broadcast:   make(chan protocol.Message, 256),
 		unregister:  make(chan string),
 		input:       make(chan *inputMsg, 64),
-		ChatHistory: make([]map[string]any, 0),
+		stop:        make(chan chan struct{}),
+		closing:     m.Draining(),
+		ChatHistory: make([]protocol.ChatMessage, 0),
 	}
 
 	m.rooms.Store(id, r)
-	go r.run(func() { m.rooms.Delete(id) })
+	m.registerRoom(id)
+	go r.run(func() { m.removeRoom(id) })
 	return id
 }
 
@@ -382,45 +480,51 @@ type Room struct {
 	Settings        Settings
 	State           int
 	Text            *db.Text
+	codeProgress    []int
 	StartTime       time.Time
 	clients         map[string]*Client
 	participants    []*Client
 	mu              sync.RWMutex
 	db              *db.DB
+	metrics         *gameMetrics
 	log             *slog.Logger
-	broadcast       chan any
+	rules           *text.Rules
+	chat            *chat.Moderator
+	mutes           *chat.Mutes
+	chatLog         chan<- chatRecord
+	created         time.Time
+	kicked          map[string]bool
+	broadcast       chan protocol.Message
 	unregister      chan string
 	input           chan *inputMsg
-	ChatHistory     []map[string]any
+	stop            chan chan struct{}
+	closing         bool
+	ChatHistory     []protocol.ChatMessage
 }
 
 type inputMsg struct {
 	c   *Client
 	idx int
+	at  time.Time
 }
 
 func (r *Room) run(cleanup func()) {
 	defer cleanup()
 	ticker := time.NewTicker(RoomUpdateTick)
+	pinger := time.NewTicker(PingInterval)
 	idle := time.NewTimer(RoomIdleTimeout)
 	defer ticker.Stop()
+	defer pinger.Stop()
 
 	for {
 		select {
 		case msg := <-r.broadcast:
-			r.mu.RLock()
-			for _, c := range r.clients {
-				select {
-				case c.send <- msg:
-				default:
-				}
-			}
-			r.mu.RUnlock()
+			r.deliverAll(msg)
 		case uid := <-r.unregister:
 			r.mu.Lock()
 			if c, ok := r.clients[uid]; ok {
 				delete(r.clients, uid)
-				close(c.send)
+				c.send.close()
 			}
 			isEmpty := len(r.clients) == 0
 			r.mu.Unlock()
@@ -432,23 +536,29 @@ func (r *Room) run(cleanup func()) {
 				r.sendPlayers()
 			}
 		case in := <-r.input:
-			r.handleInput(in.c, in.idx)
+			r.handleInput(in.c, in.idx, in.at)
+		case ack := <-r.stop:
+			r.flushBroadcast()
+			close(ack)
+		case <-pinger.C:
+			r.ping()
 		case <-ticker.C:
 			r.mu.RLock()
 			if r.State == StateGame {
-				list := make([]any, 0, len(r.clients))
+				list := make(protocol.StateUpdate, 0, len(r.clients))
 				for _, c := range r.clients {
 					c.mu.Lock()
-					list = append(list, map[string]any{
-						"user_id":  c.ID,
-						"username": c.Username,
-						"progress": c.Progress,
-						"wpm":      int(c.WPM),
+					list = append(list, protocol.PlayerState{
+						UserID:   c.ID,
+						Username: c.Username,
+						Progress: c.Progress,
+						WPM:      int(c.WPM),
+						Latency:  c.latency(),
 					})
 					c.mu.Unlock()
 				}
 				r.mu.RUnlock()
-				r.broadcast <- map[string]any{"type": "state_update", "payload": list}
+				r.broadcast <- protocol.Message{Type: protocol.TypeStateUpdate, Payload: list}
 			} else {
 				r.mu.RUnlock()
 			}
@@ -458,49 +568,76 @@ func (r *Room) run(cleanup func()) {
 	}
 }
 
+func (r *Room) deliverAll(msg protocol.Message) {
+	r.mu.RLock()
+	for _, c := range r.clients {
+		c.deliver(msg)
+	}
+	r.mu.RUnlock()
+}
+
+// flushBroadcast доставляет клиентам все, что уже поставлено в рассылку.
+func (r *Room) flushBroadcast() {
+	for {
+		select {
+		case msg := <-r.broadcast:
+			r.deliverAll(msg)
+		default:
+			return
+		}
+	}
+}
+
 func (r *Room) join(c *Client) {
 	r.mu.Lock()
 	if len(r.clients) >= r.Settings.MaxPlayers {
 		r.mu.Unlock()
-		_ = c.conn.Close(websocket.StatusPolicyViolation, "Lobby is full")
+		c.close(websocket.StatusPolicyViolation, "Lobby is full")
 		return
 	}
 
 	r.clients[c.ID] = c
 	if len(r.ChatHistory) > 0 {
-		c.send <- map[string]any{
-			"type":    "chat_history",
-			"payload": r.ChatHistory,
-		}
+		c.deliver(protocol.Message{
+			Type:    protocol.TypeChatHistory,
+			Payload: protocol.ChatHistory(append([]protocol.ChatMessage(nil), r.ChatHistory...)),
+		})
 	}
+	settings := r.Settings
 	r.mu.Unlock()
-	c.send <- map[string]any{"type": "update_settings", "payload": r.Settings}
+	c.deliver(protocol.Message{Type: protocol.TypeUpdateSettings, Payload: settings})
 	r.sendPlayers()
 }
 
 func (r *Room) sendPlayers() {
 	r.mu.RLock()
 	ownerID := r.Owner
-	list := make([]any, 0, len(r.clients))
+	list := make(protocol.Players, 0, len(r.clients))
 	for _, c := range r.clients {
 		c.mu.Lock()
-		list = append(list, map[string]any{
-			"user_id":  c.ID,
-			"username": c.Username,
-			"finished": c.Finished,
-			"is_ready": c.Ready,
-			"is_owner": c.ID == ownerID,
+		list = append(list, protocol.Player{
+			UserID:   c.ID,
+			Username: c.Username,
+			Finished: c.Finished,
+			IsReady:  c.Ready,
+			IsOwner:  c.ID == ownerID,
+			Latency:  c.latency(),
 		})
 		c.mu.Unlock()
 	}
 	r.mu.RUnlock()
-	r.broadcast <- map[string]any{"type": "player_joined", "payload": list}
+	r.broadcast <- protocol.Message{Type: protocol.TypePlayerJoined, Payload: list}
 }
 
 func (c *Client) writeLoop() {
-	for msg := range c.send {
+	defer c.send.stop()
+	for {
+		msg, ok := c.send.next()
+		if !ok {
+			return
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), WriteWait)
-		err := wsjson.Write(ctx, c.conn, msg)
+		err := c.write(ctx, msg)
 		cancel()
 		if err != nil {
 			return
@@ -511,105 +648,169 @@ func (c *Client) writeLoop() {
 func (c *Client) readLoop() {
 	defer func() { c.room.unregister <- c.ID }()
 	for {
-		var msg struct {
-			Type    string          `json:"type"`
-			Payload json.RawMessage `json:"payload"`
-		}
-		if err := wsjson.Read(context.Background(), c.conn, &msg); err != nil {
+		_, data, err := c.conn.Read(context.Background())
+		if err != nil {
 			break
 		}
+		c.handleMessage(data)
+	}
+}
 
-		switch msg.Type {
-		case "update_settings":
-			if c.ID != c.room.Owner {
-				continue
-			}
-			var newSettings struct {
-				MaxPlayers int    `json:"max_players"`
-				Language   string `json:"language"`
-				Category   string `json:"category"`
-			}
-
-			if err := json.Unmarshal(msg.Payload, &newSettings); err == nil {
-				c.room.mu.Lock()
-				currentPlayersCount := len(c.room.clients)
+// handleMessage разбирает сообщение игрока в комнате; ошибки возвращаются ему событием error.
+func (c *Client) handleMessage(data []byte) {
+	typ, payload, perr := c.codec.Decode(protocol.Client, data)
+	if perr != nil {
+		c.reject(perr)
+		return
+	}
 
-				if newSettings.MaxPlayers >= 1 && newSettings.MaxPlayers <= 8 {
-					if newSettings.MaxPlayers < currentPlayersCount {
-						c.room.Settings.MaxPlayers = currentPlayersCount
-					} else {
-						c.room.Settings.MaxPlayers = newSettings.MaxPlayers
-					}
-				}
+	switch p := payload.(type) {
+	case *protocol.Hello:
+		c.hello(p)
+	case *protocol.SettingsUpdate:
+		if c.ID != c.room.Owner {
+			c.reject(protocol.NewError(protocol.ErrForbidden, typ, "настройки меняет только владелец комнаты"))
+			return
+		}
 
-				if newSettings.Language != "" {
-					c.room.Settings.Language = newSettings.Language
-				}
-				if newSettings.Category != "" {
-					c.room.Settings.Category = newSettings.Category
-				}
+		c.room.mu.Lock()
+		currentPlayersCount := len(c.room.clients)
 
-				currentSettings := c.room.Settings
-				c.room.mu.Unlock()
-				c.room.broadcast <- map[string]any{
-					"type":    "update_settings",
-					"payload": currentSettings,
-				}
-				c.room.sendPlayers()
+		if p.MaxPlayers >= 1 {
+			if p.MaxPlayers < currentPlayersCount {
+				c.room.Settings.MaxPlayers = currentPlayersCount
+			} else {
+				c.room.Settings.MaxPlayers = p.MaxPlayers
 			}
+		}
 
-		case "client_input":
-			var p struct {
-				CurrentIndex int `json:"current_index"`
-				Accuracy     int `json:"accuracy"`
-			}
-			if json.Unmarshal(msg.Payload, &p) == nil {
-				c.mu.Lock()
-				c.Accuracy = p.Accuracy
-				c.mu.Unlock()
-				c.room.input <- &inputMsg{c, p.CurrentIndex}
-			}
-		case "player_ready":
-			c.mu.Lock()
-			c.Ready = !c.Ready
-			c.mu.Unlock()
-			if c.room.Mode == "solo" && c.Ready {
-				go c.room.startGame()
-			}
-			c.room.sendPlayers()
-		case "game_start":
+		if p.Language != "" {
+			c.room.Settings.Language = p.Language
+		}
+		if p.Category != "" {
+			c.room.Settings.Category = p.Category
+		}
+		if p.Difficulty != nil {
+			c.room.Settings.Difficulty = *p.Difficulty
+		}
+		if p.Subcategory != nil {
+			c.room.Settings.Subcategory = *p.Subcategory
+		}
+		if p.AutoIndent != nil {
+			c.room.Settings.AutoIndent = *p.AutoIndent
+		}
+
+		currentSettings := c.room.Settings
+		c.room.mu.Unlock()
+		c.room.broadcast <- protocol.Message{Type: protocol.TypeUpdateSettings, Payload: currentSettings}
+		c.room.sendPlayers()
+
+	case *protocol.ClientInput:
+		c.mu.Lock()
+		c.Accuracy = p.Accuracy
+		c.mu.Unlock()
+		c.room.input <- &inputMsg{c, p.CurrentIndex, c.inputTime(p.ClientTime, time.Now())}
+	case *protocol.Pong:
+		c.pong(p)
+	case *protocol.ClockSyncRequest:
+		c.clockSync(p)
+	case *protocol.ChatSend:
+		c.chat(p.Text)
+	case *protocol.Mute:
+		c.muteByOwner(p)
+	default:
+		switch typ {
+		case protocol.TypePlayerReady:
+			c.toggleReady()
+		case protocol.TypeGameStart:
 			go c.room.startGame()
-		case "chat_message":
-			var p struct {
-				Text string `json:"text"`
-			}
-			if json.Unmarshal(msg.Payload, &p) == nil {
-				newMsg := map[string]any{
-					"sender_id":   c.ID,
-					"sender_name": c.Username,
-					"text":        p.Text,
-					"time":        time.Now(),
-				}
+		default:
+			c.reject(protocol.NewError(protocol.ErrUnexpected, typ, "сообщение недоступно в комнате"))
+		}
+	}
+}
 
-				c.room.mu.Lock()
-				c.room.ChatHistory = append(c.room.ChatHistory, newMsg)
-				if len(c.room.ChatHistory) > 50 {
-					c.room.ChatHistory = c.room.ChatHistory[1:]
-				}
-				c.room.mu.Unlock()
+// toggleReady переключает готовность игрока; в одиночном режиме готовность запускает заезд.
+func (c *Client) toggleReady() bool {
+	c.mu.Lock()
+	c.Ready = !c.Ready
+	ready := c.Ready
+	c.mu.Unlock()
+	if c.room.Mode == "solo" && ready {
+		go c.room.startGame()
+	}
+	c.room.sendPlayers()
+	return ready
+}
 
-				c.room.broadcast <- map[string]any{
-					"type":    "chat_message",
-					"payload": newMsg,
-				}
+// hello согласует версию протокола; устаревший клиент получает ошибку и отключается.
+func (c *Client) hello(p *protocol.Hello) {
+	v, perr := protocol.Negotiate(p.Version)
+	if perr != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), WriteWait)
+		_ = c.write(ctx, protocol.Message{Type: protocol.TypeError, Payload: perr})
+		cancel()
+		c.close(websocket.StatusPolicyViolation, protocol.ErrUnsupportedVersion)
+		return
+	}
+	c.setVersion(v)
+	c.deliver(protocol.Message{Type: protocol.TypeWelcome, Payload: protocol.Welcome{Version: v, ServerVersion: protocol.Version}})
+}
+
+// setVersion запоминает согласованную версию протокола. Комната читает ее из своей
+// горутины, поэтому запись идет под c.mu.
+func (c *Client) setVersion(v int) {
+	c.mu.Lock()
+	c.version = v
+	c.mu.Unlock()
+}
+
+// protoVersion возвращает согласованную версию протокола клиента.
+func (c *Client) protoVersion() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+func (c *Client) reject(e *protocol.Error) {
+	c.deliver(protocol.Message{Type: protocol.TypeError, Payload: e})
+}
+
+// readJoin ждет join от игрока, встающего в очередь; перед ним допускается hello.
+func (c *Client) readJoin(ctx context.Context) (*protocol.JoinQueue, error) {
+	for {
+		_, data, err := c.conn.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		typ, payload, perr := c.codec.Decode(protocol.Client, data)
+		if perr == nil && typ != protocol.TypeJoinQueue && typ != protocol.TypeHello {
+			perr = protocol.NewError(protocol.ErrUnexpected, typ, "ожидалось сообщение join")
+		}
+		if perr != nil {
+			_ = c.write(ctx, protocol.Message{Type: protocol.TypeError, Payload: perr})
+			return nil, perr
+		}
+
+		if h, ok := payload.(*protocol.Hello); ok {
+			v, perr := protocol.Negotiate(h.Version)
+			if perr != nil {
+				_ = c.write(ctx, protocol.Message{Type: protocol.TypeError, Payload: perr})
+				return nil, perr
+			}
+			c.setVersion(v)
+			if err := c.write(ctx, protocol.Message{Type: protocol.TypeWelcome, Payload: protocol.Welcome{Version: v, ServerVersion: protocol.Version}}); err != nil {
+				return nil, err
 			}
+			continue
 		}
+		return payload.(*protocol.JoinQueue), nil
 	}
 }
 
 func (r *Room) startGame() {
 	r.mu.Lock()
-	if r.State != StateLobby {
+	if r.State != StateLobby || r.closing {
 		r.mu.Unlock()
 		return
 	}
@@ -620,6 +821,15 @@ func (r *Room) startGame() {
 	var err error
 	if r.Settings.TextMode == "generate" {
 		t, err = r.db.GenerateText(context.Background(), r.Settings.Language)
+	} else if r.Settings.TextID == 0 && (r.Settings.Difficulty.IsSet() || r.Settings.Category == text.CodeCategory) {
+		lang, rng := r.Settings.Language, r.Settings.Difficulty
+		if r.Settings.Category == text.CodeCategory {
+			lang = ""
+		}
+		if !rng.IsSet() {
+			rng = DifficultyRange{Min: text.DifficultyMin, Max: text.DifficultyMax}
+		}
+		t, err = r.db.GetTextInRange(context.Background(), lang, r.Settings.Category, r.Settings.Subcategory, rng.Min, rng.Max)
 	} else {
 		t, err = r.db.GetText(context.Background(), r.Settings.Language, r.Settings.Category, r.Settings.TextID)
 	}
@@ -631,37 +841,53 @@ func (r *Room) startGame() {
 		return
 	}
 
+	t.Content = r.rules.Normalize(t.Content, r.Settings.Language)
+	t.Length = text.Length(t.Content)
+
+	isCode := r.Settings.Category == text.CodeCategory
+
 	r.mu.Lock()
 	r.Text = t
+	r.codeProgress = nil
+	if isCode {
+		r.codeProgress = text.CodeProgress(t.Content)
+	}
 	r.State = StateGame
 	r.StartTime = time.Now().Add(StartDelay)
 	r.participants = make([]*Client, 0, len(r.clients))
-	playersInfo := make([]map[string]any, 0, len(r.clients))
+	playersInfo := make(protocol.Players, 0, len(r.clients))
 	for _, c := range r.clients {
 		c.mu.Lock()
 		c.Progress, c.WPM, c.Accuracy, c.Finished, c.Disqualified, c.lastIdx, c.lastInput, c.intervals = 0, 0, 100, false, false, 0, r.StartTime, nil
 		c.mu.Unlock()
 		r.participants = append(r.participants, c)
-		playersInfo = append(playersInfo, map[string]any{
-			"user_id":  c.ID,
-			"username": c.Username,
-		})
+		playersInfo = append(playersInfo, protocol.Player{UserID: c.ID, Username: c.Username})
 	}
 	r.mu.Unlock()
 
-	r.broadcast <- map[string]any{
-		"type": "game_start",
-		"payload": map[string]any{
-			"text":       t.Content,
-			"start_time": r.StartTime,
-			"players":    playersInfo,
-		},
-	}
+	r.broadcast <- protocol.Message{Type: protocol.TypeGameStart, Payload: protocol.GameStart{
+		Text:        t.Content,
+		Difficulty:  t.Difficulty,
+		TextID:      t.ID,
+		Title:       t.Title,
+		Author:      t.Author,
+		Code:        isCode,
+		CodeLang:    t.Subcategory,
+		AutoIndent:  r.Settings.AutoIndent,
+		Equivalents: r.rules.EquivalentsFor(r.Settings.Language),
+		StartTime:   r.StartTime,
+		Players:     playersInfo,
+	}}
 }
 
-func (r *Room) handleInput(c *Client, idx int) {
+// handleInput учитывает прогресс игрока; at — момент ввода по часам сервера
+// с поправкой на задержку, нулевое значение означает момент обработки.
+func (r *Room) handleInput(c *Client, idx int, at time.Time) {
+	if at.IsZero() {
+		at = time.Now()
+	}
 	r.mu.RLock()
-	if r.State != StateGame || time.Now().Before(r.StartTime) {
+	if r.State != StateGame || at.Before(r.StartTime) {
 		r.mu.RUnlock()
 		return
 	}
@@ -674,8 +900,16 @@ func (r *Room) handleInput(c *Client, idx int) {
 	}
 
 	c.lastIdx, c.Progress = idx, float64(idx)
-	if m := time.Since(r.StartTime).Minutes(); m > 0 {
-		c.WPM = (float64(idx) / WPMCharCount) / m
+	if at.Before(c.lastInput) {
+		at = c.lastInput
+	}
+	c.lastInput = at
+	chars := idx
+	if r.codeProgress != nil {
+		chars = r.codeProgress[min(idx, len(r.codeProgress)-1)]
+	}
+	if m := at.Sub(r.StartTime).Minutes(); m > 0 {
+		c.WPM = (float64(chars) / WPMCharCount) / m
 	}
 	c.Finished = idx >= r.Text.Length
 	finished := c.Finished
@@ -705,6 +939,9 @@ func (r *Room) finish() {
 		return
 	}
 	r.State = StateFinished
+	if r.metrics != nil {
+		r.metrics.races.Inc(r.Mode)
+	}
 
 	type resEntry struct {
 		ID       string
@@ -712,6 +949,8 @@ func (r *Room) finish() {
 		WPM      int
 		Accuracy float64
 		Rating   int
+		Latency  int
+		Finished bool
 	}
 
 	tempRes := make([]resEntry, 0, len(r.participants))
@@ -727,14 +966,22 @@ func (r *Room) finish() {
 			WPM:      wpm,
 			Accuracy: float64(c.Accuracy),
 			Rating:   c.Rating,
+			Latency:  c.latency(),
+			Finished: c.Finished,
 		})
 		c.mu.Unlock()
 	}
 	r.mu.Unlock()
 
-	sort.Slice(tempRes, func(i, j int) bool { return tempRes[i].WPM > tempRes[j].WPM })
+	// При принудительном завершении дошедшие до конца текста идут выше остальных.
+	sort.Slice(tempRes, func(i, j int) bool {
+		if tempRes[i].Finished != tempRes[j].Finished {
+			return tempRes[i].Finished
+		}
+		return tempRes[i].WPM > tempRes[j].WPM
+	})
 
-	finalStates := make([]any, len(tempRes))
+	finalStates := make([]protocol.Result, len(tempRes))
 	dbResults := make([]db.MatchResult, len(tempRes))
 
 	for i, entry := range tempRes {
@@ -764,10 +1011,13 @@ func (r *Room) finish() {
 			WPM:      entry.WPM,
 			Accuracy: entry.Accuracy,
 			Rank:     i + 1,
+			Latency:  entry.Latency,
 		}
 	}
 
-	_ = r.db.SaveMatch(context.Background(), r.Text.ID, dbResults)
+	if mid, err := r.db.SaveMatch(context.Background(), r.Text.ID, dbResults); err == nil {
+		r.persist(chatRecord{matchID: mid})
+	}
 
 	for i, entry := range tempRes {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
@@ -786,18 +1036,19 @@ func (r *Room) finish() {
 			newAvgWpm = updatedUser.AvgWpm
 		}
 
-		finalStates[i] = map[string]any{
-			"user_id":       entry.ID,
-			"username":      entry.Name,
-			"wpm":           entry.WPM,
-			"accuracy":      entry.Accuracy,
-			"finished":      true,
-			"new_rating":    newRating, 
-			"new_avg_wpm":   newAvgWpm, 
+		finalStates[i] = protocol.Result{
+			UserID:    entry.ID,
+			Username:  entry.Name,
+			WPM:       entry.WPM,
+			Accuracy:  entry.Accuracy,
+			Finished:  entry.Finished,
+			NewRating: newRating,
+			NewAvgWpm: newAvgWpm,
+			Latency:   entry.Latency,
 		}
 	}
 
-	r.broadcast <- map[string]any{"type": "game_end", "payload": map[string]any{"results": finalStates}}
+	r.broadcast <- protocol.Message{Type: protocol.TypeGameEnd, Payload: protocol.GameEnd{Results: finalStates}}
 }
 
 func calculateElo(ra, rb int, score float64) int {
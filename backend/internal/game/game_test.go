@@ -2,17 +2,23 @@ package game
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
+	"uplink/backend/internal/chat"
+	"uplink/backend/internal/cluster"
 	"uplink/backend/internal/db"
+	"uplink/backend/internal/text"
+	"uplink/protocol"
 
 	"github.com/coder/websocket"
 	"github.com/coder/websocket/wsjson"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestGame(t *testing.T) (*Manager, *db.DB) {
@@ -30,6 +36,48 @@ func setupTestGame(t *testing.T) (*Manager, *db.DB) {
 	return manager, dbConn
 }
 
+// uidServer поднимает сервер игры, который подключает игрока из параметра uid:
+// /ws/presence — к сокету меню, остальные пути — к игровому сокету.
+func uidServer(m *Manager) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid := r.URL.Query().Get("uid")
+		if r.URL.Path == "/ws/presence" {
+			m.HandlePresenceWS(w, r, uid, uid)
+			return
+		}
+		m.HandleWS(w, r, uid, uid)
+	}))
+}
+
+// dialWS подключается к сокету тестового сервера по пути path с параметрами.
+func dialWS(ctx context.Context, t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.Dial(ctx, "ws"+server.URL[4:]+path, nil)
+	require.NoError(t, err, "ошибка подключения к %s", path)
+	return conn
+}
+
+// readMessage читает сокет до сообщения типа typ и возвращает его целиком.
+func readMessage(ctx context.Context, t *testing.T, conn *websocket.Conn, typ string) map[string]any {
+	t.Helper()
+	for {
+		var msg map[string]any
+		if err := wsjson.Read(ctx, conn, &msg); err != nil {
+			t.Fatalf("не получено событие %s: %v", typ, err)
+		}
+		if msg["type"] == typ {
+			return msg
+		}
+	}
+}
+
+// readEvent читает сокет до сообщения типа typ и возвращает его нагрузку-объект.
+func readEvent(ctx context.Context, t *testing.T, conn *websocket.Conn, typ string) map[string]any {
+	t.Helper()
+	payload, _ := readMessage(ctx, t, conn, typ)["payload"].(map[string]any)
+	return payload
+}
+
 // Подсчет рейтинга
 func TestCalculateElo(t *testing.T) {
 	tests := []struct {
@@ -128,7 +176,7 @@ func TestGameFlow(t *testing.T) {
 	client := &Client{
 		ID:        userID,
 		Username:  username,
-		send:      make(chan any, 64),
+		send:      newOutbox(),
 		room:      room,
 		lastInput: time.Now(),
 		Progress:  0,
@@ -235,3 +283,573 @@ func TestWebSocketIntegration(t *testing.T) {
 
 	assert.Contains(t, response, "type", "ответ должен содержать поле type")
 }
+
+// Скорость в режиме кода считается без пробельных символов
+func TestCodeModeWPM(t *testing.T) {
+	content := "if x {\n\t\ty()\n}"
+	room := &Room{
+		State:        StateGame,
+		StartTime:    time.Now().Add(-time.Minute),
+		Text:         &db.Text{Content: content, Length: text.Length(content)},
+		codeProgress: text.CodeProgress(content),
+	}
+	client := &Client{ID: "code_user"}
+
+	room.handleInput(client, 10, time.Time{})
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.InDelta(t, 5.0/WPMCharCount, client.WPM, 0.05, "отступы и переводы строк не должны учитываться")
+}
+
+// Отметка времени клиента принимается только в пределах его задержки
+func TestLagCompensation(t *testing.T) {
+	now := time.Now()
+	client := &Client{ID: "lag_user"}
+	client.recordRTT(200 * time.Millisecond)
+	client.recordRTT(-time.Second)
+	client.recordRTT(time.Minute)
+	assert.Equal(t, 200, client.latency(), "недостоверные замеры RTT не учитываются")
+
+	window := 100*time.Millisecond + LagJitter
+	assert.Equal(t, now.Add(-50*time.Millisecond).UnixMilli(), client.inputTime(now.Add(-50*time.Millisecond).UnixMilli(), now).UnixMilli())
+	assert.Equal(t, now.Add(-window), client.inputTime(now.Add(-time.Second).UnixMilli(), now), "ввод нельзя сдвинуть дальше половины RTT")
+	assert.Equal(t, now, client.inputTime(now.Add(time.Second).UnixMilli(), now), "ввод из будущего прижимается к моменту получения")
+	assert.Equal(t, now, client.inputTime(0, now))
+
+	client.recordRTT(10 * time.Second)
+	assert.Equal(t, now.Add(-MaxLagCompensation), client.inputTime(now.Add(-time.Second).UnixMilli(), now))
+
+	room := &Room{
+		State:     StateGame,
+		StartTime: now.Add(-time.Minute),
+		Text:      &db.Text{Content: "hello world", Length: 11},
+	}
+	client = &Client{ID: "wpm_user", lastInput: room.StartTime}
+	room.handleInput(client, 10, room.StartTime.Add(30*time.Second))
+	client.mu.Lock()
+	assert.InDelta(t, 4.0, client.WPM, 0.01, "WPM считается по моменту ввода, а не получения")
+	client.mu.Unlock()
+}
+
+// Очередь клиента склеивает state_update, не теряет важные события и отключает медленного клиента
+func TestOutboxBackpressure(t *testing.T) {
+	now := time.Now()
+	o := newOutbox()
+
+	o.push(protocol.Message{Type: protocol.TypeStateUpdate, Payload: protocol.StateUpdate{{WPM: 10}}}, now)
+	o.push(protocol.Message{Type: protocol.TypeChatMessage}, now)
+	o.push(protocol.Message{Type: protocol.TypeStateUpdate, Payload: protocol.StateUpdate{{WPM: 20}}}, now)
+	msg, ok := o.next()
+	assert.True(t, ok)
+	assert.Equal(t, protocol.StateUpdate{{WPM: 20}}, msg.Payload, "отправляется только последнее состояние")
+	msg, _ = o.next()
+	assert.Equal(t, protocol.TypeChatMessage, msg.Type)
+	assert.Equal(t, uint64(1), o.snapshot().Coalesced)
+
+	for range OutboxSize {
+		o.push(protocol.Message{Type: protocol.TypePing}, now)
+	}
+	assert.False(t, o.push(protocol.Message{Type: protocol.TypeChatMessage}, now))
+	assert.False(t, o.push(protocol.Message{Type: protocol.TypeGameEnd}, now))
+	stats := o.snapshot()
+	assert.Equal(t, uint64(1), stats.Dropped, "при переполнении отбрасываются только второстепенные сообщения")
+	assert.Equal(t, OutboxSize+1, stats.Len)
+
+	assert.True(t, o.push(protocol.Message{Type: protocol.TypeGameStart}, now.Add(SlowConsumerGrace)), "клиент не разбирает очередь дольше допустимого")
+	assert.True(t, o.snapshot().Evicted)
+	_, ok = o.next()
+	assert.False(t, ok)
+	assert.False(t, o.push(protocol.Message{Type: protocol.TypeGameEnd}, now), "после отключения очередь не принимает сообщения")
+
+	o = newOutbox()
+	evicted := false
+	for range OutboxHardLimit {
+		evicted = o.push(protocol.Message{Type: protocol.TypePlayerJoined}, now)
+	}
+	assert.True(t, evicted, "очередь не растет дальше жесткого предела")
+}
+
+// Игрок подключается к узлу, на котором нет комнаты, и играет через шину
+func TestMultiInstanceJoin(t *testing.T) {
+	mem := cluster.NewMemory()
+	nodeA, _ := setupTestGame(t)
+	defer nodeA.Shutdown()
+	nodeB, _ := setupTestGame(t)
+	defer nodeB.Shutdown()
+	nodeA.UseCluster("node_a", mem, mem)
+	nodeB.UseCluster("node_b", mem, mem)
+
+	roomID := nodeA.CreateManualLobby("remote_owner")
+	owner, err := mem.Lookup(context.Background(), roomID)
+	assert.NoError(t, err)
+	assert.Equal(t, "node_a", owner, "комната должна принадлежать узлу A")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodeB.HandleWS(w, r, "remote_owner", "RemoteAgent")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialWS(ctx, t, server, "/ws?room_id="+roomID)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	readEvent(ctx, t, conn, "update_settings")
+	players := readMessage(ctx, t, conn, "player_joined")["payload"].([]any)
+	assert.Len(t, players, 1)
+	assert.Equal(t, true, players[0].(map[string]any)["is_owner"], "владелец должен опознаваться на чужом узле")
+
+	err = wsjson.Write(ctx, conn, map[string]any{
+		"type":    "chat_message",
+		"payload": map[string]any{"text": "hello from node b"},
+	})
+	assert.NoError(t, err)
+	chat := readEvent(ctx, t, conn, "chat_message")
+	assert.Equal(t, "hello from node b", chat["text"])
+
+	val, _ := nodeA.rooms.Load(roomID)
+	room := val.(*Room)
+	room.mu.RLock()
+	assert.Len(t, room.ChatHistory, 1, "сообщение должно попасть в историю комнаты на узле A")
+	room.mu.RUnlock()
+
+	conn.Close(websocket.StatusNormalClosure, "")
+	assert.Eventually(t, func() bool {
+		_, err := mem.Lookup(context.Background(), roomID)
+		return err != nil
+	}, 2*time.Second, 20*time.Millisecond, "пустая комната должна исчезнуть из каталога")
+}
+
+// Неизвестные и некорректные сообщения получают ответ error
+func TestProtocolErrors(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("proto_owner")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.HandleWS(w, r, "proto_guest", "Guest")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn := dialWS(ctx, t, server, "/ws?room_id="+roomID)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+
+	assert.NoError(t, wsjson.Write(ctx, conn, map[string]any{"type": "hello", "payload": map[string]any{"version": protocol.Version}}))
+	welcome := readEvent(ctx, t, conn, "welcome")
+	assert.EqualValues(t, protocol.Version, welcome["version"])
+
+	assert.NoError(t, wsjson.Write(ctx, conn, map[string]any{"type": "lobby_update"}))
+	e := readEvent(ctx, t, conn, "error")
+	assert.Equal(t, protocol.ErrUnknownType, e["code"])
+	assert.Equal(t, "lobby_update", e["type"])
+
+	assert.NoError(t, wsjson.Write(ctx, conn, map[string]any{"type": "update_settings", "payload": map[string]any{"max_players": 4}}))
+	e = readEvent(ctx, t, conn, "error")
+	assert.Equal(t, protocol.ErrForbidden, e["code"], "гость не может менять настройки")
+}
+
+// Клиент, предложивший бинарный подпротокол, получает бинарные кадры
+func TestBinarySubprotocol(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("bin_owner")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.HandleWS(w, r, "bin_owner", "BinAgent")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+server.URL[4:]+"/ws?room_id="+roomID, &websocket.DialOptions{
+		Subprotocols: []string{protocol.SubprotocolJSON, protocol.SubprotocolBinary},
+	})
+	assert.NoError(t, err)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	assert.Equal(t, protocol.SubprotocolBinary, conn.Subprotocol(), "сервер должен предпочесть бинарный формат")
+
+	frame, err := protocol.Binary.Encode(protocol.Message{Type: protocol.TypeChatMessage, Payload: protocol.ChatSend{Text: "bin"}})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Write(ctx, websocket.MessageBinary, frame))
+
+	for {
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatalf("не получено сообщение чата: %v", err)
+		}
+		assert.Equal(t, websocket.MessageBinary, typ)
+		msgType, payload, perr := protocol.Binary.Decode(protocol.Server, data)
+		assert.Nil(t, perr)
+		if msgType == protocol.TypeChatMessage {
+			assert.Equal(t, "bin", payload.(*protocol.ChatMessage).Text)
+			break
+		}
+	}
+}
+
+// Игроки, вставшие в подбор на разных узлах, попадают в одну очередь и в один заезд
+func TestClusterMatchmaking(t *testing.T) {
+	mem := cluster.NewMemory()
+	nodeA, _ := setupTestGame(t)
+	defer nodeA.Shutdown()
+	nodeB, _ := setupTestGame(t)
+	defer nodeB.Shutdown()
+	nodeA.UseCluster("node_a", mem, mem)
+	nodeB.UseCluster("node_b", mem, mem)
+	serverA, serverB := uidServer(nodeA), uidServer(nodeB)
+	defer serverA.Close()
+	defer serverB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	join := map[string]any{"type": "join", "payload": map[string]any{"mode": "ranked", "language": "ru", "textMode": "standard"}}
+	first := dialWS(ctx, t, serverA, "/ws?uid=queue_first")
+	defer first.Close(websocket.StatusNormalClosure, "")
+	require.NoError(t, wsjson.Write(ctx, first, join))
+	readMessage(ctx, t, first, "player_joined")
+	second := dialWS(ctx, t, serverB, "/ws?uid=queue_second")
+	defer second.Close(websocket.StatusNormalClosure, "")
+	require.NoError(t, wsjson.Write(ctx, second, join))
+
+	players := readMessage(ctx, t, second, "player_joined")["payload"].([]any)
+	assert.Len(t, players, 2, "очередь ведет узел A, игрок с узла B видит обоих")
+	assert.Len(t, nodeB.Queues(), 0, "у узла B своей очереди нет")
+
+	roomA := readEvent(ctx, t, first, "match_found")["room_id"]
+	roomB := readEvent(ctx, t, second, "match_found")["room_id"]
+	require.NotEmpty(t, roomA)
+	assert.Equal(t, roomA, roomB, "игроки с разных узлов подобраны в один заезд")
+	nodeA.qMu.Lock()
+	assert.Empty(t, nodeA.queues, "опустевшая очередь удаляется")
+	nodeA.qMu.Unlock()
+}
+
+// При остановке идущий заезд завершается к сроку, результаты рассылаются, сокеты закрываются
+func TestGracefulDrain(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("drain_owner")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.HandleWS(w, r, "drain_owner", "Drainer")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn := dialWS(ctx, t, server, "/ws?room_id="+roomID)
+	defer conn.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, conn, "update_settings")
+
+	val, _ := manager.rooms.Load(roomID)
+	room := val.(*Room)
+	room.mu.Lock()
+	client := room.clients["drain_owner"]
+	room.State = StateGame
+	room.StartTime = time.Now().Add(-time.Minute)
+	room.Text = &db.Text{Content: "hello world", Length: 11}
+	room.participants = []*Client{client}
+	room.mu.Unlock()
+	room.handleInput(client, 5, time.Time{})
+
+	drainCtx, stop := context.WithTimeout(context.Background(), DrainCloseMargin+500*time.Millisecond)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		manager.Drain(drainCtx)
+		close(drained)
+	}()
+
+	readEvent(ctx, t, conn, "server_shutdown")
+	results := readEvent(ctx, t, conn, "game_end")["results"].([]any)
+	assert.Len(t, results, 1)
+	assert.Equal(t, false, results[0].(map[string]any)["finished"], "заезд завершен принудительно")
+
+	_, _, err := conn.Read(ctx)
+	assert.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+	<-drained
+	assert.True(t, manager.Draining())
+
+	queue := dialWS(ctx, t, server, "/ws")
+	_, _, err = queue.Read(ctx)
+	assert.Equal(t, websocket.StatusTryAgainLater, websocket.CloseStatus(err), "новые игроки не принимаются")
+}
+
+// Управление комнатами и игроками из админки
+func TestAdminControls(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("admin_owner")
+	server := uidServer(manager)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	owner := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=admin_owner")
+	defer owner.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, owner, "update_settings")
+	guest := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=admin_guest")
+	defer guest.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, guest, "update_settings")
+
+	assert.Eventually(t, func() bool {
+		info, err := manager.Room(roomID)
+		return err == nil && len(info.Clients) == 2
+	}, time.Second, 10*time.Millisecond)
+	rooms := manager.Rooms()
+	assert.Len(t, rooms, 1)
+	assert.Equal(t, "lobby", rooms[0].State)
+	assert.ErrorIs(t, manager.FinishRoom(roomID), ErrNotRacing, "в лобби завершать нечего")
+	assert.ErrorIs(t, manager.FinishRoom("missing"), ErrRoomNotFound)
+
+	manager.Announce("плановые работы")
+	msg := readEvent(ctx, t, guest, "chat_message")
+	assert.Equal(t, SystemSender, msg["sender_name"])
+	assert.Equal(t, "плановые работы", msg["text"])
+	assert.Equal(t, "плановые работы", readEvent(ctx, t, owner, "chat_message")["text"], "объявление получают все игроки")
+
+	manager.KickUser("admin_guest")
+	_, _, err := guest.Read(ctx)
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+
+	assert.NoError(t, manager.CloseRoom(roomID, "комната закрыта администратором"))
+	assert.Equal(t, "комната закрыта администратором", readEvent(ctx, t, owner, "chat_message")["text"])
+	_, _, err = owner.Read(ctx)
+	assert.Equal(t, websocket.StatusNormalClosure, websocket.CloseStatus(err))
+	_, err = manager.Room(roomID)
+	assert.ErrorIs(t, err, ErrRoomNotFound, "закрытая комната пропадает из списка")
+}
+
+// Модерация чата: фильтр слов, лимит частоты, заглушение владельцем и контекст жалобы
+func TestChatModeration(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+	manager.SetChatPolicy(&chat.Policy{MaxLength: 50, Rate: 0.01, Burst: 2, Words: map[string][]string{"ru": {"спам"}}})
+
+	roomID := manager.CreateManualLobby("chat_owner")
+	server := uidServer(manager)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	send := func(conn *websocket.Conn, typ string, payload any) {
+		assert.NoError(t, wsjson.Write(ctx, conn, map[string]any{"type": typ, "payload": payload}))
+	}
+
+	owner := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=chat_owner")
+	defer owner.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, owner, "update_settings")
+	guest := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=chat_guest")
+	defer guest.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, guest, "update_settings")
+
+	send(guest, "chat_message", map[string]string{"text": "это СПАМ"})
+	msg := readEvent(ctx, t, owner, "chat_message")
+	assert.Equal(t, "это ****", msg["text"])
+	assert.NotEmpty(t, msg["id"])
+
+	_, around, err := manager.ChatContext(roomID, "chat_owner", msg["id"].(string))
+	assert.NoError(t, err)
+	assert.Len(t, around, 1)
+	_, _, err = manager.ChatContext(roomID, "stranger", msg["id"].(string))
+	assert.ErrorIs(t, err, ErrNotInRoom)
+	_, _, err = manager.ChatContext(roomID, "chat_owner", "missing")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+
+	send(guest, "chat_message", map[string]string{"text": "второе"})
+	readEvent(ctx, t, owner, "chat_message")
+	send(guest, "chat_message", map[string]string{"text": "третье"})
+	assert.Equal(t, protocol.ErrRateLimited, readEvent(ctx, t, guest, "error")["code"])
+
+	send(guest, "mute", map[string]any{"user_id": "chat_owner", "seconds": 60})
+	assert.Equal(t, protocol.ErrForbidden, readEvent(ctx, t, guest, "error")["code"], "заглушать может только владелец")
+
+	send(owner, "mute", map[string]any{"user_id": "chat_guest", "seconds": 60})
+	assert.Equal(t, "chat_guest заглушен на 1 мин", readEvent(ctx, t, guest, "chat_message")["text"])
+	send(guest, "chat_message", map[string]string{"text": "молчу"})
+	assert.Equal(t, protocol.ErrMuted, readEvent(ctx, t, guest, "error")["code"])
+
+	assert.NoError(t, manager.MuteUser(roomID, "chat_guest", 0))
+	assert.Equal(t, "chat_guest снова может писать в чат", readEvent(ctx, t, guest, "chat_message")["text"])
+	assert.ErrorIs(t, manager.MuteUser(roomID, "stranger", time.Minute), ErrNotInRoom)
+}
+
+// Команды чата: разбор, ответы автору, действия от третьего лица и исключение игрока
+func TestChatCommands(t *testing.T) {
+	for text, want := range map[string]string{"/roll 20": "roll", " /ME машет": "me", "/": "", "/ hi": "", "//me": "", "привет": ""} {
+		name, _, ok := parseCommand(text)
+		assert.Equal(t, want != "", ok, text)
+		assert.Equal(t, want, name, text)
+	}
+
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("cmd_owner")
+	server := uidServer(manager)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	say := func(conn *websocket.Conn, text string) {
+		assert.NoError(t, wsjson.Write(ctx, conn, map[string]any{"type": "chat_message", "payload": map[string]string{"text": text}}))
+	}
+
+	owner := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=cmd_owner")
+	defer owner.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, owner, "update_settings")
+	guest := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=cmd_guest")
+	defer guest.Close(websocket.StatusNormalClosure, "")
+	readEvent(ctx, t, guest, "update_settings")
+
+	say(guest, "/help")
+	msg := readEvent(ctx, t, guest, "chat_message")
+	assert.Equal(t, SystemSender, msg["sender_name"])
+	assert.Contains(t, msg["text"], "/roll [N]")
+
+	say(guest, "/start")
+	assert.Contains(t, readEvent(ctx, t, guest, "chat_message")["text"], "только владелец")
+	say(guest, "/dance")
+	assert.Contains(t, readEvent(ctx, t, guest, "chat_message")["text"], "неизвестная команда /dance")
+
+	say(guest, "/me машет рукой")
+	msg = readEvent(ctx, t, owner, "chat_message")
+	assert.Equal(t, "машет рукой", msg["text"])
+	assert.Equal(t, true, msg["action"])
+	assert.Equal(t, "cmd_guest", msg["sender_id"])
+
+	say(owner, "/roll 6")
+	msg = readEvent(ctx, t, owner, "chat_message")
+	assert.Regexp(t, `^выбрасывает [1-6] \(1–6\)$`, msg["text"])
+	info, _ := manager.Room(roomID)
+	assert.Len(t, info.ChatHistory, 2, "действия попадают в историю, ответы автору — нет")
+
+	say(owner, "/kick CMD_GUEST")
+	assert.Equal(t, "cmd_guest исключен из комнаты", readEvent(ctx, t, owner, "chat_message")["text"])
+	var err error
+	for err == nil {
+		_, _, err = guest.Read(ctx)
+	}
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err))
+
+	again := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=cmd_guest")
+	defer again.Close(websocket.StatusNormalClosure, "")
+	_, _, err = again.Read(ctx)
+	assert.Equal(t, websocket.StatusPolicyViolation, websocket.CloseStatus(err), "исключенный игрок не возвращается в комнату")
+}
+
+// Присутствие по живым клиентам и доставка уведомлений в сокет меню
+func TestPresenceInvite(t *testing.T) {
+	manager, _ := setupTestGame(t)
+	defer manager.Shutdown()
+
+	roomID := manager.CreateManualLobby("presence_owner")
+	server := uidServer(manager)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	owner := dialWS(ctx, t, server, "/ws?room_id="+roomID+"&uid=presence_owner")
+	defer owner.Close(websocket.StatusNormalClosure, "")
+	friend := dialWS(ctx, t, server, "/ws/presence?uid=presence_friend")
+	defer friend.Close(websocket.StatusNormalClosure, "")
+
+	assert.Eventually(t, func() bool {
+		p := manager.Presence([]string{"presence_owner", "presence_friend"})
+		return p["presence_owner"].Status == PresenceInLobby && p["presence_friend"].Status == PresenceOnline
+	}, time.Second, 10*time.Millisecond)
+	p := manager.Presence([]string{"presence_owner", "nobody"})
+	assert.Equal(t, roomID, p["presence_owner"].RoomID)
+	assert.Equal(t, PresenceOffline, p["nobody"].Status)
+
+	_, err := manager.Invite("presence_owner", "Owner", "presence_owner", roomID)
+	assert.ErrorIs(t, err, ErrInviteSelf)
+	_, err = manager.Invite("presence_owner", "Owner", "presence_friend", "missing")
+	assert.ErrorIs(t, err, ErrRoomNotFound)
+	_, err = manager.Invite("presence_friend", "Friend", "presence_owner", roomID)
+	assert.ErrorIs(t, err, ErrNotInRoom, "приглашает только участник комнаты")
+	invite, err := manager.Invite("presence_owner", "Owner", "presence_friend", roomID)
+	assert.NoError(t, err)
+	assert.Equal(t, roomID, invite.RoomID)
+
+	// Уведомление уходит только в сокет меню, игровой сокет его не получает
+	data, _ := json.Marshal(invite)
+	manager.PushUser("presence_friend", protocol.Message{Type: protocol.TypeNotification, Payload: protocol.Notification{ID: 7, Kind: "lobby_invite", Data: data}})
+	manager.PushUser("presence_owner", protocol.Message{Type: protocol.TypeNotification, Payload: protocol.Notification{ID: 8, Kind: "lobby_invite", Data: data}})
+
+	var msg struct {
+		Type    string                `json:"type"`
+		Payload protocol.Notification `json:"payload"`
+	}
+	assert.NoError(t, wsjson.Read(ctx, friend, &msg))
+	assert.Equal(t, protocol.TypeNotification, msg.Type)
+	assert.Equal(t, int64(7), msg.Payload.ID)
+	var got protocol.LobbyInvite
+	assert.NoError(t, json.Unmarshal(msg.Payload.Data, &got))
+	assert.Equal(t, roomID, got.RoomID)
+	assert.Equal(t, "Owner", got.FromName)
+
+	// Событие lobby_invite приходит во все сокеты игрока, включая игровой
+	manager.DeliverInvite("presence_friend", invite)
+	manager.DeliverInvite("presence_owner", invite)
+	event := readEvent(ctx, t, friend, protocol.TypeLobbyInvite)
+	assert.Equal(t, roomID, event["room_id"])
+	assert.Equal(t, "Owner", event["from_name"])
+	for {
+		var m struct {
+			Type string `json:"type"`
+		}
+		require.NoError(t, wsjson.Read(ctx, owner, &m), "игровой сокет получает lobby_invite")
+		assert.NotEqual(t, protocol.TypeNotification, m.Type)
+		if m.Type == protocol.TypeLobbyInvite {
+			break
+		}
+	}
+}
+
+// Статус друга и доставка приглашения, когда игроки подключены к разным узлам
+func TestClusterPresence(t *testing.T) {
+	mem := cluster.NewMemory()
+	nodeA, _ := setupTestGame(t)
+	defer nodeA.Shutdown()
+	nodeB, _ := setupTestGame(t)
+	defer nodeB.Shutdown()
+	nodeA.UseCluster("node_a", mem, mem)
+	nodeB.UseCluster("node_b", mem, mem)
+	serverB := uidServer(nodeB)
+	defer serverB.Close()
+
+	roomID := nodeA.CreateManualLobby("cluster_owner")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	owner := dialWS(ctx, t, serverB, "/ws?room_id="+roomID+"&uid=cluster_owner")
+	defer owner.Close(websocket.StatusNormalClosure, "")
+	friend := dialWS(ctx, t, serverB, "/ws/presence?uid=cluster_friend")
+	defer friend.Close(websocket.StatusNormalClosure, "")
+
+	ids := []string{"cluster_owner", "cluster_friend", "nobody"}
+	for _, node := range []*Manager{nodeA, nodeB} {
+		assert.Eventually(t, func() bool {
+			p := node.Presence(ids)
+			return p["cluster_owner"].Status == PresenceInLobby && p["cluster_owner"].RoomID == roomID &&
+				p["cluster_friend"].Status == PresenceOnline && p["nobody"].Status == PresenceOffline
+		}, 2*time.Second, 20*time.Millisecond, "узел %s видит игроков обоих узлов", node.NodeID())
+	}
+
+	invite, err := nodeA.Invite("cluster_owner", "Owner", "cluster_friend", roomID)
+	require.NoError(t, err)
+	// Состав комнаты узла A узел B узнает у него через шину
+	_, err = nodeB.Invite("cluster_owner", "Owner", "cluster_friend", roomID)
+	assert.NoError(t, err)
+	_, err = nodeB.Invite("cluster_friend", "Friend", "cluster_owner", roomID)
+	assert.ErrorIs(t, err, ErrNotInRoom)
+	data, _ := json.Marshal(invite)
+	nodeA.PushUser("cluster_friend", protocol.Message{Type: protocol.TypeNotification, Payload: protocol.Notification{ID: 9, Kind: "lobby_invite", Data: data}})
+	msg := readMessage(ctx, t, friend, protocol.TypeNotification)
+	assert.EqualValues(t, 9, msg["payload"].(map[string]any)["id"], "приглашение с узла A дошло до сокета на узле B")
+}
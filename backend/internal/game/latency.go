@@ -0,0 +1,82 @@
+package game
+
+import (
+	"time"
+	"uplink/protocol"
+)
+
+// Компенсация задержки. Сервер раз в PingInterval шлет ping и по ответам считает
+// сглаженный RTT игрока. Клиент, синхронизировавший часы через clock_sync, помечает
+// ввод своим временем; сервер принимает отметку, если она не старше половины RTT
+// с запасом на джиттер, иначе прижимает ее к границе окна.
+const (
+	PingInterval       = 2 * time.Second
+	MaxRTTSample       = 10 * time.Second
+	LagJitter          = 30 * time.Millisecond
+	MaxLagCompensation = 250 * time.Millisecond
+)
+
+// recordRTT учитывает замер RTT: первый замер берется как есть, дальше — скользящее среднее.
+func (c *Client) recordRTT(sample time.Duration) {
+	if sample < 0 || sample > MaxRTTSample {
+		return
+	}
+	c.mu.Lock()
+	if c.rtt == 0 {
+		c.rtt = sample
+	} else {
+		c.rtt = (c.rtt*4 + sample) / 5
+	}
+	c.mu.Unlock()
+}
+
+// latency возвращает сглаженный RTT в миллисекундах; вызывающий держит c.mu.
+func (c *Client) latency() int {
+	return int(c.rtt.Milliseconds())
+}
+
+// inputTime переводит отметку клиента в момент ввода по часам сервера.
+// now — время получения сообщения сервером.
+func (c *Client) inputTime(clientMS int64, now time.Time) time.Time {
+	if clientMS <= 0 {
+		return now
+	}
+	c.mu.Lock()
+	bound := min(c.rtt/2+LagJitter, MaxLagCompensation)
+	c.mu.Unlock()
+
+	at := time.UnixMilli(clientMS)
+	if earliest := now.Add(-bound); at.Before(earliest) {
+		at = earliest
+	}
+	if at.After(now) {
+		at = now
+	}
+	return at
+}
+
+// ping рассылает замер задержки игрокам, чей клиент понимает pong.
+func (r *Room) ping() {
+	msg := protocol.Message{Type: protocol.TypePing, Payload: protocol.Ping{ServerTime: time.Now().UnixMilli()}}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.clients {
+		if c.protoVersion() < protocol.VersionLatency {
+			continue
+		}
+		c.deliver(msg)
+	}
+}
+
+func (c *Client) pong(p *protocol.Pong) {
+	c.recordRTT(time.Since(time.UnixMilli(p.ServerTime)))
+}
+
+// clockSync отвечает на запрос синхронизации часов временем сервера.
+func (c *Client) clockSync(p *protocol.ClockSyncRequest) {
+	reply := protocol.Message{Type: protocol.TypeClockSync, Payload: protocol.ClockSync{
+		ClientTime: p.ClientTime,
+		ServerTime: time.Now().UnixMilli(),
+	}}
+	c.deliver(reply)
+}
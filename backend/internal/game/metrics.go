@@ -0,0 +1,95 @@
+package game
+
+import (
+	"uplink/backend/internal/metrics"
+)
+
+type gameMetrics struct {
+	races   *metrics.Counter
+	wait    *metrics.Histogram
+	dropped *metrics.Counter
+	evicted *metrics.Counter
+	chat    *metrics.Counter
+}
+
+func newGameMetrics() *gameMetrics {
+	return &gameMetrics{
+		races: metrics.NewCounter("uplink_races_finished_total",
+			"Завершенные заезды по режиму комнаты.", "mode"),
+		wait: metrics.NewHistogram("uplink_matchmaking_wait_seconds",
+			"Время от входа в очередь подбора до найденного матча.",
+			[]float64{1, 2, 5, 10, 20, 30, 60, 120, 300}, "queue"),
+		dropped: metrics.NewCounter("uplink_ws_messages_dropped_total",
+			"Исходящие сообщения, не доставленные клиентам: переполнение очереди или отключение медленного клиента.", "reason"),
+		evicted: metrics.NewCounter("uplink_ws_slow_consumers_evicted_total",
+			"Клиенты, отключенные за медленное чтение."),
+		chat: metrics.NewCounter("uplink_chat_messages_total",
+			"Сообщения чата по результату модерации: sent, filtered, rate_limited, rejected, muted.", "result"),
+	}
+}
+
+var stateNames = map[int]string{
+	StateLobby:    "lobby",
+	StateGame:     "game",
+	StateFinished: "finished",
+	StateLoading:  "loading",
+}
+
+// Metrics возвращает метрики менеджера для регистрации в metrics.Registry.
+func (m *Manager) Metrics() []metrics.Metric {
+	rooms := metrics.NewGaugeFunc("uplink_rooms", "Комнаты на узле по состоянию и режиму.", func(emit func(float64, ...string)) {
+		counts := make(map[[2]string]int)
+		m.rooms.Range(func(_, v any) bool {
+			r := v.(*Room)
+			r.mu.RLock()
+			counts[[2]string{stateNames[r.State], r.Mode}]++
+			r.mu.RUnlock()
+			return true
+		})
+		for k, n := range counts {
+			emit(float64(n), k[0], k[1])
+		}
+	}, "state", "mode")
+
+	clients := metrics.NewGaugeFunc("uplink_clients", "Подключенные клиенты: в комнатах, через другой узел и в очереди подбора.", func(emit func(float64, ...string)) {
+		var local, remote int
+		m.rooms.Range(func(_, v any) bool {
+			r := v.(*Room)
+			r.mu.RLock()
+			for _, c := range r.clients {
+				if c.conn != nil {
+					local++
+				} else {
+					remote++
+				}
+			}
+			r.mu.RUnlock()
+			return true
+		})
+		m.qMu.Lock()
+		queued := 0
+		for _, q := range m.queues {
+			queued += len(q)
+		}
+		m.qMu.Unlock()
+		emit(float64(local), "room")
+		emit(float64(remote), "remote")
+		emit(float64(queued), "queue")
+	}, "kind")
+
+	queues := metrics.NewGaugeFunc("uplink_matchmaking_queue_size", "Игроки в очередях подбора по ключу language|text_mode.", func(emit func(float64, ...string)) {
+		m.qMu.Lock()
+		defer m.qMu.Unlock()
+		for k, q := range m.queues {
+			emit(float64(len(q)), k)
+		}
+	}, "queue")
+
+	return []metrics.Metric{rooms, clients, queues, m.metrics.races, m.metrics.wait, m.metrics.dropped, m.metrics.evicted, m.metrics.chat}
+}
+
+func (m *Manager) newOutbox() *outbox {
+	o := newOutbox()
+	o.metrics = m.metrics
+	return o
+}
@@ -0,0 +1,174 @@
+package game
+
+import (
+	"sync"
+	"time"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Исходящая очередь клиента. Важные события (старт и конец заезда, найденный матч,
+// состав и настройки комнаты) не отбрасываются никогда. Новый state_update заменяет
+// еще не отправленный, остальные сообщения отбрасываются, если очередь заполнена.
+// Клиента, который не разбирает очередь дольше SlowConsumerGrace или довел ее
+// до OutboxHardLimit, сервер отключает с причиной SLOW_CONSUMER.
+const (
+	OutboxSize        = 64
+	OutboxHardLimit   = 4 * OutboxSize
+	SlowConsumerGrace = 5 * time.Second
+
+	ReasonSlowConsumer = "SLOW_CONSUMER"
+)
+
+// QueueStats — счетчики исходящей очереди клиента.
+type QueueStats struct {
+	Len       int    `json:"len"`
+	Peak      int    `json:"peak"`
+	Sent      uint64 `json:"sent"`
+	Dropped   uint64 `json:"dropped"`
+	Coalesced uint64 `json:"coalesced"`
+	Evicted   bool   `json:"evicted"`
+}
+
+type outbox struct {
+	mu        sync.Mutex
+	queue     []protocol.Message
+	stateAt   int
+	wake      chan struct{}
+	drained   chan struct{}
+	once      sync.Once
+	closed    bool
+	fullSince time.Time
+	stats     QueueStats
+	metrics   *gameMetrics
+}
+
+func newOutbox() *outbox {
+	return &outbox{stateAt: -1, wake: make(chan struct{}, 1), drained: make(chan struct{})}
+}
+
+func critical(typ string) bool {
+	switch typ {
+	case protocol.TypeGameStart, protocol.TypeGameEnd, protocol.TypeMatchFound, protocol.TypeShutdown,
+		protocol.TypePlayerJoined, protocol.TypeUpdateSettings, protocol.TypeChatHistory, protocol.TypeWelcome:
+		return true
+	}
+	return false
+}
+
+// push ставит сообщение в очередь и возвращает true, если клиента пора отключить.
+func (o *outbox) push(msg protocol.Message, now time.Time) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return false
+	}
+
+	switch {
+	case msg.Type == protocol.TypeStateUpdate && o.stateAt >= 0:
+		o.queue[o.stateAt] = msg
+		o.stats.Coalesced++
+		return false
+	case len(o.queue) >= OutboxSize && !critical(msg.Type) && msg.Type != protocol.TypeStateUpdate:
+		o.stats.Dropped++
+		if o.metrics != nil {
+			o.metrics.dropped.Inc("overflow")
+		}
+	default:
+		if msg.Type == protocol.TypeStateUpdate {
+			o.stateAt = len(o.queue)
+		}
+		o.queue = append(o.queue, msg)
+		o.stats.Peak = max(o.stats.Peak, len(o.queue))
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	if len(o.queue) < OutboxSize {
+		o.fullSince = time.Time{}
+		return false
+	}
+	if o.fullSince.IsZero() {
+		o.fullSince = now
+	}
+	if len(o.queue) >= OutboxHardLimit || now.Sub(o.fullSince) >= SlowConsumerGrace {
+		o.stats.Evicted = true
+		o.stats.Dropped += uint64(len(o.queue))
+		if o.metrics != nil {
+			o.metrics.dropped.Add(float64(len(o.queue)), "evicted")
+			o.metrics.evicted.Inc()
+		}
+		o.queue, o.stateAt, o.closed = nil, -1, true
+		close(o.wake)
+		return true
+	}
+	return false
+}
+
+// next ждет следующее сообщение; после close отдает остаток очереди и возвращает false.
+func (o *outbox) next() (protocol.Message, bool) {
+	for {
+		o.mu.Lock()
+		if len(o.queue) > 0 {
+			msg := o.queue[0]
+			o.queue[0] = protocol.Message{}
+			o.queue = o.queue[1:]
+			o.stateAt--
+			if o.stateAt < -1 {
+				o.stateAt = -1
+			}
+			o.stats.Sent++
+			o.mu.Unlock()
+			return msg, true
+		}
+		if o.closed {
+			o.mu.Unlock()
+			return protocol.Message{}, false
+		}
+		o.mu.Unlock()
+		<-o.wake
+	}
+}
+
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.closed {
+		o.closed = true
+		close(o.wake)
+	}
+}
+
+// stop вызывается при выходе из writeLoop: все, что можно было отправить, отправлено.
+func (o *outbox) stop() {
+	o.close()
+	o.once.Do(func() { close(o.drained) })
+}
+
+// flush закрывает очередь и ждет, пока writeLoop отправит ее остаток.
+func (o *outbox) flush(timeout time.Duration) {
+	o.close()
+	select {
+	case <-o.drained:
+	case <-time.After(timeout):
+	}
+}
+
+func (o *outbox) snapshot() QueueStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.stats
+	s.Len = len(o.queue)
+	return s
+}
+
+// deliver ставит сообщение в очередь клиента и отключает клиента, который не успевает его читать.
+// Закрытие идет в отдельной горутине: вызывающий часто держит блокировку комнаты или очереди.
+func (c *Client) deliver(msg protocol.Message) {
+	if c.send.push(msg, time.Now()) {
+		go c.close(websocket.StatusPolicyViolation, ReasonSlowConsumer)
+	}
+}
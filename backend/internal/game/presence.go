@@ -0,0 +1,366 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"uplink/protocol"
+
+	"github.com/coder/websocket"
+)
+
+// Присутствие и доставка уведомлений. После входа игрок держит сокет /ws/presence,
+// в комнате и очереди подбора — еще и игровой сокет. Статус друзей считается по живым
+// клиентам всех узлов, уведомления расходятся по шине в сокеты меню игрока на всех узлах,
+// а приглашения в лобби — во все его сокеты.
+const (
+	PresenceOffline = "offline"
+	PresenceOnline  = "online"
+	PresenceInLobby = "in_lobby"
+	PresenceInRace  = "in_race"
+
+	userTopic        = "users"
+	envPush          = "push"
+	envInvite        = "invite"
+	envPresence      = "presence"
+	envPresenceReply = "presence_reply"
+	envMember        = "member"
+	envMemberReply   = "member_reply"
+)
+
+// PresenceWait — сколько ждать ответа других узлов о статусе игроков. Не ответивший
+// вовремя узел не учитывается.
+const PresenceWait = time.Second
+
+var ErrInviteSelf = errors.New("нельзя пригласить себя")
+
+// Presence — где сейчас игрок; RoomID заполняется для лобби и заезда.
+type Presence struct {
+	Status string `json:"status"`
+	RoomID string `json:"room_id,omitempty"`
+}
+
+var presenceRank = map[string]int{PresenceOffline: 0, PresenceOnline: 1, PresenceInLobby: 2, PresenceInRace: 3}
+
+// HandlePresenceWS держит сокет игрока на все время входа: по нему приходят уведомления.
+func (m *Manager) HandlePresenceWS(w http.ResponseWriter, r *http.Request, uid, user string) {
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+		OriginPatterns: []string{"*"},
+		Subprotocols:   protocol.Subprotocols,
+	})
+	if err != nil {
+		m.log.Warn("ошибка рукопожатия", "err", err)
+		return
+	}
+	c := &Client{
+		ID:       uid,
+		Username: user,
+		conn:     conn,
+		codec:    protocol.CodecFor(conn.Subprotocol()),
+		joinTime: time.Now(),
+		send:     m.newOutbox(),
+	}
+	m.hMu.Lock()
+	if m.homes[uid] == nil {
+		m.homes[uid] = make(map[*Client]struct{})
+	}
+	m.homes[uid][c] = struct{}{}
+	m.hMu.Unlock()
+	go c.writeLoop()
+
+	defer func() {
+		m.hMu.Lock()
+		delete(m.homes[uid], c)
+		if len(m.homes[uid]) == 0 {
+			delete(m.homes, uid)
+		}
+		m.hMu.Unlock()
+		c.send.close()
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}()
+
+	for {
+		_, data, err := conn.Read(context.Background())
+		if err != nil {
+			return
+		}
+		typ, payload, perr := c.codec.Decode(protocol.Client, data)
+		if perr != nil {
+			c.reject(perr)
+			continue
+		}
+		switch p := payload.(type) {
+		case *protocol.Hello:
+			c.hello(p)
+		default:
+			c.reject(protocol.NewError(protocol.ErrUnexpected, typ, "сообщение недоступно вне комнаты"))
+		}
+	}
+}
+
+// Presence возвращает статус игроков по клиентам всех узлов: заезд важнее лобби,
+// лобби важнее открытого меню или очереди подбора. Игрок может быть на нескольких
+// узлах сразу, поэтому остальные живые узлы опрашиваются через шину.
+func (m *Manager) Presence(uids []string) map[string]Presence {
+	res := m.localPresence(uids)
+	ctx, cancel := context.WithTimeout(context.Background(), PresenceWait)
+	defer cancel()
+	nodes, err := m.dir.Nodes(ctx)
+	if err != nil {
+		m.log.Warn("ошибка получения списка узлов", "err", err)
+		return res
+	}
+	ids, _ := json.Marshal(uids)
+	ask := genID() + genID()
+	replies := make(chan json.RawMessage, len(nodes))
+	m.asks.Store(ask, replies)
+	defer m.asks.Delete(ask)
+
+	waiting := 0
+	for _, node := range nodes {
+		if node != m.nodeID {
+			m.publish(nodeTopic(node), envelope{Kind: envPresence, Conn: ask, User: m.nodeID, Data: ids})
+			waiting++
+		}
+	}
+	for ; waiting > 0; waiting-- {
+		select {
+		case data := <-replies:
+			var got map[string]Presence
+			if json.Unmarshal(data, &got) != nil {
+				continue
+			}
+			for uid, p := range got {
+				if cur, ok := res[uid]; ok && presenceRank[p.Status] > presenceRank[cur.Status] {
+					res[uid] = p
+				}
+			}
+		case <-ctx.Done():
+			m.log.Warn("не все узлы ответили о статусе игроков", "missing", waiting)
+			return res
+		}
+	}
+	return res
+}
+
+// answerPresence отвечает узлу env.User на опрос статуса игроков.
+func (m *Manager) answerPresence(env envelope) {
+	var uids []string
+	if json.Unmarshal(env.Data, &uids) != nil {
+		return
+	}
+	data, _ := json.Marshal(m.localPresence(uids))
+	m.publish(nodeTopic(env.User), envelope{Kind: envPresenceReply, Conn: env.Conn, Data: data})
+}
+
+// localPresence возвращает статус игроков по клиентам этого узла.
+func (m *Manager) localPresence(uids []string) map[string]Presence {
+	res := make(map[string]Presence, len(uids))
+	want := make(map[string]bool, len(uids))
+	for _, id := range uids {
+		res[id] = Presence{Status: PresenceOffline}
+		want[id] = true
+	}
+	set := func(uid string, p Presence) {
+		if want[uid] && presenceRank[p.Status] > presenceRank[res[uid].Status] {
+			res[uid] = p
+		}
+	}
+
+	m.rooms.Range(func(_, v any) bool {
+		r := v.(*Room)
+		r.mu.RLock()
+		status := PresenceInLobby
+		if r.State == StateGame || r.State == StateLoading {
+			status = PresenceInRace
+		}
+		for uid := range r.clients {
+			set(uid, Presence{Status: status, RoomID: r.ID})
+		}
+		r.mu.RUnlock()
+		return true
+	})
+	m.qMu.Lock()
+	for _, q := range m.queues {
+		for _, c := range q {
+			set(c.ID, Presence{Status: PresenceOnline})
+		}
+	}
+	m.qMu.Unlock()
+	m.hMu.Lock()
+	for uid := range m.homes {
+		set(uid, Presence{Status: PresenceOnline})
+	}
+	m.hMu.Unlock()
+	return res
+}
+
+// Invite проверяет комнату и собирает приглашение игроку to. Комната ищется в общем
+// каталоге, поэтому приглашать можно в комнату на любом узле; приглашает только ее
+// владелец или участник, это проверяет узел комнаты. Во входящие приглашение
+// кладет сервис уведомлений, в открытые сокеты его отправляет DeliverInvite.
+func (m *Manager) Invite(fromID, fromName, to, roomID string) (protocol.LobbyInvite, error) {
+	if fromID == to {
+		return protocol.LobbyInvite{}, ErrInviteSelf
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), WriteWait)
+	defer cancel()
+	node, err := m.dir.Lookup(ctx, roomID)
+	if err != nil {
+		return protocol.LobbyInvite{}, ErrRoomNotFound
+	}
+	if node == m.nodeID {
+		err = m.localMember(roomID, fromID)
+	} else {
+		err = m.askMember(ctx, node, roomID, fromID)
+	}
+	if err != nil {
+		return protocol.LobbyInvite{}, err
+	}
+	return protocol.LobbyInvite{RoomID: roomID, FromID: fromID, FromName: fromName, Time: time.Now()}, nil
+}
+
+// localMember проверяет, что игрок — владелец или участник комнаты этого узла.
+func (m *Manager) localMember(roomID, uid string) error {
+	val, ok := m.rooms.Load(roomID)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	r := val.(*Room)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if uid != r.Owner && !r.member(uid) {
+		return ErrNotInRoom
+	}
+	return nil
+}
+
+// askMember спрашивает узел node, владелец или участник ли игрок его комнаты.
+// Ответ — текст ошибки localMember, пустой при успехе.
+func (m *Manager) askMember(ctx context.Context, node, roomID, uid string) error {
+	ask := genID() + genID()
+	replies := make(chan json.RawMessage, 1)
+	m.asks.Store(ask, replies)
+	defer m.asks.Delete(ask)
+
+	data, _ := json.Marshal(uid)
+	m.publish(nodeTopic(node), envelope{Kind: envMember, Conn: ask, User: m.nodeID, Room: roomID, Data: data})
+	select {
+	case data := <-replies:
+		var reply string
+		if json.Unmarshal(data, &reply) != nil {
+			return ErrRoomNotFound
+		}
+		switch reply {
+		case "":
+			return nil
+		case ErrNotInRoom.Error():
+			return ErrNotInRoom
+		default:
+			return ErrRoomNotFound
+		}
+	case <-ctx.Done():
+		m.log.Warn("узел комнаты не ответил о составе комнаты", "node", node, "room", roomID)
+		return ErrRoomNotFound
+	}
+}
+
+// answerMember отвечает узлу env.User, владелец или участник ли игрок комнаты env.Room.
+func (m *Manager) answerMember(env envelope) {
+	var uid string
+	if json.Unmarshal(env.Data, &uid) != nil {
+		return
+	}
+	var reply string
+	if err := m.localMember(env.Room, uid); err != nil {
+		reply = err.Error()
+	}
+	data, _ := json.Marshal(reply)
+	m.publish(nodeTopic(env.User), envelope{Kind: envMemberReply, Conn: env.Conn, Data: data})
+}
+
+// PushUser отправляет сообщение в сокеты меню игрока на всех узлах через шину.
+func (m *Manager) PushUser(uid string, msg protocol.Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	m.publish(userTopic, envelope{Kind: envPush, User: uid, Data: data})
+}
+
+// DeliverInvite отправляет событие lobby_invite во все сокеты игрока на всех узлах:
+// и в сокет меню, и в игровой. Клиенты, которые не читают уведомления, узнают
+// о приглашении по нему.
+func (m *Manager) DeliverInvite(uid string, invite protocol.LobbyInvite) {
+	data, err := json.Marshal(invite)
+	if err != nil {
+		return
+	}
+	m.publish(userTopic, envelope{Kind: envInvite, User: uid, Data: data})
+}
+
+func (m *Manager) handleUserMessage(b []byte) {
+	var env envelope
+	if json.Unmarshal(b, &env) != nil {
+		return
+	}
+	switch env.Kind {
+	case envPush:
+		typ, payload, perr := protocol.Server.Decode(env.Data)
+		if perr != nil {
+			return
+		}
+		msg := protocol.Message{Type: typ, Payload: payload}
+		for _, c := range m.homeClients(env.User) {
+			c.deliver(msg)
+		}
+	case envInvite:
+		var invite protocol.LobbyInvite
+		if json.Unmarshal(env.Data, &invite) != nil {
+			return
+		}
+		m.deliverUser(env.User, protocol.Message{Type: protocol.TypeLobbyInvite, Payload: invite})
+	}
+}
+
+// homeClients возвращает сокеты меню игрока на этом узле.
+func (m *Manager) homeClients(uid string) []*Client {
+	m.hMu.Lock()
+	defer m.hMu.Unlock()
+	targets := make([]*Client, 0, len(m.homes[uid]))
+	for c := range m.homes[uid] {
+		targets = append(targets, c)
+	}
+	return targets
+}
+
+// deliverUser отправляет сообщение во все сокеты игрока, известные этому узлу.
+// Игроку комнаты или очереди с другого узла сообщение уходит через его прокси,
+// как и сообщения комнаты.
+func (m *Manager) deliverUser(uid string, msg protocol.Message) {
+	targets := m.homeClients(uid)
+	m.rooms.Range(func(_, v any) bool {
+		r := v.(*Room)
+		r.mu.RLock()
+		if c, ok := r.clients[uid]; ok {
+			targets = append(targets, c)
+		}
+		r.mu.RUnlock()
+		return true
+	})
+	m.qMu.Lock()
+	for _, q := range m.queues {
+		for _, c := range q {
+			if c.ID == uid {
+				targets = append(targets, c)
+			}
+		}
+	}
+	m.qMu.Unlock()
+
+	for _, c := range targets {
+		c.deliver(msg)
+	}
+}
@@ -0,0 +1,189 @@
+// Package mail отправляет письма игрокам. Транспорт выбирается настройкой: SMTP
+// для боевого сервера, папка с файлами .eml или журнал для разработки и тестов.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrBadAddress = errors.New("некорректный адрес почты")
+
+// Message — письмо с телом в обычном тексте.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// ParseAddress проверяет адрес вида name@example.com без отображаемого имени.
+func ParseAddress(s string) (string, error) {
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Name != "" || a.Address != s {
+		return "", ErrBadAddress
+	}
+	return a.Address, nil
+}
+
+// compose собирает письмо по RFC 5322. Тема кодируется по RFC 2047, тело — quoted-printable.
+func compose(from string, m Message, now time.Time) ([]byte, error) {
+	if _, err := ParseAddress(m.To); err != nil {
+		return nil, err
+	}
+	if strings.ContainsAny(from+m.Subject, "\r\n") {
+		return nil, ErrBadAddress
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if a, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(a.Address, "@"); ok {
+			domain = d
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(m.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// SMTP отправляет письма через почтовый сервер. Если сервер поддерживает STARTTLS,
+// соединение шифруется; без шифрования пароль не передается.
+type SMTP struct {
+	// Addr — адрес сервера, host:port.
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	msg, err := compose(s.From, m, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return ErrBadAddress
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		// PlainAuth сам откажется отправлять пароль по открытому каналу не на localhost.
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Dir складывает письма файлами .eml в папку. Их открывает любой почтовый клиент.
+type Dir struct {
+	Path string
+	From string
+}
+
+func (d *Dir) Send(ctx context.Context, m Message) error {
+	now := time.Now()
+	msg, err := compose(d.From, m, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(d.Path, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := now.Format("20060102-150405.000000") + "-" + hex.EncodeToString(suffix) + ".eml"
+	return os.WriteFile(filepath.Join(d.Path, name), msg, 0o600)
+}
+
+// Log пишет письма в журнал вместо отправки. Ссылки из писем видны в выводе сервера.
+type Log struct {
+	Log *slog.Logger
+}
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	if _, err := ParseAddress(m.To); err != nil {
+		return err
+	}
+	log := l.Log
+	if log == nil {
+		log = slog.Default()
+	}
+	log.InfoContext(ctx, "письмо не отправлено, транспорт log", "to", m.To, "subject", m.Subject, "body", m.Body)
+	return nil
+}
@@ -0,0 +1,140 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var letter = Message{To: "neo@example.com", Subject: "Сброс пароля", Body: "Ссылка:\nhttps://uplink.example.com/auth/reset#token=abc"}
+
+// readMessage разбирает письмо и возвращает тему и раскодированное тело.
+func readMessage(t *testing.T, r io.Reader) (*mail.Message, string, string) {
+	msg, err := mail.ReadMessage(r)
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	return msg, subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+// Письмо ложится в папку файлом .eml, который разбирает обычный парсер почты
+func TestDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	m := &Dir{Path: dir, From: "Uplink <noreply@uplink.example.com>"}
+	require.NoError(t, m.Send(context.Background(), letter))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+
+	msg, subject, body := readMessage(t, f)
+	assert.Equal(t, "neo@example.com", msg.Header.Get("To"))
+	assert.Equal(t, "Сброс пароля", subject)
+	assert.Equal(t, letter.Body, body)
+	assert.Contains(t, msg.Header.Get("Message-ID"), "@uplink.example.com>")
+}
+
+// Адреса с отображаемым именем и переводами строк не пропускаются в заголовки
+func TestBadAddress(t *testing.T) {
+	for _, to := range []string{"", "neo", "Neo <neo@example.com>", "neo@example.com\r\nBcc: all@example.com"} {
+		_, err := ParseAddress(to)
+		assert.ErrorIs(t, err, ErrBadAddress, to)
+		err = (&Log{}).Send(context.Background(), Message{To: to})
+		assert.ErrorIs(t, err, ErrBadAddress, to)
+	}
+	_, err := compose("noreply@example.com", Message{To: "neo@example.com", Subject: "a\r\nBcc: all@example.com"}, time.Now())
+	assert.ErrorIs(t, err, ErrBadAddress)
+}
+
+// Письмо доходит до SMTP-сервера с отправителем, получателем и телом
+func TestSMTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	type envelope struct {
+		from, to, auth string
+		data           string
+	}
+	got := make(chan envelope, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		var e envelope
+		reply("220 test ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-test")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(cmd, "AUTH PLAIN"):
+				e.auth = strings.TrimPrefix(cmd, "AUTH PLAIN ")
+				reply("235 ok")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				e.from = strings.TrimPrefix(cmd, "MAIL FROM:")
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				e.to = strings.TrimPrefix(cmd, "RCPT TO:")
+				reply("250 ok")
+			case cmd == "DATA":
+				reply("354 go")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				e.data = data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				got <- e
+				return
+			default:
+				reply("502 unknown")
+			}
+		}
+	}()
+
+	m := &SMTP{Addr: ln.Addr().String(), From: "Uplink <noreply@uplink.example.com>", Username: "uplink", Password: "secret"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, m.Send(ctx, letter))
+
+	e := <-got
+	assert.Equal(t, "<noreply@uplink.example.com>", e.from)
+	assert.Equal(t, "<neo@example.com>", e.to)
+	assert.NotEmpty(t, e.auth, "пароль передается серверу на localhost")
+	_, subject, body := readMessage(t, strings.NewReader(e.data))
+	assert.Equal(t, "Сброс пароля", subject)
+	assert.Equal(t, letter.Body, strings.TrimSuffix(body, "\n"), "перед точкой клиент SMTP дописывает перевод строки")
+}
@@ -0,0 +1,297 @@
+// Package metrics — счетчики и гистограммы в текстовом формате Prometheus.
+// Пакет не зависит от клиента Prometheus: вывод проверяется обычными тестами.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric — семейство метрик, которое умеет записать себя в формате экспозиции.
+type Metric interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+type desc struct {
+	name, help, typ string
+	labels          []string
+}
+
+func (d *desc) Name() string { return d.name }
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.typ)
+}
+
+func (d *desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s ожидает %d меток, передано %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// Counter — монотонный счетчик с метками.
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	v      float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{desc: desc{name, help, "counter", labels}, series: make(map[string]*counterSeries)}
+}
+
+func (c *Counter) Inc(values ...string) { c.Add(1, values...) }
+
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: счетчик не может уменьшаться")
+	}
+	c.check(values)
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{values: append([]string(nil), values...)}
+		c.series[key] = s
+	}
+	s.v += v
+	c.mu.Unlock()
+}
+
+// Value возвращает текущее значение ряда; нужен в основном тестам.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[strings.Join(values, "\xff")]; ok {
+		return s.v
+	}
+	return 0
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	list := make([]*counterSeries, 0, len(c.series))
+	for _, s := range c.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return less(list[i].values, list[j].values) })
+	for _, s := range list {
+		sample(w, c.name, c.labels, s.values, "", "", s.v)
+	}
+	c.mu.Unlock()
+}
+
+// Histogram — распределение значений по корзинам с метками.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// DefBuckets подходят для длительности HTTP запросов в секундах.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &Histogram{desc: desc{name, help, "histogram", labels}, buckets: b, series: make(map[string]*histogramSeries)}
+}
+
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.check(values)
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	list := make([]*histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return less(list[i].values, list[j].values) })
+	for _, s := range list {
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += s.counts[i]
+			sample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(b), float64(cum))
+		}
+		sample(w, h.name+"_bucket", h.labels, s.values, "le", "+Inf", float64(s.count))
+		sample(w, h.name+"_sum", h.labels, s.values, "", "", s.sum)
+		sample(w, h.name+"_count", h.labels, s.values, "", "", float64(s.count))
+	}
+	h.mu.Unlock()
+}
+
+// Func — метрика, значения которой снимаются в момент запроса /metrics.
+type Func struct {
+	desc
+	collect func(emit func(v float64, values ...string))
+}
+
+// NewGaugeFunc описывает текущее состояние: число комнат, размер очередей и т.п.
+func NewGaugeFunc(name, help string, collect func(emit func(v float64, values ...string)), labels ...string) *Func {
+	return &Func{desc{name, help, "gauge", labels}, collect}
+}
+
+// NewCounterFunc отдает счетчик, который ведет кто-то другой, например пул соединений.
+func NewCounterFunc(name, help string, collect func(emit func(v float64, values ...string)), labels ...string) *Func {
+	return &Func{desc{name, help, "counter", labels}, collect}
+}
+
+func (f *Func) write(w *bufio.Writer) {
+	f.header(w)
+	type row struct {
+		values []string
+		v      float64
+	}
+	var rows []row
+	f.collect(func(v float64, values ...string) {
+		f.check(values)
+		rows = append(rows, row{append([]string(nil), values...), v})
+	})
+	sort.SliceStable(rows, func(i, j int) bool { return less(rows[i].values, rows[j].values) })
+	for _, r := range rows {
+		sample(w, f.name, f.labels, r.values, "", "", r.v)
+	}
+}
+
+// Registry собирает семейства метрик и отдает их по HTTP.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// MustRegister добавляет метрики; повторное имя — ошибка программиста.
+func (r *Registry) MustRegister(ms ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range ms {
+		if r.names[m.Name()] {
+			panic("metrics: повторная регистрация " + m.Name())
+		}
+		r.names[m.Name()] = true
+		r.metrics = append(r.metrics, m)
+	}
+}
+
+// WriteTo пишет все метрики в текстовом формате экспозиции 0.0.4.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	r.mu.Lock()
+	list := append([]Metric(nil), r.metrics...)
+	r.mu.Unlock()
+	for _, m := range list {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func sample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func less(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
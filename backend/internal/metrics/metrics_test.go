@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Вывод в текстовом формате экспозиции
+func TestExposition(t *testing.T) {
+	reg := NewRegistry()
+	races := NewCounter("uplink_races_finished_total", "Завершенные заезды.", "mode")
+	wait := NewHistogram("uplink_wait_seconds", "Ожидание в очереди.", []float64{1, 5}, "queue")
+	rooms := NewGaugeFunc("uplink_rooms", "Активные комнаты.", func(emit func(float64, ...string)) {
+		emit(2, "lobby")
+		emit(1, "game")
+	}, "state")
+	reg.MustRegister(races, wait, rooms)
+
+	races.Inc("solo")
+	races.Add(2, "matchmaking")
+	wait.Observe(0.5, "ru|standard")
+	wait.Observe(3, "ru|standard")
+	wait.Observe(30, "ru|standard")
+
+	var b strings.Builder
+	_, err := reg.WriteTo(&b)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP uplink_races_finished_total Завершенные заезды.
+# TYPE uplink_races_finished_total counter
+uplink_races_finished_total{mode="matchmaking"} 2
+uplink_races_finished_total{mode="solo"} 1
+# HELP uplink_wait_seconds Ожидание в очереди.
+# TYPE uplink_wait_seconds histogram
+uplink_wait_seconds_bucket{queue="ru|standard",le="1"} 1
+uplink_wait_seconds_bucket{queue="ru|standard",le="5"} 2
+uplink_wait_seconds_bucket{queue="ru|standard",le="+Inf"} 3
+uplink_wait_seconds_sum{queue="ru|standard"} 33.5
+uplink_wait_seconds_count{queue="ru|standard"} 3
+# HELP uplink_rooms Активные комнаты.
+# TYPE uplink_rooms gauge
+uplink_rooms{state="game"} 1
+uplink_rooms{state="lobby"} 2
+`, b.String())
+}
+
+// Экранирование меток и ошибки регистрации
+func TestEscapingAndMisuse(t *testing.T) {
+	reg := NewRegistry()
+	c := NewCounter("uplink_test_total", "Строка\nс переносом и \\.", "route")
+	reg.MustRegister(c)
+	c.Inc(`GET /api/"x"` + "\n")
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Contains(t, rec.Body.String(), `# HELP uplink_test_total Строка\nс переносом и \\.`)
+	assert.Contains(t, rec.Body.String(), `uplink_test_total{route="GET /api/\"x\"\n"} 1`)
+
+	assert.Panics(t, func() { reg.MustRegister(NewCounter("uplink_test_total", "")) }, "имена метрик уникальны")
+	assert.Panics(t, func() { c.Inc() }, "число меток должно совпадать")
+	assert.Panics(t, func() { c.Add(-1, "x") }, "счетчик не уменьшается")
+}
@@ -0,0 +1,70 @@
+// Package notify — входящие уведомления игроков. Сервис сохраняет уведомление
+// и сразу отправляет его в сокет игрока; прочитанными их отмечает сам игрок через API.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+	"uplink/protocol"
+)
+
+// Виды уведомлений. Data каждого вида описан рядом с константой.
+const (
+	// KindFriendRequest — входящая заявка в друзья, Data — From.
+	KindFriendRequest = "friend_request"
+	// KindFriendAccepted — заявку приняли, Data — From.
+	KindFriendAccepted = "friend_accepted"
+	// KindLobbyInvite — приглашение в лобби, Data — protocol.LobbyInvite.
+	KindLobbyInvite = "lobby_invite"
+)
+
+// From — кто вызвал уведомление.
+type From struct {
+	ID   string `json:"from_id"`
+	Name string `json:"from_name"`
+}
+
+// Store сохраняет уведомление во входящих и возвращает его номер и время.
+type Store interface {
+	SaveNotification(ctx context.Context, uid, kind string, data []byte) (int64, time.Time, error)
+}
+
+// Pusher доставляет сообщение во все сокеты меню игрока на всех узлах.
+type Pusher interface {
+	PushUser(uid string, msg protocol.Message)
+}
+
+type Service struct {
+	store Store
+	push  Pusher
+	log   *slog.Logger
+}
+
+func New(store Store, push Pusher, log *slog.Logger) *Service {
+	return &Service{store: store, push: push, log: log}
+}
+
+// Publish сохраняет уведомление и отправляет его игроку. Если сохранить не удалось,
+// игрок уведомление не получает: во входящих не бывает того, чего нет в базе.
+func (s *Service) Publish(ctx context.Context, uid, kind string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	id, at, err := s.store.SaveNotification(ctx, uid, kind, b)
+	if err != nil {
+		if s.log != nil {
+			s.log.Warn("не удалось сохранить уведомление", "user", uid, "kind", kind, "err", err)
+		}
+		return err
+	}
+	s.push.PushUser(uid, protocol.Message{Type: protocol.TypeNotification, Payload: protocol.Notification{
+		ID:   id,
+		Kind: kind,
+		Data: b,
+		Time: at,
+	}})
+	return nil
+}
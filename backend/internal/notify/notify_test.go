@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"uplink/protocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	saved []string
+	err   error
+}
+
+func (f *fakeStore) SaveNotification(_ context.Context, uid, kind string, data []byte) (int64, time.Time, error) {
+	if f.err != nil {
+		return 0, time.Time{}, f.err
+	}
+	f.saved = append(f.saved, uid+"|"+kind+"|"+string(data))
+	return int64(len(f.saved)), time.Unix(100, 0), nil
+}
+
+type fakePusher map[string][]protocol.Message
+
+func (f fakePusher) PushUser(uid string, msg protocol.Message) {
+	f[uid] = append(f[uid], msg)
+}
+
+// Уведомление сохраняется и уходит игроку с номером из базы
+func TestPublish(t *testing.T) {
+	store, push := &fakeStore{}, fakePusher{}
+	s := New(store, push, nil)
+
+	require.NoError(t, s.Publish(context.Background(), "u1", KindFriendRequest, From{ID: "u2", Name: "bob"}))
+	assert.Equal(t, []string{`u1|friend_request|{"from_id":"u2","from_name":"bob"}`}, store.saved)
+
+	require.Len(t, push["u1"], 1)
+	msg := push["u1"][0]
+	assert.Equal(t, protocol.TypeNotification, msg.Type)
+	n := msg.Payload.(protocol.Notification)
+	assert.Equal(t, int64(1), n.ID)
+	assert.Equal(t, KindFriendRequest, n.Kind)
+	assert.Equal(t, time.Unix(100, 0), n.Time)
+
+	var from From
+	require.NoError(t, json.Unmarshal(n.Data, &from))
+	assert.Equal(t, "bob", from.Name)
+}
+
+// Несохраненное уведомление не отправляется
+func TestPublishStoreError(t *testing.T) {
+	push := fakePusher{}
+	s := New(&fakeStore{err: errors.New("нет связи")}, push, nil)
+
+	assert.Error(t, s.Publish(context.Background(), "u1", KindLobbyInvite, protocol.LobbyInvite{RoomID: "r1"}))
+	assert.Empty(t, push)
+}
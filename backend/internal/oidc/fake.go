@@ -0,0 +1,191 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const fakeKeyID = "fake"
+
+// Fake — минимальный провайдер OIDC для тестов и локальной проверки входа без сети.
+// Страницы входа у него нет: /authorize сразу выдает код для пользователя из
+// параметра login_hint (по умолчанию "user"). Издатель — адрес, по которому
+// к нему обратились.
+type Fake struct {
+	// ClientID и ClientSecret, если заданы, проверяются при обмене кода.
+	ClientID     string
+	ClientSecret string
+
+	key *rsa.PrivateKey
+	mux *http.ServeMux
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	clientID  string
+	redirect  string
+	nonce     string
+	challenge string
+	subject   string
+	expires   time.Time
+}
+
+func NewFake() (*Fake, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fake{key: key, mux: http.NewServeMux(), codes: make(map[string]fakeGrant)}
+	f.mux.HandleFunc("GET /.well-known/openid-configuration", f.discovery)
+	f.mux.HandleFunc("GET /jwks", f.jwks)
+	f.mux.HandleFunc("GET /authorize", f.authorize)
+	f.mux.HandleFunc("POST /token", f.token)
+	return f, nil
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) { f.mux.ServeHTTP(w, r) }
+
+func issuer(r *http.Request) string {
+	if r.TLS != nil {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+func (f *Fake) discovery(w http.ResponseWriter, r *http.Request) {
+	iss := issuer(r)
+	writeJSON(w, map[string]any{
+		"issuer":                                iss,
+		"authorization_endpoint":                iss + "/authorize",
+		"token_endpoint":                        iss + "/token",
+		"jwks_uri":                              iss + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	}, 200)
+}
+
+func (f *Fake) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := f.key.PublicKey
+	writeJSON(w, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": fakeKeyID,
+		"alg": "RS256",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}}, 200)
+}
+
+func (f *Fake) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if f.ClientID != "" && q.Get("client_id") != f.ClientID {
+		http.Error(w, "unauthorized_client", http.StatusBadRequest)
+		return
+	}
+	subject := q.Get("login_hint")
+	if subject == "" {
+		subject = "user"
+	}
+	code, err := Random()
+	if err != nil {
+		http.Error(w, "server_error", http.StatusInternalServerError)
+		return
+	}
+	f.mu.Lock()
+	for c, g := range f.codes {
+		if time.Now().After(g.expires) {
+			delete(f.codes, c)
+		}
+	}
+	f.codes[code] = fakeGrant{
+		clientID:  q.Get("client_id"),
+		redirect:  redirect.String(),
+		nonce:     q.Get("nonce"),
+		challenge: q.Get("code_challenge"),
+		subject:   subject,
+		expires:   time.Now().Add(time.Minute),
+	}
+	f.mu.Unlock()
+
+	back := redirect.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (f *Fake) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, map[string]string{"error": "invalid_request"}, 400)
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if (f.ClientID != "" && clientID != f.ClientID) || (f.ClientSecret != "" && secret != f.ClientSecret) {
+		writeJSON(w, map[string]string{"error": "invalid_client"}, 401)
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	f.mu.Lock()
+	g, ok := f.codes[code]
+	delete(f.codes, code)
+	f.mu.Unlock()
+	if !ok || time.Now().After(g.expires) || g.clientID != clientID ||
+		g.redirect != r.PostForm.Get("redirect_uri") || g.challenge != Challenge(r.PostForm.Get("code_verifier")) {
+		writeJSON(w, map[string]string{"error": "invalid_grant"}, 400)
+		return
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                issuer(r),
+		"sub":                g.subject,
+		"aud":                g.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              g.nonce,
+		"email":              g.subject + "@example.test",
+		"email_verified":     true,
+		"name":               g.subject,
+		"preferred_username": g.subject,
+	})
+	t.Header["kid"] = fakeKeyID
+	idToken, err := t.SignedString(f.key)
+	if err != nil {
+		writeJSON(w, map[string]string{"error": "server_error"}, 500)
+		return
+	}
+	access, _ := Random()
+	writeJSON(w, map[string]any{"access_token": access, "token_type": "Bearer", "expires_in": 300, "id_token": idToken}, 200)
+}
+
+func writeJSON(w http.ResponseWriter, v any, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,249 @@
+// Package oidc реализует вход через внешнего провайдера OpenID Connect по коду
+// авторизации с PKCE. Метаданные и ключи провайдера загружаются при первом входе,
+// поэтому недоступный провайдер не мешает запуску сервера.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrDiscovery = errors.New("провайдер входа недоступен")
+	ErrExchange  = errors.New("провайдер отклонил код авторизации")
+	ErrIDToken   = errors.New("некорректный ID-токен провайдера")
+)
+
+// Config — настройки одного провайдера.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL — адрес обратного вызова; пустой выводится из адреса запроса.
+	RedirectURL string
+	Scopes      []string
+}
+
+// Identity — проверенные данные пользователя из ID-токена.
+type Identity struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
+
+type metadata struct {
+	Issuer        string `json:"issuer"`
+	AuthEndpoint  string `json:"authorization_endpoint"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JWKSURI       string `json:"jwks_uri"`
+}
+
+// Client — клиент одного провайдера.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys map[string]*rsa.PublicKey
+}
+
+func New(cfg Config) *Client {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *Client) Name() string { return c.cfg.Name }
+
+func (c *Client) RedirectURL() string { return c.cfg.RedirectURL }
+
+// AuthURL возвращает адрес страницы входа провайдера.
+func (c *Client) AuthURL(ctx context.Context, redirect, state, nonce, verifier string) (string, error) {
+	m, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {redirect},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange меняет код авторизации на ID-токен и проверяет его подпись, издателя,
+// получателя, срок и nonce.
+func (c *Client) Exchange(ctx context.Context, code, redirect, verifier, nonce string) (*Identity, error) {
+	m, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d %s", ErrExchange, resp.StatusCode, tok.Error)
+	}
+	return c.verify(ctx, m, tok.IDToken, nonce)
+}
+
+func (c *Client) verify(ctx context.Context, m *metadata, raw, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.key(ctx, m, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(m.Issuer),
+		jwt.WithAudience(c.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDToken, err)
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, fmt.Errorf("%w: nonce не совпадает", ErrIDToken)
+	}
+	b, _ := json.Marshal(claims)
+	var id Identity
+	if err := json.Unmarshal(b, &id); err != nil || id.Subject == "" {
+		return nil, fmt.Errorf("%w: нет sub", ErrIDToken)
+	}
+	return &id, nil
+}
+
+// discover загружает метаданные провайдера и кеширует их после первого успеха.
+func (c *Client) discover(ctx context.Context) (*metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.meta != nil {
+		return c.meta, nil
+	}
+	var m metadata
+	if err := c.get(ctx, c.cfg.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != c.cfg.Issuer || m.AuthEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: неполные метаданные %s", ErrDiscovery, c.cfg.Issuer)
+	}
+	c.meta = &m
+	return c.meta, nil
+}
+
+// key возвращает ключ подписи по kid. Незнакомый kid означает смену ключей
+// у провайдера, и набор ключей загружается заново.
+func (c *Client) key(ctx context.Context, m *metadata, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.get(ctx, m.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	c.keys = make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		c.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("неизвестный ключ %q", kid)
+}
+
+func (c *Client) get(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s ответил %d", ErrDiscovery, u, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	return nil
+}
+
+// Random возвращает случайную строку для state, nonce и PKCE-верификатора.
+func Random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge — PKCE code_challenge метода S256.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,83 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeProvider(t *testing.T) (*httptest.Server, *Client) {
+	f, err := NewFake()
+	require.NoError(t, err)
+	f.ClientID, f.ClientSecret = "uplink", "s3cret"
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return srv, New(Config{Name: "fake", Issuer: srv.URL, ClientID: "uplink", ClientSecret: "s3cret"})
+}
+
+// authorize проходит страницу входа провайдера и возвращает параметры обратного вызова.
+func authorize(t *testing.T, authURL, hint string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL + "&login_hint=" + hint)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return loc.Query()
+}
+
+// Полный вход по коду с PKCE через встроенный провайдер
+func TestCodeFlow(t *testing.T) {
+	_, c := fakeProvider(t)
+	ctx := context.Background()
+	const redirect = "http://app.test/callback"
+
+	authURL, err := c.AuthURL(ctx, redirect, "st", "n1", "verifier")
+	require.NoError(t, err)
+	back := authorize(t, authURL, "alice")
+	assert.Equal(t, "st", back.Get("state"))
+
+	id, err := c.Exchange(ctx, back.Get("code"), redirect, "verifier", "n1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", id.Subject)
+	assert.Equal(t, "alice@example.test", id.Email)
+	assert.True(t, id.EmailVerified)
+
+	_, err = c.Exchange(ctx, back.Get("code"), redirect, "verifier", "n1")
+	assert.ErrorIs(t, err, ErrExchange, "код одноразовый")
+}
+
+// Обмен отклоняется при чужом верификаторе, nonce, секрете или издателе
+func TestCodeFlowRejects(t *testing.T) {
+	srv, c := fakeProvider(t)
+	ctx := context.Background()
+	const redirect = "http://app.test/callback"
+	code := func() string {
+		authURL, err := c.AuthURL(ctx, redirect, "st", "n1", "verifier")
+		require.NoError(t, err)
+		return authorize(t, authURL, "bob").Get("code")
+	}
+
+	_, err := c.Exchange(ctx, code(), redirect, "other", "n1")
+	assert.ErrorIs(t, err, ErrExchange, "PKCE")
+	_, err = c.Exchange(ctx, code(), "http://evil.test/callback", "verifier", "n1")
+	assert.ErrorIs(t, err, ErrExchange, "redirect_uri")
+	_, err = c.Exchange(ctx, code(), redirect, "verifier", "n2")
+	assert.ErrorIs(t, err, ErrIDToken, "nonce")
+
+	wrong := New(Config{Issuer: srv.URL, ClientID: "uplink", ClientSecret: "wrong"})
+	authURL, err := wrong.AuthURL(ctx, redirect, "st", "n1", "verifier")
+	require.NoError(t, err)
+	_, err = wrong.Exchange(ctx, authorize(t, authURL, "bob").Get("code"), redirect, "verifier", "n1")
+	assert.ErrorIs(t, err, ErrExchange, "секрет клиента")
+
+	other := New(Config{Issuer: "http://127.0.0.1:1", ClientID: "uplink"})
+	_, err = other.AuthURL(ctx, redirect, "st", "n1", "verifier")
+	assert.ErrorIs(t, err, ErrDiscovery)
+}
@@ -0,0 +1,40 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// CodeCategory — категория текстов, которые набираются с сохранением переводов строк и отступов.
+const CodeCategory = "code"
+
+// CodeProgress возвращает для каждой позиции ввода число уже набранных непробельных символов.
+// В режиме кода скорость считается только по ним, чтобы отступы не завышали WPM.
+func CodeProgress(content string) []int {
+	g := Graphemes(content)
+	res := make([]int, len(g)+1)
+	for i, s := range g {
+		res[i+1] = res[i]
+		if strings.TrimSpace(s) != "" {
+			res[i+1]++
+		}
+	}
+	return res
+}
+
+// SplitCode разбивает исходный код на фрагменты по пустым строкам, сохраняя переводы строк и отступы.
+func SplitCode(content string, minLen, maxLen int) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var res []string
+	for _, block := range strings.Split(content, "\n\n") {
+		lines := strings.Split(block, "\n")
+		for i, l := range lines {
+			lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+		}
+		snippet := strings.Trim(strings.Join(lines, "\n"), "\n")
+		if n := Length(snippet); n >= minLen && n <= maxLen {
+			res = append(res, snippet)
+		}
+	}
+	return res
+}
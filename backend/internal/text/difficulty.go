@@ -0,0 +1,109 @@
+package text
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	DifficultyMin = 0.0
+	DifficultyMax = 100.0
+
+	// Минимальное число заездов, после которого учитывается средняя скорость на тексте
+	MinRacesForWPM = 3
+)
+
+// Stats — накопленная статистика заездов по тексту и эталонная скорость по всему корпусу.
+type Stats struct {
+	AvgWPM       float64
+	Races        int
+	ReferenceWPM float64
+}
+
+var commonBigrams = map[string]map[string]bool{
+	"en": set("th", "he", "in", "er", "an", "re", "on", "at", "en", "nd",
+		"ti", "es", "or", "te", "of", "ed", "is", "it", "al", "ar",
+		"st", "to", "nt", "ng", "se", "ha", "as", "ou", "io", "le",
+		"ve", "co", "me", "de", "hi", "ri", "ro", "ic", "ne", "ea",
+		"ra", "ce", "li", "ch", "ll", "be", "ma", "si", "om", "ur"),
+	"ru": set("ст", "но", "то", "на", "ен", "ов", "ни", "ра", "во", "ко",
+		"ро", "ал", "по", "пр", "ре", "ет", "ол", "ор", "ан", "не",
+		"ли", "ос", "ер", "го", "од", "ть", "ск", "та", "ва", "ел",
+		"ом", "ии", "ла", "ит", "ка", "ес", "ле", "ог", "те", "ми",
+		"ат", "де", "ем", "ль", "ин", "ас", "ве", "ис", "ны", "ая"),
+}
+
+func set(items ...string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, s := range items {
+		m[s] = true
+	}
+	return m
+}
+
+// Difficulty оценивает сложность текста по шкале 0..100.
+// Учитываются длина, доля редких биграмм, плотность пунктуации, частота спецсимволов
+// и, если заездов достаточно, средняя скорость игроков относительно эталонной.
+func Difficulty(content, lang string, s Stats) float64 {
+	runes := []rune(content)
+	n := float64(len(runes))
+	if n == 0 {
+		return DifficultyMin
+	}
+
+	var punct, symbols float64
+	for _, r := range runes {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsSpace(r):
+		case unicode.IsDigit(r) || unicode.IsSymbol(r) || strings.ContainsRune("{}[]()<>_#@&*/\\|%$^~`", r):
+			symbols++
+		case unicode.IsPunct(r):
+			punct++
+		}
+	}
+
+	base := 0.25*clamp((n-40)/160) +
+		0.30*clamp(RareBigramRatio(content, lang)/0.6) +
+		0.20*clamp((punct/n)/0.1) +
+		0.25*clamp((symbols/n)/0.08)
+
+	if s.Races >= MinRacesForWPM && s.AvgWPM > 0 && s.ReferenceWPM > 0 {
+		wpm := clamp(0.5 + (s.ReferenceWPM-s.AvgWPM)/s.ReferenceWPM)
+		base = 0.7*base + 0.3*wpm
+	}
+
+	return math.Round(base*DifficultyMax*10) / 10
+}
+
+// RareBigramRatio возвращает долю буквенных биграмм, не входящих в список частых для языка.
+func RareBigramRatio(content, lang string) float64 {
+	common, ok := commonBigrams[lang]
+	if !ok {
+		common = commonBigrams["en"]
+	}
+
+	var total, rare float64
+	var prev rune
+	for _, r := range strings.ToLower(content) {
+		if !unicode.IsLetter(r) {
+			prev = 0
+			continue
+		}
+		if prev != 0 {
+			total++
+			if !common[string([]rune{prev, r})] {
+				rare++
+			}
+		}
+		prev = r
+	}
+	if total == 0 {
+		return 0
+	}
+	return rare / total
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,132 @@
+package text
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"uplink/protocol"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// AnyLanguage — ключ правил, применяемых ко всем языкам.
+const AnyLanguage = "*"
+
+// Rules задает типографскую нормализацию текстов.
+// Replace применяется при сохранении текста, Equivalents — при проверке ввода:
+// символ текста (ключ) засчитывается, если введен любой из перечисленных вариантов.
+type Rules struct {
+	Replace     map[string]map[string]string   `json:"replace"`
+	Equivalents map[string]map[string][]string `json:"equivalents"`
+}
+
+func DefaultRules() *Rules {
+	return &Rules{
+		Replace: map[string]map[string]string{
+			AnyLanguage: {
+				"…":      "...",
+				"\u00a0": " ",
+				"\u202f": " ",
+				"\u2009": " ",
+				"\u200b": "",
+				"\ufeff": "",
+			},
+		},
+		Equivalents: map[string]map[string][]string{
+			AnyLanguage: {
+				"–":      {"-"},
+				"—":      {"-"},
+				"\u2011": {"-"},
+				"\u2212": {"-"},
+				"«":      {"\""},
+				"»":      {"\""},
+				"„":      {"\""},
+				"“":      {"\""},
+				"”":      {"\""},
+				"‘":      {"'"},
+				"’":      {"'"},
+				"‚":      {"'"},
+			},
+			"ru": {
+				"ё": {"е"},
+				"Ё": {"Е"},
+			},
+		},
+	}
+}
+
+// LoadRules читает правила из JSON-файла и накладывает их поверх правил по умолчанию.
+func LoadRules(path string) (*Rules, error) {
+	r := DefaultRules()
+	if path == "" {
+		return r, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var custom Rules
+	if err := json.Unmarshal(b, &custom); err != nil {
+		return nil, err
+	}
+	for lang, m := range custom.Replace {
+		if r.Replace[lang] == nil {
+			r.Replace[lang] = make(map[string]string)
+		}
+		for k, v := range m {
+			r.Replace[lang][k] = v
+		}
+	}
+	for lang, m := range custom.Equivalents {
+		if r.Equivalents[lang] == nil {
+			r.Equivalents[lang] = make(map[string][]string)
+		}
+		for k, v := range m {
+			r.Equivalents[lang][k] = v
+		}
+	}
+	return r, nil
+}
+
+// Normalize приводит текст к NFC и заменяет символы, которые нельзя набрать с клавиатуры.
+func (r *Rules) Normalize(s, lang string) string {
+	s = norm.NFC.String(s)
+	pairs := make([]string, 0)
+	for _, l := range []string{lang, AnyLanguage} {
+		keys := make([]string, 0, len(r.Replace[l]))
+		for k := range r.Replace[l] {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			pairs = append(pairs, k, r.Replace[l][k])
+		}
+	}
+	if len(pairs) > 0 {
+		s = strings.NewReplacer(pairs...).Replace(s)
+	}
+	return s
+}
+
+// EquivalentsFor возвращает таблицу допустимых замен для языка вместе с общими правилами.
+func (r *Rules) EquivalentsFor(lang string) map[string][]string {
+	res := make(map[string][]string)
+	for _, l := range []string{AnyLanguage, lang} {
+		for k, v := range r.Equivalents[l] {
+			res[k] = append(res[k], v...)
+		}
+	}
+	return res
+}
+
+// Graphemes приводит строку к NFC и разбивает ее на символы так же, как клиент:
+// см. protocol.Graphemes.
+func Graphemes(s string) []string {
+	return protocol.Graphemes(norm.NFC.String(s))
+}
+
+// Length возвращает длину текста в графемах.
+func Length(s string) int {
+	return len(Graphemes(s))
+}
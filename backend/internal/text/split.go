@@ -0,0 +1,117 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	PassageMinLength = 40
+	PassageMaxLength = 300
+)
+
+// Split разбивает корпус на отрывки для заездов по границам предложений.
+// Предложения длиннее maxLen пропускаются, остаток короче minLen отбрасывается.
+func Split(content string, minLen, maxLen int) []string {
+	var res []string
+	var cur []string
+	curLen := 0
+
+	flush := func() {
+		if curLen >= minLen {
+			res = append(res, strings.Join(cur, " "))
+		}
+		cur, curLen = nil, 0
+	}
+
+	for _, s := range Sentences(content) {
+		n := Length(s)
+		if n > maxLen {
+			flush()
+			continue
+		}
+		add := n
+		if curLen > 0 {
+			add++
+		}
+		if curLen+add > maxLen {
+			flush()
+			add = n
+		}
+		cur = append(cur, s)
+		curLen += add
+	}
+	flush()
+	return res
+}
+
+// Sentences делит текст на предложения, схлопывая переводы строк и повторные пробелы.
+func Sentences(content string) []string {
+	words := strings.Fields(content)
+	var res []string
+	var cur []string
+	for i, w := range words {
+		cur = append(cur, w)
+		if endsSentence(w) && (i == len(words)-1 || startsSentence(words[i+1])) {
+			res = append(res, strings.Join(cur, " "))
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		res = append(res, strings.Join(cur, " "))
+	}
+	return res
+}
+
+func endsSentence(w string) bool {
+	w = strings.TrimRight(w, "\"'»”’)]")
+	return strings.HasSuffix(w, ".") || strings.HasSuffix(w, "!") || strings.HasSuffix(w, "?") || strings.HasSuffix(w, "…")
+}
+
+func startsSentence(w string) bool {
+	for _, r := range w {
+		if strings.ContainsRune("\"'«“„‘(-–—", r) {
+			continue
+		}
+		return unicode.IsUpper(r) || unicode.IsDigit(r)
+	}
+	return false
+}
+
+// DetectLanguage определяет язык текста по преобладающему алфавиту.
+func DetectLanguage(content string) string {
+	var cyr, lat int
+	for _, r := range content {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyr++
+		case unicode.Is(unicode.Latin, r):
+			lat++
+		}
+	}
+	if cyr > lat {
+		return "ru"
+	}
+	return "en"
+}
+
+// Fingerprint возвращает ключ для поиска дубликатов: регистр, пунктуация и пробелы не учитываются.
+func Fingerprint(content string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(content) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// DedupKey возвращает ключ для поиска дубликатов текста категории category. В коде
+// регистр, знаки и отступы значимы, поэтому фрагменты сравниваются целиком;
+// остальные тексты сравниваются по Fingerprint.
+func DedupKey(content, category string) string {
+	if category == CodeCategory {
+		return CodeCategory + "\x00" + content
+	}
+	return Fingerprint(content)
+}
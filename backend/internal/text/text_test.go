@@ -0,0 +1,112 @@
+package text
+
+import (
+	"testing"
+	"uplink/protocol"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Сложность текста
+func TestDifficulty(t *testing.T) {
+	pangram := "The quick brown fox jumps over the lazy dog."
+	code := "func (s *Server) ListenAndServe() error { if s.shuttingDown() { return ErrServerClosed } return s.Serve(ln) }"
+
+	easy := Difficulty(pangram, "en", Stats{})
+	hard := Difficulty(code, "en", Stats{})
+	assert.Less(t, easy, hard, "код должен быть сложнее панграммы")
+	assert.GreaterOrEqual(t, easy, DifficultyMin)
+	assert.LessOrEqual(t, hard, DifficultyMax)
+
+	assert.Equal(t, DifficultyMin, Difficulty("", "en", Stats{}))
+}
+
+// Влияние средней скорости на сложность
+func TestDifficultyHistoricalWPM(t *testing.T) {
+	content := "Typing speed is usually measured in words per minute."
+
+	slow := Difficulty(content, "en", Stats{AvgWPM: 30, Races: 10, ReferenceWPM: 60})
+	fast := Difficulty(content, "en", Stats{AvgWPM: 90, Races: 10, ReferenceWPM: 60})
+	assert.Greater(t, slow, fast, "текст с низкой средней скоростью должен быть сложнее")
+
+	few := Difficulty(content, "en", Stats{AvgWPM: 30, Races: 1, ReferenceWPM: 60})
+	assert.Equal(t, Difficulty(content, "en", Stats{}), few, "малое число заездов не должно учитываться")
+}
+
+// Редкие биграммы
+func TestRareBigramRatio(t *testing.T) {
+	assert.Equal(t, 0.0, RareBigramRatio("the", "en"))
+	assert.Equal(t, 1.0, RareBigramRatio("qzx", "en"))
+	assert.Less(t, RareBigramRatio("на столе", "ru"), RareBigramRatio("съешь ещё", "ru"))
+}
+
+// Типографская нормализация
+func TestNormalize(t *testing.T) {
+	r := DefaultRules()
+
+	assert.Equal(t, "Подожди... нет", r.Normalize("Подожди…\u00a0нет", "ru"))
+	assert.Equal(t, "ё", r.Normalize("\u0435\u0308", "ru"), "текст должен приводиться к NFC")
+	assert.Equal(t, "a – b", r.Normalize("a – b", "en"), "тире сохраняется в тексте")
+}
+
+// Эквивалентные символы при вводе
+func TestMatches(t *testing.T) {
+	r := DefaultRules()
+	ru, en := r.EquivalentsFor("ru"), r.EquivalentsFor("en")
+
+	assert.True(t, protocol.Matches(ru, "–", "-"))
+	assert.True(t, protocol.Matches(ru, "ё", "е"))
+	assert.False(t, protocol.Matches(en, "ё", "е"), "замена ё/е действует только для русского")
+	assert.True(t, protocol.Matches(en, "«", "\""))
+	assert.False(t, protocol.Matches(en, "a", "b"))
+
+	assert.Contains(t, ru, "ё")
+	assert.Contains(t, ru, "—")
+}
+
+// Длина в графемах
+func TestLength(t *testing.T) {
+	assert.Equal(t, 3, Length("ёжа"))
+	assert.Equal(t, 3, Length("\u0435\u0308жа"), "комбинирующий знак не увеличивает длину")
+	assert.Equal(t, 2, Length("\U0001F469\u200d\U0001F4BB!"), "последовательность с ZWJ — один символ")
+	assert.Equal(t, []string{"a", "é", "b"}, Graphemes("aéb"))
+}
+
+// Разбиение корпуса на отрывки
+func TestSplit(t *testing.T) {
+	corpus := "Это первое предложение.  Это второе,\nдлинное предложение!\n\nТретье? Да. Мистер Смит пришёл в 10 ч. утра."
+
+	sentences := Sentences(corpus)
+	assert.Equal(t, "Это второе, длинное предложение!", sentences[1])
+	assert.Equal(t, "Мистер Смит пришёл в 10 ч. утра.", sentences[len(sentences)-1], "сокращение не должно разрывать предложение")
+
+	passages := Split(corpus, 20, 60)
+	assert.NotEmpty(t, passages)
+	for _, p := range passages {
+		assert.GreaterOrEqual(t, Length(p), 20)
+		assert.LessOrEqual(t, Length(p), 60)
+	}
+
+	assert.Empty(t, Split("Коротко.", 20, 60))
+}
+
+// Определение языка и дубликаты
+func TestDetectLanguageAndFingerprint(t *testing.T) {
+	assert.Equal(t, "ru", DetectLanguage("Съешь же ещё этих мягких французских булок"))
+	assert.Equal(t, "en", DetectLanguage("The quick brown fox"))
+	assert.Equal(t, Fingerprint("Hello,  World!"), Fingerprint("hello world"))
+
+	assert.Equal(t, DedupKey("Hello,  World!", "general"), DedupKey("hello world", "general"))
+	assert.NotEqual(t, DedupKey("a := b", CodeCategory), DedupKey("a = b", CodeCategory))
+	assert.NotEqual(t, DedupKey("if x {\n\ty()\n}", CodeCategory), DedupKey("if x {\ny()\n}", CodeCategory))
+	assert.NotEqual(t, DedupKey("abc", CodeCategory), DedupKey("abc", "general"))
+}
+
+// Режим кода
+func TestCodeProgressAndSplitCode(t *testing.T) {
+	assert.Equal(t, []int{0, 1, 1, 1, 2}, CodeProgress("a\n\tb"))
+
+	src := "func a() {\n\treturn 1   \n}\n\n\nx := 1\n\nfunc b() {\n\treturn 2\n}\r\n"
+	snippets := SplitCode(src, 10, 100)
+	assert.Equal(t, []string{"func a() {\n\treturn 1\n}", "func b() {\n\treturn 2\n}"}, snippets)
+}
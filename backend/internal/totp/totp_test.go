@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Секрет "12345678901234567890" из RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Коды совпадают с контрольными значениями RFC 6238 (последние 6 цифр)
+func TestCode(t *testing.T) {
+	cases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range cases {
+		got, err := Code(rfcSecret, Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, unix)
+	}
+}
+
+// Код принимается на соседнем шаге и отклоняется дальше
+func TestVerify(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step, ok := Verify(rfcSecret, "081804", now)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	_, ok = Verify(rfcSecret, "081 804", now.Add(Period*time.Second))
+	assert.True(t, ok, "отставание на шаг и пробелы допустимы")
+	_, ok = Verify(rfcSecret, "081804", now.Add(3*Period*time.Second))
+	assert.False(t, ok)
+	_, ok = Verify(rfcSecret, "12345", now)
+	assert.False(t, ok)
+	_, ok = Verify("not base32!", "081804", now)
+	assert.False(t, ok)
+}
+
+func TestSecretAndURI(t *testing.T) {
+	s, err := NewSecret()
+	require.NoError(t, err)
+	assert.Len(t, s, 32)
+	_, err = Code(s, 1)
+	require.NoError(t, err)
+
+	uri := URI("Uplink", "neo runner", s)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Uplink:neo%20runner?"))
+	assert.Contains(t, uri, "secret="+s)
+	assert.Contains(t, uri, "issuer=Uplink")
+}
@@ -0,0 +1,5 @@
+ALTER TABLE texts
+    ADD COLUMN difficulty DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN difficulty_updated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_texts_lang_cat_difficulty ON texts(language, category, difficulty);
@@ -0,0 +1,26 @@
+ALTER TABLE texts
+    ADD COLUMN title VARCHAR(200) NOT NULL DEFAULT '',
+    ADD COLUMN author VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN source VARCHAR(200) NOT NULL DEFAULT '',
+    ADD COLUMN license VARCHAR(50) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_matches_text_id ON matches(text_id);
+
+UPDATE texts SET title = 'A Tale of Two Cities', author = 'Charles Dickens', source = 'Project Gutenberg', license = 'public-domain'
+    WHERE content LIKE 'It was the best of times%';
+UPDATE texts SET title = 'Moby-Dick', author = 'Herman Melville', source = 'Project Gutenberg', license = 'public-domain'
+    WHERE content LIKE 'Call me Ishmael%';
+UPDATE texts SET title = 'Anna Karenina', author = 'Leo Tolstoy', source = 'Project Gutenberg', license = 'public-domain'
+    WHERE content LIKE 'All happy families%';
+UPDATE texts SET title = 'Pride and Prejudice', author = 'Jane Austen', source = 'Project Gutenberg', license = 'public-domain'
+    WHERE content LIKE 'It is a truth universally acknowledged%';
+UPDATE texts SET title = 'Neuromancer', author = 'William Gibson', source = 'Ace Books', license = 'fair-use'
+    WHERE content LIKE 'The sky above the port%';
+UPDATE texts SET title = 'Преступление и наказание', author = 'Ф. М. Достоевский', source = 'Общественное достояние', license = 'public-domain'
+    WHERE content LIKE 'В начале июля%';
+UPDATE texts SET title = 'Евгений Онегин', author = 'А. С. Пушкин', source = 'Общественное достояние', license = 'public-domain'
+    WHERE content LIKE 'Мой дядя самых честных правил%' OR content LIKE 'Я к вам пишу%';
+UPDATE texts SET title = 'Анна Каренина', author = 'Л. Н. Толстой', source = 'Общественное достояние', license = 'public-domain'
+    WHERE content LIKE 'Все счастливые семьи%';
+UPDATE texts SET title = 'Крестьянские дети', author = 'Н. А. Некрасов', source = 'Общественное достояние', license = 'public-domain'
+    WHERE content LIKE 'Однажды в студеную зимнюю пору%';
@@ -0,0 +1,24 @@
+ALTER TABLE texts ADD COLUMN subcategory VARCHAR(20) NOT NULL DEFAULT '';
+
+UPDATE texts SET content = E'func (s *Server) ListenAndServe() error {\n\tif s.shuttingDown() {\n\t\treturn ErrServerClosed\n\t}\n\treturn s.Serve(ln)\n}', length = 114, subcategory = 'go'
+    WHERE category = 'code' AND content LIKE E'func (s *Server) ListenAndServe()%';
+UPDATE texts SET content = E'public static void main(String[] args) {\n    System.out.println("Hello, World!");\n}', length = 83, subcategory = 'java'
+    WHERE category = 'code' AND content LIKE E'public static void main%';
+UPDATE texts SET content = E'SELECT *\nFROM users\nWHERE id = 1 AND active = true\nORDER BY created_at DESC;', length = 76, subcategory = 'sql'
+    WHERE category = 'code' AND content LIKE E'SELECT * FROM users WHERE id = 1%';
+UPDATE texts SET content = E'const express = require("express");\nconst app = express();\napp.listen(3000);', length = 76, subcategory = 'javascript'
+    WHERE category = 'code' AND content LIKE E'const express = require%';
+UPDATE texts SET content = E'if __name__ == "__main__":\n    print("This is a script")\nelse:\n    pass', length = 71, subcategory = 'python'
+    WHERE category = 'code' AND content LIKE E'if __name__ == "__main__"%';
+
+INSERT INTO texts (content, language, category, subcategory, length) VALUES
+    (E'for i, v := range items {\n\tif v == nil {\n\t\tcontinue\n\t}\n\tsum += v.Value * i\n}', 'en', 'code', 'go', 76),
+    (E'func Max(a, b int) int {\n\tif a > b {\n\t\treturn a\n\t}\n\treturn b\n}', 'en', 'code', 'go', 62),
+    (E'def fib(n):\n    a, b = 0, 1\n    for _ in range(n):\n        a, b = b, a + b\n    return a', 'en', 'code', 'python', 87),
+    (E'with open("data.txt") as f:\n    for line in f:\n        print(line.strip())', 'en', 'code', 'python', 74),
+    (E'const sum = (xs) => {\n  return xs.reduce((acc, x) => acc + x, 0);\n};', 'en', 'code', 'javascript', 68),
+    (E'fetch("/api/v1/texts")\n  .then((res) => res.json())\n  .then((data) => console.log(data));', 'en', 'code', 'javascript', 89),
+    (E'for (int i = 0; i < n; i++) {\n    if (i % 2 == 0) {\n        total += i;\n    }\n}', 'en', 'code', 'java', 79),
+    (E'SELECT u.username, COUNT(*) AS races\nFROM match_results mr\nJOIN users u ON u.id = mr.user_id\nGROUP BY u.username;', 'en', 'code', 'sql', 113);
+
+CREATE INDEX idx_texts_category_subcategory ON texts(category, subcategory);
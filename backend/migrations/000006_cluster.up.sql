@@ -0,0 +1,20 @@
+CREATE TABLE cluster_nodes (
+    node_id VARCHAR(64) PRIMARY KEY,
+    seen_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE room_directory (
+    room_id VARCHAR(32) PRIMARY KEY,
+    node_id VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_room_directory_node ON room_directory(node_id);
+
+-- Сообщения шины, не помещающиеся в полезную нагрузку NOTIFY
+CREATE TABLE cluster_messages (
+    id BIGSERIAL PRIMARY KEY,
+    topic VARCHAR(128) NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
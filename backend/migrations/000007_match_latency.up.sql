@@ -0,0 +1 @@
+ALTER TABLE match_results ADD COLUMN latency_ms INT NOT NULL DEFAULT 0;
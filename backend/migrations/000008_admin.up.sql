@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN banned_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN ban_reason TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE admin_actions (
+    id BIGSERIAL PRIMARY KEY,
+    admin_id UUID NOT NULL REFERENCES users(id),
+    action VARCHAR(32) NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_admin_actions_created ON admin_actions(created_at DESC);
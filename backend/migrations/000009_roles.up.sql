@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'player'
+    CHECK (role IN ('player', 'moderator', 'admin'));
+UPDATE users SET role = 'admin' WHERE is_admin;
+ALTER TABLE users DROP COLUMN is_admin;
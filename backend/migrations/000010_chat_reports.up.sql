@@ -0,0 +1,19 @@
+CREATE TABLE chat_reports (
+    id BIGSERIAL PRIMARY KEY,
+    reporter_id UUID NOT NULL REFERENCES users(id),
+    room_id VARCHAR(32) NOT NULL,
+    message_id VARCHAR(32) NOT NULL,
+    sender_id TEXT NOT NULL,
+    sender_name TEXT NOT NULL,
+    text TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    context JSONB NOT NULL DEFAULT '[]',
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by UUID REFERENCES users(id),
+    resolved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (reporter_id, room_id, message_id)
+);
+
+CREATE INDEX idx_chat_reports_status ON chat_reports(status, created_at DESC);
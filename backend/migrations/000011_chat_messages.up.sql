@@ -0,0 +1,14 @@
+CREATE TABLE chat_messages (
+    id BIGSERIAL PRIMARY KEY,
+    room_id VARCHAR(32) NOT NULL,
+    match_id UUID REFERENCES matches(id) ON DELETE SET NULL,
+    message_id VARCHAR(32) NOT NULL,
+    sender_id TEXT NOT NULL,
+    sender_name TEXT NOT NULL,
+    text TEXT NOT NULL,
+    action BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_chat_messages_room ON chat_messages(room_id, id DESC);
+CREATE INDEX idx_chat_messages_match ON chat_messages(match_id, id DESC);
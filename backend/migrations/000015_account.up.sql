@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE users ADD COLUMN username_changed_at TIMESTAMPTZ;
+
+-- Результаты удаленного игрока остаются в матчах соперников без ссылки на него.
+ALTER TABLE match_results DROP CONSTRAINT match_results_pkey;
+ALTER TABLE match_results ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE match_results ADD CONSTRAINT match_results_match_user UNIQUE (match_id, user_id);
+ALTER TABLE match_results DROP CONSTRAINT match_results_user_id_fkey,
+    ADD CONSTRAINT match_results_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE admin_actions ALTER COLUMN admin_id DROP NOT NULL;
+ALTER TABLE admin_actions DROP CONSTRAINT admin_actions_admin_id_fkey,
+    ADD CONSTRAINT admin_actions_admin_id_fkey FOREIGN KEY (admin_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE chat_reports DROP CONSTRAINT chat_reports_reporter_id_fkey,
+    ADD CONSTRAINT chat_reports_reporter_id_fkey FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE chat_reports DROP CONSTRAINT chat_reports_resolved_by_fkey,
+    ADD CONSTRAINT chat_reports_resolved_by_fkey FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_chat_messages_sender ON chat_messages(sender_id);
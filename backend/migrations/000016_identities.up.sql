@@ -0,0 +1,12 @@
+-- Внешние учетные записи (OIDC), привязанные к игрокам. У игрока, вошедшего только
+-- через провайдера, password_hash пустой.
+CREATE TABLE user_identities (
+    provider VARCHAR(32) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMPTZ,
+    PRIMARY KEY (provider, subject),
+    UNIQUE (user_id, provider)
+);
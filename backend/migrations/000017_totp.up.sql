@@ -0,0 +1,15 @@
+-- Двухфакторная аутентификация. totp_secret зашифрован ключом сервера; пока
+-- totp_enabled_at пуст, секрет ждет подтверждения первым кодом.
+-- totp_last_step — шаг последнего принятого кода, повторно он не принимается.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_recovery_codes_user ON recovery_codes(user_id);
@@ -0,0 +1,14 @@
+-- Неудачные попытки входа. key — 'user:<имя>' или 'ip:<адрес>'; имя хранится как
+-- введено, поэтому перебор несуществующих аккаунтов тоже упирается в задержку.
+-- Счетчик начинается заново, если прошлая неудача была давно.
+CREATE TABLE login_failures (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 1,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX idx_login_failures_last ON login_failures(last_failure_at);
+
+-- Записи журнала, которые сделал сервер, а не администратор.
+ALTER TABLE admin_actions ADD COLUMN by_system BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,14 @@
+-- Почта для восстановления пароля. Необязательна; адрес сравнивается без учета регистра.
+ALTER TABLE users ADD COLUMN email VARCHAR(255);
+CREATE UNIQUE INDEX idx_users_email ON users(LOWER(email));
+
+-- Токены сброса пароля. Хранится только SHA-256 токена; токен одноразовый.
+CREATE TABLE password_resets (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_password_resets_user ON password_resets(user_id, created_at DESC);
@@ -0,0 +1,10 @@
+-- Одноразовые билеты для подключения к WebSocket: браузер не может передать заголовок
+-- при открытии сокета, а токен в адресе попадал бы в журналы. Хранится только SHA-256.
+CREATE TABLE ws_tickets (
+    ticket_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID REFERENCES sessions(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_ws_tickets_expires ON ws_tickets(expires_at);
@@ -0,0 +1,2 @@
+-- Роль того, кто заблокировал аккаунт: снять блокировку может только тот же ранг или старше.
+ALTER TABLE users ADD COLUMN ban_role VARCHAR(16);
@@ -0,0 +1,12 @@
+-- Подтверждение почты. Адрес попадает в users.email, только когда владелец ящика
+-- перешел по ссылке из письма. Хранится только SHA-256 токена; токен одноразовый.
+CREATE TABLE email_verifications (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_email_verifications_user ON email_verifications(user_id, created_at DESC);
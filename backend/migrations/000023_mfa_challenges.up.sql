@@ -0,0 +1,11 @@
+-- Токены второго шага входа. Попытки ввести код считаются в базе, чтобы токен нельзя
+-- было перебирать на разных узлах, и токен гасится удалением строки. Хранится только
+-- SHA-256 идентификатора токена (jti).
+CREATE TABLE mfa_challenges (
+    jti_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tries INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_mfa_challenges_expires ON mfa_challenges(expires_at);
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall/js"
+)
+
+func (a *App) bindAccount() {
+	bind := func(name string, fn func(args []js.Value)) {
+		js.Global().Set(name, js.FuncOf(func(this js.Value, args []js.Value) any {
+			fn(args)
+			return nil
+		}))
+	}
+	value := func(id string) string {
+		el := a.doc.Call("getElementById", id)
+		if el.IsNull() {
+			return ""
+		}
+		v := el.Get("value").String()
+		el.Set("value", "")
+		return v
+	}
+	bind("accountPassword", func([]js.Value) {
+		current, next := value("account-current"), value("account-new")
+		if len(next) < 8 {
+			a.accountStatus("ERROR новый пароль короче 8 символов")
+			return
+		}
+		go func() {
+			var res authReply
+			err := a.apiCall("POST", "/api/v1/account/password", map[string]string{"current_password": current, "new_password": next}, &res)
+			if err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			// Сервер завершил все сессии и положил в cookie новую для этой вкладки.
+			saveSession(res.ExpiresIn)
+			a.accountStatus("OK пароль изменен, остальные сессии завершены")
+		}()
+	})
+	bind("accountRename", func([]js.Value) {
+		name := strings.TrimSpace(value("account-username"))
+		if name == "" {
+			return
+		}
+		go func() {
+			if err := a.apiCall("POST", "/api/v1/account/username", map[string]string{"username": name}, nil); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			// Имя в токене доступа обновится только при обмене, поэтому меняем токен сразу.
+			js.Global().Get("localStorage").Call("removeItem", "session_exp")
+			a.session()
+			a.User.Username = name
+			renderMenu(a, "account")
+		}()
+	})
+	bind("accountEmail", func([]js.Value) {
+		email, password := strings.TrimSpace(value("account-email")), value("account-email-password")
+		go func() {
+			if err := a.apiCall("POST", "/api/v1/account/email", map[string]string{"email": email, "password": password}, nil); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			if email == "" {
+				a.User.Email = ""
+				a.accountNotice = "OK почта удалена, восстановить пароль по почте не получится"
+			} else {
+				// Адрес сохранится, когда игрок откроет ссылку из письма.
+				a.accountNotice = "OK на " + email + " отправлена ссылка, почта сохранится после перехода по ней"
+			}
+			renderMenu(a, "account")
+		}()
+	})
+	bind("accountExport", func([]js.Value) { go a.exportAccount() })
+	bind("accountLink", func(args []js.Value) {
+		provider := args[0].String()
+		go func() {
+			var res struct {
+				URL string `json:"url"`
+			}
+			if err := a.apiCall("POST", "/api/v1/auth/oidc/"+url.PathEscape(provider)+"/link", nil, &res); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			js.Global().Get("location").Set("href", res.URL)
+		}()
+	})
+	bind("accountUnlink", func(args []js.Value) {
+		provider := args[0].String()
+		if !confirm("Отвязать учетную запись " + provider + "?") {
+			return
+		}
+		go func() {
+			if err := a.apiCall("DELETE", "/api/v1/account/identities/"+url.PathEscape(provider), nil, nil); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.fetchIdentities()
+		}()
+	})
+	bind("accountTwoFactorEnroll", func([]js.Value) {
+		password := value("account-2fa-password")
+		go func() {
+			var res struct {
+				Secret string `json:"secret"`
+				URI    string `json:"uri"`
+			}
+			if err := a.apiCall("POST", "/api/v1/account/2fa/enroll", map[string]string{"password": password}, &res); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.setTwoFactor(`<div class="text-[10px] opacity-60 normal-case">Добавьте ключ в приложение-аутентификатор по ссылке или вручную и введите код из приложения.</div>
+				<a href="` + html.EscapeString(res.URI) + `" class="text-xs underline normal-case break-all">` + html.EscapeString(res.URI) + `</a>
+				<div class="text-xs font-mono tracking-widest">` + html.EscapeString(res.Secret) + `</div>
+				<div class="flex gap-2">` + accountInput("account-2fa-code", "text", "000000") + accountButton("accountTwoFactorConfirm()", "CONFIRM") + `</div>`)
+		}()
+	})
+	bind("accountTwoFactorConfirm", func([]js.Value) {
+		code := value("account-2fa-code")
+		go func() {
+			var res struct {
+				Codes []string `json:"recovery_codes"`
+			}
+			if err := a.apiCall("POST", "/api/v1/account/2fa/confirm", map[string]string{"code": code}, &res); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.accountStatus("OK двухфакторная аутентификация включена")
+			a.showRecoveryCodes(res.Codes)
+		}()
+	})
+	bind("accountTwoFactorCodes", func([]js.Value) {
+		password, code := value("account-2fa-password"), value("account-2fa-code")
+		go func() {
+			var res struct {
+				Codes []string `json:"recovery_codes"`
+			}
+			if err := a.apiCall("POST", "/api/v1/account/2fa/recovery-codes", map[string]string{"password": password, "code": code}, &res); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.accountStatus("OK старые коды восстановления больше не действуют")
+			a.showRecoveryCodes(res.Codes)
+		}()
+	})
+	bind("accountTwoFactorDisable", func([]js.Value) {
+		password, code := value("account-2fa-password"), value("account-2fa-code")
+		go func() {
+			if err := a.apiCall("POST", "/api/v1/account/2fa/disable", map[string]string{"password": password, "code": code}, nil); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.accountStatus("OK двухфакторная аутентификация выключена")
+			a.fetchTwoFactor()
+		}()
+	})
+	bind("accountDelete", func([]js.Value) {
+		password := value("account-delete-password")
+		if !confirm("Удалить аккаунт без возможности восстановления? Результаты матчей останутся у соперников без вашего имени.") {
+			return
+		}
+		go func() {
+			if err := a.apiCall("DELETE", "/api/v1/account", map[string]string{"password": password}, nil); err != nil {
+				a.accountStatus("ERROR " + err.Error())
+				return
+			}
+			a.User = nil
+			a.closePresence()
+			a.clearSession()
+			a.navigate("/auth")
+		}()
+	})
+}
+
+func (a *App) accountStatus(text string) {
+	if el := a.doc.Call("getElementById", "account-status"); !el.IsNull() {
+		el.Set("innerText", text)
+	}
+}
+
+// fetchIdentities рисует привязанные учетные записи провайдеров и кнопки привязки остальных.
+func (a *App) fetchIdentities() {
+	var linked struct {
+		Data []struct {
+			Provider string `json:"provider"`
+			Email    string `json:"email"`
+		} `json:"data"`
+	}
+	var providers struct {
+		Data []string `json:"data"`
+	}
+	if err := a.apiCall("GET", "/api/v1/account/identities", nil, &linked); err != nil {
+		a.accountStatus("ERROR " + err.Error())
+		return
+	}
+	if err := a.apiCall("GET", "/api/v1/auth/oidc", nil, &providers); err != nil {
+		a.accountStatus("ERROR " + err.Error())
+		return
+	}
+	var rows strings.Builder
+	seen := map[string]bool{}
+	for _, i := range linked.Data {
+		seen[i.Provider] = true
+		p := html.EscapeString(i.Provider)
+		rows.WriteString(`<div class="flex justify-between items-center text-xs"><span>` + strings.ToUpper(p) + ` <span class="opacity-40 normal-case">` + html.EscapeString(i.Email) + `</span></span>
+			<button onclick="accountUnlink('` + p + `')" class="text-[9px] border border-red-500/30 text-red-500/70 px-2 py-1 hover:bg-red-500/10">UNLINK</button></div>`)
+	}
+	for _, name := range providers.Data {
+		if seen[name] {
+			continue
+		}
+		p := html.EscapeString(name)
+		rows.WriteString(`<div class="flex justify-between items-center text-xs"><span class="opacity-40">` + strings.ToUpper(p) + `</span>
+			<button onclick="accountLink('` + p + `')" class="text-[9px] border border-[#00f3ff]/50 px-2 py-1 hover:bg-[#00f3ff]/20">LINK</button></div>`)
+	}
+	if rows.Len() == 0 {
+		rows.WriteString(`<div class="text-[10px] opacity-30">NO_EXTERNAL_PROVIDERS</div>`)
+	}
+	if el := a.doc.Call("getElementById", "account-identities"); !el.IsNull() {
+		el.Set("innerHTML", rows.String())
+	}
+}
+
+func (a *App) setTwoFactor(content string) {
+	if el := a.doc.Call("getElementById", "account-2fa"); !el.IsNull() {
+		el.Set("innerHTML", content)
+	}
+}
+
+// fetchTwoFactor рисует состояние двухфакторной аутентификации и действия с ней.
+func (a *App) fetchTwoFactor() {
+	var st struct {
+		Enabled bool `json:"enabled"`
+		Left    int  `json:"recovery_codes_left"`
+	}
+	if err := a.apiCall("GET", "/api/v1/account/2fa", nil, &st); err != nil {
+		a.accountStatus("ERROR " + err.Error())
+		return
+	}
+	if !st.Enabled {
+		a.setTwoFactor(`<div class="flex gap-2">` + accountInput("account-2fa-password", "password", "CURRENT") + accountButton("accountTwoFactorEnroll()", "ENABLE") + `</div>`)
+		return
+	}
+	a.setTwoFactor(`<div class="text-xs">ENABLED <span class="opacity-40">· RECOVERY_CODES_LEFT ` + strconv.Itoa(st.Left) + `</span></div>
+		<div class="flex gap-2">` + accountInput("account-2fa-password", "password", "CURRENT") + accountInput("account-2fa-code", "text", "CODE") + `</div>
+		<div class="flex gap-2">` + accountButton("accountTwoFactorCodes()", "NEW_RECOVERY_CODES") + accountButton("accountTwoFactorDisable()", "DISABLE") + `</div>`)
+}
+
+// showRecoveryCodes показывает новые коды восстановления; сервер хранит только их хэши.
+func (a *App) showRecoveryCodes(codes []string) {
+	var list strings.Builder
+	for _, c := range codes {
+		list.WriteString(`<div>` + html.EscapeString(c) + `</div>`)
+	}
+	a.setTwoFactor(`<div class="text-[10px] opacity-60 normal-case">Сохраните коды восстановления: каждый сработает один раз вместо кода из приложения. Больше они показаны не будут.</div>
+		<div class="grid grid-cols-2 gap-1 text-xs font-mono normal-case">` + list.String() + `</div>
+		<div>` + accountButton("changeTab('account')", "DONE") + `</div>`)
+}
+
+// exportAccount скачивает выгрузку данных игрока JSON-файлом.
+func (a *App) exportAccount() {
+	var data json.RawMessage
+	if err := a.apiCall("GET", "/api/v1/account/export", nil, &data); err != nil {
+		a.accountStatus("ERROR " + err.Error())
+		return
+	}
+	blob := js.Global().Get("Blob").New(js.ValueOf([]any{string(data)}), js.ValueOf(map[string]any{"type": "application/json"}))
+	href := js.Global().Get("URL").Call("createObjectURL", blob)
+	link := a.doc.Call("createElement", "a")
+	link.Set("href", href)
+	link.Set("download", "uplink-export-"+a.User.ID+".json")
+	link.Call("click")
+	js.Global().Get("URL").Call("revokeObjectURL", href)
+	a.accountStatus("OK выгрузка сохранена")
+}
+
+// renderAccount рисует вкладку аккаунта: пароль, имя, почту, 2FA, выгрузку данных и удаление.
+func (a *App) renderAccount() string {
+	notice := a.accountNotice
+	a.accountNotice = ""
+	go a.fetchIdentities()
+	go a.fetchTwoFactor()
+	input, button := accountInput, accountButton
+	recovery := "NOT_SET"
+	if a.User.Email != "" {
+		recovery = `<span class="normal-case">` + html.EscapeString(a.User.Email) + `</span>`
+	}
+	return `
+		<div class="relative z-10 grid gap-6">
+			<div id="account-status" class="text-[10px] opacity-50 normal-case h-4">` + html.EscapeString(notice) + `</div>
+			<div class="hud-border p-4 bg-black/40">
+				<div class="text-[9px] opacity-40 mb-2 tracking-widest">ACCESS_KEY</div>
+				<div class="flex gap-2">` + input("account-current", "password", "CURRENT") + input("account-new", "password", "NEW") + button("accountPassword()", "CHANGE") + `</div>
+			</div>
+			<div class="hud-border p-4 bg-black/40">
+				<div class="text-[9px] opacity-40 mb-2 tracking-widest">CALLSIGN · ` + html.EscapeString(a.User.Username) + ` · ONCE_PER_30_DAYS</div>
+				<div class="flex gap-2">` + input("account-username", "text", "NETRUNER_NAME") + button("accountRename()", "RENAME") + `</div>
+			</div>
+			<div class="hud-border p-4 bg-black/40">
+				<div class="text-[9px] opacity-40 mb-2 tracking-widest">RECOVERY_EMAIL · ` + recovery + `</div>
+				<div class="flex gap-2">` + input("account-email", "email", "NAME@EXAMPLE.COM") + input("account-email-password", "password", "CURRENT") + button("accountEmail()", "SAVE") + `</div>
+			</div>
+			<div class="hud-border p-4 bg-black/40">
+				<div class="text-[9px] opacity-40 mb-2 tracking-widest">TWO_FACTOR · TOTP</div>
+				<div id="account-2fa" class="grid gap-2"></div>
+			</div>
+			<div class="hud-border p-4 bg-black/40">
+				<div class="text-[9px] opacity-40 mb-2 tracking-widest">EXTERNAL_IDENTITIES</div>
+				<div id="account-identities" class="grid gap-2"></div>
+			</div>
+			<div class="hud-border p-4 bg-black/40 flex justify-between items-center">
+				<div class="text-[9px] opacity-40 tracking-widest">PERSONAL_DATA_DUMP · PROFILE · MATCHES · CHAT</div>
+				` + button("accountExport()", "EXPORT_JSON") + `
+			</div>
+			<div class="p-4 border border-red-500/30 bg-black/40">
+				<div class="text-[9px] text-red-500/70 mb-2 tracking-widest">TERMINATE_IDENTITY</div>
+				<div class="flex gap-2">` + input("account-delete-password", "password", "CURRENT") + `
+					<button onclick="accountDelete()" class="px-4 border border-red-500/50 text-red-500/70 hover:bg-red-500/10 text-[10px] tracking-widest">DELETE</button>
+				</div>
+			</div>
+		</div>`
+}
+
+func accountInput(id, typ, placeholder string) string {
+	return `<input id="` + id + `" type="` + typ + `" placeholder="` + placeholder + `"
+			class="flex-1 bg-transparent border border-[#00f3ff]/30 p-2 text-[#00f3ff] focus:outline-none focus:border-[#00f3ff] placeholder:opacity-30 normal-case">`
+}
+
+func accountButton(onclick, label string) string {
+	return `<button onclick="` + onclick + `" class="px-4 border border-[#00f3ff]/50 hover:bg-[#00f3ff]/20 text-[10px] tracking-widest">` + label + `</button>`
+}
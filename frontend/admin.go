@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+)
+
+type AdminClient struct {
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	Remote   bool    `json:"remote"`
+	Ready    bool    `json:"ready"`
+	Finished bool    `json:"finished"`
+	Progress float64 `json:"progress"`
+	WPM      int     `json:"wpm"`
+	Latency  int     `json:"latency_ms"`
+	Queue    struct {
+		Len     int    `json:"len"`
+		Dropped uint64 `json:"dropped"`
+	} `json:"queue"`
+}
+
+type AdminRoom struct {
+	ID          string        `json:"id"`
+	Owner       string        `json:"owner"`
+	Mode        string        `json:"mode"`
+	State       string        `json:"state"`
+	Closing     bool          `json:"closing"`
+	Clients     []AdminClient `json:"clients"`
+	ChatHistory []struct {
+		SenderName string `json:"sender_name"`
+		Text       string `json:"text"`
+	} `json:"chat_history"`
+}
+
+type AdminReport struct {
+	ID         int64  `json:"id"`
+	Reporter   string `json:"reporter"`
+	RoomID     string `json:"room_id"`
+	MessageID  string `json:"message_id"`
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Text       string `json:"text"`
+	Reason     string `json:"reason"`
+	Context    []struct {
+		ID         string `json:"id"`
+		SenderName string `json:"sender_name"`
+		Text       string `json:"text"`
+	} `json:"context"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AdminUser struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Rating    int    `json:"rating"`
+	Role      string `json:"role"`
+	Banned    bool   `json:"banned"`
+	TwoFactor bool   `json:"two_factor"`
+}
+
+// apiCall выполняет запрос к API с токеном игрока и разбирает ответ в out.
+func (a *App) apiCall(method, path string, body, out any) error {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, path, &buf)
+	a.authorize(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%d: %s", resp.StatusCode, e.Error)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// adminCall выполняет запрос к /api/v1/admin и разбирает ответ в out.
+func (a *App) adminCall(method, path string, body, out any) error {
+	return a.apiCall(method, "/api/v1/admin"+path, body, out)
+}
+
+// adminAction выполняет команду и перерисовывает консоль; ошибка показывается в статусной строке.
+func (a *App) adminAction(method, path string, body any) {
+	go func() {
+		if err := a.adminCall(method, path, body, nil); err != nil {
+			a.adminStatus("ERROR " + err.Error())
+			return
+		}
+		a.adminStatus("OK " + method + " " + path)
+		a.fetchAdmin()
+	}()
+}
+
+func (a *App) adminStatus(text string) {
+	if el := a.doc.Call("getElementById", "admin-status"); !el.IsNull() {
+		el.Set("innerText", text)
+	}
+}
+
+func prompt(text string) (string, bool) {
+	v := js.Global().Call("prompt", text)
+	if v.IsNull() || v.IsUndefined() {
+		return "", false
+	}
+	return strings.TrimSpace(v.String()), true
+}
+
+func confirm(text string) bool {
+	return js.Global().Call("confirm", text).Bool()
+}
+
+func (a *App) bindAdmin() {
+	bind := func(name string, fn func(args []js.Value)) {
+		js.Global().Set(name, js.FuncOf(func(this js.Value, args []js.Value) any {
+			fn(args)
+			return nil
+		}))
+	}
+	bind("adminRefresh", func([]js.Value) { go a.fetchAdmin() })
+	bind("adminInspect", func(args []js.Value) { go a.inspectRoom(args[0].String()) })
+	bind("adminFinish", func(args []js.Value) {
+		if confirm("Завершить заезд в комнате " + args[0].String() + "?") {
+			a.adminAction("POST", "/rooms/"+args[0].String()+"/finish", nil)
+		}
+	})
+	bind("adminClose", func(args []js.Value) {
+		if msg, ok := prompt("Сообщение игрокам перед закрытием комнаты:"); ok {
+			a.adminAction("POST", "/rooms/"+args[0].String()+"/close", map[string]string{"message": msg})
+		}
+	})
+	bind("adminKick", func(args []js.Value) {
+		a.adminAction("POST", "/users/"+args[0].String()+"/kick", nil)
+	})
+	bind("adminBan", func(args []js.Value) {
+		if reason, ok := prompt("Причина блокировки:"); ok {
+			a.adminAction("POST", "/users/"+args[0].String()+"/ban", map[string]string{"reason": reason})
+		}
+	})
+	bind("adminUnban", func(args []js.Value) {
+		a.adminAction("POST", "/users/"+args[0].String()+"/unban", nil)
+	})
+	bind("adminRating", func(args []js.Value) {
+		v, ok := prompt("Изменение рейтинга (например, -50 или 25):")
+		if !ok {
+			return
+		}
+		delta, err := strconv.Atoi(v)
+		if err != nil || delta == 0 {
+			a.adminStatus("ERROR некорректное число")
+			return
+		}
+		a.adminAction("POST", "/users/"+args[0].String()+"/rating", map[string]int{"delta": delta})
+	})
+	bind("adminRole", func(args []js.Value) {
+		if role, ok := prompt("Новая роль: player, moderator или admin"); ok {
+			a.adminAction("POST", "/users/"+args[0].String()+"/role", map[string]string{"role": role})
+		}
+	})
+	bind("adminResetTwoFactor", func(args []js.Value) {
+		if confirm("Сбросить двухфакторную аутентификацию игрока? Войти можно будет по одному паролю.") {
+			a.adminAction("POST", "/users/"+args[0].String()+"/2fa/reset", nil)
+		}
+	})
+	bind("adminMute", func(args []js.Value) {
+		v, ok := prompt("Заглушить в чате комнаты на сколько минут (0 — снять):")
+		if !ok {
+			return
+		}
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 0 {
+			a.adminStatus("ERROR некорректное число")
+			return
+		}
+		a.adminAction("POST", "/rooms/"+args[0].String()+"/mute", map[string]any{"user_id": args[1].String(), "seconds": minutes * 60})
+	})
+	bind("adminResolve", func(args []js.Value) {
+		if resolution, ok := prompt("Комментарий к решению:"); ok {
+			a.adminAction("POST", "/reports/"+args[0].String()+"/resolve", map[string]string{"status": args[1].String(), "resolution": resolution})
+		}
+	})
+	bind("adminBroadcast", func([]js.Value) {
+		el := a.doc.Call("getElementById", "admin-broadcast")
+		text := strings.TrimSpace(el.Get("value").String())
+		if text == "" {
+			return
+		}
+		el.Set("value", "")
+		a.adminAction("POST", "/broadcast", map[string]string{"text": text})
+	})
+	bind("adminFindUser", func([]js.Value) {
+		name := strings.TrimSpace(a.doc.Call("getElementById", "admin-username").Get("value").String())
+		if name != "" {
+			go a.findUser(name)
+		}
+	})
+}
+
+// fetchAdmin рисует консоль: комнаты узла, очереди подбора, поиск игрока и журнал действий.
+func (a *App) fetchAdmin() {
+	var res struct {
+		Node   string                   `json:"node"`
+		Rooms  []AdminRoom              `json:"rooms"`
+		Queues map[string][]AdminClient `json:"queues"`
+	}
+	isAdmin := a.User.admin()
+	if err := a.adminCall("GET", "/rooms", nil, &res); err != nil {
+		if el := a.doc.Call("getElementById", "menu-content"); !el.IsNull() {
+			el.Set("innerHTML", `<div class="opacity-40 text-center mt-20 tracking-[0.5em] text-xs text-red-500">ACCESS_DENIED // `+html.EscapeString(err.Error())+`</div>`)
+		}
+		return
+	}
+	var actions struct {
+		Data []struct {
+			Admin     string    `json:"admin"`
+			Action    string    `json:"action"`
+			Target    string    `json:"target"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if isAdmin {
+		a.adminCall("GET", "/actions", nil, &actions)
+	}
+	var reports struct {
+		Data []AdminReport `json:"data"`
+	}
+	a.adminCall("GET", "/reports?status=open", nil, &reports)
+
+	var rooms string
+	for _, r := range res.Rooms {
+		var clients string
+		for _, c := range r.Clients {
+			clients += a.adminClientRow(r.ID, c)
+		}
+		if clients == "" {
+			clients = `<div class="opacity-20 text-[10px]">EMPTY</div>`
+		}
+		closing := ""
+		if r.Closing {
+			closing = `<span class="text-yellow-400 ml-2">CLOSING</span>`
+		}
+		finish := ""
+		if isAdmin {
+			finish = fmt.Sprintf(`<button onclick="adminFinish('%s')" class="border border-yellow-500/40 text-yellow-400 px-2 py-1 hover:bg-yellow-500/10">FINISH</button>`, r.ID)
+		}
+		rooms += fmt.Sprintf(`
+			<div class="hud-border p-4 mb-4 bg-black/40 border-[#00f3ff]/20">
+				<div class="flex justify-between items-center mb-3">
+					<div class="text-sm font-bold">%s <span class="opacity-40 text-[10px] ml-2">%s · %s%s</span></div>
+					<div class="flex gap-2 text-[9px]">
+						<button onclick="adminInspect('%s')" class="border border-[#00f3ff]/30 px-2 py-1 hover:bg-[#00f3ff]/10">INSPECT</button>
+						%s
+						<button onclick="adminClose('%s')" class="border border-red-500/40 text-red-500 px-2 py-1 hover:bg-red-500/10">CLOSE</button>
+					</div>
+				</div>
+				%s
+				<div id="room-details-%s"></div>
+			</div>`, r.ID, r.Mode, r.State, closing, r.ID, finish, r.ID, clients, r.ID)
+	}
+	if rooms == "" {
+		rooms = `<div class="opacity-20 text-center py-6 text-xs">NO_ACTIVE_ROOMS</div>`
+	}
+
+	var queues string
+	for key, q := range res.Queues {
+		for _, c := range q {
+			queues += `<div class="text-[9px] opacity-40 mt-2">` + html.EscapeString(key) + `</div>` + a.adminClientRow("", c)
+		}
+	}
+	if queues == "" {
+		queues = `<div class="opacity-20 text-[10px]">EMPTY</div>`
+	}
+
+	var reportList string
+	for _, r := range reports.Data {
+		reportList += a.adminReportRow(r)
+	}
+	if reportList == "" {
+		reportList = `<div class="opacity-20 text-[10px]">NO_OPEN_REPORTS</div>`
+	}
+
+	var log string
+	for _, e := range actions.Data {
+		log += fmt.Sprintf(`<div class="text-[10px] opacity-60">%s %s → %s %s</div>`,
+			e.CreatedAt.Local().Format("02.01 15:04"), html.EscapeString(e.Admin), e.Action, html.EscapeString(e.Target))
+	}
+
+	// Объявления и журнал доступны только администраторам.
+	broadcast := ""
+	if isAdmin {
+		broadcast = `
+			<div class="flex gap-2">
+				<input id="admin-broadcast" maxlength="500" placeholder="SYSTEM_BROADCAST..." class="flex-1 bg-black/40 border border-[#00f3ff]/30 p-2 text-xs normal-case">
+				<button onclick="adminBroadcast()" class="border border-[#00f3ff]/30 px-4 text-[10px] hover:bg-[#00f3ff]/10">SEND</button>
+			</div>`
+		log = `
+			<div>
+				<h3 class="text-sm tracking-[0.2em] opacity-70 mb-4 border-b border-[#00f3ff]/10 pb-2">AUDIT_LOG</h3>
+				` + log + `
+			</div>`
+	}
+
+	page := `
+		<div class="max-w-5xl mx-auto py-4 space-y-8">
+			<div id="admin-status" class="text-[10px] opacity-60 h-4"></div>
+			` + broadcast + `
+			<div class="flex gap-2">
+				<input id="admin-username" placeholder="NETRUNER_ID..." class="flex-1 bg-black/40 border border-[#00f3ff]/30 p-2 text-xs normal-case">
+				<button onclick="adminFindUser()" class="border border-[#00f3ff]/30 px-4 text-[10px] hover:bg-[#00f3ff]/10">FIND</button>
+			</div>
+			<div id="admin-user"></div>
+			<div>
+				<h3 class="text-sm tracking-[0.2em] opacity-70 mb-4 border-b border-[#00f3ff]/10 pb-2">CHAT_REPORTS</h3>
+				` + reportList + `
+			</div>
+			<div>
+				<div class="flex justify-between items-end mb-4 border-b border-[#00f3ff]/10 pb-2">
+					<h3 class="text-sm tracking-[0.2em] opacity-70">ROOMS // NODE ` + html.EscapeString(res.Node) + `</h3>
+					<button onclick="adminRefresh()" class="text-[10px] border border-[#00f3ff]/30 px-2 py-1 hover:bg-[#00f3ff]/10">REFRESH</button>
+				</div>
+				` + rooms + `
+			</div>
+			<div>
+				<h3 class="text-sm tracking-[0.2em] opacity-70 mb-4 border-b border-[#00f3ff]/10 pb-2">MATCHMAKING_QUEUES</h3>
+				` + queues + `
+			</div>
+			` + log + `
+		</div>`
+	if el := a.doc.Call("getElementById", "menu-content"); !el.IsNull() {
+		el.Set("innerHTML", page)
+	}
+}
+
+// adminReportRow показывает жалобу: обжалуемое сообщение выделено среди соседних.
+func (a *App) adminReportRow(r AdminReport) string {
+	var context string
+	for _, m := range r.Context {
+		cls := "opacity-40"
+		if m.ID == r.MessageID {
+			cls = "text-red-400"
+		}
+		context += fmt.Sprintf(`<div class="text-[10px] normal-case %s">[%s] %s</div>`, cls, html.EscapeString(m.SenderName), html.EscapeString(m.Text))
+	}
+	return fmt.Sprintf(`
+		<div class="hud-border p-3 mb-3 bg-black/40 border-red-500/20">
+			<div class="flex justify-between items-center mb-2 text-[10px]">
+				<div><span class="text-white">%s</span> <span class="opacity-40">→ %s · ROOM %s · %s</span></div>
+				<div class="flex gap-2 text-[9px]">
+					<button onclick="adminMute('%s', '%s')" class="border border-yellow-500/40 text-yellow-400 px-2 py-1 hover:bg-yellow-500/10">MUTE</button>
+					<button onclick="adminResolve(%d, 'actioned')" class="border border-red-500/40 text-red-500 px-2 py-1 hover:bg-red-500/10">ACTION</button>
+					<button onclick="adminResolve(%d, 'dismissed')" class="border border-[#00f3ff]/30 px-2 py-1 hover:bg-[#00f3ff]/10">DISMISS</button>
+				</div>
+			</div>
+			<div class="text-[10px] opacity-60 mb-2 normal-case">%s</div>
+			%s
+		</div>`, html.EscapeString(r.Reporter), html.EscapeString(r.SenderName), r.RoomID, r.CreatedAt.Local().Format("02.01 15:04"),
+		r.RoomID, r.SenderID, r.ID, r.ID, html.EscapeString(r.Reason), context)
+}
+
+// adminClientRow рисует игрока; roomID пуст для очередей подбора, где заглушать негде.
+func (a *App) adminClientRow(roomID string, c AdminClient) string {
+	mute := ""
+	if roomID != "" {
+		mute = fmt.Sprintf(`<button onclick="adminMute('%s', '%s')" class="text-yellow-400 hover:underline">MUTE</button>`, roomID, c.UserID)
+	}
+	flags := ""
+	if c.Remote {
+		flags += " REMOTE"
+	}
+	if c.Ready {
+		flags += " READY"
+	}
+	if c.Finished {
+		flags += " FINISHED"
+	}
+	return fmt.Sprintf(`
+		<div class="flex justify-between items-center text-[10px] py-1 border-b border-[#00f3ff]/5">
+			<div><span class="text-white">%s</span> <span class="opacity-30">%s%s</span></div>
+			<div class="flex gap-4 items-center">
+				<span class="opacity-50">%.0f CH · %d WPM · %d MS · Q%d/%d</span>
+				%s
+				<button onclick="adminKick('%s')" class="text-yellow-400 hover:underline">KICK</button>
+				<button onclick="adminBan('%s')" class="text-red-500 hover:underline">BAN</button>
+			</div>
+		</div>`, html.EscapeString(c.Username), c.UserID, flags, c.Progress, c.WPM, c.Latency, c.Queue.Len, c.Queue.Dropped, mute, c.UserID, c.UserID)
+}
+
+func (a *App) inspectRoom(id string) {
+	var r AdminRoom
+	if err := a.adminCall("GET", "/rooms/"+id, nil, &r); err != nil {
+		a.adminStatus("ERROR " + err.Error())
+		return
+	}
+	chat := ""
+	for _, m := range r.ChatHistory {
+		chat += fmt.Sprintf(`<div class="text-[10px] normal-case"><span class="text-[#00f3ff]">[%s]</span> %s</div>`,
+			html.EscapeString(m.SenderName), html.EscapeString(m.Text))
+	}
+	if chat == "" {
+		chat = `<div class="opacity-20 text-[10px]">NO_CHAT</div>`
+	}
+	if el := a.doc.Call("getElementById", "room-details-"+id); !el.IsNull() {
+		el.Set("innerHTML", `<div class="mt-3 p-3 bg-black/40 border border-[#00f3ff]/10">
+			<div class="text-[9px] opacity-40 mb-2">OWNER `+r.Owner+`</div>`+chat+`</div>`)
+	}
+}
+
+func (a *App) findUser(name string) {
+	var u AdminUser
+	if err := a.adminCall("GET", "/users?username="+url.QueryEscape(name), nil, &u); err != nil {
+		a.adminStatus("ERROR " + err.Error())
+		return
+	}
+	ban := fmt.Sprintf(`<button onclick="adminBan('%s')" class="text-red-500 hover:underline">BAN</button>`, u.ID)
+	if u.Banned {
+		ban = fmt.Sprintf(`<span class="text-red-500">BANNED</span> <button onclick="adminUnban('%s')" class="text-[#00f3ff] hover:underline">UNBAN</button>`, u.ID)
+	}
+	manage := ""
+	if a.User.admin() {
+		manage = fmt.Sprintf(`<button onclick="adminRating('%s')" class="text-[#00f3ff] hover:underline">ADJUST</button>
+			<button onclick="adminRole('%s')" class="text-[#00f3ff] hover:underline">ROLE</button>`, u.ID, u.ID)
+		if u.TwoFactor {
+			manage += fmt.Sprintf(`<button onclick="adminResetTwoFactor('%s')" class="text-yellow-400 hover:underline">RESET_2FA</button>`, u.ID)
+		}
+	}
+	if el := a.doc.Call("getElementById", "admin-user"); !el.IsNull() {
+		el.Set("innerHTML", fmt.Sprintf(`
+			<div class="hud-border p-4 bg-black/40 border-[#00f3ff]/20 flex justify-between items-center text-xs">
+				<div><span class="text-white font-bold">%s</span> <span class="opacity-30 text-[10px]">%s · %s</span></div>
+				<div class="flex gap-4 items-center">
+					<span>RATING %d</span>
+					%s
+					<button onclick="adminKick('%s')" class="text-yellow-400 hover:underline">KICK</button>
+					%s
+				</div>
+			</div>`, html.EscapeString(u.Username), u.ID, u.Role, u.Rating, manage, u.ID, ban))
+	}
+}
@@ -4,14 +4,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"syscall/js"
+	"time"
 )
 
 func renderAuth(a *App, isReg bool) {
 	title, btn, link := "ТРЕБУЕТСЯ ИДЕНТИФИКАЦИЯ", "СОЕДИНЕНИЕ", "СОЗДАТЬ НОВЫЙ ID"
+	extra := `<button onclick="showForgot()" class="w-full text-[9px] opacity-30 hover:opacity-100 transition-all tracking-[0.2em]">> ЗАБЫЛИ КЛЮЧ ДОСТУПА?</button>`
 	if isReg {
 		title, btn, link = "РЕГИСТРАЦИЯ АГЕНТА", "ПОДТВЕРДИТЬ", "ВЕРНУТЬСЯ К ВХОДУ"
+		extra = `<input id="email" type="email" placeholder="ПОЧТА ДЛЯ ВОССТАНОВЛЕНИЯ (НЕОБЯЗАТЕЛЬНО)" class="w-full p-3 text-xs tracking-widest">`
 	}
 
 	html := `
@@ -31,18 +38,75 @@ func renderAuth(a *App, isReg bool) {
 			<div class="space-y-6">
 				<input id="login" type="text" placeholder="ЛОГИН" class="w-full p-3 text-xs tracking-widest uppercase">
 				<input id="pass" type="password" placeholder="КЛЮЧ_ДОСТУПА" class="w-full p-3 text-xs tracking-widest uppercase">
+				` + extra + `
 				
 				<button onclick="pressSubmit(` + fmt.Sprint(isReg) + `)" class="w-full bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">
 					` + btn + `
 				</button>
 			</div>
 			
+			<div id="sso-list" class="mt-6 space-y-2"></div>
+
 			<button onclick="switchView(` + fmt.Sprint(!isReg) + `)" class="w-full mt-8 text-[9px] opacity-30 hover:opacity-100 transition-all tracking-[0.2em]">
 				> ` + link + `
 			</button>
 		</div>
 	</div>`
 	a.root.Set("innerHTML", html)
+	go a.fetchProviders()
+}
+
+// fetchProviders добавляет на страницу входа кнопки внешних провайдеров.
+func (a *App) fetchProviders() {
+	res, err := http.Get("/api/v1/auth/oidc")
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+	var b struct {
+		Data []string `json:"data"`
+	}
+	json.NewDecoder(res.Body).Decode(&b)
+	var links strings.Builder
+	for _, name := range b.Data {
+		links.WriteString(`<a href="/api/v1/auth/oidc/` + url.PathEscape(name) + `/login"
+			class="block w-full border border-[#00f3ff]/40 py-3 text-center text-[10px] tracking-[0.2em] hover:bg-[#00f3ff]/10 transition-all">ВХОД ЧЕРЕЗ ` +
+			html.EscapeString(strings.ToUpper(name)) + `</a>`)
+	}
+	if el := a.doc.Call("getElementById", "sso-list"); !el.IsNull() {
+		el.Set("innerHTML", links.String())
+	}
+}
+
+// finishOIDC разбирает результат входа или привязки через провайдера: сервер передает
+// его во фрагменте адреса /auth/callback.
+func (a *App) finishOIDC() {
+	loc := js.Global().Get("location")
+	res, _ := url.ParseQuery(strings.TrimPrefix(loc.Get("hash").String(), "#"))
+	hist := js.Global().Get("history")
+	switch {
+	case res.Get("session") != "":
+		exp, _ := strconv.ParseInt(res.Get("expires_in"), 10, 64)
+		saveSession(exp)
+		a.User = nil
+		hist.Call("replaceState", nil, "", "/menu")
+	case res.Get("challenge") != "":
+		hist.Call("replaceState", nil, "", "/auth")
+		renderTwoFactor(a, res.Get("challenge"))
+		return
+	case res.Get("linked") != "":
+		a.accountNotice = "OK учетная запись " + res.Get("linked") + " привязана"
+		hist.Call("replaceState", nil, "", "/account")
+	case a.signedIn():
+		a.accountNotice = "ERROR " + res.Get("error")
+		hist.Call("replaceState", nil, "", "/account")
+	default:
+		hist.Call("replaceState", nil, "", "/auth")
+		renderAuth(a, false)
+		showError(a, res.Get("error"))
+		return
+	}
+	a.router()
 }
 
 func handleAuth(a *App, isReg bool) {
@@ -54,29 +118,212 @@ func handleAuth(a *App, isReg bool) {
 		url = "/api/v1/auth/register"
 	}
 
+	body := map[string]string{"username": u, "password": p}
+	if el := a.doc.Call("getElementById", "email"); isReg && !el.IsNull() {
+		body["email"] = strings.TrimSpace(el.Get("value").String())
+	}
+
 	go func() {
-		d, _ := json.Marshal(map[string]string{"username": u, "password": p})
-		res, err := http.Post(url, "application/json", bytes.NewBuffer(d))
+		code, b, err := postSession(url, body)
 		if err != nil {
 			showError(a, "ОШИБКА_СЕТИ")
 			return
 		}
-		defer res.Body.Close()
 
-		var b map[string]string
-		json.NewDecoder(res.Body).Decode(&b)
-
-		if res.StatusCode == 200 {
-			token := b["token"]
-			js.Global().Get("localStorage").Call("setItem", "token", token)
+		if code == 200 && b.Challenge != "" {
+			renderTwoFactor(a, b.Challenge)
+		} else if code == 200 {
+			saveSession(b.ExpiresIn)
 			a.fetchUser() 
 			a.navigate("/menu")
 		} else {
-			showError(a, b["error"])
+			showError(a, b.Error)
 		}
 	}() 
 } 
 
+// renderTwoFactor — второй шаг входа для аккаунта с 2FA: код из приложения или код восстановления.
+func renderTwoFactor(a *App, challenge string) {
+	js.Global().Set("pressTwoFactor", js.FuncOf(func(this js.Value, args []js.Value) any {
+		code := strings.TrimSpace(a.doc.Call("getElementById", "mfa-code").Get("value").String())
+		if code == "" {
+			return nil
+		}
+		go func() {
+			status, b, err := postSession("/api/v1/auth/2fa", map[string]string{"challenge": challenge, "code": code})
+			if err != nil {
+				showError(a, "ОШИБКА_СЕТИ")
+				return
+			}
+			if status == 200 {
+				saveSession(b.ExpiresIn)
+				a.fetchUser()
+				a.navigate("/menu")
+			} else {
+				showError(a, b.Error)
+			}
+		}()
+		return nil
+	}))
+
+	a.root.Set("innerHTML", `
+	<div class="fixed inset-0 flex flex-col items-center justify-center p-4">
+		<div class="hud-border bg-black/40 p-8 w-full max-w-[380px] backdrop-blur-md relative">
+			<h2 class="text-center mb-4 tracking-[0.2em] font-bold opacity-80 text-sm">ВТОРОЙ ФАКТОР</h2>
+			<div class="text-center text-[10px] opacity-50 mb-8">Код из приложения-аутентификатора или код восстановления</div>
+			<div id="err-log" class="hidden mb-6 p-2 border border-red-500/50 text-red-400 text-[10px] text-center bg-red-500/10 font-mono"></div>
+			<div class="space-y-6">
+				<input id="mfa-code" type="text" inputmode="numeric" autocomplete="one-time-code" placeholder="000000" class="w-full p-3 text-center text-lg tracking-[0.5em]">
+				<button onclick="pressTwoFactor()" class="w-full bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">ПОДТВЕРДИТЬ</button>
+			</div>
+			<button onclick="switchView(false)" class="w-full mt-8 text-[9px] opacity-30 hover:opacity-100 transition-all tracking-[0.2em]">> ВЕРНУТЬСЯ К ВХОДУ</button>
+		</div>
+	</div>`)
+}
+
+// renderForgot — запрос ссылки для сброса пароля на почту аккаунта.
+func renderForgot(a *App) {
+	js.Global().Set("pressForgot", js.FuncOf(func(this js.Value, args []js.Value) any {
+		email := strings.TrimSpace(a.doc.Call("getElementById", "forgot-email").Get("value").String())
+		if email == "" {
+			return nil
+		}
+		go func() {
+			d, _ := json.Marshal(map[string]string{"email": email})
+			res, err := http.Post("/api/v1/auth/password/forgot", "application/json", bytes.NewBuffer(d))
+			if err != nil {
+				showError(a, "ОШИБКА_СЕТИ")
+				return
+			}
+			defer res.Body.Close()
+			var b map[string]string
+			json.NewDecoder(res.Body).Decode(&b)
+			if res.StatusCode != 202 {
+				showError(a, b["error"])
+				return
+			}
+			// Сервер не сообщает, есть ли такая почта, поэтому и клиент не обещает письма.
+			a.doc.Call("getElementById", "err-log").Get("classList").Call("add", "hidden")
+			a.doc.Call("getElementById", "forgot-status").Set("innerText", "Если почта привязана к аккаунту, ссылка для сброса придет в течение нескольких минут. Она действует час.")
+		}()
+		return nil
+	}))
+
+	a.root.Set("innerHTML", `
+	<div class="fixed inset-0 flex flex-col items-center justify-center p-4">
+		<div class="hud-border bg-black/40 p-8 w-full max-w-[380px] backdrop-blur-md relative">
+			<h2 class="text-center mb-4 tracking-[0.2em] font-bold opacity-80 text-sm">ВОССТАНОВЛЕНИЕ ДОСТУПА</h2>
+			<div class="text-center text-[10px] opacity-50 mb-8">Ссылка для нового пароля придет на почту аккаунта</div>
+			<div id="err-log" class="hidden mb-6 p-2 border border-red-500/50 text-red-400 text-[10px] text-center bg-red-500/10 font-mono"></div>
+			<div id="forgot-status" class="mb-6 text-[10px] text-center opacity-70"></div>
+			<div class="space-y-6">
+				<input id="forgot-email" type="email" placeholder="ПОЧТА" class="w-full p-3 text-xs tracking-widest">
+				<button onclick="pressForgot()" class="w-full bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">ОТПРАВИТЬ ССЫЛКУ</button>
+			</div>
+			<button onclick="switchView(false)" class="w-full mt-8 text-[9px] opacity-30 hover:opacity-100 transition-all tracking-[0.2em]">> ВЕРНУТЬСЯ К ВХОДУ</button>
+		</div>
+	</div>`)
+}
+
+// renderReset — новый пароль по ссылке из письма. Токен приходит во фрагменте
+// /auth/reset#token=...; адрес сразу очищается, чтобы токен не остался в истории.
+func renderReset(a *App) {
+	loc := js.Global().Get("location")
+	q, _ := url.ParseQuery(strings.TrimPrefix(loc.Get("hash").String(), "#"))
+	token := q.Get("token")
+	js.Global().Get("history").Call("replaceState", nil, "", "/auth/reset")
+
+	js.Global().Set("pressReset", js.FuncOf(func(this js.Value, args []js.Value) any {
+		pass := a.doc.Call("getElementById", "reset-pass").Get("value").String()
+		if len(pass) < 8 {
+			showError(a, "ключ доступа короче 8 символов")
+			return nil
+		}
+		go func() {
+			d, _ := json.Marshal(map[string]string{"token": token, "password": pass})
+			res, err := http.Post("/api/v1/auth/password/reset", "application/json", bytes.NewBuffer(d))
+			if err != nil {
+				showError(a, "ОШИБКА_СЕТИ")
+				return
+			}
+			defer res.Body.Close()
+			if res.StatusCode != 204 {
+				var b map[string]string
+				json.NewDecoder(res.Body).Decode(&b)
+				showError(a, b["error"])
+				return
+			}
+			js.Global().Get("history").Call("replaceState", nil, "", "/auth")
+			a.doc.Call("getElementById", "err-log").Get("classList").Call("add", "hidden")
+			a.doc.Call("getElementById", "reset-form").Set("innerHTML", `
+				<div class="text-center text-xs tracking-widest">КЛЮЧ ИЗМЕНЕН</div>
+				<button onclick="switchView(false)" class="w-full bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">ВОЙТИ</button>`)
+		}()
+		return nil
+	}))
+
+	a.root.Set("innerHTML", `
+	<div class="fixed inset-0 flex flex-col items-center justify-center p-4">
+		<div class="hud-border bg-black/40 p-8 w-full max-w-[380px] backdrop-blur-md relative">
+			<h2 class="text-center mb-4 tracking-[0.2em] font-bold opacity-80 text-sm">НОВЫЙ КЛЮЧ ДОСТУПА</h2>
+			<div class="text-center text-[10px] opacity-50 mb-8">Все открытые сессии будут завершены</div>
+			<div id="err-log" class="hidden mb-6 p-2 border border-red-500/50 text-red-400 text-[10px] text-center bg-red-500/10 font-mono"></div>
+			<div id="reset-form" class="space-y-6">
+				<input id="reset-pass" type="password" placeholder="НОВЫЙ_КЛЮЧ" class="w-full p-3 text-xs tracking-widest uppercase">
+				<button onclick="pressReset()" class="w-full bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">СОХРАНИТЬ</button>
+			</div>
+			<button onclick="switchView(false)" class="w-full mt-8 text-[9px] opacity-30 hover:opacity-100 transition-all tracking-[0.2em]">> ВЕРНУТЬСЯ К ВХОДУ</button>
+		</div>
+	</div>`)
+	if token == "" {
+		showError(a, "в ссылке нет токена, запросите письмо заново")
+	}
+}
+
+// renderConfirmEmail подтверждает почту по ссылке из письма /auth/email#token=...
+// Токен сам подтверждает владельца ящика, поэтому вход не нужен.
+func renderConfirmEmail(a *App) {
+	loc := js.Global().Get("location")
+	q, _ := url.ParseQuery(strings.TrimPrefix(loc.Get("hash").String(), "#"))
+	token := q.Get("token")
+	js.Global().Get("history").Call("replaceState", nil, "", "/auth/email")
+
+	a.root.Set("innerHTML", `
+	<div class="fixed inset-0 flex flex-col items-center justify-center p-4">
+		<div class="hud-border bg-black/40 p-8 w-full max-w-[380px] backdrop-blur-md relative">
+			<h2 class="text-center mb-4 tracking-[0.2em] font-bold opacity-80 text-sm">ПОДТВЕРЖДЕНИЕ ПОЧТЫ</h2>
+			<div id="err-log" class="hidden mb-6 p-2 border border-red-500/50 text-red-400 text-[10px] text-center bg-red-500/10 font-mono"></div>
+			<div id="confirm-status" class="mb-6 text-[10px] text-center opacity-70">ПРОВЕРКА...</div>
+			<a href="/" class="block w-full text-center bg-[#00f3ff] text-black font-bold py-4 hover:bg-white transition-all tracking-[0.2em] text-sm">ПРОДОЛЖИТЬ</a>
+		</div>
+	</div>`)
+	status := a.doc.Call("getElementById", "confirm-status")
+	if token == "" {
+		status.Set("innerText", "")
+		showError(a, "в ссылке нет токена, запросите письмо заново")
+		return
+	}
+	go func() {
+		d, _ := json.Marshal(map[string]string{"token": token})
+		res, err := http.Post("/api/v1/auth/email/confirm", "application/json", bytes.NewBuffer(d))
+		if err != nil {
+			status.Set("innerText", "")
+			showError(a, "ОШИБКА_СЕТИ")
+			return
+		}
+		defer res.Body.Close()
+		var b map[string]string
+		json.NewDecoder(res.Body).Decode(&b)
+		if res.StatusCode != 200 {
+			status.Set("innerText", "")
+			showError(a, b["error"])
+			return
+		}
+		js.Global().Get("history").Call("replaceState", nil, "", "/")
+		status.Set("innerText", "Почта "+b["email"]+" привязана к аккаунту. На нее можно будет выслать ссылку для сброса пароля.")
+	}()
+}
+
 func showError(a *App, msg string) {
 	el := a.doc.Call("getElementById", "err-log")
 	translatedMsg := msg
@@ -86,4 +333,139 @@ func showError(a *App, msg string) {
 	
 	el.Set("innerText", ">> " + translatedMsg)
 	el.Get("classList").Call("remove", "hidden")
-}
\ No newline at end of file
+}
+// Сессия браузера лежит в cookie, недоступных скриптам: сервер выдает их, когда запрос
+// несет заголовок X-Session-Mode: cookie. Странице видны только CSRF-токен, который она
+// повторяет в заголовке X-CSRF-Token, и срок токена доступа. Токен доступа живет 15 минут;
+// обмен идет под authMu: два одновременных обмена одного токена сервер примет за кражу.
+const tokenRefreshMargin = 60
+
+// authReply — ответ на вход, второй шаг входа и обмен токенов.
+type authReply struct {
+	Challenge string `json:"challenge"`
+	CSRFToken string `json:"csrf_token"`
+	ExpiresIn int64  `json:"expires_in"`
+	Error     string `json:"error"`
+}
+
+// postSession отправляет запрос, в ответ на который сервер кладет сессию в cookie.
+func postSession(path string, body any) (int, authReply, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest("POST", path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Session-Mode", "cookie")
+	if csrf := csrfToken(); csrf != "" {
+		req.Header.Set("X-CSRF-Token", csrf)
+	}
+	var b authReply
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, b, err
+	}
+	defer res.Body.Close()
+	json.NewDecoder(res.Body).Decode(&b)
+	return res.StatusCode, b, nil
+}
+
+// saveSession запоминает, когда истечет токен доступа в cookie.
+func saveSession(expiresIn int64) {
+	js.Global().Get("localStorage").Call("setItem", "session_exp", strconv.FormatInt(time.Now().Unix()+expiresIn, 10))
+}
+
+// csrfToken читает CSRF-токен сессии из cookie; пустая строка — сессии нет.
+func csrfToken() string {
+	for _, c := range strings.Split(js.Global().Get("document").Get("cookie").String(), "; ") {
+		if v, ok := strings.CutPrefix(c, "uplink_csrf="); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// clearSession забывает сессию на странице. Cookie с токенами удаляет сервер при выходе.
+func (a *App) clearSession() {
+	ls := js.Global().Get("localStorage")
+	ls.Call("removeItem", "session_exp")
+	ls.Call("removeItem", "token")
+	ls.Call("removeItem", "refresh_token")
+	js.Global().Get("document").Set("cookie", "uplink_csrf=; Max-Age=0; Path=/")
+}
+
+// signedIn сообщает, что у страницы есть сессия, в том числе старая, с токенами в localStorage.
+func (a *App) signedIn() bool {
+	return csrfToken() != "" || storedItem("refresh_token") != ""
+}
+
+func storedItem(key string) string {
+	v := js.Global().Get("localStorage").Call("getItem", key)
+	if v.IsNull() {
+		return ""
+	}
+	return v.String()
+}
+
+// session возвращает CSRF-токен действующей сессии, при необходимости обменивая токены.
+// Выполняет HTTP-запрос, поэтому вызывается только из горутины.
+func (a *App) session() string {
+	a.authMu.Lock()
+	defer a.authMu.Unlock()
+
+	var body any
+	if legacy := storedItem("refresh_token"); legacy != "" {
+		// Вкладка помнит токены из localStorage: меняем их на сессию в cookie и забываем.
+		body = map[string]string{"refresh_token": legacy}
+		ls := js.Global().Get("localStorage")
+		ls.Call("removeItem", "token")
+		ls.Call("removeItem", "refresh_token")
+	} else {
+		csrf := csrfToken()
+		exp, _ := strconv.ParseInt(storedItem("session_exp"), 10, 64)
+		if csrf == "" || exp-time.Now().Unix() > tokenRefreshMargin {
+			return csrf
+		}
+	}
+
+	exp := storedItem("session_exp")
+	code, b, err := postSession("/api/v1/auth/refresh", body)
+	switch {
+	case err != nil:
+	case code == 200:
+		saveSession(b.ExpiresIn)
+	case storedItem("session_exp") != exp:
+		// Другая вкладка успела обменять токен, новые cookie уже у браузера.
+	case code == 400 || code == 401 || code == 403:
+		a.clearSession()
+	}
+	return csrfToken()
+}
+
+// authorize подписывает запрос к API сессией браузера. Вызывается только из горутины.
+func (a *App) authorize(req *http.Request) {
+	csrf := a.session()
+	req.Header.Set("X-Session-Mode", "cookie")
+	req.Header.Set("X-CSRF-Token", csrf)
+}
+
+// wsTicket получает одноразовый билет для открытия сокета, чтобы не класть токен в адрес.
+func (a *App) wsTicket() string {
+	var res struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := a.apiCall("POST", "/api/v1/ws/ticket", nil, &res); err != nil {
+		return ""
+	}
+	return res.Ticket
+}
+
+// endSession завершает сессию на сервере; ответ сервера удаляет cookie с токенами.
+func (a *App) endSession() {
+	a.clearSession()
+	go func() {
+		if res, err := http.Post("/api/v1/auth/logout", "application/json", nil); err == nil {
+			res.Body.Close()
+		}
+	}()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"uplink/protocol"
+)
+
+const (
+	clockSyncSamples = 5
+	clockSyncSpacing = 150 * time.Millisecond
+)
+
+// clock — смещение часов сервера относительно браузера по замеру clock_sync
+// с наименьшим RTT: чем быстрее пришел ответ, тем точнее оценка.
+type clock struct {
+	offset int64
+	rtt    int64
+	synced bool
+}
+
+// syncClock отправляет серию запросов clock_sync после рукопожатия.
+func (a *App) syncClock() {
+	a.clock = clock{}
+	go func() {
+		for range clockSyncSamples {
+			a.send(protocol.TypeClockSync, protocol.ClockSyncRequest{ClientTime: time.Now().UnixMilli()})
+			time.Sleep(clockSyncSpacing)
+		}
+	}()
+}
+
+// handleTiming обрабатывает служебные сообщения о задержке; возвращает true, если сообщение разобрано.
+func (a *App) handleTiming(payload protocol.Payload) bool {
+	switch p := payload.(type) {
+	case *protocol.Welcome:
+		if p.Version >= protocol.VersionLatency {
+			a.syncClock()
+		}
+	case *protocol.Ping:
+		a.send(protocol.TypePong, protocol.Pong{ServerTime: p.ServerTime})
+	case *protocol.ClockSync:
+		offset, rtt := protocol.ClockOffset(p.ClientTime, p.ServerTime, time.Now().UnixMilli())
+		if rtt >= 0 && (!a.clock.synced || rtt < a.clock.rtt) {
+			a.clock = clock{offset: offset, rtt: rtt, synced: true}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// serverNow — текущее время сервера в миллисекундах или 0, пока часы не синхронизированы.
+func (a *App) serverNow() int64 {
+	if !a.clock.synced {
+		return 0
+	}
+	return time.Now().UnixMilli() + a.clock.offset
+}
+
+// localTime переводит момент по часам сервера в часы браузера.
+func (a *App) localTime(t time.Time) time.Time {
+	return t.Add(-time.Duration(a.clock.offset) * time.Millisecond)
+}
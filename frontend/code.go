@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+var codeKeywords = map[string][]string{
+	"go":         {"func", "return", "if", "else", "for", "range", "var", "const", "type", "struct", "interface", "package", "import", "go", "defer", "select", "case", "switch", "continue", "break", "nil", "map", "chan", "error", "int", "string", "bool"},
+	"python":     {"def", "return", "if", "elif", "else", "for", "in", "while", "with", "as", "import", "from", "class", "pass", "None", "True", "False", "and", "or", "not", "lambda", "yield", "print", "range"},
+	"javascript": {"const", "let", "var", "function", "return", "if", "else", "for", "while", "new", "class", "import", "export", "from", "async", "await", "null", "undefined", "true", "false", "require"},
+	"java":       {"public", "private", "protected", "static", "void", "class", "new", "return", "if", "else", "for", "while", "int", "String", "boolean", "true", "false", "null", "final"},
+	"sql":        {"SELECT", "FROM", "WHERE", "AND", "OR", "ORDER", "BY", "GROUP", "JOIN", "ON", "AS", "DESC", "ASC", "INSERT", "INTO", "VALUES", "UPDATE", "SET", "DELETE", "COUNT", "LIMIT", "true", "false"},
+}
+
+var codeComments = map[string]string{
+	"python": "#",
+	"sql":    "--",
+}
+
+var codeColors = map[string]string{
+	"kw":  "#ff4fd8",
+	"str": "#ffd166",
+	"com": "#6b7f8c",
+	"num": "#7dff9a",
+	"":    "#e6f7ff",
+}
+
+// highlightCode размечает каждую графему кода классом токена: ключевое слово, строка, комментарий или число.
+func highlightCode(g []string, lang string) []string {
+	classes := make([]string, len(g))
+	kws := make(map[string]bool)
+	for _, k := range codeKeywords[lang] {
+		kws[k] = true
+	}
+	comment := codeComments[lang]
+	if comment == "" {
+		comment = "//"
+	}
+
+	for i := 0; i < len(g); {
+		switch {
+		case strings.HasPrefix(strings.Join(g[i:min(i+len(comment), len(g))], ""), comment):
+			j := i
+			for j < len(g) && g[j] != "\n" {
+				classes[j] = "com"
+				j++
+			}
+			i = j
+		case g[i] == `"` || g[i] == "'" || g[i] == "`":
+			quote := g[i]
+			j := i + 1
+			for j < len(g) && g[j] != quote && g[j] != "\n" {
+				if g[j] == `\` {
+					j++
+				}
+				j++
+			}
+			for k := i; k <= j && k < len(g); k++ {
+				classes[k] = "str"
+			}
+			i = j + 1
+		case isWordStart(g[i]):
+			j := i
+			for j < len(g) && isWordPart(g[j]) {
+				j++
+			}
+			word := strings.Join(g[i:j], "")
+			class := ""
+			if kws[word] {
+				class = "kw"
+			} else if unicode.IsDigit([]rune(word)[0]) {
+				class = "num"
+			}
+			for k := i; k < j; k++ {
+				classes[k] = class
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return classes
+}
+
+func isWordStart(s string) bool {
+	r := []rune(s)[0]
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isWordPart(s string) bool {
+	return isWordStart(s) || s == "."
+}
+
+// renderCodeHTML отрисовывает код с подсветкой: набранная часть яркая, оставшаяся приглушена.
+func renderCodeHTML(g, classes []string, cursor int) string {
+	var b strings.Builder
+	for i, s := range g {
+		color := codeColors[classes[i]]
+		text := html.EscapeString(s)
+		switch {
+		case i == cursor:
+			if s == "\n" {
+				text = "↵\n"
+			} else if s == "\t" {
+				text = "→\t"
+			}
+			fmt.Fprintf(&b, `<span id="cursor-char" class="bg-[#00f3ff] text-black animate-pulse">%s</span>`, text)
+		case i < cursor:
+			fmt.Fprintf(&b, `<span style="color:%s;text-shadow:0 0 6px %s">%s</span>`, color, color, text)
+		default:
+			fmt.Fprintf(&b, `<span style="color:%s;opacity:.35">%s</span>`, color, text)
+		}
+	}
+	return b.String()
+}
+
+func nonSpaceCount(g []string) int {
+	n := 0
+	for _, s := range g {
+		if strings.TrimSpace(s) != "" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"syscall/js"
+)
+
+type Friend struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating"`
+	Status   string `json:"status"`
+	Presence *struct {
+		Status string `json:"status"`
+		RoomID string `json:"room_id"`
+	} `json:"presence"`
+}
+
+func (a *App) bindFriends() {
+	bind := func(name string, fn func(args []js.Value)) {
+		js.Global().Set(name, js.FuncOf(func(this js.Value, args []js.Value) any {
+			fn(args)
+			return nil
+		}))
+	}
+	action := func(method, path string, body any) {
+		go func() {
+			if err := a.apiCall(method, "/api/v1/friends"+path, body, nil); err != nil {
+				a.friendsStatus("ERROR " + err.Error())
+				return
+			}
+			a.fetchFriends()
+		}()
+	}
+	bind("friendAdd", func([]js.Value) {
+		el := a.doc.Call("getElementById", "friend-username")
+		name := strings.TrimSpace(el.Get("value").String())
+		if name == "" {
+			return
+		}
+		el.Set("value", "")
+		action("POST", "/requests", map[string]string{"username": name})
+	})
+	bind("friendAccept", func(args []js.Value) { action("POST", "/"+args[0].String()+"/accept", nil) })
+	bind("friendRemove", func(args []js.Value) {
+		if confirm("Удалить " + args[1].String() + " из друзей или отклонить заявку?") {
+			action("DELETE", "/"+args[0].String(), nil)
+		}
+	})
+	bind("refreshFriends", func([]js.Value) { go a.fetchFriends() })
+}
+
+func (a *App) friendsStatus(text string) {
+	if el := a.doc.Call("getElementById", "friends-status"); !el.IsNull() {
+		el.Set("innerText", text)
+	}
+}
+
+// fetchFriends рисует вкладку друзей: добавление по имени, заявки и друзей со статусом.
+func (a *App) fetchFriends() {
+	var res struct {
+		Data []Friend `json:"data"`
+	}
+	if err := a.apiCall("GET", "/api/v1/friends", nil, &res); err != nil {
+		a.friendsStatus("ERROR " + err.Error())
+		return
+	}
+
+	var rows strings.Builder
+	for _, f := range res.Data {
+		rows.WriteString(a.friendRow(f))
+	}
+	if len(res.Data) == 0 {
+		rows.WriteString(`<div class="text-center opacity-30 text-xs py-10 font-mono">NO_CONTACTS</div>`)
+	}
+
+	content := a.doc.Call("getElementById", "menu-content")
+	if content.IsNull() {
+		return
+	}
+	content.Set("innerHTML", `
+		<div class="relative z-10">
+			<div class="flex gap-2 mb-2">
+				<input id="friend-username" type="text" placeholder="NETRUNER_NAME"
+					class="flex-1 bg-transparent border border-[#00f3ff]/30 p-2 text-[#00f3ff] focus:outline-none focus:border-[#00f3ff] placeholder:opacity-30">
+				<button onclick="friendAdd()" class="px-4 border border-[#00f3ff]/50 hover:bg-[#00f3ff]/20 text-[10px] tracking-widest">ADD_CONTACT</button>
+				<button onclick="refreshFriends()" class="px-4 border border-[#00f3ff]/30 hover:bg-[#00f3ff]/10 text-[10px] tracking-widest">REFRESH</button>
+			</div>
+			<div id="friends-status" class="text-[10px] opacity-50 mb-4 normal-case h-4"></div>
+			<div class="grid gap-3">`+rows.String()+`</div>
+		</div>`)
+}
+
+func (a *App) friendRow(f Friend) string {
+	name := html.EscapeString(f.Username)
+	state, actions := "", ""
+	remove := `<button onclick="friendRemove('` + f.ID + `', '` + name + `')" class="text-[9px] border border-red-500/30 text-red-500/70 px-2 py-1 hover:bg-red-500/10">REMOVE</button>`
+	switch f.Status {
+	case "incoming":
+		state = `<span class="text-yellow-400">REQUEST</span>`
+		actions = `<button onclick="friendAccept('` + f.ID + `')" class="text-[9px] border border-[#00f3ff]/50 px-2 py-1 hover:bg-[#00f3ff]/20">ACCEPT</button>` + remove
+	case "outgoing":
+		state = `<span class="opacity-40">PENDING</span>`
+		actions = remove
+	default:
+		status := "offline"
+		if f.Presence != nil {
+			status = f.Presence.Status
+		}
+		switch status {
+		case "offline":
+			state = `<span class="opacity-30">OFFLINE</span>`
+		case "online":
+			state = `<span class="text-green-400">ONLINE</span>`
+		default:
+			state = `<span class="text-[#ff00ff]">` + strings.ToUpper(status) + `</span>`
+			if status == "in_lobby" {
+				actions = `<button onclick="joinLobby('` + f.Presence.RoomID + `')" class="text-[9px] border border-[#00f3ff]/50 px-2 py-1 hover:bg-[#00f3ff]/20">JOIN</button>`
+			}
+		}
+		actions += remove
+	}
+	return fmt.Sprintf(`
+		<div class="hud-border p-3 bg-black/40 flex justify-between items-center">
+			<div>
+				<div class="text-sm text-white">%s</div>
+				<div class="text-[9px] opacity-40">RATING %d · %s</div>
+			</div>
+			<div class="flex gap-2">%s</div>
+		</div>`, name, f.Rating, state, actions)
+}
+
+// inviteFriend предлагает выбрать друга в сети и отправляет ему приглашение в текущее лобби.
+func (a *App) inviteFriend(roomID string) {
+	var res struct {
+		Data []Friend `json:"data"`
+	}
+	if err := a.apiCall("GET", "/api/v1/friends", nil, &res); err != nil {
+		a.appendChat("SYSTEM", "не удалось загрузить друзей: "+err.Error())
+		return
+	}
+	var online []string
+	for _, f := range res.Data {
+		if f.Status == "accepted" && f.Presence != nil && f.Presence.Status != "offline" {
+			online = append(online, f.Username)
+		}
+	}
+	if len(online) == 0 {
+		a.appendChat("SYSTEM", "никого из друзей нет в сети")
+		return
+	}
+	name, ok := prompt("Кого пригласить? В сети: " + strings.Join(online, ", "))
+	if !ok || name == "" {
+		return
+	}
+	for _, f := range res.Data {
+		if f.Status == "accepted" && strings.EqualFold(f.Username, name) {
+			if err := a.apiCall("POST", "/api/v1/friends/"+f.ID+"/invite", map[string]string{"room_id": roomID}, nil); err != nil {
+				a.appendChat("SYSTEM", "приглашение не отправлено: "+err.Error())
+				return
+			}
+			a.appendChat("SYSTEM", "приглашение отправлено: "+f.Username)
+			return
+		}
+	}
+	a.appendChat("SYSTEM", name+" нет в списке друзей")
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"math"
+	"strings"
 	"syscall/js"
 	"time"
+	"uplink/protocol"
 )
 
 type GameState struct {
-	FullText     []rune
+	FullText     []string
+	Equivalents  map[string][]string
+	IsCode       bool
+	AutoIndent   bool
+	Classes      []string
 	CurrentIndex int
 	Errors       int
 	StartTime    time.Time
@@ -20,26 +25,41 @@ type GameState struct {
 
 var game *GameState
 
-func (a *App) renderGamePage(payload json.RawMessage) {
-	var startData struct {
-		Text      string    `json:"text"`
-		StartTime time.Time `json:"start_time"`
-	}
-	json.Unmarshal(payload, &startData)
+func (a *App) renderGamePage(startData *protocol.GameStart) {
 
 	game = &GameState{
-		FullText:     []rune(startData.Text),
-		StartTime:    startData.StartTime,
+		FullText:     protocol.Graphemes(startData.Text),
+		Equivalents:  startData.Equivalents,
+		IsCode:       startData.Code,
+		AutoIndent:   startData.AutoIndent,
+		StartTime:    a.localTime(startData.StartTime),
 		CurrentIndex: 0,
 		Accuracy:     100.0,
 	}
 
+	if game.IsCode {
+		game.Classes = highlightCode(game.FullText, startData.CodeLang)
+	}
+
+	textClass := "text-2xl md:text-4xl leading-relaxed tracking-wide font-medium font-mono break-words outline-none text-center"
+	if game.IsCode {
+		textClass = "text-lg md:text-2xl leading-relaxed font-mono whitespace-pre text-left [tab-size:4] overflow-x-auto"
+	}
+
+	source := "UPLINK_ESTABLISHED"
+	if startData.Title != "" {
+		source = startData.Title
+		if startData.Author != "" {
+			source += " // " + startData.Author
+		}
+	}
+
 	html := `
     <div class="fixed inset-0 flex flex-col bg-black text-[#00f3ff] font-mono select-none overflow-hidden">
         <div class="flex justify-between items-end p-6 border-b border-[#00f3ff]/20 bg-black/80 backdrop-blur">
             <div>
                 <div class="text-[10px] opacity-40 tracking-[0.5em] mb-1">LIVE_FEED</div>
-                <div class="text-2xl font-bold glow-text">UPLINK_ESTABLISHED</div>
+                <div class="text-2xl font-bold glow-text">` + source + `</div>
             </div>
             <div class="flex gap-12 text-center">
                 <div>
@@ -59,7 +79,7 @@ func (a *App) renderGamePage(payload json.RawMessage) {
             </div>
 
             <div class="max-w-4xl w-full p-8 relative z-10">
-                <div id="game-text" class="text-2xl md:text-4xl leading-relaxed tracking-wide font-medium font-mono break-words outline-none text-center">
+                <div id="game-text" class="` + textClass + `">
                 </div>
             </div>
         </div>
@@ -82,6 +102,15 @@ func (a *App) renderGamePage(payload json.RawMessage) {
 		event := args[0]
 		key := event.Get("key").String()
 
+		if game.IsCode {
+			switch key {
+			case "Enter":
+				key = "\n"
+			case "Tab":
+				key = "\t"
+			}
+		}
+
 		if len([]rune(key)) != 1 {
 			return nil
 		}
@@ -95,31 +124,26 @@ func (a *App) renderGamePage(payload json.RawMessage) {
 
 	if !a.Socket.IsUndefined() && !a.Socket.IsNull() {
 		a.Socket.Set("onmessage", js.FuncOf(func(this js.Value, args []js.Value) any {
-			jsonData := args[0].Get("data").String()
-			var msg struct {
-				Type    string          `json:"type"`
-				Payload json.RawMessage `json:"payload"`
+			_, payload := a.decodeServer(args[0])
+			if a.handleTiming(payload) {
+				return nil
 			}
-			json.Unmarshal([]byte(jsonData), &msg)
 
-			switch msg.Type {
-			case "state_update":
-				a.updateOpponentsUI(msg.Payload)
-			case "game_end":
+			switch p := payload.(type) {
+			case *protocol.StateUpdate:
+				a.updateOpponentsUI(*p)
+			case *protocol.ServerShutdown:
+				a.showShutdownBanner(p)
+			case *protocol.ChatMessage:
+				if p.SenderID == "" {
+					a.showBanner(p.Text)
+				}
+			case *protocol.GameEnd:
 				game.IsFinished = true
 				js.Global().Get("window").Set("onkeydown", nil)
 
-				var resPayload struct {
-					Results []struct {
-						UserID    string  `json:"user_id"`
-						NewRating int     `json:"new_rating"`
-						NewAvgWpm float64 `json:"new_avg_wpm"`
-					} `json:"results"`
-				}
-				json.Unmarshal(msg.Payload, &resPayload)
-
 				if a.User != nil {
-					for _, r := range resPayload.Results {
+					for _, r := range p.Results {
 						if r.UserID == a.User.ID {
 							a.User.Rating = r.NewRating
 							a.User.AvgWpm = r.NewAvgWpm
@@ -128,7 +152,7 @@ func (a *App) renderGamePage(payload json.RawMessage) {
 					}
 				}
 
-				a.showResultsModal(msg.Payload)
+				a.showResultsModal(p)
 			}
 			return nil
 		}))
@@ -167,14 +191,19 @@ func (a *App) renderGameText() {
 		return
 	}
 
-	passed := string(game.FullText[:game.CurrentIndex])
+	if game.IsCode {
+		el.Set("innerHTML", renderCodeHTML(game.FullText, game.Classes, game.CurrentIndex))
+		return
+	}
+
+	passed := strings.Join(game.FullText[:game.CurrentIndex], "")
 	current := ""
 	if game.CurrentIndex < len(game.FullText) {
-		current = string(game.FullText[game.CurrentIndex])
+		current = game.FullText[game.CurrentIndex]
 	}
 	future := ""
 	if game.CurrentIndex+1 < len(game.FullText) {
-		future = string(game.FullText[game.CurrentIndex+1:])
+		future = strings.Join(game.FullText[game.CurrentIndex+1:], "")
 	}
 
 	html := fmt.Sprintf(`<span class="text-[#00f3ff] shadow-[0_0_10px_#00f3ff] whitespace-pre-wrap">%s</span>`, passed)
@@ -191,22 +220,22 @@ func (a *App) renderGameText() {
 }
 
 func (a *App) handleTyping(key string) {
-	targetChar := string(game.FullText[game.CurrentIndex])
+	targetChar := game.FullText[game.CurrentIndex]
 
-	if key == targetChar {
+	if protocol.Matches(game.Equivalents, targetChar, key) {
 		game.CurrentIndex++
+		if game.IsCode && game.AutoIndent && key == "\n" {
+			for game.CurrentIndex < len(game.FullText) && (game.FullText[game.CurrentIndex] == " " || game.FullText[game.CurrentIndex] == "\t") {
+				game.CurrentIndex++
+			}
+		}
 		a.updateStats()
 
-		msg := map[string]any{
-			"type": "client_input",
-			"payload": map[string]any{
-				"current_index": game.CurrentIndex,
-				"wpm":           game.WPM,
-				"accuracy":      int(game.Accuracy),
-			},
-		}
-		data, _ := json.Marshal(msg)
-		a.Socket.Call("send", string(data))
+		a.send(protocol.TypeClientInput, protocol.ClientInput{
+			CurrentIndex: game.CurrentIndex,
+			Accuracy:     int(game.Accuracy),
+			ClientTime:   a.serverNow(),
+		})
 
 		if game.CurrentIndex >= len(game.FullText) {
 			game.IsFinished = true
@@ -225,8 +254,12 @@ func (a *App) handleTyping(key string) {
 
 func (a *App) updateStats() {
 	elapsed := time.Since(game.StartTime).Minutes()
+	chars := game.CurrentIndex
+	if game.IsCode {
+		chars = nonSpaceCount(game.FullText[:game.CurrentIndex])
+	}
 	if elapsed > 0 {
-		game.WPM = int((float64(game.CurrentIndex) / 5.0) / elapsed)
+		game.WPM = int((float64(chars) / 5.0) / elapsed)
 	}
 	totalPresses := game.CurrentIndex + game.Errors
 	if totalPresses > 0 {
@@ -244,14 +277,20 @@ func (a *App) updateStats() {
 	}
 }
 
-func (a *App) updateOpponentsUI(payload json.RawMessage) {
-	var states []struct {
-		UserID   string  `json:"user_id"`
-		Username string  `json:"username"`
-		Progress float64 `json:"progress"`
-		WPM      int     `json:"wpm"`
-	}
-	json.Unmarshal(payload, &states)
+// showShutdownBanner предупреждает, что заезд будет завершен принудительно.
+func (a *App) showShutdownBanner(notice *protocol.ServerShutdown) {
+	a.showBanner(fmt.Sprintf("%s: осталось %d с", notice.Message, int(time.Until(a.localTime(notice.Deadline)).Seconds())))
+}
+
+// showBanner выводит системное сообщение поверх поля заезда.
+func (a *App) showBanner(text string) {
+	banner := a.doc.Call("createElement", "div")
+	banner.Set("className", "fixed top-0 inset-x-0 py-2 bg-yellow-500/10 border-b border-yellow-500/50 text-yellow-400 text-center text-xs font-mono uppercase tracking-widest z-[150]")
+	banner.Set("innerText", text)
+	a.doc.Get("body").Call("appendChild", banner)
+}
+
+func (a *App) updateOpponentsUI(states protocol.StateUpdate) {
 	container := a.doc.Call("getElementById", "opponents-container")
 	if container.IsNull() {
 		return
@@ -276,26 +315,17 @@ func (a *App) updateOpponentsUI(payload json.RawMessage) {
         <div class="mb-3">
             <div class="flex justify-between text-[10px] font-mono mb-1 text-[#00f3ff]">
                 <span>%s</span>
-                <span class="opacity-50">%d WPM</span>
+                <span class="opacity-50">%d WPM · %d MS</span>
             </div>
             <div class="h-1 w-full bg-[#00f3ff]/10">
                 <div class="h-full bg-[#00f3ff] shadow-[0_0_8px_#00f3ff] transition-all duration-300" style="width: %.1f%%;"></div>
             </div>
-        </div>`, name, s.WPM, percent)
+        </div>`, name, s.WPM, s.Latency, percent)
 	}
 	container.Set("innerHTML", html)
 }
 
-func (a *App) showResultsModal(payload json.RawMessage) {
-	var res struct {
-		Results []struct {
-			UserID   string `json:"user_id"`
-			Username string `json:"username"`
-			WPM      int    `json:"wpm"`
-			Accuracy int    `json:"accuracy"`
-		} `json:"results"`
-	}
-	json.Unmarshal(payload, &res)
+func (a *App) showResultsModal(res *protocol.GameEnd) {
 
 	overlay := a.doc.Call("createElement", "div")
 	overlay.Set("className", "fixed inset-0 flex items-center justify-center bg-black/95 backdrop-blur-md z-[200]")
@@ -319,9 +349,10 @@ func (a *App) showResultsModal(payload json.RawMessage) {
 				</div>
 				<div class="flex gap-8 text-right font-mono">
 					<div><div class="text-[8px] opacity-40">WPM</div><div class="text-xl text-[#00f3ff]">%d</div></div>
-					<div><div class="text-[8px] opacity-40">ACC</div><div class="text-xl text-white">%d%%</div></div>
+					<div><div class="text-[8px] opacity-40">ACC</div><div class="text-xl text-white">%.0f%%</div></div>
+					<div><div class="text-[8px] opacity-40">PING</div><div class="text-xl text-white/60">%d</div></div>
 				</div>
-			</div>`, rankColor, i+1, name, r.WPM, r.Accuracy)
+			</div>`, rankColor, i+1, name, r.WPM, r.Accuracy, r.Latency)
 	}
 
 	overlay.Set("innerHTML", `
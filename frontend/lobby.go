@@ -3,10 +3,14 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"syscall/js"
+	"time"
+	"uplink/protocol"
 )
 
 func (a *App) showErrorModal(message string) {
@@ -45,6 +49,9 @@ func (a *App) renderLobbyPage(roomID string) {
                 <div class="text-2xl font-bold text-white shadow-[#00f3ff] drop-shadow-md">` + roomID + `</div>
             </div>
             <div class="flex gap-6">
+                <button id="invite-btn" class="hud-border px-4 py-2 hover:bg-[#00f3ff]/20 border-[#00f3ff]/50 text-xs transition-all">
+                    INVITE_FRIEND
+                </button>
                 <button id="exit-btn" class="hud-border px-4 py-2 hover:bg-red-500/20 border-red-500/50 text-red-500 text-xs transition-all">
                     ABORT_SESSION
                 </button>
@@ -79,6 +86,28 @@ func (a *App) renderLobbyPage(roomID string) {
                                 <option value="">LOADING...</option>
                             </select>
                         </div>
+                        <div class="flex flex-col gap-1">
+                            <label class="text-[9px] opacity-60">CODE_LANGUAGE</label>
+                            <select id="subcategory-select" class="bg-black border border-[#00f3ff]/30 text-[#00f3ff] p-1 text-xs focus:outline-none focus:border-[#00f3ff]">
+                                <option value="">ANY</option>
+                            </select>
+                        </div>
+                        <div class="flex flex-col gap-1">
+                            <label class="text-[9px] opacity-60">INDENTATION</label>
+                            <select id="indent-select" class="bg-black border border-[#00f3ff]/30 text-[#00f3ff] p-1 text-xs focus:outline-none focus:border-[#00f3ff]">
+                                <option value="manual">MANUAL</option>
+                                <option value="auto">AUTO</option>
+                            </select>
+                        </div>
+                        <div class="flex flex-col gap-1">
+                            <label class="text-[9px] opacity-60">DIFFICULTY</label>
+                            <select id="difficulty-select" class="bg-black border border-[#00f3ff]/30 text-[#00f3ff] p-1 text-xs focus:outline-none focus:border-[#00f3ff]">
+                                <option value="0-0">ANY</option>
+                                <option value="0-35">EASY</option>
+                                <option value="35-65">MEDIUM</option>
+                                <option value="65-100">HARD</option>
+                            </select>
+                        </div>
                     </div>
                 </div>
 
@@ -93,7 +122,10 @@ func (a *App) renderLobbyPage(roomID string) {
             </div>
 
             <div class="flex-1 flex flex-col hud-border bg-black/40 backdrop-blur-sm overflow-hidden">
-                <div class="p-2 border-b border-[#00f3ff]/10 text-[10px] opacity-50">SECURE_CHANNEL_v4.2</div>
+                <div class="p-2 border-b border-[#00f3ff]/10 text-[10px] flex justify-between">
+                    <span class="opacity-50">SECURE_CHANNEL_v4.2 · /help</span>
+                    <button id="chat-earlier" onclick="loadEarlierChat()" class="opacity-50 hover:opacity-100">EARLIER</button>
+                </div>
                 <div id="chat-messages" class="flex-1 p-4 overflow-y-auto space-y-2 text-sm normal-case font-sans"></div>
                 <div class="p-4 border-t border-[#00f3ff]/20 bg-black/20 flex gap-2">
                     <input id="chat-input" type="text" placeholder="TYPE MESSAGE..." 
@@ -115,17 +147,18 @@ func (a *App) renderLobbyPage(roomID string) {
 		maxVal, _ := strconv.Atoi(a.doc.Call("getElementById", "max-players-select").Get("value").String())
 		langVal := a.doc.Call("getElementById", "language-select").Get("value").String()
 		catVal := a.doc.Call("getElementById", "category-select").Get("value").String()
-
-		msg := map[string]any{
-			"type": "update_settings",
-			"payload": map[string]any{
-				"max_players": maxVal,
-				"language":    langVal,
-				"category":    catVal,
-			},
-		}
-		data, _ := json.Marshal(msg)
-		a.Socket.Call("send", string(data))
+		diffMin, diffMax := parseDifficulty(a.doc.Call("getElementById", "difficulty-select").Get("value").String())
+		subVal := a.doc.Call("getElementById", "subcategory-select").Get("value").String()
+		autoIndent := a.doc.Call("getElementById", "indent-select").Get("value").String() == "auto"
+
+		a.send(protocol.TypeUpdateSettings, protocol.SettingsUpdate{
+			MaxPlayers:  maxVal,
+			Language:    langVal,
+			Category:    catVal,
+			Difficulty:  &protocol.DifficultyRange{Min: diffMin, Max: diffMax},
+			Subcategory: &subVal,
+			AutoIndent:  &autoIndent,
+		})
 	}
 
 	sendChat := func() {
@@ -135,18 +168,11 @@ func (a *App) renderLobbyPage(roomID string) {
 			return
 		}
 
-		msg := map[string]any{
-			"type": "chat_message",
-			"payload": map[string]string{
-				"text": val,
-			},
-		}
-		data, _ := json.Marshal(msg)
-		a.Socket.Call("send", string(data))
+		a.send(protocol.TypeChatMessage, protocol.ChatSend{Text: val})
 		el.Set("value", "")
 	}
 
-	for _, id := range []string{"max-players-select", "language-select", "category-select"} {
+	for _, id := range []string{"max-players-select", "language-select", "category-select", "subcategory-select", "indent-select", "difficulty-select"} {
 		a.doc.Call("getElementById", id).Set("onchange", js.FuncOf(func(this js.Value, args []js.Value) any {
 			sendSettings()
 			return nil
@@ -158,10 +184,13 @@ func (a *App) renderLobbyPage(roomID string) {
 		return nil
 	}))
 
+	a.doc.Call("getElementById", "invite-btn").Set("onclick", js.FuncOf(func(this js.Value, args []js.Value) any {
+		go a.inviteFriend(roomID)
+		return nil
+	}))
+
 	a.doc.Call("getElementById", "start-btn").Set("onclick", js.FuncOf(func(this js.Value, args []js.Value) any {
-		msg := map[string]any{"type": "game_start"}
-		data, _ := json.Marshal(msg)
-		a.Socket.Call("send", string(data))
+		a.send(protocol.TypeGameStart, nil)
 		return nil
 	}))
 
@@ -177,6 +206,8 @@ func (a *App) renderLobbyPage(roomID string) {
 		return nil
 	}))
 
+	a.bindChatModeration()
+	a.bindChatHistory(roomID)
 	a.loadCategories()
 	go func() { a.setupLobbyWS(roomID) }()
 }
@@ -190,7 +221,8 @@ func (a *App) loadCategories() {
 		defer resp.Body.Close()
 
 		var res struct {
-			Categories []string `json:"categories"`
+			Categories    []string `json:"categories"`
+			CodeLanguages []string `json:"code_languages"`
 		}
 		json.NewDecoder(resp.Body).Decode(&res)
 
@@ -200,85 +232,231 @@ func (a *App) loadCategories() {
 			html += fmt.Sprintf(`<option value="%s">%s</option>`, cat, strings.ToUpper(cat))
 		}
 		selectEl.Set("innerHTML", html)
+
+		subHTML := `<option value="">ANY</option>`
+		for _, l := range res.CodeLanguages {
+			subHTML += fmt.Sprintf(`<option value="%s">%s</option>`, l, strings.ToUpper(l))
+		}
+		if el := a.doc.Call("getElementById", "subcategory-select"); !el.IsNull() {
+			el.Set("innerHTML", subHTML)
+		}
 	}()
 }
 
 func (a *App) setupLobbyWS(roomID string) js.Value {
-	protocol := "ws://"
+	scheme := "ws://"
 	if js.Global().Get("location").Get("protocol").String() == "https:" {
-		protocol = "wss://"
+		scheme = "wss://"
 	}
 
-	ls := js.Global().Get("localStorage")
-	tokenVal := ls.Call("getItem", "auth_token")
-	if tokenVal.IsNull() {
-		tokenVal = ls.Call("getItem", "token")
-	}
-	token := tokenVal.String()
+	ticket := a.wsTicket()
 
-	url := fmt.Sprintf("%s%s/ws?room_id=%s&token=%s", protocol, js.Global().Get("location").Get("host").String(), roomID, token)
-	ws := js.Global().Get("WebSocket").New(url)
+	url := fmt.Sprintf("%s%s/ws?room_id=%s&ticket=%s", scheme, js.Global().Get("location").Get("host").String(), roomID, ticket)
+	ws := a.openSocket(url)
 
 	a.Socket = ws
 
+	ws.Set("onopen", js.FuncOf(func(this js.Value, args []js.Value) any {
+		a.codec = protocol.CodecFor(ws.Get("protocol").String())
+		a.send(protocol.TypeHello, protocol.Hello{Version: protocol.Version})
+		return nil
+	}))
+
 	ws.Set("onclose", js.FuncOf(func(this js.Value, args []js.Value) any {
 		event := args[0]
 		if event.Get("reason").String() == "LOBBY_FULL" || event.Get("code").Int() == 4008 {
 			a.showErrorModal("В данной сессии достигнут максимальный лимит агентов.")
 		}
+		if event.Get("reason").String() == "SERVER_SHUTDOWN" && (game == nil || !game.IsFinished) {
+			a.showErrorModal("Сервер перезапускается. Попробуйте подключиться через минуту.")
+		}
+		if event.Get("reason").String() == "KICKED" {
+			a.showErrorModal("Администратор отключил вас от сервера.")
+		}
+		if event.Get("reason").String() == "KICKED_BY_OWNER" {
+			a.showErrorModal("Владелец комнаты исключил вас из лобби.")
+		}
+		if event.Get("reason").String() == "ROOM_CLOSED" {
+			a.showErrorModal("Комната закрыта администратором.")
+		}
+		if event.Get("reason").String() == "SLOW_CONSUMER" {
+			a.showErrorModal("Соединение не успевает получать данные. Сервер отключил сессию, проверьте сеть и переподключитесь.")
+		}
 		return nil
 	}))
 
 	ws.Set("onmessage", js.FuncOf(func(this js.Value, args []js.Value) any {
-		jsonData := args[0].Get("data").String()
-		var rawMsg struct {
-			Type    string          `json:"type"`
-			Payload json.RawMessage `json:"payload"`
+		_, payload := a.decodeServer(args[0])
+		if a.handleTiming(payload) {
+			return nil
 		}
-		json.Unmarshal([]byte(jsonData), &rawMsg)
-
-		switch rawMsg.Type {
-		case "player_joined", "lobby_update":
-			a.updateAgentsUI(rawMsg.Payload)
 
-		case "update_settings":
-			var settings struct {
-				MaxPlayers int    `json:"max_players"`
-				Language   string `json:"language"`
-				Category   string `json:"category"`
+		switch p := payload.(type) {
+		case *protocol.Players:
+			a.updateAgentsUI(*p)
+
+		case *protocol.Settings:
+			a.syncSelectValue("max-players-select", strconv.Itoa(p.MaxPlayers))
+			a.syncSelectValue("language-select", p.Language)
+			a.syncSelectValue("category-select", p.Category)
+			a.syncSelectValue("difficulty-select", fmt.Sprintf("%g-%g", p.Difficulty.Min, p.Difficulty.Max))
+			a.syncSelectValue("subcategory-select", p.Subcategory)
+			indent := "manual"
+			if p.AutoIndent {
+				indent = "auto"
 			}
-			if err := json.Unmarshal(rawMsg.Payload, &settings); err == nil {
-				a.syncSelectValue("max-players-select", strconv.Itoa(settings.MaxPlayers))
-				a.syncSelectValue("language-select", settings.Language)
-				a.syncSelectValue("category-select", settings.Category)
+			a.syncSelectValue("indent-select", indent)
+
+		case *protocol.GameStart:
+			a.renderGamePage(p)
+
+		case *protocol.ChatHistory:
+			for _, m := range *p {
+				a.appendPlayerChat(m)
 			}
 
-		case "game_start":
-			a.renderGamePage(rawMsg.Payload)
+		case *protocol.ChatMessage:
+			a.appendPlayerChat(*p)
+
+		case *protocol.Error:
+			a.appendChat("SYSTEM", p.Message)
+
+		case *protocol.ServerShutdown:
+			a.appendChat("SYSTEM", p.Message)
+		}
+		return nil
+	}))
+
+	return ws
+}
+
+func (a *App) appendChat(sender, text string) {
+	a.insertChat("beforeend", a.chatHTML(protocol.ChatMessage{SenderName: sender, Text: text}))
+}
 
-		case "chat_message":
-			var chatData struct {
-				Sender string `json:"sender_name"`
-				Text   string `json:"text"`
+// appendPlayerChat добавляет сообщение игрока; на чужие сообщения можно пожаловаться.
+func (a *App) appendPlayerChat(m protocol.ChatMessage) {
+	a.insertChat("beforeend", a.chatHTML(m))
+}
+
+func (a *App) chatHTML(m protocol.ChatMessage) string {
+	report := ""
+	if m.ID != "" && a.User != nil && m.SenderID != a.User.ID {
+		report = fmt.Sprintf(`<button onclick="reportMessage('%s')" class="ml-2 text-[9px] text-red-500/40 hover:text-red-500">REPORT</button>`, m.ID)
+	}
+	if m.Action {
+		return fmt.Sprintf(`
+        <div data-id="%s" class="mb-2 animate-in fade-in slide-in-from-left-2 duration-300">
+            <span class="text-[#00f3ff]/70 italic text-sm">* %s %s</span>%s
+        </div>
+    `, m.ID, html.EscapeString(m.SenderName), html.EscapeString(m.Text), report)
+	}
+	return fmt.Sprintf(`
+        <div data-id="%s" class="mb-2 animate-in fade-in slide-in-from-left-2 duration-300">
+            <span class="text-[#00f3ff] font-bold text-[10px] mr-2">[%s]:</span>
+            <span class="text-white/90 text-sm">%s</span>%s
+        </div>
+    `, m.ID, html.EscapeString(m.SenderName), html.EscapeString(m.Text), report)
+}
+
+func (a *App) insertChat(where, msgHtml string) {
+	container := a.doc.Call("getElementById", "chat-messages")
+	if container.IsNull() {
+		return
+	}
+	container.Call("insertAdjacentHTML", where, msgHtml)
+	if where == "beforeend" {
+		container.Set("scrollTop", container.Get("scrollHeight"))
+	}
+}
+
+// bindChatHistory подгружает сохраненный чат комнаты старше показанного.
+// Сообщения, которые уже есть на экране, пропускаются по ID.
+func (a *App) bindChatHistory(roomID string) {
+	cursor, done := "", false
+	js.Global().Set("loadEarlierChat", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if done {
+			return nil
+		}
+		go func() {
+			var res struct {
+				Data []struct {
+					MessageID  string    `json:"message_id"`
+					SenderID   string    `json:"sender_id"`
+					SenderName string    `json:"sender_name"`
+					Text       string    `json:"text"`
+					Action     bool      `json:"action"`
+					CreatedAt  time.Time `json:"created_at"`
+				} `json:"data"`
+				NextCursor string `json:"next_cursor"`
 			}
-			if err := json.Unmarshal(rawMsg.Payload, &chatData); err == nil {
-				container := a.doc.Call("getElementById", "chat-messages")
-				if !container.IsNull() {
-					msgHtml := fmt.Sprintf(`
-                        <div class="mb-2 animate-in fade-in slide-in-from-left-2 duration-300">
-                            <span class="text-[#00f3ff] font-bold text-[10px] mr-2">[%s]:</span>
-                            <span class="text-white/90 text-sm">%s</span>
-                        </div>
-                    `, chatData.Sender, chatData.Text)
-					container.Call("insertAdjacentHTML", "beforeend", msgHtml)
-					container.Set("scrollTop", container.Get("scrollHeight"))
+			path := "/api/v1/rooms/" + roomID + "/chat"
+			if cursor != "" {
+				path += "?cursor=" + url.QueryEscape(cursor)
+			}
+			if err := a.apiCall("GET", path, nil, &res); err != nil {
+				a.appendChat("SYSTEM", "История недоступна: "+err.Error())
+				return
+			}
+			for _, m := range res.Data {
+				if !a.doc.Call("querySelector", `[data-id="`+m.MessageID+`"]`).IsNull() {
+					continue
+				}
+				a.insertChat("afterbegin", a.chatHTML(protocol.ChatMessage{
+					ID: m.MessageID, SenderID: m.SenderID, SenderName: m.SenderName, Text: m.Text, Action: m.Action, Time: m.CreatedAt,
+				}))
+			}
+			cursor, done = res.NextCursor, res.NextCursor == ""
+			if done {
+				if el := a.doc.Call("getElementById", "chat-earlier"); !el.IsNull() {
+					el.Get("style").Set("display", "none")
 				}
 			}
+		}()
+		return nil
+	}))
+}
+
+// bindChatModeration регистрирует жалобы на сообщения и заглушение игроков владельцем.
+func (a *App) bindChatModeration() {
+	js.Global().Set("reportMessage", js.FuncOf(func(this js.Value, args []js.Value) any {
+		id := args[0].String()
+		reason, ok := prompt("Причина жалобы:")
+		if !ok {
+			return nil
+		}
+		go func() {
+			err := a.apiCall("POST", "/api/v1/rooms/"+a.CurrentRoomID+"/report", map[string]string{"message_id": id, "reason": reason}, nil)
+			if err != nil {
+				a.appendChat("SYSTEM", "Жалоба не отправлена: "+err.Error())
+				return
+			}
+			a.appendChat("SYSTEM", "Жалоба отправлена модераторам.")
+		}()
+		return nil
+	}))
+	js.Global().Set("muteAgent", js.FuncOf(func(this js.Value, args []js.Value) any {
+		v, ok := prompt("Заглушить в чате на сколько минут (0 — снять):")
+		if !ok {
+			return nil
 		}
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 0 {
+			return nil
+		}
+		a.send(protocol.TypeMute, protocol.Mute{UserID: args[0].String(), Seconds: minutes * 60})
 		return nil
 	}))
+}
 
-	return ws
+func parseDifficulty(val string) (float64, float64) {
+	parts := strings.SplitN(val, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	lo, _ := strconv.ParseFloat(parts[0], 64)
+	hi, _ := strconv.ParseFloat(parts[1], 64)
+	return lo, hi
 }
 
 func (a *App) syncSelectValue(id, val string) {
@@ -288,37 +466,37 @@ func (a *App) syncSelectValue(id, val string) {
 	}
 }
 
-func (a *App) updateAgentsUI(payload json.RawMessage) {
-	var players []struct {
-		UserID   string `json:"user_id"`
-		Username string `json:"username"`
-		IsOwner  bool   `json:"is_owner"`
-	}
-	json.Unmarshal(payload, &players)
+func (a *App) updateAgentsUI(players protocol.Players) {
 
 	playerListEl := a.doc.Call("getElementById", "player-list")
 	isImOwner := false
-	html := ""
 	for _, p := range players {
 		if a.User != nil && p.UserID == a.User.ID && p.IsOwner {
 			isImOwner = true
 		}
+	}
+	if len(players) == 1 {
+		isImOwner = true
+	}
+	list := ""
+	for _, p := range players {
 		badge := ""
 		if p.IsOwner {
 			badge = ` <span class="text-[9px] border border-[#00f3ff] px-1 text-[#00f3ff]">HOST</span>`
 		}
-		html += fmt.Sprintf(`<div class="flex items-center gap-2 py-1"><div class="w-1.5 h-1.5 bg-[#00f3ff]"></div><div class="text-sm">%s%s</div></div>`, p.Username, badge)
-	}
-	if len(players) == 1 {
-		isImOwner = true
+		// Владелец заглушает других игроков прямо из списка.
+		if isImOwner && (a.User == nil || p.UserID != a.User.ID) {
+			badge += fmt.Sprintf(` <button onclick="muteAgent('%s')" class="text-[9px] text-yellow-400/60 hover:text-yellow-400">MUTE</button>`, p.UserID)
+		}
+		list += fmt.Sprintf(`<div class="flex items-center gap-2 py-1"><div class="w-1.5 h-1.5 bg-[#00f3ff]"></div><div class="text-sm">%s%s</div></div>`, html.EscapeString(p.Username), badge)
 	}
-	playerListEl.Set("innerHTML", html)
+	playerListEl.Set("innerHTML", list)
 
 	if el := a.doc.Call("getElementById", "host-settings"); !el.IsNull() {
 		el.Get("style").Set("display", "block")
 	}
 
-	for _, id := range []string{"max-players-select", "language-select", "category-select", "start-btn"} {
+	for _, id := range []string{"max-players-select", "language-select", "category-select", "subcategory-select", "indent-select", "difficulty-select", "start-btn"} {
 		el := a.doc.Call("getElementById", id)
 		if el.IsNull() {
 			continue
@@ -3,9 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"net/http"
 	"strings"
+	"sync"
 	"syscall/js"
+	"uplink/protocol"
 )
 
 type User struct {
@@ -13,6 +16,17 @@ type User struct {
 	Username string  `json:"username"`
 	Rating   int     `json:"rating"`
 	AvgWpm   float64 `json:"avg_wpm"`
+	Role     string  `json:"role"`
+	Email    string  `json:"email"`
+}
+
+// staff — модератор или администратор, им доступна консоль.
+func (u *User) staff() bool {
+	return u != nil && (u.Role == "moderator" || u.Role == "admin")
+}
+
+func (u *User) admin() bool {
+	return u != nil && u.Role == "admin"
 }
 
 type LobbyInfo struct {
@@ -27,6 +41,13 @@ type App struct {
 	User          *User
 	CurrentRoomID string
 	Socket        js.Value
+	presence      js.Value
+	dialing       bool
+	unread        int
+	accountNotice string
+	authMu        sync.Mutex
+	codec         protocol.Codec
+	clock         clock
 }
 
 func main() {
@@ -62,9 +83,14 @@ func main() {
 		renderAuth(app, args[0].Bool())
 		return nil
 	}))
+	js.Global().Set("showForgot", js.FuncOf(func(this js.Value, args []js.Value) any {
+		renderForgot(app)
+		return nil
+	}))
 	js.Global().Set("logout", js.FuncOf(func(this js.Value, args []js.Value) any {
-		js.Global().Get("localStorage").Call("removeItem", "token")
+		app.endSession()
 		app.User = nil
+		app.closePresence()
 		renderAuth(app, false)
 		return nil
 	}))
@@ -84,6 +110,68 @@ func main() {
 	select {}
 }
 
+// wire возвращает кодек, согласованный с сервером при открытии сокета.
+func (a *App) wire() protocol.Codec {
+	if a.codec == nil {
+		return protocol.JSON
+	}
+	return a.codec
+}
+
+// send отправляет типизированное сообщение в текущий сокет.
+func (a *App) send(typ string, payload any) {
+	if a.Socket.IsUndefined() || a.Socket.IsNull() {
+		return
+	}
+	data, err := a.wire().Encode(protocol.Message{Type: typ, Payload: payload})
+	if err != nil {
+		return
+	}
+	if !a.wire().Binary() {
+		a.Socket.Call("send", string(data))
+		return
+	}
+	buf := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(buf, data)
+	a.Socket.Call("send", buf)
+}
+
+// openSocket подключается к серверу, предлагая бинарный формат.
+// Для отладки его можно отключить: localStorage.setItem("uplink_codec", "json").
+func (a *App) openSocket(url string) js.Value {
+	protocols := js.Global().Get("Array").New(protocol.SubprotocolBinary, protocol.SubprotocolJSON)
+	if js.Global().Get("localStorage").Call("getItem", "uplink_codec").String() == "json" {
+		protocols = js.Global().Get("Array").New(protocol.SubprotocolJSON)
+	}
+	ws := js.Global().Get("WebSocket").New(url, protocols)
+	ws.Set("binaryType", "arraybuffer")
+	a.codec = nil
+	return ws
+}
+
+// decodeServer разбирает событие сервера; ошибки протокола выводятся в консоль.
+func (a *App) decodeServer(event js.Value) (string, protocol.Payload) {
+	raw := event.Get("data")
+	var data []byte
+	if raw.Type() == js.TypeString {
+		data = []byte(raw.String())
+	} else {
+		buf := js.Global().Get("Uint8Array").New(raw)
+		data = make([]byte, buf.Get("length").Int())
+		js.CopyBytesToGo(data, buf)
+	}
+
+	typ, payload, err := a.wire().Decode(protocol.Server, data)
+	if err != nil {
+		js.Global().Get("console").Call("warn", "uplink: "+err.Error())
+		return "", nil
+	}
+	if e, ok := payload.(*protocol.Error); ok {
+		js.Global().Get("console").Call("warn", "uplink: "+e.Error())
+	}
+	return typ, payload
+}
+
 func (a *App) navigate(path string) {
 	js.Global().Get("history").Call("pushState", nil, "", path)
 	a.router()
@@ -93,9 +181,20 @@ func (a *App) router() {
 	fullPath := js.Global().Get("location").Get("pathname").String()
 	cleanPath := strings.Split(fullPath, "?")[0]
 
-	token := js.Global().Get("localStorage").Call("getItem", "token")
+	if cleanPath == "/auth/callback" {
+		a.finishOIDC()
+		return
+	}
+	if cleanPath == "/auth/reset" {
+		renderReset(a)
+		return
+	}
+	if cleanPath == "/auth/email" {
+		renderConfirmEmail(a)
+		return
+	}
 
-	if token.IsNull() || token.String() == "" {
+	if !a.signedIn() {
 		renderAuth(a, false)
 		return
 	}
@@ -105,6 +204,7 @@ func (a *App) router() {
 		a.fetchUser()
 		return
 	}
+	a.connectPresence()
 
 	if strings.HasPrefix(cleanPath, "/lobby/") {
 		roomID := strings.TrimPrefix(cleanPath, "/lobby/")
@@ -115,6 +215,16 @@ func (a *App) router() {
 		}
 	}
 
+	if cleanPath == "/account" {
+		renderMenu(a, "account")
+		return
+	}
+
+	if cleanPath == "/admin" && a.User.staff() {
+		renderMenu(a, "admin")
+		return
+	}
+
 	renderMenu(a, "dashboard")
 }
 
@@ -130,15 +240,10 @@ func (a *App) renderLoading() {
 }
 
 func (a *App) fetchUser() {
-	token := js.Global().Get("localStorage").Call("getItem", "token").String()
-	if token == "" {
-		renderAuth(a, false)
-		return
-	}
 	go func() {
 		client := &http.Client{}
 		req, _ := http.NewRequest("GET", "/api/v1/users/me", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		a.authorize(req)
 		resp, err := client.Do(req)
 
 		if err == nil && resp.StatusCode == 200 {
@@ -149,7 +254,7 @@ func (a *App) fetchUser() {
 			if resp != nil {
 				resp.Body.Close()
 			}
-			js.Global().Get("localStorage").Call("removeItem", "token")
+			a.clearSession()
 			a.User = nil
 			renderAuth(a, false)
 		}
@@ -158,10 +263,9 @@ func (a *App) fetchUser() {
 
 func (a *App) fetchLobbies() {
 	go func() {
-		token := js.Global().Get("localStorage").Call("getItem", "token").String()
 		client := &http.Client{}
 		req, _ := http.NewRequest("GET", "/api/v1/lobbies", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		a.authorize(req)
 		resp, err := client.Do(req)
 		if err != nil {
 			return
@@ -194,11 +298,10 @@ func (a *App) fetchLobbies() {
 }
 
 func (a *App) handleCreateLobby() {
-	token := js.Global().Get("localStorage").Call("getItem", "token").String()
 	go func() {
 		client := &http.Client{}
 		req, _ := http.NewRequest("POST", "/api/v1/lobby/create", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		a.authorize(req)
 		resp, err := client.Do(req)
 		if err != nil || resp.StatusCode != 200 {
 			return
@@ -213,11 +316,10 @@ func (a *App) handleCreateLobby() {
 }
 
 func (a *App) fetchLeaderboard() {
-	token := js.Global().Get("localStorage").Call("getItem", "token").String()
 	go func() {
 		client := &http.Client{}
 		req, _ := http.NewRequest("GET", "/api/v1/leaderboard", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		a.authorize(req)
 		resp, err := client.Do(req)
 		if err != nil || resp.StatusCode != 200 {
 			return
@@ -264,11 +366,10 @@ func (a *App) fetchLeaderboard() {
 }
 
 func (a *App) fetchHistory() {
-	token := js.Global().Get("localStorage").Call("getItem", "token").String()
 	go func() {
 		client := &http.Client{}
 		req, _ := http.NewRequest("GET", "/api/v1/users/history", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
+		a.authorize(req)
 		resp, err := client.Do(req)
 		if err != nil || resp.StatusCode != 200 {
 			return
@@ -284,11 +385,20 @@ func (a *App) fetchHistory() {
 			if len(date) > 16 {
 				date = date[:10] + " " + date[11:16]
 			}
+			preview := fmt.Sprintf("%v...", m["text_preview"])
+			if title, _ := m["text_title"].(string); title != "" {
+				preview = title
+				if author, _ := m["text_author"].(string); author != "" {
+					preview += " // " + author
+				}
+			}
+			// Название и автор приходят из внешних корпусов текстов.
+			preview = html.EscapeString(preview)
 			rows += fmt.Sprintf(`
 				<div class="hud-border bg-[#00f3ff]/5 p-8 mb-6 flex justify-between items-center group hover:bg-[#00f3ff]/10 transition-all">
 					<div class="flex-1 pr-10">
 						<div class="text-[10px] text-[#00f3ff]/40 font-mono mb-2 tracking-[0.2em]">%s</div>
-						<div class="text-2xl font-bold tracking-tight text-[#00f3ff] opacity-90 group-hover:opacity-100 uppercase">%v...</div>
+						<div class="text-2xl font-bold tracking-tight text-[#00f3ff] opacity-90 group-hover:opacity-100 uppercase">%s</div>
 					</div>
 					<div class="flex items-center gap-12 border-l border-[#00f3ff]/10 pl-12">
 						<div class="text-center">
@@ -304,7 +414,7 @@ func (a *App) fetchHistory() {
 							<div class="text-4xl font-black font-mono text-[#00f3ff] shadow-[#00f3ff]/20 drop-shadow-md">#%v</div>
 						</div>
 					</div>
-				</div>`, date, m["text_preview"], m["wpm"], m["accuracy"], m["rank"])
+				</div>`, date, preview, m["wpm"], m["accuracy"], m["rank"])
 		}
 		if el := a.doc.Call("getElementById", "menu-content"); !el.IsNull() {
 			if rows == "" {
@@ -8,7 +8,7 @@ import (
 func renderMenu(a *App, tab string) {
     act := "bg-[#00f3ff] text-black shadow-[0_0_15px_#00f3ff]"
     inact := "hover:bg-[#00f3ff]/10 border border-transparent hover:border-[#00f3ff]/30"
-    ds, ls, hs := inact, inact, inact
+    ds, ls, hs, fs, is, acs, as := inact, inact, inact, inact, inact, inact, inact
 
     js.Global().Set("changeTab", js.FuncOf(func(this js.Value, args []js.Value) any {
         if len(args) > 0 {
@@ -19,11 +19,8 @@ func renderMenu(a *App, tab string) {
 
     js.Global().Set("logout", js.FuncOf(func(this js.Value, args []js.Value) any {
         a.User = nil
-
-        storage := js.Global().Get("localStorage")
-        if !storage.IsUndefined() {
-            storage.Call("removeItem", "token")
-        }
+        a.closePresence()
+        a.endSession()
 
         fmt.Println("UPLINK: Connection terminated by netruner.")
 
@@ -94,8 +91,35 @@ func renderMenu(a *App, tab string) {
         hs = act
         cont = `<div class="opacity-40 tracking-[0.5em] text-center mt-20 text-xs animate-pulse font-mono z-10 relative uppercase">DECRYPTING_LOGS...</div>`
         go a.fetchHistory()
+    } else if tab == "friends" {
+        fs = act
+        cont = `<div class="opacity-40 tracking-[0.5em] text-center mt-20 text-xs animate-pulse font-mono z-10 relative uppercase">TRACING_CONTACTS...</div>`
+        a.bindFriends()
+        go a.fetchFriends()
+    } else if tab == "inbox" {
+        is = act
+        cont = `<div class="opacity-40 tracking-[0.5em] text-center mt-20 text-xs animate-pulse font-mono z-10 relative uppercase">RECEIVING_SIGNALS...</div>`
+        a.bindInbox()
+        go a.fetchInbox()
+    } else if tab == "account" && a.User != nil {
+        acs = act
+        a.bindAccount()
+        cont = a.renderAccount()
+    } else if tab == "admin" && a.User.staff() {
+        as = act
+        cont = `<div class="opacity-40 tracking-[0.5em] text-center mt-20 text-xs animate-pulse font-mono z-10 relative uppercase">SCANNING_NODE...</div>`
+        a.bindAdmin()
+        go a.fetchAdmin()
     }
 
+    adminTab := ""
+    if a.User.staff() {
+        adminTab = `<button onclick="changeTab('admin')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + as + `">ADMIN</button>`
+    }
+
+    unread := ""
+    if a.unread > 0 { unread = fmt.Sprintf("[%d]", a.unread) }
+
     username := "UNKNOWN_NETRUNER"
     if a.User != nil { username = a.User.Username }
 
@@ -116,6 +140,10 @@ func renderMenu(a *App, tab string) {
                 <button onclick="changeTab('dashboard')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + ds + `">DASHBOARD</button>
                 <button onclick="changeTab('leaderboard')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + ls + `">LEADERBOARD</button>
                 <button onclick="changeTab('history')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + hs + `">LOGS</button>
+                <button onclick="changeTab('friends')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + fs + `">FRIENDS</button>
+                <button onclick="changeTab('inbox')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + is + `">INBOX <span id="inbox-count">` + unread + `</span></button>
+                <button onclick="changeTab('account')" class="w-full p-4 text-[10px] text-left tracking-[0.3em] font-bold transition-all ` + acs + `">ACCOUNT</button>
+                ` + adminTab + `
             </nav>
 
             <div class="mt-auto pt-8 border-t border-[#00f3ff]/10">
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"syscall/js"
+	"time"
+	"uplink/protocol"
+)
+
+// Notification — запись во входящих, как ее отдает /api/v1/notifications.
+type Notification struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at"`
+}
+
+type notifyFrom struct {
+	ID   string `json:"from_id"`
+	Name string `json:"from_name"`
+}
+
+// connectPresence открывает сокет игрока после входа и держит его до выхода: пока он открыт,
+// друзья видят игрока в сети, а уведомления приходят сюда на любой странице.
+func (a *App) connectPresence() {
+	if a.dialing || !a.presence.IsUndefined() && !a.presence.IsNull() {
+		return
+	}
+	a.dialing = true
+	go a.dialPresence()
+}
+
+func (a *App) dialPresence() {
+	defer func() { a.dialing = false }()
+	scheme := "ws://"
+	if js.Global().Get("location").Get("protocol").String() == "https:" {
+		scheme = "wss://"
+	}
+	ticket := a.wsTicket()
+	if ticket == "" {
+		return
+	}
+	url := fmt.Sprintf("%s%s/ws/presence?ticket=%s", scheme, js.Global().Get("location").Get("host").String(), ticket)
+
+	// Сокет игрока всегда говорит в JSON: кодек игрового сокета к нему не относится.
+	ws := js.Global().Get("WebSocket").New(url, js.Global().Get("Array").New(protocol.SubprotocolJSON))
+	a.presence = ws
+	ws.Set("onopen", js.FuncOf(func(this js.Value, args []js.Value) any {
+		data, _ := protocol.JSON.Encode(protocol.Message{Type: protocol.TypeHello, Payload: protocol.Hello{Version: protocol.Version}})
+		ws.Call("send", string(data))
+		go a.fetchUnread()
+		return nil
+	}))
+	ws.Set("onclose", js.FuncOf(func(this js.Value, args []js.Value) any {
+		if a.presence.Equal(ws) {
+			a.presence = js.Undefined()
+		}
+		return nil
+	}))
+	ws.Set("onmessage", js.FuncOf(func(this js.Value, args []js.Value) any {
+		_, payload, err := protocol.JSON.Decode(protocol.Server, []byte(args[0].Get("data").String()))
+		if err != nil {
+			return nil
+		}
+		if n, ok := payload.(*protocol.Notification); ok {
+			a.setUnread(a.unread + 1)
+			a.showNotification(Notification{ID: n.ID, Kind: n.Kind, Data: n.Data, CreatedAt: n.Time})
+		}
+		return nil
+	}))
+}
+
+func (a *App) closePresence() {
+	if !a.presence.IsUndefined() && !a.presence.IsNull() {
+		a.presence.Call("close")
+	}
+	a.presence = js.Undefined()
+}
+
+func (a *App) fetchUnread() {
+	var res struct {
+		Unread int `json:"unread"`
+	}
+	if a.apiCall("GET", "/api/v1/notifications?unread=true", nil, &res) == nil {
+		a.setUnread(res.Unread)
+	}
+}
+
+// setUnread обновляет счетчик непрочитанных на кнопке INBOX.
+func (a *App) setUnread(n int) {
+	a.unread = n
+	if el := a.doc.Call("getElementById", "inbox-count"); !el.IsNull() {
+		text := ""
+		if n > 0 {
+			text = fmt.Sprintf("[%d]", n)
+		}
+		el.Set("innerText", text)
+	}
+}
+
+// markRead отмечает уведомления прочитанными; без ids — все входящие.
+func (a *App) markRead(ids ...int64) {
+	var res struct {
+		Unread int `json:"unread"`
+	}
+	var err error
+	switch len(ids) {
+	case 0:
+		err = a.apiCall("POST", "/api/v1/notifications/read?all=true", nil, &res)
+	case 1:
+		err = a.apiCall("POST", fmt.Sprintf("/api/v1/notifications/%d/read", ids[0]), nil, &res)
+	default:
+		err = a.apiCall("POST", "/api/v1/notifications/read", map[string][]int64{"ids": ids}, &res)
+	}
+	if err == nil {
+		a.setUnread(res.Unread)
+	}
+}
+
+// notificationText описывает уведомление; для приглашения в лобби возвращает и комнату.
+func notificationText(n Notification) (string, string) {
+	switch n.Kind {
+	case "lobby_invite":
+		var inv protocol.LobbyInvite
+		json.Unmarshal(n.Data, &inv)
+		return html.EscapeString(inv.FromName) + " зовет вас в лобби " + html.EscapeString(inv.RoomID), inv.RoomID
+	case "friend_request":
+		var from notifyFrom
+		json.Unmarshal(n.Data, &from)
+		return html.EscapeString(from.Name) + " хочет добавить вас в друзья", ""
+	case "friend_accepted":
+		var from notifyFrom
+		json.Unmarshal(n.Data, &from)
+		return html.EscapeString(from.Name) + " теперь в списке друзей", ""
+	}
+	return html.EscapeString(n.Kind), ""
+}
+
+// showNotification показывает всплывающее уведомление. Приглашение в лобби открывается
+// в один клик, остальные ведут во входящие; в обоих случаях уведомление становится прочитанным.
+func (a *App) showNotification(n Notification) {
+	text, roomID := notificationText(n)
+	label := "OPEN"
+	if roomID != "" {
+		label = "JOIN"
+	}
+	toast := a.doc.Call("createElement", "div")
+	toast.Set("className", "fixed bottom-6 right-6 hud-border bg-black/90 p-4 z-[90] text-[#00f3ff] font-mono max-w-xs")
+	toast.Set("innerHTML", `
+		<div class="text-[9px] opacity-40 tracking-[0.4em] mb-1">INCOMING_SIGNAL</div>
+		<div class="text-sm text-white normal-case font-sans mb-3">`+text+`</div>
+		<div class="flex gap-2">
+			<button class="notify-open flex-1 bg-[#00f3ff] text-black py-2 text-[10px] font-bold tracking-widest">`+label+`</button>
+			<button class="notify-dismiss flex-1 border border-[#00f3ff]/30 py-2 text-[10px] tracking-widest hover:bg-[#00f3ff]/10">DISMISS</button>
+		</div>`)
+	a.doc.Get("body").Call("appendChild", toast)
+
+	toast.Call("querySelector", ".notify-open").Set("onclick", js.FuncOf(func(this js.Value, args []js.Value) any {
+		toast.Call("remove")
+		go a.markRead(n.ID)
+		if roomID != "" {
+			a.joinInvite(roomID)
+		} else {
+			a.navigate("/menu")
+			renderMenu(a, "inbox")
+		}
+		return nil
+	}))
+	toast.Call("querySelector", ".notify-dismiss").Set("onclick", js.FuncOf(func(this js.Value, args []js.Value) any {
+		toast.Call("remove")
+		return nil
+	}))
+}
+
+// joinInvite переходит в лобби по приглашению, закрывая текущую игровую сессию.
+func (a *App) joinInvite(roomID string) {
+	if roomID == a.CurrentRoomID && strings.HasPrefix(js.Global().Get("location").Get("pathname").String(), "/lobby/") {
+		return
+	}
+	if !a.Socket.IsUndefined() && !a.Socket.IsNull() {
+		a.Socket.Set("onclose", nil)
+		a.Socket.Call("close")
+	}
+	js.Global().Get("window").Set("onkeydown", nil)
+	a.navigate("/lobby/" + roomID)
+}
+
+func (a *App) bindInbox() {
+	js.Global().Set("inboxRead", js.FuncOf(func(this js.Value, args []js.Value) any {
+		id := int64(args[0].Int())
+		go func() {
+			a.markRead(id)
+			a.fetchInbox()
+		}()
+		return nil
+	}))
+	js.Global().Set("inboxReadAll", js.FuncOf(func(this js.Value, args []js.Value) any {
+		go func() {
+			a.markRead()
+			a.fetchInbox()
+		}()
+		return nil
+	}))
+	js.Global().Set("inboxJoin", js.FuncOf(func(this js.Value, args []js.Value) any {
+		id, roomID := int64(args[0].Int()), args[1].String()
+		go a.markRead(id)
+		a.joinInvite(roomID)
+		return nil
+	}))
+}
+
+// fetchInbox рисует вкладку входящих: последние уведомления, непрочитанные выделены.
+func (a *App) fetchInbox() {
+	var res struct {
+		Data   []Notification `json:"data"`
+		Unread int            `json:"unread"`
+	}
+	content := a.doc.Call("getElementById", "menu-content")
+	if err := a.apiCall("GET", "/api/v1/notifications", nil, &res); err != nil {
+		if !content.IsNull() {
+			content.Set("innerHTML", `<div class="text-center text-red-500 text-xs py-10">`+html.EscapeString(err.Error())+`</div>`)
+		}
+		return
+	}
+	a.setUnread(res.Unread)
+
+	var rows strings.Builder
+	for _, n := range res.Data {
+		text, roomID := notificationText(n)
+		style, actions := "opacity-40", ""
+		if n.ReadAt == nil {
+			style = "border-[#00f3ff]/50"
+			actions = fmt.Sprintf(`<button onclick="inboxRead(%d)" class="text-[9px] border border-[#00f3ff]/30 px-2 py-1 hover:bg-[#00f3ff]/10">MARK_READ</button>`, n.ID)
+		}
+		if roomID != "" {
+			actions = fmt.Sprintf(`<button onclick="inboxJoin(%d, '%s')" class="text-[9px] border border-[#00f3ff]/50 px-2 py-1 hover:bg-[#00f3ff]/20">JOIN</button>`, n.ID, html.EscapeString(roomID)) + actions
+		}
+		fmt.Fprintf(&rows, `
+			<div class="hud-border p-3 bg-black/40 flex justify-between items-center %s">
+				<div>
+					<div class="text-sm text-white normal-case font-sans">%s</div>
+					<div class="text-[9px] opacity-40">%s</div>
+				</div>
+				<div class="flex gap-2">%s</div>
+			</div>`, style, text, n.CreatedAt.Local().Format("02.01 15:04"), actions)
+	}
+	if len(res.Data) == 0 {
+		rows.WriteString(`<div class="text-center opacity-30 text-xs py-10 font-mono">NO_SIGNALS</div>`)
+	}
+	if content.IsNull() {
+		return
+	}
+	content.Set("innerHTML", `
+		<div class="relative z-10">
+			<div class="flex justify-end mb-4">
+				<button onclick="inboxReadAll()" class="px-4 py-1 border border-[#00f3ff]/30 hover:bg-[#00f3ff]/10 text-[10px] tracking-widest">MARK_ALL_READ</button>
+			</div>
+			<div class="grid gap-3">`+rows.String()+`</div>
+		</div>`)
+}
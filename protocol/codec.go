@@ -0,0 +1,239 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Подпротоколы WebSocket. Сервер предпочитает бинарный формат, клиент без подпротокола получает JSON.
+const (
+	SubprotocolJSON   = "uplink.json.v1"
+	SubprotocolBinary = "uplink.bin.v1"
+)
+
+// Codec переводит сообщения в кадры WebSocket и обратно.
+type Codec interface {
+	Subprotocol() string
+	Binary() bool
+	Encode(msg Message) ([]byte, error)
+	Decode(r Registry, data []byte) (string, Payload, *Error)
+}
+
+var (
+	JSON   Codec = jsonCodec{}
+	Binary Codec = binaryCodec{}
+)
+
+// Subprotocols — подпротоколы в порядке предпочтения сервера.
+var Subprotocols = []string{SubprotocolBinary, SubprotocolJSON}
+
+// CodecFor возвращает кодек для согласованного подпротокола.
+func CodecFor(subprotocol string) Codec {
+	if subprotocol == SubprotocolBinary {
+		return Binary
+	}
+	return JSON
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return SubprotocolJSON }
+func (jsonCodec) Binary() bool        { return false }
+
+func (jsonCodec) Encode(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Decode(r Registry, data []byte) (string, Payload, *Error) {
+	return r.Decode(data)
+}
+
+// Бинарный кадр: первый байт — вид кадра, дальше тело.
+// Частые сообщения кодируются varint-полями, остальные передаются JSON внутри кадра.
+const (
+	frameJSON        = 0
+	frameStateUpdate = 1
+	frameClientInput = 2
+)
+
+var errShortFrame = errors.New("кадр обрезан")
+
+type binaryCodec struct{}
+
+func (binaryCodec) Subprotocol() string { return SubprotocolBinary }
+func (binaryCodec) Binary() bool        { return true }
+
+func (binaryCodec) Encode(msg Message) ([]byte, error) {
+	switch p := msg.Payload.(type) {
+	case StateUpdate:
+		return appendStateUpdate(make([]byte, 0, stateUpdateSize(p)), p), nil
+	case *StateUpdate:
+		return appendStateUpdate(make([]byte, 0, stateUpdateSize(*p)), *p), nil
+	case ClientInput:
+		return appendClientInput(nil, p), nil
+	case *ClientInput:
+		return appendClientInput(nil, *p), nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{frameJSON}, data...), nil
+}
+
+func (binaryCodec) Decode(r Registry, data []byte) (string, Payload, *Error) {
+	if len(data) == 0 {
+		return "", nil, NewError(ErrBadJSON, "", errShortFrame.Error())
+	}
+
+	var typ string
+	var p Payload
+	var err error
+	switch data[0] {
+	case frameJSON:
+		return r.Decode(data[1:])
+	case frameStateUpdate:
+		typ = TypeStateUpdate
+		p, err = readStateUpdate(data[1:])
+	case frameClientInput:
+		typ = TypeClientInput
+		p, err = readClientInput(data[1:])
+	default:
+		return "", nil, NewError(ErrUnknownType, "", fmt.Sprintf("неизвестный вид кадра %d", data[0]))
+	}
+
+	if _, ok := r[typ]; !ok {
+		return typ, nil, NewError(ErrUnexpected, typ, "сообщение не принимается этой стороной")
+	}
+	if err != nil {
+		return typ, nil, NewError(ErrInvalidPayload, typ, err.Error())
+	}
+	if err := p.Validate(); err != nil {
+		return typ, nil, NewError(ErrInvalidPayload, typ, err.Error())
+	}
+	return typ, p, nil
+}
+
+// Прогресс в state_update — индекс символа, поэтому передается целым числом.
+func appendStateUpdate(b []byte, s StateUpdate) []byte {
+	b = append(b, frameStateUpdate)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	for _, p := range s {
+		b = appendString(b, p.UserID)
+		b = appendString(b, p.Username)
+		b = binary.AppendUvarint(b, uint64(math.Max(0, math.Round(p.Progress))))
+		b = binary.AppendUvarint(b, uint64(max(0, p.WPM)))
+		b = binary.AppendUvarint(b, uint64(max(0, p.Latency)))
+	}
+	return b
+}
+
+func stateUpdateSize(s StateUpdate) int {
+	n := 1 + binary.MaxVarintLen16
+	for _, p := range s {
+		n += len(p.UserID) + len(p.Username) + 5*binary.MaxVarintLen32
+	}
+	return n
+}
+
+func readStateUpdate(b []byte) (*StateUpdate, error) {
+	r := reader{b: b}
+	n := r.uvarint()
+	if n > MaxPlayers*4 {
+		return nil, fmt.Errorf("слишком много игроков: %d", n)
+	}
+	s := make(StateUpdate, 0, n)
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		s = append(s, PlayerState{
+			UserID:   r.string(),
+			Username: r.string(),
+			Progress: float64(r.uvarint()),
+			WPM:      int(r.uvarint()),
+			Latency:  int(r.uvarint()),
+		})
+	}
+	return &s, r.done()
+}
+
+func appendClientInput(b []byte, c ClientInput) []byte {
+	b = append(b, frameClientInput)
+	b = binary.AppendUvarint(b, uint64(max(0, c.CurrentIndex)))
+	b = binary.AppendUvarint(b, uint64(max(0, c.Accuracy)))
+	if c.ClientTime > 0 {
+		b = binary.AppendUvarint(b, uint64(c.ClientTime))
+	}
+	return b
+}
+
+// Отметка времени в client_input необязательна: клиенты первой версии ее не передают.
+func readClientInput(b []byte) (*ClientInput, error) {
+	r := reader{b: b}
+	c := &ClientInput{CurrentIndex: int(r.uvarint()), Accuracy: int(r.uvarint())}
+	if r.err == nil && len(r.b) > 0 {
+		c.ClientTime = int64(r.uvarint())
+	}
+	return c, r.done()
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errShortFrame
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.b)) {
+		r.err = errShortFrame
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func (r *reader) done() error {
+	if r.err == nil && len(r.b) > 0 {
+		return fmt.Errorf("лишние байты в кадре: %d", len(r.b))
+	}
+	return r.err
+}
+
+// Transcode перекодирует кадр между кодеками, например при проксировании игрока на другой узел.
+func Transcode(r Registry, from, to Codec, data []byte) ([]byte, *Error) {
+	if from == to {
+		return data, nil
+	}
+	typ, p, perr := from.Decode(r, data)
+	if perr != nil {
+		return nil, perr
+	}
+	out, err := to.Encode(Message{Type: typ, Payload: p})
+	if err != nil {
+		return nil, NewError(ErrInvalidPayload, typ, err.Error())
+	}
+	return out, nil
+}
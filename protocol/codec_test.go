@@ -0,0 +1,129 @@
+package protocol
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roomState(players int) StateUpdate {
+	s := make(StateUpdate, players)
+	for i := range s {
+		s[i] = PlayerState{
+			UserID:   fmt.Sprintf("9f0c2a4e-1b7d-4c3a-8e21-%012d", i),
+			Username: fmt.Sprintf("netrunner_%d", i),
+			Progress: float64(40 + i*7),
+			WPM:      60 + i*5,
+			Latency:  20 + i*3,
+		}
+	}
+	return s
+}
+
+// Бинарный формат сохраняет частые и редкие сообщения
+func TestBinaryRoundTrip(t *testing.T) {
+	state := roomState(8)
+	data, err := Binary.Encode(Message{Type: TypeStateUpdate, Payload: state})
+	require.NoError(t, err)
+	typ, p, perr := Binary.Decode(Server, data)
+	require.Nil(t, perr)
+	assert.Equal(t, TypeStateUpdate, typ)
+	assert.Equal(t, &state, p)
+
+	data, _ = Binary.Encode(Message{Type: TypeClientInput, Payload: ClientInput{CurrentIndex: 300, Accuracy: 97}})
+	typ, p, perr = Binary.Decode(Client, data)
+	require.Nil(t, perr)
+	assert.Equal(t, TypeClientInput, typ)
+	assert.Equal(t, &ClientInput{CurrentIndex: 300, Accuracy: 97}, p)
+
+	stamped := ClientInput{CurrentIndex: 301, Accuracy: 97, ClientTime: time.Now().UnixMilli()}
+	data, _ = Binary.Encode(Message{Type: TypeClientInput, Payload: stamped})
+	_, p, perr = Binary.Decode(Client, data)
+	require.Nil(t, perr)
+	assert.Equal(t, &stamped, p)
+
+	chat := ChatMessage{SenderName: "neo", Text: "привет", Time: time.Now().UTC().Truncate(time.Second)}
+	data, _ = Binary.Encode(Message{Type: TypeChatMessage, Payload: chat})
+	typ, p, perr = Binary.Decode(Server, data)
+	require.Nil(t, perr)
+	assert.Equal(t, TypeChatMessage, typ)
+	assert.Equal(t, &chat, p)
+}
+
+// Испорченные кадры отклоняются с ошибкой протокола
+func TestBinaryInvalidFrames(t *testing.T) {
+	full, _ := Binary.Encode(Message{Type: TypeStateUpdate, Payload: roomState(2)})
+
+	tests := []struct {
+		name string
+		data []byte
+		reg  Registry
+		code string
+	}{
+		{"empty", nil, Server, ErrBadJSON},
+		{"unknown_frame", []byte{42}, Server, ErrUnknownType},
+		{"truncated", full[:len(full)-3], Server, ErrInvalidPayload},
+		{"trailing_bytes", append(append([]byte{}, full...), 1), Server, ErrInvalidPayload},
+		{"wrong_direction", full, Client, ErrUnexpected},
+		{"bad_accuracy", []byte{frameClientInput, 5, 120}, Client, ErrInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, perr := Binary.Decode(tt.reg, tt.data)
+			require.NotNil(t, perr)
+			assert.Equal(t, tt.code, perr.Code)
+		})
+	}
+}
+
+// Перекодирование между узлом и клиентом
+func TestTranscode(t *testing.T) {
+	jsonData, _ := JSON.Encode(Message{Type: TypeStateUpdate, Payload: roomState(3)})
+	bin, perr := Transcode(Server, JSON, Binary, jsonData)
+	require.Nil(t, perr)
+	assert.Less(t, len(bin), len(jsonData))
+
+	back, perr := Transcode(Server, Binary, JSON, bin)
+	require.Nil(t, perr)
+	assert.JSONEq(t, string(jsonData), string(back))
+}
+
+// Стоимость одной рассылки state_update в комнате на 8 игроков:
+// сообщение кодируется для каждого получателя.
+func benchmarkBroadcast(b *testing.B, codec Codec) {
+	msg := Message{Type: TypeStateUpdate, Payload: roomState(8)}
+	bytes := 0
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bytes = 0
+		for range 8 {
+			data, err := codec.Encode(msg)
+			if err != nil {
+				b.Fatal(err)
+			}
+			bytes += len(data)
+		}
+	}
+	b.ReportMetric(float64(bytes), "bytes/broadcast")
+}
+
+func BenchmarkBroadcastJSON(b *testing.B)   { benchmarkBroadcast(b, JSON) }
+func BenchmarkBroadcastBinary(b *testing.B) { benchmarkBroadcast(b, Binary) }
+
+func benchmarkDecode(b *testing.B, codec Codec) {
+	data, _ := codec.Encode(Message{Type: TypeStateUpdate, Payload: roomState(8)})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, perr := codec.Decode(Server, data); perr != nil {
+			b.Fatal(perr)
+		}
+	}
+}
+
+func BenchmarkDecodeStateJSON(b *testing.B)   { benchmarkDecode(b, JSON) }
+func BenchmarkDecodeStateBinary(b *testing.B) { benchmarkDecode(b, Binary) }
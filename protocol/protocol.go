@@ -0,0 +1,421 @@
+// Package protocol описывает сообщения WebSocket между сервером и WASM клиентом.
+// Пакет не зависит от backend/internal, поэтому его импортируют обе стороны.
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version — текущая версия протокола. Клиент без hello считается клиентом версии MinVersion.
+// Во второй версии появились ping/pong и синхронизация часов.
+const (
+	Version    = 2
+	MinVersion = 1
+
+	VersionLatency = 2
+
+	MaxPlayers    = 8
+	DifficultyMax = 100
+)
+
+// Языки текстов и режимы текста, которые можно выбрать для подбора соперников.
+// Из них складывается ключ очереди, поэтому других значений сервер не принимает.
+var (
+	Languages = []string{"ru", "en"}
+	TextModes = []string{"standard", "generate"}
+)
+
+// Сообщения клиента.
+const (
+	TypeHello       = "hello"
+	TypeJoinQueue   = "join"
+	TypePlayerReady = "player_ready"
+	TypeClientInput = "client_input"
+	TypePong        = "pong"
+	TypeMute        = "mute"
+)
+
+// Сообщения сервера.
+const (
+	TypeWelcome      = "welcome"
+	TypeError        = "error"
+	TypeMatchFound   = "match_found"
+	TypePlayerJoined = "player_joined"
+	TypeChatHistory  = "chat_history"
+	TypeStateUpdate  = "state_update"
+	TypeGameEnd      = "game_end"
+	TypePing         = "ping"
+	TypeShutdown     = "server_shutdown"
+	TypeNotification = "notification"
+	TypeLobbyInvite  = "lobby_invite"
+)
+
+// Сообщения, которые ходят в обе стороны с разной нагрузкой.
+const (
+	TypeUpdateSettings = "update_settings"
+	TypeGameStart      = "game_start"
+	TypeChatMessage    = "chat_message"
+	TypeClockSync      = "clock_sync"
+)
+
+// Коды ошибок в событии error.
+const (
+	ErrBadJSON            = "bad_json"
+	ErrUnknownType        = "unknown_type"
+	ErrInvalidPayload     = "invalid_payload"
+	ErrUnexpected         = "unexpected_message"
+	ErrForbidden          = "forbidden"
+	ErrUnsupportedVersion = "unsupported_version"
+	ErrRateLimited        = "rate_limited"
+	ErrMuted              = "muted"
+)
+
+// MaxMute — наибольший срок заглушения в чате комнаты.
+const MaxMute = 24 * time.Hour
+
+// Message — исходящее сообщение.
+type Message struct {
+	Type    string `json:"type"`
+	Payload any    `json:"payload,omitempty"`
+}
+
+// Envelope — входящее сообщение до разбора нагрузки.
+type Envelope struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Payload — нагрузка зарегистрированного типа сообщения.
+type Payload interface {
+	Validate() error
+}
+
+type Empty struct{}
+
+func (Empty) Validate() error { return nil }
+
+type Hello struct {
+	Version int `json:"version"`
+}
+
+func (h *Hello) Validate() error {
+	if h.Version <= 0 {
+		return fmt.Errorf("version должна быть положительной")
+	}
+	return nil
+}
+
+type Welcome struct {
+	Version       int `json:"version"`
+	ServerVersion int `json:"server_version"`
+}
+
+func (w *Welcome) Validate() error { return nil }
+
+// Error — ответ на сообщение, которое сервер не смог принять.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Type != "" {
+		return e.Code + " (" + e.Type + "): " + e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Validate() error {
+	if e.Code == "" {
+		return fmt.Errorf("code обязателен")
+	}
+	return nil
+}
+
+func NewError(code, typ, msg string) *Error {
+	return &Error{Code: code, Type: typ, Message: msg}
+}
+
+type JoinQueue struct {
+	Mode     string `json:"mode"`
+	Language string `json:"language"`
+	TextMode string `json:"textMode"`
+}
+
+func (j *JoinQueue) Validate() error {
+	if j.Language == "" || j.TextMode == "" {
+		return fmt.Errorf("language и textMode обязательны")
+	}
+	if !slices.Contains(Languages, j.Language) {
+		return fmt.Errorf("неизвестный язык %q", j.Language)
+	}
+	if !slices.Contains(TextModes, j.TextMode) {
+		return fmt.Errorf("неизвестный режим текста %q", j.TextMode)
+	}
+	return nil
+}
+
+type DifficultyRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (d DifficultyRange) IsSet() bool {
+	return d.Max > 0
+}
+
+func (d DifficultyRange) Valid() bool {
+	return d.Min >= 0 && d.Min <= d.Max && d.Max <= DifficultyMax
+}
+
+type Settings struct {
+	Language    string          `json:"language"`
+	TextMode    string          `json:"text_mode"`
+	Category    string          `json:"category"`
+	Subcategory string          `json:"subcategory"`
+	TextID      int             `json:"text_id"`
+	MaxPlayers  int             `json:"max_players"`
+	Difficulty  DifficultyRange `json:"difficulty"`
+	AutoIndent  bool            `json:"auto_indent"`
+}
+
+func (s *Settings) Validate() error { return nil }
+
+// SettingsUpdate — изменение настроек владельцем; пустые поля не меняются.
+type SettingsUpdate struct {
+	MaxPlayers  int              `json:"max_players"`
+	Language    string           `json:"language"`
+	Category    string           `json:"category"`
+	Subcategory *string          `json:"subcategory,omitempty"`
+	Difficulty  *DifficultyRange `json:"difficulty,omitempty"`
+	AutoIndent  *bool            `json:"auto_indent,omitempty"`
+}
+
+func (s *SettingsUpdate) Validate() error {
+	if s.MaxPlayers < 0 || s.MaxPlayers > MaxPlayers {
+		return fmt.Errorf("max_players должно быть от 1 до %d", MaxPlayers)
+	}
+	if s.Difficulty != nil && !s.Difficulty.Valid() {
+		return fmt.Errorf("некорректный диапазон сложности %g..%g", s.Difficulty.Min, s.Difficulty.Max)
+	}
+	return nil
+}
+
+// ClientInput — прогресс игрока. ClientTime — момент ввода в миллисекундах Unix
+// по часам сервера, пересчитанным клиентом через clock_sync; 0, если клиент часы не синхронизировал.
+type ClientInput struct {
+	CurrentIndex int   `json:"current_index"`
+	Accuracy     int   `json:"accuracy"`
+	ClientTime   int64 `json:"client_time,omitempty"`
+}
+
+func (c *ClientInput) Validate() error {
+	if c.CurrentIndex < 0 {
+		return fmt.Errorf("current_index не может быть отрицательным")
+	}
+	if c.Accuracy < 0 || c.Accuracy > 100 {
+		return fmt.Errorf("accuracy должна быть от 0 до 100")
+	}
+	if c.ClientTime < 0 {
+		return fmt.Errorf("client_time не может быть отрицательным")
+	}
+	return nil
+}
+
+// Ping рассылается сервером, клиент возвращает ServerTime в pong; по разнице сервер считает RTT.
+type Ping struct {
+	ServerTime int64 `json:"server_time"`
+}
+
+func (p *Ping) Validate() error { return nil }
+
+type Pong struct {
+	ServerTime int64 `json:"server_time"`
+}
+
+func (p *Pong) Validate() error {
+	if p.ServerTime <= 0 {
+		return fmt.Errorf("server_time обязателен")
+	}
+	return nil
+}
+
+// ClockSyncRequest — запрос синхронизации часов, ClientTime — время отправки по часам клиента.
+type ClockSyncRequest struct {
+	ClientTime int64 `json:"client_time"`
+}
+
+func (c *ClockSyncRequest) Validate() error {
+	if c.ClientTime <= 0 {
+		return fmt.Errorf("client_time обязателен")
+	}
+	return nil
+}
+
+type ClockSync struct {
+	ClientTime int64 `json:"client_time"`
+	ServerTime int64 `json:"server_time"`
+}
+
+func (c *ClockSync) Validate() error { return nil }
+
+// ClockOffset считает смещение часов сервера относительно клиента и RTT по одному обмену clock_sync:
+// t0 — отправка запроса, t1 — время сервера, t3 — получение ответа (все в миллисекундах).
+func ClockOffset(t0, t1, t3 int64) (offset, rtt int64) {
+	return t1 - (t0+t3)/2, t3 - t0
+}
+
+type ChatSend struct {
+	Text string `json:"text"`
+}
+
+func (c *ChatSend) Validate() error {
+	if strings.TrimSpace(c.Text) == "" {
+		return fmt.Errorf("пустое сообщение")
+	}
+	return nil
+}
+
+// ChatMessage — сообщение чата. ID есть только у сообщений игроков, по нему на них жалуются.
+// Action отмечает действие от третьего лица (/me, /roll): «* имя текст».
+type ChatMessage struct {
+	ID         string    `json:"id,omitempty"`
+	SenderID   string    `json:"sender_id,omitempty"`
+	SenderName string    `json:"sender_name"`
+	Text       string    `json:"text"`
+	Action     bool      `json:"action,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+func (c *ChatMessage) Validate() error { return nil }
+
+type ChatHistory []ChatMessage
+
+// Mute — владелец комнаты заглушает игрока на Seconds секунд; ноль снимает заглушение.
+type Mute struct {
+	UserID  string `json:"user_id"`
+	Seconds int    `json:"seconds"`
+}
+
+func (m *Mute) Validate() error {
+	if m.UserID == "" {
+		return fmt.Errorf("user_id обязателен")
+	}
+	if m.Seconds < 0 || time.Duration(m.Seconds)*time.Second > MaxMute {
+		return fmt.Errorf("срок заглушения вне диапазона 0..%d с", int(MaxMute.Seconds()))
+	}
+	return nil
+}
+
+func (c *ChatHistory) Validate() error { return nil }
+
+type MatchFound struct {
+	RoomID string `json:"room_id"`
+}
+
+func (m *MatchFound) Validate() error {
+	if m.RoomID == "" {
+		return fmt.Errorf("room_id обязателен")
+	}
+	return nil
+}
+
+type Player struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Rating   int    `json:"rating,omitempty"`
+	Finished bool   `json:"finished"`
+	IsReady  bool   `json:"is_ready"`
+	IsOwner  bool   `json:"is_owner"`
+	Latency  int    `json:"latency_ms,omitempty"`
+}
+
+type Players []Player
+
+func (p *Players) Validate() error { return nil }
+
+type PlayerState struct {
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	Progress float64 `json:"progress"`
+	WPM      int     `json:"wpm"`
+	Latency  int     `json:"latency_ms"`
+}
+
+type StateUpdate []PlayerState
+
+func (s *StateUpdate) Validate() error { return nil }
+
+type GameStart struct {
+	Text        string              `json:"text"`
+	Difficulty  float64             `json:"difficulty"`
+	TextID      int                 `json:"text_id"`
+	Title       string              `json:"title"`
+	Author      string              `json:"author"`
+	Code        bool                `json:"code"`
+	CodeLang    string              `json:"code_lang"`
+	AutoIndent  bool                `json:"auto_indent"`
+	Equivalents map[string][]string `json:"equivalents"`
+	StartTime   time.Time           `json:"start_time"`
+	Players     Players             `json:"players"`
+}
+
+func (g *GameStart) Validate() error {
+	if g.Text == "" {
+		return fmt.Errorf("пустой текст заезда")
+	}
+	return nil
+}
+
+type Result struct {
+	UserID    string  `json:"user_id"`
+	Username  string  `json:"username"`
+	WPM       int     `json:"wpm"`
+	Accuracy  float64 `json:"accuracy"`
+	Finished  bool    `json:"finished"`
+	NewRating int     `json:"new_rating"`
+	NewAvgWpm float64 `json:"new_avg_wpm"`
+	Latency   int     `json:"latency_ms"`
+}
+
+// ServerShutdown предупреждает об остановке сервера. Идущий заезд доигрывается
+// до Deadline, после чего завершается принудительно с сохранением результатов.
+type ServerShutdown struct {
+	Deadline time.Time `json:"deadline"`
+	Message  string    `json:"message"`
+}
+
+func (s *ServerShutdown) Validate() error { return nil }
+
+// Notification — уведомление из входящих игрока; приходит в сокет меню сразу после сохранения.
+// Data зависит от Kind: для приглашения в лобби это LobbyInvite.
+type Notification struct {
+	ID   int64           `json:"id"`
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+	Time time.Time       `json:"time"`
+}
+
+func (n *Notification) Validate() error { return nil }
+
+// LobbyInvite — друг зовет в свое лобби. Вместе с уведомлением приходит
+// в любой открытый сокет игрока, в том числе игровой.
+type LobbyInvite struct {
+	RoomID   string    `json:"room_id"`
+	FromID   string    `json:"from_id"`
+	FromName string    `json:"from_name"`
+	Time     time.Time `json:"time"`
+}
+
+func (l *LobbyInvite) Validate() error { return nil }
+
+type GameEnd struct {
+	Results []Result `json:"results"`
+}
+
+func (g *GameEnd) Validate() error { return nil }
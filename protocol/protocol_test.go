@@ -0,0 +1,101 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Разбор входящих сообщений клиента
+func TestDecodeClient(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		code string
+	}{
+		{"valid_chat", `{"type":"chat_message","payload":{"text":"hi"}}`, ""},
+		{"empty_payload", `{"type":"player_ready"}`, ""},
+		{"bad_json", `{"type":`, ErrBadJSON},
+		{"unknown_type", `{"type":"lobby_update"}`, ErrUnknownType},
+		{"wrong_field_type", `{"type":"client_input","payload":{"current_index":"x"}}`, ErrInvalidPayload},
+		{"empty_chat", `{"type":"chat_message","payload":{"text":"  "}}`, ErrInvalidPayload},
+		{"bad_difficulty", `{"type":"update_settings","payload":{"difficulty":{"min":70,"max":30}}}`, ErrInvalidPayload},
+		{"too_many_players", `{"type":"update_settings","payload":{"max_players":9}}`, ErrInvalidPayload},
+		{"bad_accuracy", `{"type":"client_input","payload":{"current_index":3,"accuracy":101}}`, ErrInvalidPayload},
+		{"join_queue", `{"type":"join","payload":{"language":"ru","textMode":"standard"}}`, ""},
+		{"unknown_language", `{"type":"join","payload":{"language":"xx","textMode":"standard"}}`, ErrInvalidPayload},
+		{"unknown_text_mode", `{"type":"join","payload":{"language":"en","textMode":"x"}}`, ErrInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Client.Decode([]byte(tt.data))
+			if tt.code == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.Equal(t, tt.code, err.Code)
+		})
+	}
+}
+
+// Сообщение сервера проходит через JSON без потерь
+func TestServerRoundTrip(t *testing.T) {
+	start := GameStart{
+		Text:      "hello world",
+		TextID:    7,
+		Code:      true,
+		CodeLang:  "go",
+		StartTime: time.Now().UTC().Truncate(time.Millisecond),
+		Players:   Players{{UserID: "u1", Username: "neo"}},
+	}
+	data, err := json.Marshal(Message{Type: TypeGameStart, Payload: start})
+	require.NoError(t, err)
+
+	typ, payload, perr := Server.Decode(data)
+	require.Nil(t, perr)
+	assert.Equal(t, TypeGameStart, typ)
+	assert.Equal(t, &start, payload)
+
+	data, _ = json.Marshal(Message{Type: TypeStateUpdate, Payload: StateUpdate{{UserID: "u1", Progress: 4, WPM: 60}}})
+	_, payload, perr = Server.Decode(data)
+	require.Nil(t, perr)
+	assert.Equal(t, 60, (*payload.(*StateUpdate))[0].WPM)
+}
+
+// Согласование версии
+func TestNegotiate(t *testing.T) {
+	v, err := Negotiate(Version + 5)
+	assert.Nil(t, err)
+	assert.Equal(t, Version, v, "сервер не может говорить на версии новее своей")
+
+	_, err = Negotiate(MinVersion - 1)
+	require.NotNil(t, err)
+	assert.Equal(t, ErrUnsupportedVersion, err.Code)
+}
+
+// Смещение часов по обмену clock_sync
+func TestClockOffset(t *testing.T) {
+	// Часы сервера спешат на 5 секунд, путь в каждую сторону — 40 мс.
+	offset, rtt := ClockOffset(1000, 6040, 1080)
+	assert.Equal(t, int64(5000), offset)
+	assert.Equal(t, int64(80), rtt)
+
+	offset, _ = ClockOffset(1000, 1040, 1080)
+	assert.Zero(t, offset, "синхронные часы не должны давать смещения")
+}
+
+// Разбиение текста на символы и замены при вводе
+func TestGraphemes(t *testing.T) {
+	assert.Equal(t, []string{"a", "é", "b"}, Graphemes("aéb"), "комбинирующий знак присоединяется к букве")
+	assert.Equal(t, []string{"\U0001F469\u200d\U0001F4BB", "!"}, Graphemes("\U0001F469\u200d\U0001F4BB!"), "последовательность с ZWJ — один символ")
+
+	eq := map[string][]string{"—": {"-"}}
+	assert.True(t, Matches(eq, "—", "-"))
+	assert.True(t, Matches(eq, "a", "a"))
+	assert.False(t, Matches(eq, "-", "—"), "замена действует в одну сторону")
+}
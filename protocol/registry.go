@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Registry сопоставляет тип сообщения с конструктором его нагрузки.
+type Registry map[string]func() Payload
+
+// Client — сообщения, которые сервер принимает от клиента.
+var Client = Registry{
+	TypeHello:          func() Payload { return &Hello{} },
+	TypeJoinQueue:      func() Payload { return &JoinQueue{} },
+	TypeUpdateSettings: func() Payload { return &SettingsUpdate{} },
+	TypeClientInput:    func() Payload { return &ClientInput{} },
+	TypePlayerReady:    func() Payload { return Empty{} },
+	TypeGameStart:      func() Payload { return Empty{} },
+	TypeChatMessage:    func() Payload { return &ChatSend{} },
+	TypePong:           func() Payload { return &Pong{} },
+	TypeClockSync:      func() Payload { return &ClockSyncRequest{} },
+	TypeMute:           func() Payload { return &Mute{} },
+}
+
+// Server — сообщения, которые клиент принимает от сервера.
+var Server = Registry{
+	TypeWelcome:        func() Payload { return &Welcome{} },
+	TypeError:          func() Payload { return &Error{} },
+	TypeMatchFound:     func() Payload { return &MatchFound{} },
+	TypePlayerJoined:   func() Payload { return &Players{} },
+	TypeChatHistory:    func() Payload { return &ChatHistory{} },
+	TypeUpdateSettings: func() Payload { return &Settings{} },
+	TypeStateUpdate:    func() Payload { return &StateUpdate{} },
+	TypeGameStart:      func() Payload { return &GameStart{} },
+	TypeChatMessage:    func() Payload { return &ChatMessage{} },
+	TypeGameEnd:        func() Payload { return &GameEnd{} },
+	TypePing:           func() Payload { return &Ping{} },
+	TypeShutdown:       func() Payload { return &ServerShutdown{} },
+	TypeClockSync:      func() Payload { return &ClockSync{} },
+	TypeNotification:   func() Payload { return &Notification{} },
+	TypeLobbyInvite:    func() Payload { return &LobbyInvite{} },
+}
+
+// Types возвращает отсортированный список зарегистрированных типов.
+func (r Registry) Types() []string {
+	list := make([]string, 0, len(r))
+	for t := range r {
+		list = append(list, t)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Decode разбирает и проверяет сообщение. Ошибка всегда *Error, готовая к отправке собеседнику.
+func (r Registry) Decode(data []byte) (string, Payload, *Error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return "", nil, NewError(ErrBadJSON, "", err.Error())
+	}
+	newPayload, ok := r[env.Type]
+	if !ok {
+		return env.Type, nil, NewError(ErrUnknownType, env.Type, "неизвестный тип сообщения")
+	}
+
+	p := newPayload()
+	if _, empty := p.(Empty); !empty && len(env.Payload) > 0 && string(env.Payload) != "null" {
+		if err := json.Unmarshal(env.Payload, p); err != nil {
+			return env.Type, nil, NewError(ErrInvalidPayload, env.Type, err.Error())
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return env.Type, nil, NewError(ErrInvalidPayload, env.Type, err.Error())
+	}
+	return env.Type, p, nil
+}
+
+// Negotiate выбирает версию протокола для клиента, приславшего hello.
+func Negotiate(clientVersion int) (int, *Error) {
+	if clientVersion < MinVersion {
+		return 0, NewError(ErrUnsupportedVersion, TypeHello, "версия клиента устарела, обновите страницу")
+	}
+	return min(clientVersion, Version), nil
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import "unicode"
+
+const zeroWidthJoiner = '\u200d'
+
+// Graphemes разбивает текст заезда на символы в том виде, в каком их набирает пользователь:
+// комбинирующие знаки, селекторы вариантов и последовательности с ZWJ присоединяются к базовому символу.
+// Сервер и клиент считают прогресс по этому разбиению, поэтому индекс ввода совпадает с длиной текста.
+// Текст должен быть в NFC: сервер нормализует его перед отправкой.
+func Graphemes(s string) []string {
+	res := make([]string, 0, len(s))
+	join := false
+	for _, r := range s {
+		if len(res) > 0 && (join || extendsCluster(r)) {
+			res[len(res)-1] += string(r)
+		} else {
+			res = append(res, string(r))
+		}
+		join = r == zeroWidthJoiner
+	}
+	return res
+}
+
+func extendsCluster(r rune) bool {
+	return r == zeroWidthJoiner ||
+		unicode.In(r, unicode.Mn, unicode.Me) ||
+		unicode.Is(unicode.Variation_Selector, r)
+}
+
+// Matches проверяет, засчитывается ли ввод input для символа текста target
+// по таблице замен из GameStart.Equivalents.
+func Matches(equivalents map[string][]string, target, input string) bool {
+	if target == input {
+		return true
+	}
+	for _, alt := range equivalents[target] {
+		if alt == input {
+			return true
+		}
+	}
+	return false
+}